@@ -0,0 +1,57 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// givenStorer is implemented by storage that keeps given keys separately from keys that are replaced by refreshes.
+type givenStorer interface {
+	Given() jwkset.Storage
+}
+
+func (k keyfunc) Snapshot(ctx context.Context) ([]jwkset.JWK, error) {
+	all, err := k.storage.KeyReadAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read JWKs from storage", errors.Join(err, ErrKeyfunc))
+	}
+	return all, nil
+}
+func (k keyfunc) KeyByKID(ctx context.Context, kid string) (jwkset.JWK, error) {
+	jwk, err := k.keyRead(ctx, k.normalizeKID(kid))
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not read JWK from storage", errors.Join(err, ErrKeyfunc))
+	}
+	return jwk, nil
+}
+func (k keyfunc) AddGivenKey(ctx context.Context, jwk jwkset.JWK) error {
+	if jwk.Marshal().KID == "" {
+		return fmt.Errorf("%w: a given key must have a key ID", ErrKeyfunc)
+	}
+	store := k.storage
+	if g, ok := store.(givenStorer); ok {
+		store = g.Given()
+	}
+	err := store.KeyWrite(ctx, jwk)
+	if err != nil {
+		return fmt.Errorf("%w: could not write JWK to storage", errors.Join(err, ErrKeyfunc))
+	}
+	return nil
+}
+func (k keyfunc) RemoveKey(ctx context.Context, kid string) (bool, error) {
+	ok, err := k.storage.KeyDelete(ctx, kid)
+	if err != nil && !errors.Is(err, jwkset.ErrKeyNotFound) {
+		return false, fmt.Errorf("%w: could not delete JWK from storage", errors.Join(err, ErrKeyfunc))
+	}
+	return ok, nil
+}
+func (k keyfunc) Provenance(kid string) []KeyProvenance {
+	r, ok := k.storage.(provenanceReader)
+	if !ok {
+		return nil
+	}
+	return r.Provenance(kid)
+}
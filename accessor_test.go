@@ -0,0 +1,80 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyfuncAccessors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	all, err := k.(KeyManager).Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot. Error: %s", err)
+	}
+	if len(all) != 1 || all[0].Marshal().KID != keyID {
+		t.Fatalf("Expected the snapshot to hold the remote JWK, got %d JWKs.", len(all))
+	}
+	jwk, err := k.(KeyManager).KeyByKID(ctx, keyID)
+	if err != nil || jwk.Marshal().KID != keyID {
+		t.Fatalf("Failed to read JWK by key ID. Error: %v", err)
+	}
+
+	const givenKID = "given-key-id"
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	given, err := jwkset.NewJWKFromKey(pub, jwkset.JWKOptions{Metadata: jwkset.JWKMetadataOptions{KID: givenKID}})
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	err = k.(KeyManager).AddGivenKey(ctx, given)
+	if err != nil {
+		t.Fatalf("Failed to add given key. Error: %s", err)
+	}
+	for _, store := range k.Storage().(HTTPClient).HTTPStorages() {
+		err = store.(HTTPStorage).Refresh(ctx)
+		if err != nil {
+			t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+		}
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, givenKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected the given key to be kept across refreshes. Error: %s", err)
+	}
+
+	ok, err := k.(KeyManager).RemoveKey(ctx, givenKID)
+	if err != nil || !ok {
+		t.Fatalf("Expected the given key to be removed. Error: %v", err)
+	}
+	ok, err = k.(KeyManager).RemoveKey(ctx, givenKID)
+	if err != nil || ok {
+		t.Fatalf("Expected the given key to already be removed. Error: %v", err)
+	}
+	_, err = k.(KeyManager).KeyByKID(ctx, givenKID)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected error to be jwkset.ErrKeyNotFound. Error: %v", err)
+	}
+
+	err = k.(KeyManager).AddGivenKey(ctx, jwkset.JWK{})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for a JWK without a key ID. Error: %v", err)
+	}
+}
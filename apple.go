@@ -0,0 +1,60 @@
+package keyfunc
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// AppleIssuer is the issuer of Sign in with Apple identity tokens.
+	AppleIssuer = "https://appleid.apple.com"
+	// AppleKeysURL is the JWK Set of Sign in with Apple.
+	AppleKeysURL = "https://appleid.apple.com/auth/keys"
+)
+
+// AppleOptions configure NewApple.
+type AppleOptions struct {
+	// ClientIDs are the bundle IDs of apps and the services IDs of websites that use Sign in with Apple. If set, the
+	// "aud" claim of a JWT must contain one of them.
+	ClientIDs []string
+	// Ctx ends the refresh goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// KeysURL is the JWK Set of Sign in with Apple.
+	//
+	// This defaults to AppleKeysURL.
+	KeysURL string
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the JWK Set caused by JWTs with an unknown key
+	// ID. Apple rotates keys without notice and identity tokens are only valid for minutes, so JWTs signed with a new
+	// key must be verifiable right away.
+	//
+	// This defaults to 30 seconds.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the remote JWK Set.
+	URLOptions URLOptions
+}
+
+// NewApple creates a new Keyfunc for Sign in with Apple identity tokens. JWTs with an "iss" claim other than
+// AppleIssuer, or not for one of the ClientIDs if set, are rejected with jwt.ErrTokenInvalidIssuer or
+// jwt.ErrTokenInvalidAudience. The "exp" claim is checked by jwt.Parse as usual.
+func NewApple(options AppleOptions) (Keyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.KeysURL == "" {
+		options.KeysURL = AppleKeysURL
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = 30 * time.Second
+	}
+	k, err := newProviderKeyfunc(options.Ctx, options.KeysURL, options.URLOptions, options.UnknownKIDRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return claimsKeyfunc{
+		managedKeyfunc: k,
+		audiences:      options.ClientIDs,
+		issuers:        []string{AppleIssuer},
+	}, nil
+}
@@ -0,0 +1,65 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewApple(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	server := newJWKSServer(ctx, t, store)
+	defer server.Close()
+
+	options := AppleOptions{
+		ClientIDs: []string{"com.example.app"},
+		Ctx:       ctx,
+		KeysURL:   server.URL,
+	}
+	k, err := NewApple(options)
+	if err != nil {
+		t.Fatalf("Failed to create Apple keyfunc. Error: %s", err)
+	}
+	_, err = k.(KeyManager).KeyByKID(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key with the KeyManager of the Apple keyfunc. Error: %s", err)
+	}
+
+	rotated := writeEdDSAKey(ctx, t, store, "rotated")
+	tc := []struct {
+		name   string
+		kid    string
+		priv   any
+		claims jwt.MapClaims
+		err    error
+	}{
+		{name: "Valid", kid: keyID, priv: priv, claims: jwt.MapClaims{"iss": AppleIssuer, "aud": "com.example.app"}},
+		{name: "Rotated", kid: "rotated", priv: rotated, claims: jwt.MapClaims{"iss": AppleIssuer, "aud": "com.example.app"}},
+		{name: "WrongIssuer", kid: keyID, priv: priv, claims: jwt.MapClaims{"iss": "appleid.apple.com", "aud": "com.example.app"}, err: jwt.ErrTokenInvalidIssuer},
+		{name: "WrongAudience", kid: keyID, priv: priv, claims: jwt.MapClaims{"iss": AppleIssuer, "aud": "com.example.other"}, err: jwt.ErrTokenInvalidAudience},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, c.claims)
+			token.Header[jwkset.HeaderKID] = c.kid
+			signed, err := token.SignedString(c.priv)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			_, err = ParseCtx(ctx, k, signed)
+			if c.err == nil && err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected error to be %q. Error: %s", c.err, err)
+			}
+		})
+	}
+}
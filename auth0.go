@@ -0,0 +1,74 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Auth0Options configure NewAuth0WithOptions.
+type Auth0Options struct {
+	// Audience is the identifier of the Auth0 API the JWTs are for. If set, the "aud" claim of a JWT must contain it.
+	Audience string
+	// Ctx ends the refresh goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Domain is the Auth0 tenant domain or custom domain, such as "example.us.auth0.com". The "https" scheme is used if
+	// none is given.
+	Domain string
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the JWK Set caused by JWTs with an unknown key
+	// ID. The default follows the rate limit of 10 requests per minute recommended by Auth0, which protects the tenant
+	// from JWTs with fabricated key IDs.
+	//
+	// This defaults to 6 seconds.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the remote JWK Set.
+	//
+	// The RefreshInterval defaults to 10 minutes, the signing key cache duration recommended by Auth0.
+	URLOptions URLOptions
+}
+
+// NewAuth0 creates a new Keyfunc for the given Auth0 tenant domain with Auth0's recommended defaults.
+func NewAuth0(domain string) (Keyfunc, error) {
+	return NewAuth0WithOptions(Auth0Options{Domain: domain})
+}
+
+// NewAuth0WithOptions creates a new Keyfunc for an Auth0 tenant with the given options. JWTs with an "iss" claim other
+// than the tenant, or not for the Audience if set, are rejected with jwt.ErrTokenInvalidIssuer or
+// jwt.ErrTokenInvalidAudience.
+func NewAuth0WithOptions(options Auth0Options) (Keyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = 6 * time.Second
+	}
+	if options.URLOptions.RefreshInterval == 0 {
+		options.URLOptions.RefreshInterval = 10 * time.Minute
+	}
+	base := strings.TrimSuffix(options.Domain, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	u, err := url.ParseRequestURI(base)
+	if err != nil || u.Host == "" {
+		return nil, redactError(fmt.Errorf("%w: failed to parse Auth0 domain %q", errors.Join(err, ErrKeyfunc), redact(options.Domain)))
+	}
+	k, err := newProviderKeyfunc(options.Ctx, base+"/.well-known/jwks.json", options.URLOptions, options.UnknownKIDRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	var audiences []string
+	if options.Audience != "" {
+		audiences = []string{options.Audience}
+	}
+	return claimsKeyfunc{
+		managedKeyfunc: k,
+		audiences:      audiences,
+		issuers:        []string{base + "/"},
+	}, nil
+}
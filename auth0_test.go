@@ -0,0 +1,80 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewAuth0(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		raw, err := store.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON. Error: %s", err)
+		}
+		_, _ = w.Write(raw)
+	}))
+	defer server.Close()
+
+	options := Auth0Options{
+		Audience: "https://api.example.com",
+		Ctx:      ctx,
+		Domain:   server.URL,
+	}
+	a, err := NewAuth0WithOptions(options)
+	if err != nil {
+		t.Fatalf("Failed to create Auth0 keyfunc. Error: %s", err)
+	}
+	_, err = a.(KeyManager).KeyByKID(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key with the KeyManager of the Auth0 keyfunc. Error: %s", err)
+	}
+
+	tc := []struct {
+		name   string
+		claims jwt.MapClaims
+		err    error
+	}{
+		{name: "Valid", claims: jwt.MapClaims{"iss": server.URL + "/", "aud": "https://api.example.com"}},
+		{name: "WrongIssuer", claims: jwt.MapClaims{"iss": "https://other.auth0.com/", "aud": "https://api.example.com"}, err: jwt.ErrTokenInvalidIssuer},
+		{name: "WrongAudience", claims: jwt.MapClaims{"iss": server.URL + "/", "aud": "https://other.example.com"}, err: jwt.ErrTokenInvalidAudience},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, c.claims)
+			token.Header[jwkset.HeaderKID] = keyID
+			signed, err := token.SignedString(priv)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			_, err = ParseCtx(ctx, a, signed)
+			if c.err == nil && err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected error to be %q. Error: %s", c.err, err)
+			}
+		})
+	}
+}
+
+func TestNewAuth0InvalidDomain(t *testing.T) {
+	_, err := NewAuth0("")
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected error to be ErrKeyfunc. Error: %s", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package awskms resolves JWT key IDs to AWS KMS asymmetric signing keys, so JWTs signed by keys held in AWS KMS can be
+// verified through the same keyfunc.Keyfunc as keys from other sources.
+//
+// It is a separate module, so the AWS SDK is only a dependency of programs that use AWS KMS.
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+var (
+	// ErrKMS is returned when an AWS KMS key cannot be used to verify JWTs.
+	ErrKMS = errors.New("failed AWS KMS key resolution")
+)
+
+// Client is the subset of the AWS KMS API used by this package. *kms.Client implements it.
+type Client interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Verify(ctx context.Context, params *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error)
+}
+
+// Key is an AWS KMS asymmetric key with the SIGN_VERIFY key usage.
+type Key struct {
+	// ALG is the "alg" header value of the JWTs signed by the key. If empty, it is the JWT equivalent of the signing
+	// algorithms of the key when there is only one, such as ES256 for an ECC_NIST_P256 key. RSA keys support several
+	// signing algorithms, so it must be set for them.
+	ALG jwkset.ALG
+	// KeyID is the key ID, key ARN, alias name, or alias ARN of the KMS key.
+	KeyID string
+	// KID is the key ID of the JWT header that is resolved to the KMS key.
+	KID string
+}
+
+// Options configure NewStorage.
+type Options struct {
+	// Client is the AWS KMS client. It must not be nil.
+	Client Client
+	// Ctx is used for the requests to AWS KMS.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Keys are the KMS keys and the JWT key IDs they are resolved for.
+	Keys []Key
+	// Timeout bounds each request to AWS KMS.
+	//
+	// This defaults to 10 seconds.
+	Timeout time.Duration
+	// VerifyWithKMS verifies every signature with the Verify API of AWS KMS instead of fetching the public keys, for key
+	// policies that deny kms:GetPublicKey or auditing requirements that need every verification logged in AWS
+	// CloudTrail. Each verification is a request that counts against the KMS request quotas. The signing methods must be
+	// registered with keyfunc.RegisterVerifierSigningMethods.
+	VerifyWithKMS bool
+}
+
+// signingAlgorithm is the AWS KMS equivalent of a JWT signing algorithm.
+type signingAlgorithm struct {
+	hash crypto.Hash
+	// ecdsaSize is the size in bytes of each of the two integers of an ECDSA signature in a JWT, or zero for RSA.
+	ecdsaSize int
+	spec      types.SigningAlgorithmSpec
+}
+
+var signingAlgorithms = map[jwkset.ALG]signingAlgorithm{
+	jwkset.AlgES256: {hash: crypto.SHA256, ecdsaSize: 32, spec: types.SigningAlgorithmSpecEcdsaSha256},
+	jwkset.AlgES384: {hash: crypto.SHA384, ecdsaSize: 48, spec: types.SigningAlgorithmSpecEcdsaSha384},
+	jwkset.AlgES512: {hash: crypto.SHA512, ecdsaSize: 66, spec: types.SigningAlgorithmSpecEcdsaSha512},
+	jwkset.AlgPS256: {hash: crypto.SHA256, spec: types.SigningAlgorithmSpecRsassaPssSha256},
+	jwkset.AlgPS384: {hash: crypto.SHA384, spec: types.SigningAlgorithmSpecRsassaPssSha384},
+	jwkset.AlgPS512: {hash: crypto.SHA512, spec: types.SigningAlgorithmSpecRsassaPssSha512},
+	jwkset.AlgRS256: {hash: crypto.SHA256, spec: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256},
+	jwkset.AlgRS384: {hash: crypto.SHA384, spec: types.SigningAlgorithmSpecRsassaPkcs1V15Sha384},
+	jwkset.AlgRS512: {hash: crypto.SHA512, spec: types.SigningAlgorithmSpecRsassaPkcs1V15Sha512},
+}
+
+// NewStorage creates a jwkset.Storage for the KMS keys. Use it as the Storage option of a keyfunc.Keyfunc or as the
+// Given storage of a keyfunc.HTTPClient.
+//
+// By default, the public key of each KMS key is fetched once and cached, as the public key of a KMS key never changes,
+// and JWTs are verified locally. If the VerifyWithKMS option is set, no public keys are fetched.
+func NewStorage(options Options) (jwkset.Storage, error) {
+	if options.Client == nil {
+		return nil, fmt.Errorf("%w: no AWS KMS client given in options", ErrKMS)
+	}
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 10 * time.Second
+	}
+	for _, key := range options.Keys {
+		if _, ok := signingAlgorithms[key.ALG]; key.ALG != "" && !ok {
+			return nil, fmt.Errorf("%w: AWS KMS does not support the %q signing algorithm for key ID %q", ErrKMS, key.ALG, key.KID)
+		}
+	}
+	if options.VerifyWithKMS {
+		return newVerifierStorage(options)
+	}
+
+	store := jwkset.NewMemoryStorage()
+	for _, key := range options.Keys {
+		jwk, err := fetchPublicKey(options, key)
+		if err != nil {
+			return nil, err
+		}
+		err = store.KeyWrite(options.Ctx, jwk)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not write JWK to storage", errors.Join(err, ErrKMS))
+		}
+	}
+	return store, nil
+}
+
+// fetchPublicKey fetches the public key of the KMS key as a JWK.
+func fetchPublicKey(options Options, key Key) (jwkset.JWK, error) {
+	ctx, cancel := context.WithTimeout(options.Ctx, options.Timeout)
+	defer cancel()
+	keyID := key.KeyID
+	out, err := options.Client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &keyID})
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not get public key of KMS key %q", errors.Join(err, ErrKMS), key.KeyID)
+	}
+	if out.KeyUsage != types.KeyUsageTypeSignVerify {
+		return jwkset.JWK{}, fmt.Errorf("%w: KMS key %q has key usage %q, not %q", ErrKMS, key.KeyID, out.KeyUsage, types.KeyUsageTypeSignVerify)
+	}
+	alg := key.ALG
+	if alg == "" {
+		for a, s := range signingAlgorithms {
+			for _, spec := range out.SigningAlgorithms {
+				if spec == s.spec && s.ecdsaSize > 0 {
+					alg = a
+				}
+			}
+		}
+		if alg == "" {
+			return jwkset.JWK{}, fmt.Errorf("%w: an ALG is required for KMS key %q with signing algorithms %v", ErrKMS, key.KeyID, out.SigningAlgorithms)
+		}
+	}
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not parse public key of KMS key %q", errors.Join(err, ErrKMS), key.KeyID)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: alg,
+			KID: key.KID,
+			USE: jwkset.UseSig,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not create JWK for KMS key %q", errors.Join(err, ErrKMS), key.KeyID)
+	}
+	return jwk, nil
+}
+
+// newVerifierStorage creates a storage whose keys are verified with the Verify API of AWS KMS.
+func newVerifierStorage(options Options) (jwkset.Storage, error) {
+	keys := make([]keyfunc.VerifierKey, 0, len(options.Keys))
+	for _, key := range options.Keys {
+		keys = append(keys, keyfunc.VerifierKey{
+			ALG: key.ALG,
+			KID: key.KID,
+			USE: jwkset.UseSig,
+			Verifier: verifier{
+				client:  options.Client,
+				ctx:     options.Ctx,
+				keyID:   key.KeyID,
+				timeout: options.Timeout,
+			},
+		})
+	}
+	return keyfunc.NewVerifierStorage(keys...)
+}
+
+// verifier is a keyfunc.Verifier for a KMS key.
+type verifier struct {
+	client  Client
+	ctx     context.Context
+	keyID   string
+	timeout time.Duration
+}
+
+// Verify verifies the signature with the Verify API of AWS KMS. The digest of the signing input is sent, rather than the
+// signing input itself, as KMS limits messages to 4096 bytes.
+func (v verifier) Verify(alg string, signingInput, signature []byte) error {
+	s, ok := signingAlgorithms[jwkset.ALG(alg)]
+	if !ok {
+		return fmt.Errorf("%w: AWS KMS does not support the %q signing algorithm", ErrKMS, alg)
+	}
+	if s.ecdsaSize > 0 {
+		der, err := ecdsaDER(signature, s.ecdsaSize)
+		if err != nil {
+			return err
+		}
+		signature = der
+	}
+	h := s.hash.New()
+	h.Write(signingInput)
+	keyID := v.keyID
+	ctx, cancel := context.WithTimeout(v.ctx, v.timeout)
+	defer cancel()
+	out, err := v.client.Verify(ctx, &kms.VerifyInput{
+		KeyId:            &keyID,
+		Message:          h.Sum(nil),
+		MessageType:      types.MessageTypeDigest,
+		Signature:        signature,
+		SigningAlgorithm: s.spec,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: could not verify signature with KMS key %q", errors.Join(err, ErrKMS), v.keyID)
+	}
+	if !out.SignatureValid {
+		return fmt.Errorf("%w: KMS key %q reported an invalid signature", ErrKMS, v.keyID)
+	}
+	return nil
+}
+
+// ecdsaDER converts an ECDSA signature from the concatenated integers of a JWT to the ASN.1 DER encoding used by AWS
+// KMS.
+func ecdsaDER(signature []byte, size int) ([]byte, error) {
+	if len(signature) != 2*size {
+		return nil, fmt.Errorf("%w: ECDSA signature is %d bytes, not %d", ErrKMS, len(signature), 2*size)
+	}
+	der, err := asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not encode ECDSA signature", errors.Join(err, ErrKMS))
+	}
+	return der, nil
+}
@@ -0,0 +1,122 @@
+package awskms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+const (
+	keyID = "my-key-id"
+	kmsID = "alias/my-kms-key"
+)
+
+// fakeClient is a Client backed by an in-memory ECDSA key.
+type fakeClient struct {
+	getPublicKey int
+	priv         *ecdsa.PrivateKey
+	verify       int
+}
+
+func (c *fakeClient) GetPublicKey(_ context.Context, params *kms.GetPublicKeyInput, _ ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	c.getPublicKey++
+	if *params.KeyId != kmsID {
+		return nil, &types.NotFoundException{}
+	}
+	der, err := x509.MarshalPKIXPublicKey(c.priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GetPublicKeyOutput{
+		KeyId:             params.KeyId,
+		KeyUsage:          types.KeyUsageTypeSignVerify,
+		PublicKey:         der,
+		SigningAlgorithms: []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256},
+	}, nil
+}
+
+func (c *fakeClient) Verify(_ context.Context, params *kms.VerifyInput, _ ...func(*kms.Options)) (*kms.VerifyOutput, error) {
+	c.verify++
+	if params.MessageType != types.MessageTypeDigest || params.SigningAlgorithm != types.SigningAlgorithmSpecEcdsaSha256 {
+		return nil, errors.New("unexpected verify input")
+	}
+	if !ecdsa.VerifyASN1(&c.priv.PublicKey, params.Message, params.Signature) {
+		return nil, &types.KMSInvalidSignatureException{}
+	}
+	return &kms.VerifyOutput{KeyId: params.KeyId, SignatureValid: true}, nil
+}
+
+func TestNewStorage(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	keyfunc.RegisterVerifierSigningMethods(jwt.SigningMethodES256.Alg())
+
+	for _, verifyWithKMS := range []bool{false, true} {
+		client := &fakeClient{priv: priv}
+		store, err := NewStorage(Options{
+			Client:        client,
+			Keys:          []Key{{KeyID: kmsID, KID: keyID}},
+			VerifyWithKMS: verifyWithKMS,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create storage. Error: %s", err)
+		}
+		k, err := keyfunc.New(keyfunc.Options{Storage: store})
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err = jwt.Parse(signES256(t, priv, keyID), k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+		}
+		_, err = jwt.Parse(signES256(t, other, keyID), k.Keyfunc)
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Fatalf("Expected invalid signature. Error: %v", err)
+		}
+
+		if verifyWithKMS && (client.getPublicKey != 0 || client.verify != 3) {
+			t.Fatalf("Expected 0 GetPublicKey and 3 Verify requests, got %d and %d.", client.getPublicKey, client.verify)
+		}
+		if !verifyWithKMS && (client.getPublicKey != 1 || client.verify != 0) {
+			t.Fatalf("Expected 1 GetPublicKey and 0 Verify requests, got %d and %d.", client.getPublicKey, client.verify)
+		}
+	}
+
+	_, err = NewStorage(Options{Client: &fakeClient{priv: priv}, Keys: []Key{{KeyID: "missing", KID: keyID}}})
+	if !errors.Is(err, ErrKMS) {
+		t.Fatalf("Expected ErrKMS for a missing KMS key. Error: %v", err)
+	}
+	_, err = NewStorage(Options{Client: &fakeClient{priv: priv}, Keys: []Key{{ALG: "EdDSA", KeyID: kmsID, KID: keyID}}})
+	if !errors.Is(err, ErrKMS) {
+		t.Fatalf("Expected ErrKMS for an unsupported signing algorithm. Error: %v", err)
+	}
+}
+
+func signES256(t *testing.T, priv *ecdsa.PrivateKey, kid string) string {
+	token := jwt.New(jwt.SigningMethodES256)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	return signed
+}
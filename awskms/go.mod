@@ -0,0 +1,21 @@
+module github.com/MicahParks/keyfunc/v3/awskms
+
+go 1.21
+
+require (
+	github.com/MicahParks/jwkset v0.8.0
+	github.com/MicahParks/keyfunc/v3 v3.3.8
+	github.com/aws/aws-sdk-go-v2/service/kms v1.35.7
+	github.com/golang-jwt/jwt/v5 v5.2.1
+)
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.30.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.3.17 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.6.17 // indirect
+	github.com/aws/smithy-go v1.20.4 // indirect
+	golang.org/x/time v0.9.0 // indirect
+)
+
+// This module uses APIs of keyfunc that are newer than v3.3.8. Until they are tagged, build against the parent module.
+replace github.com/MicahParks/keyfunc/v3 => ../
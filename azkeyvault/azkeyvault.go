@@ -0,0 +1,243 @@
+// Package azkeyvault resolves JWT key IDs to Azure Key Vault key versions, so JWTs signed by keys held in Azure Key Vault
+// can be verified through the same keyfunc.Keyfunc as keys from other sources.
+//
+// It is a separate module, so the Azure SDK is only a dependency of programs that use Azure Key Vault.
+package azkeyvault
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/MicahParks/jwkset"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+var (
+	// ErrKeyVault is returned when an Azure Key Vault key cannot be used to verify JWTs.
+	ErrKeyVault = errors.New("failed Azure Key Vault key resolution")
+)
+
+// Client is the subset of the Azure Key Vault keys API used by this package. *azkeys.Client implements it.
+type Client interface {
+	GetKey(ctx context.Context, name string, version string, options *azkeys.GetKeyOptions) (azkeys.GetKeyResponse, error)
+	Verify(ctx context.Context, name string, version string, parameters azkeys.VerifyParameters, options *azkeys.VerifyOptions) (azkeys.VerifyResponse, error)
+}
+
+// Key is an Azure Key Vault key version with the verify key operation.
+type Key struct {
+	// ALG is the "alg" header value of the JWTs signed by the key. If empty, it is derived from the curve of an EC key,
+	// such as ES256 for a P-256 key. RSA keys support several signing algorithms, so it must be set for them unless
+	// VerifyWithKeyVault is set, in which case any "alg" header value is sent to Azure Key Vault.
+	ALG jwkset.ALG
+	// KID is the key ID of the JWT header that is resolved to the key version.
+	KID string
+	// Name is the name of the key in the vault of the Client.
+	Name string
+	// Version is the version of the key. If empty, the current version when NewStorage is called is used for the
+	// lifetime of the storage, so JWTs signed by a version created later are not verified.
+	Version string
+}
+
+// Options configure NewStorage.
+type Options struct {
+	// Client is the Azure Key Vault keys client. It must not be nil.
+	Client Client
+	// Ctx is used for the requests to Azure Key Vault.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Keys are the key versions and the JWT key IDs they are resolved for.
+	Keys []Key
+	// Timeout bounds each request to Azure Key Vault.
+	//
+	// This defaults to 10 seconds.
+	Timeout time.Duration
+	// VerifyWithKeyVault verifies every signature with the verify operation of Azure Key Vault instead of fetching the
+	// public keys, for access policies that only grant the verify key permission. Each verification is a request that
+	// counts against the Azure Key Vault service limits. The signing methods must be registered with
+	// keyfunc.RegisterVerifierSigningMethods.
+	VerifyWithKeyVault bool
+}
+
+// hashes are the digest algorithms of the JWT signing algorithms supported by Azure Key Vault.
+var hashes = map[jwkset.ALG]crypto.Hash{
+	jwkset.AlgES256: crypto.SHA256,
+	jwkset.AlgES384: crypto.SHA384,
+	jwkset.AlgES512: crypto.SHA512,
+	jwkset.AlgPS256: crypto.SHA256,
+	jwkset.AlgPS384: crypto.SHA384,
+	jwkset.AlgPS512: crypto.SHA512,
+	jwkset.AlgRS256: crypto.SHA256,
+	jwkset.AlgRS384: crypto.SHA384,
+	jwkset.AlgRS512: crypto.SHA512,
+}
+
+// curves are the elliptic curves of Azure Key Vault EC keys that have a JWT signing algorithm.
+var curves = map[azkeys.CurveName]struct {
+	alg   jwkset.ALG
+	curve elliptic.Curve
+}{
+	azkeys.CurveNameP256: {alg: jwkset.AlgES256, curve: elliptic.P256()},
+	azkeys.CurveNameP384: {alg: jwkset.AlgES384, curve: elliptic.P384()},
+	azkeys.CurveNameP521: {alg: jwkset.AlgES512, curve: elliptic.P521()},
+}
+
+// NewStorage creates a jwkset.Storage for the Azure Key Vault key versions. Use it as the Storage option of a
+// keyfunc.Keyfunc or as the Given storage of a keyfunc.HTTPClient.
+//
+// By default, the public key of each key version is fetched once and cached, as the public key of a key version never
+// changes, and JWTs are verified locally. If the VerifyWithKeyVault option is set, no public keys are fetched.
+func NewStorage(options Options) (jwkset.Storage, error) {
+	if options.Client == nil {
+		return nil, fmt.Errorf("%w: no Azure Key Vault client given in options", ErrKeyVault)
+	}
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 10 * time.Second
+	}
+	for _, key := range options.Keys {
+		if _, ok := hashes[key.ALG]; key.ALG != "" && !ok {
+			return nil, fmt.Errorf("%w: Azure Key Vault does not support the %q signing algorithm for key ID %q", ErrKeyVault, key.ALG, key.KID)
+		}
+	}
+	if options.VerifyWithKeyVault {
+		return newVerifierStorage(options)
+	}
+
+	store := jwkset.NewMemoryStorage()
+	for _, key := range options.Keys {
+		jwk, err := fetchPublicKey(options, key)
+		if err != nil {
+			return nil, err
+		}
+		err = store.KeyWrite(options.Ctx, jwk)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not write JWK to storage", errors.Join(err, ErrKeyVault))
+		}
+	}
+	return store, nil
+}
+
+// fetchPublicKey fetches the public portion of the key version as a JWK.
+func fetchPublicKey(options Options, key Key) (jwkset.JWK, error) {
+	ctx, cancel := context.WithTimeout(options.Ctx, options.Timeout)
+	defer cancel()
+	resp, err := options.Client.GetKey(ctx, key.Name, key.Version, nil)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not get key %q", errors.Join(err, ErrKeyVault), key.Name)
+	}
+	if resp.Attributes != nil && resp.Attributes.Enabled != nil && !*resp.Attributes.Enabled {
+		return jwkset.JWK{}, fmt.Errorf("%w: key %q is disabled", ErrKeyVault, key.Name)
+	}
+	if resp.Key == nil || resp.Key.Kty == nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: no key material for key %q", ErrKeyVault, key.Name)
+	}
+	var pub crypto.PublicKey
+	alg := key.ALG
+	switch *resp.Key.Kty {
+	case azkeys.KeyTypeEC, azkeys.KeyTypeECHSM:
+		if resp.Key.Crv == nil {
+			return jwkset.JWK{}, fmt.Errorf("%w: no curve for EC key %q", ErrKeyVault, key.Name)
+		}
+		c, ok := curves[*resp.Key.Crv]
+		if !ok {
+			return jwkset.JWK{}, fmt.Errorf("%w: key %q has curve %s without a JWT signing algorithm", ErrKeyVault, key.Name, *resp.Key.Crv)
+		}
+		if alg == "" {
+			alg = c.alg
+		}
+		pub = &ecdsa.PublicKey{
+			Curve: c.curve,
+			X:     new(big.Int).SetBytes(resp.Key.X),
+			Y:     new(big.Int).SetBytes(resp.Key.Y),
+		}
+	case azkeys.KeyTypeRSA, azkeys.KeyTypeRSAHSM:
+		if alg == "" {
+			return jwkset.JWK{}, fmt.Errorf("%w: an ALG is required for RSA key %q", ErrKeyVault, key.Name)
+		}
+		pub = &rsa.PublicKey{
+			E: int(new(big.Int).SetBytes(resp.Key.E).Int64()),
+			N: new(big.Int).SetBytes(resp.Key.N),
+		}
+	default:
+		return jwkset.JWK{}, fmt.Errorf("%w: key %q has key type %s, which cannot verify signatures", ErrKeyVault, key.Name, *resp.Key.Kty)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: alg,
+			KID: key.KID,
+			USE: jwkset.UseSig,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not create JWK for key %q", errors.Join(err, ErrKeyVault), key.Name)
+	}
+	return jwk, nil
+}
+
+// newVerifierStorage creates a storage whose keys are verified with the verify operation of Azure Key Vault.
+func newVerifierStorage(options Options) (jwkset.Storage, error) {
+	keys := make([]keyfunc.VerifierKey, 0, len(options.Keys))
+	for _, key := range options.Keys {
+		keys = append(keys, keyfunc.VerifierKey{
+			ALG: key.ALG,
+			KID: key.KID,
+			USE: jwkset.UseSig,
+			Verifier: verifier{
+				client:  options.Client,
+				ctx:     options.Ctx,
+				name:    key.Name,
+				timeout: options.Timeout,
+				version: key.Version,
+			},
+		})
+	}
+	return keyfunc.NewVerifierStorage(keys...)
+}
+
+// verifier is a keyfunc.Verifier for an Azure Key Vault key version.
+type verifier struct {
+	client  Client
+	ctx     context.Context
+	name    string
+	timeout time.Duration
+	version string
+}
+
+// Verify verifies the signature with the verify operation of Azure Key Vault. Azure Key Vault uses the signature
+// encoding of JWS, so the signature is sent unchanged with the digest of the signing input.
+func (v verifier) Verify(alg string, signingInput, signature []byte) error {
+	hash, ok := hashes[jwkset.ALG(alg)]
+	if !ok {
+		return fmt.Errorf("%w: Azure Key Vault does not support the %q signing algorithm", ErrKeyVault, alg)
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	algorithm := azkeys.SignatureAlgorithm(alg)
+	ctx, cancel := context.WithTimeout(v.ctx, v.timeout)
+	defer cancel()
+	resp, err := v.client.Verify(ctx, v.name, v.version, azkeys.VerifyParameters{
+		Algorithm: &algorithm,
+		Digest:    h.Sum(nil),
+		Signature: signature,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("%w: could not verify signature with key %q", errors.Join(err, ErrKeyVault), v.name)
+	}
+	if resp.Value == nil || !*resp.Value {
+		return fmt.Errorf("%w: key %q reported an invalid signature", ErrKeyVault, v.name)
+	}
+	return nil
+}
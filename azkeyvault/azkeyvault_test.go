@@ -0,0 +1,122 @@
+package azkeyvault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+const (
+	keyID   = "my-key-id"
+	keyName = "my-vault-key"
+)
+
+// fakeClient is a Client backed by an in-memory ECDSA key.
+type fakeClient struct {
+	getKey int
+	priv   *ecdsa.PrivateKey
+	verify int
+}
+
+func (c *fakeClient) GetKey(_ context.Context, name string, _ string, _ *azkeys.GetKeyOptions) (azkeys.GetKeyResponse, error) {
+	c.getKey++
+	if name != keyName {
+		return azkeys.GetKeyResponse{}, errors.New("key not found")
+	}
+	kty, crv := azkeys.KeyTypeECHSM, azkeys.CurveNameP256
+	return azkeys.GetKeyResponse{
+		KeyBundle: azkeys.KeyBundle{
+			Key: &azkeys.JSONWebKey{
+				Crv: &crv,
+				Kty: &kty,
+				X:   c.priv.X.FillBytes(make([]byte, 32)),
+				Y:   c.priv.Y.FillBytes(make([]byte, 32)),
+			},
+		},
+	}, nil
+}
+
+func (c *fakeClient) Verify(_ context.Context, _ string, _ string, parameters azkeys.VerifyParameters, _ *azkeys.VerifyOptions) (azkeys.VerifyResponse, error) {
+	c.verify++
+	if *parameters.Algorithm != azkeys.SignatureAlgorithmES256 || len(parameters.Signature) != 64 {
+		return azkeys.VerifyResponse{}, errors.New("unexpected verify parameters")
+	}
+	r := new(big.Int).SetBytes(parameters.Signature[:32])
+	s := new(big.Int).SetBytes(parameters.Signature[32:])
+	valid := ecdsa.Verify(&c.priv.PublicKey, parameters.Digest, r, s)
+	return azkeys.VerifyResponse{KeyVerifyResult: azkeys.KeyVerifyResult{Value: &valid}}, nil
+}
+
+func TestNewStorage(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	keyfunc.RegisterVerifierSigningMethods(jwt.SigningMethodES256.Alg())
+
+	for _, verifyWithKeyVault := range []bool{false, true} {
+		client := &fakeClient{priv: priv}
+		store, err := NewStorage(Options{
+			Client:             client,
+			Keys:               []Key{{KID: keyID, Name: keyName}},
+			VerifyWithKeyVault: verifyWithKeyVault,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create storage. Error: %s", err)
+		}
+		k, err := keyfunc.New(keyfunc.Options{Storage: store})
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err = jwt.Parse(signES256(t, priv, keyID), k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+		}
+		_, err = jwt.Parse(signES256(t, other, keyID), k.Keyfunc)
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Fatalf("Expected invalid signature. Error: %v", err)
+		}
+
+		if verifyWithKeyVault && (client.getKey != 0 || client.verify != 3) {
+			t.Fatalf("Expected 0 GetKey and 3 Verify requests, got %d and %d.", client.getKey, client.verify)
+		}
+		if !verifyWithKeyVault && (client.getKey != 1 || client.verify != 0) {
+			t.Fatalf("Expected 1 GetKey and 0 Verify requests, got %d and %d.", client.getKey, client.verify)
+		}
+	}
+
+	_, err = NewStorage(Options{Client: &fakeClient{priv: priv}, Keys: []Key{{KID: keyID, Name: "missing"}}})
+	if !errors.Is(err, ErrKeyVault) {
+		t.Fatalf("Expected ErrKeyVault for a missing key. Error: %v", err)
+	}
+	_, err = NewStorage(Options{Client: &fakeClient{priv: priv}, Keys: []Key{{ALG: "EdDSA", KID: keyID, Name: keyName}}})
+	if !errors.Is(err, ErrKeyVault) {
+		t.Fatalf("Expected ErrKeyVault for an unsupported signing algorithm. Error: %v", err)
+	}
+}
+
+func signES256(t *testing.T, priv *ecdsa.PrivateKey, kid string) string {
+	token := jwt.New(jwt.SigningMethodES256)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	return signed
+}
@@ -0,0 +1,22 @@
+module github.com/MicahParks/keyfunc/v3/azkeyvault
+
+go 1.21
+
+require (
+	github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys v1.1.0
+	github.com/MicahParks/jwkset v0.8.0
+	github.com/MicahParks/keyfunc/v3 v3.3.8
+	github.com/golang-jwt/jwt/v5 v5.2.1
+)
+
+require (
+	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.9.1 // indirect
+	github.com/Azure/azure-sdk-for-go/sdk/internal v1.5.1 // indirect
+	github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/internal v1.0.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/time v0.9.0 // indirect
+)
+
+// This module uses APIs of keyfunc that are newer than v3.3.8. Until they are tagged, build against the parent module.
+replace github.com/MicahParks/keyfunc/v3 => ../
@@ -0,0 +1,195 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrB2CPolicy is returned when a JWT is not for a policy managed by a B2C.
+	ErrB2CPolicy = errors.New("JWT is not for a known Azure AD B2C policy")
+)
+
+// B2COptions configure a B2C.
+type B2COptions struct {
+	// BaseURL is the URL the JWK Set path "/discovery/v2.0/keys" is added to for each policy. Set it for custom domains
+	// or to identify the tenant by its ID.
+	//
+	// This defaults to "https://{Tenant}.b2clogin.com/{Tenant}.onmicrosoft.com".
+	BaseURL string
+	// Ctx ends the refresh goroutines of every policy when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Policies are the user flows and custom policies whose JWTs are accepted, such as "B2C_1_signupsignin". Policy
+	// names are case-insensitive.
+	Policies []string
+	// Tenant is the name of the Azure AD B2C tenant, such as "contoso". It is required if BaseURL is empty.
+	Tenant string
+	// URLOptions configure the remote JWK Set of each policy.
+	URLOptions URLOptions
+}
+
+// B2C routes JWTs from an Azure AD B2C tenant to the JWK Set of their policy. B2C exposes a distinct JWK Set for each
+// user flow or custom policy. The policy of a JWT is read from its "tfp" claim, or its "acr" claim if "tfp" is absent.
+// The remote JWK Set of a policy is fetched when the first JWT for it is seen and is cached after that.
+type B2C interface {
+	// AddPolicy starts accepting JWTs for the policy.
+	AddPolicy(policy string)
+	// Keyfunc routes the JWT to the JWK Set of its policy with the context given at creation.
+	Keyfunc(token *jwt.Token) (any, error)
+	// KeyfuncCtx returns a jwt.Keyfunc that routes the JWT to the JWK Set of its policy with the given context.
+	KeyfuncCtx(ctx context.Context) jwt.Keyfunc
+	// Policies returns the policies whose JWTs are accepted, in lowercase.
+	Policies() []string
+	// RemovePolicy stops accepting JWTs for the policy and ends the refresh goroutine of its JWK Set.
+	RemovePolicy(policy string)
+}
+
+type b2c struct {
+	baseURL  string
+	cache    *keyfuncCache
+	ctx      context.Context
+	mux      sync.RWMutex
+	options  URLOptions
+	policies map[string]struct{}
+}
+
+// NewB2C creates a new B2C for the policies of an Azure AD B2C tenant.
+func NewB2C(options B2COptions) (B2C, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.BaseURL == "" {
+		if options.Tenant == "" {
+			return nil, fmt.Errorf("%w: either a tenant or a base URL is required for Azure AD B2C", ErrKeyfunc)
+		}
+		options.BaseURL = fmt.Sprintf("https://%s.b2clogin.com/%s.onmicrosoft.com", options.Tenant, options.Tenant)
+	}
+	_, err := url.ParseRequestURI(options.BaseURL)
+	if err != nil {
+		return nil, redactError(fmt.Errorf("%w: failed to parse Azure AD B2C base URL %q", errors.Join(err, ErrKeyfunc), redact(options.BaseURL)))
+	}
+	b := &b2c{
+		baseURL:  strings.TrimSuffix(options.BaseURL, "/"),
+		cache:    newKeyfuncCache(options.Ctx, 0, nil),
+		ctx:      options.Ctx,
+		options:  options.URLOptions,
+		policies: make(map[string]struct{}, len(options.Policies)),
+	}
+	for _, policy := range options.Policies {
+		b.AddPolicy(policy)
+	}
+	return b, nil
+}
+
+func (b *b2c) AddPolicy(policy string) {
+	policy = strings.ToLower(policy)
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.policies[policy] = struct{}{}
+}
+func (b *b2c) Keyfunc(token *jwt.Token) (any, error) {
+	return b.KeyfuncCtx(b.ctx)(token)
+}
+func (b *b2c) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		policy, err := b2cTokenPolicy(token)
+		if err != nil {
+			return nil, err
+		}
+		k, err := b.keyfunc(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		return k.KeyfuncCtx(ctx)(token)
+	}
+}
+func (b *b2c) Policies() []string {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	policies := make([]string, 0, len(b.policies))
+	for policy := range b.policies {
+		policies = append(policies, policy)
+	}
+	slices.Sort(policies)
+	return policies
+}
+func (b *b2c) RemovePolicy(policy string) {
+	policy = strings.ToLower(policy)
+	b.mux.Lock()
+	delete(b.policies, policy)
+	b.mux.Unlock()
+	b.cache.delete(policy)
+}
+
+// keyfunc returns the Keyfunc for the JWK Set of the policy, creating it on first use. A failure to create it is
+// cached with a backoff, and the wait for its creation ends with ctx.
+func (b *b2c) keyfunc(ctx context.Context, policy string) (Keyfunc, error) {
+	policy = strings.ToLower(policy)
+	if !b.hasPolicy(policy) {
+		return nil, fmt.Errorf("%w: %q", ErrB2CPolicy, policy)
+	}
+	k, err := b.cache.get(ctx, policy, func(ctx context.Context) (Keyfunc, error) {
+		jwksURL := b.baseURL + "/discovery/v2.0/keys?p=" + url.QueryEscape(policy)
+		return NewDefaultURLOptionsCtx(ctx, map[string]URLOptions{jwksURL: b.options})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create keyfunc for Azure AD B2C policy %q", err, policy)
+	}
+	if !b.hasPolicy(policy) {
+		// The policy was removed while its Keyfunc was created.
+		b.cache.delete(policy)
+		return nil, fmt.Errorf("%w: %q", ErrB2CPolicy, policy)
+	}
+	return k, nil
+}
+
+// hasPolicy reports if JWTs for the lowercase policy are accepted.
+func (b *b2c) hasPolicy(policy string) bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	_, ok := b.policies[policy]
+	return ok
+}
+
+// b2cTokenPolicy reads the policy from the "tfp" or "acr" claim of the JWT.
+func b2cTokenPolicy(token *jwt.Token) (string, error) {
+	var claims struct {
+		ACR string `json:"acr"`
+		TFP string `json:"tfp"`
+	}
+	if mapClaims, ok := token.Claims.(jwt.MapClaims); ok {
+		claims.ACR, _ = mapClaims["acr"].(string)
+		claims.TFP, _ = mapClaims["tfp"].(string)
+	} else {
+		parts := strings.Split(token.Raw, ".")
+		if len(parts) != 3 {
+			return "", fmt.Errorf("%w: could not read raw JWT claims", ErrB2CPolicy)
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", fmt.Errorf("%w: could not decode JWT claims", errors.Join(err, ErrB2CPolicy))
+		}
+		err = json.Unmarshal(payload, &claims)
+		if err != nil {
+			return "", fmt.Errorf("%w: could not unmarshal JWT claims", errors.Join(err, ErrB2CPolicy))
+		}
+	}
+	if claims.TFP != "" {
+		return claims.TFP, nil
+	}
+	if claims.ACR != "" {
+		return claims.ACR, nil
+	}
+	return "", fmt.Errorf(`%w: JWT has no "tfp" or "acr" claim`, ErrB2CPolicy)
+}
@@ -0,0 +1,177 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestB2C(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signUp := jwkset.NewMemoryStorage()
+	signUpPriv := writeEdDSAKey(ctx, t, signUp, keyID)
+	reset := jwkset.NewMemoryStorage()
+	resetPriv := writeEdDSAKey(ctx, t, reset, keyID)
+	stores := map[string]jwkset.Storage{
+		"b2c_1_signup": signUp,
+		"b2c_1_reset":  reset,
+	}
+	requested := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/contoso.onmicrosoft.com/discovery/v2.0/keys" {
+			t.Errorf("Unexpected path %q.", r.URL.Path)
+		}
+		policy := r.URL.Query().Get("p")
+		requested[policy]++
+		store, ok := stores[policy]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		raw, err := store.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON. Error: %s", err)
+		}
+		_, _ = w.Write(raw)
+	}))
+	defer server.Close()
+
+	options := B2COptions{
+		BaseURL:  server.URL + "/contoso.onmicrosoft.com/",
+		Ctx:      ctx,
+		Policies: []string{"B2C_1_signup", "B2C_1_reset"},
+	}
+	b, err := NewB2C(options)
+	if err != nil {
+		t.Fatalf("Failed to create B2C. Error: %s", err)
+	}
+	if !reflect.DeepEqual(b.Policies(), []string{"b2c_1_reset", "b2c_1_signup"}) {
+		t.Fatalf("Unexpected policies %v.", b.Policies())
+	}
+	if len(requested) != 0 {
+		t.Fatalf("Expected no JWK Set to be requested before a JWT for its policy.")
+	}
+
+	tc := []struct {
+		name   string
+		claims jwt.Claims
+		priv   ed25519.PrivateKey
+		err    error
+	}{
+		{name: "tfp", claims: jwt.MapClaims{"tfp": "B2C_1_signup"}, priv: signUpPriv},
+		{name: "acr", claims: jwt.MapClaims{"acr": "b2c_1_reset"}, priv: resetPriv},
+		{name: "custom claims", claims: b2cClaims{TFP: "B2C_1_reset"}, priv: resetPriv},
+		{name: "wrong policy", claims: jwt.MapClaims{"tfp": "B2C_1_signup"}, priv: resetPriv, err: jwt.ErrTokenSignatureInvalid},
+		{name: "unknown policy", claims: jwt.MapClaims{"tfp": "B2C_1_other"}, priv: signUpPriv, err: ErrB2CPolicy},
+		{name: "no policy", claims: jwt.MapClaims{}, priv: signUpPriv, err: ErrB2CPolicy},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, c.claims)
+			token.Header[jwkset.HeaderKID] = keyID
+			signed, err := token.SignedString(c.priv)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			var claims jwt.Claims = jwt.MapClaims{}
+			if _, ok := c.claims.(b2cClaims); ok {
+				claims = &b2cClaims{}
+			}
+			_, err = jwt.ParseWithClaims(signed, claims, b.Keyfunc)
+			if c.err == nil && err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected error to be %q. Error: %s", c.err, err)
+			}
+		})
+	}
+	if requested["b2c_1_signup"] != 1 || requested["b2c_1_reset"] != 1 {
+		t.Fatalf("Expected each JWK Set to be requested once, got %v.", requested)
+	}
+
+	b.RemovePolicy("B2C_1_SIGNUP")
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"tfp": "B2C_1_signup"})
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(signUpPriv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, b.Keyfunc)
+	if !errors.Is(err, ErrB2CPolicy) {
+		t.Fatalf("Expected error to be ErrB2CPolicy after removing the policy. Error: %s", err)
+	}
+}
+
+func TestB2CSlowPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	b, err := NewB2C(B2COptions{
+		BaseURL:  server.URL + "/contoso.onmicrosoft.com",
+		Ctx:      ctx,
+		Policies: []string{"B2C_1_signup"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create B2C. Error: %s", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"tfp": "B2C_1_signup"})
+	token.Header[jwkset.HeaderKID] = keyID
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		requestCtx, requestCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		start := time.Now()
+		_, err = jwt.Parse(signed, b.KeyfuncCtx(requestCtx))
+		requestCancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected the lookup to end with its context. Error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Expected the lookup to not wait for the JWK Set of the policy, took %s.", elapsed)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("Expected lookups to share the fetch of the JWK Set of the policy, got %d requests.", n)
+	}
+}
+
+func TestNewB2CTenantRequired(t *testing.T) {
+	_, err := NewB2C(B2COptions{})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected error to be ErrKeyfunc. Error: %s", err)
+	}
+}
+
+type b2cClaims struct {
+	jwt.RegisteredClaims
+	TFP string `json:"tfp"`
+}
@@ -0,0 +1,44 @@
+package keyfunc
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minScheduledRefresh is the shortest wait for a refresh scheduled by the Cache-Control header, which protects remote
+// resources that send a small max-age.
+const minScheduledRefresh = time.Minute
+
+// maxDurationSeconds keeps a large number of seconds, such as a max-age, from overflowing a time.Duration.
+const maxDurationSeconds = int64(math.MaxInt64 / time.Second)
+
+// cacheControlMaxAge returns how long the response may be cached according to its Cache-Control and Age headers. It
+// returns false if the response must not be cached or has no max-age.
+func cacheControlMaxAge(header http.Header) (time.Duration, bool) {
+	var maxAge time.Duration
+	found := false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0, false
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil || seconds < 0 {
+				return 0, false
+			}
+			maxAge = time.Duration(min(seconds, maxDurationSeconds)) * time.Second
+			found = true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+		maxAge -= time.Duration(age) * time.Second
+	}
+	return max(maxAge, 0), true
+}
@@ -0,0 +1,39 @@
+package keyfunc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheControlMaxAge(t *testing.T) {
+	tc := []struct {
+		name         string
+		cacheControl string
+		age          string
+		maxAge       time.Duration
+		ok           bool
+	}{
+		{name: "MaxAge", cacheControl: "public, max-age=3600", maxAge: time.Hour, ok: true},
+		{name: "Age", cacheControl: "max-age=3600", age: "1800", maxAge: 30 * time.Minute, ok: true},
+		{name: "Stale", cacheControl: "max-age=60", age: "120", maxAge: 0, ok: true},
+		{name: "Quoted", cacheControl: `Max-Age="60"`, maxAge: time.Minute, ok: true},
+		{name: "NoStore", cacheControl: "no-store, max-age=3600"},
+		{name: "NoCache", cacheControl: "max-age=3600, no-cache"},
+		{name: "Missing", cacheControl: "public"},
+		{name: "Invalid", cacheControl: "max-age=soon"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Cache-Control", c.cacheControl)
+			if c.age != "" {
+				header.Set("Age", c.age)
+			}
+			maxAge, ok := cacheControlMaxAge(header)
+			if maxAge != c.maxAge || ok != c.ok {
+				t.Fatalf("Expected %s, %t, got %s, %t.", c.maxAge, c.ok, maxAge, ok)
+			}
+		})
+	}
+}
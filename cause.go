@@ -0,0 +1,49 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrShutdown is wrapped by the errors of refreshes and lookups that are aborted because the context given at
+	// creation, such as the Ctx option, was cancelled. The errors also wrap the cause of the cancellation given by
+	// context.Cause. These errors are expected during shutdown and can be filtered from real failures.
+	ErrShutdown = errors.New("aborted by shutdown")
+	// ErrTimeout is wrapped by the errors of refreshes and lookups that are aborted because a deadline was exceeded, such
+	// as the HTTPTimeout or LookupTimeout options or the deadline of the context given to a lookup.
+	ErrTimeout = errors.New("deadline exceeded")
+	// ErrRemoteFailure is wrapped by the errors of refreshes that failed for any other reason, such as a network error,
+	// an unexpected HTTP status code, or a JWK Set that could not be parsed.
+	ErrRemoteFailure = errors.New("remote JWK Set failure")
+)
+
+// abortCause classifies the error of an operation that may have been aborted by a context. The shutdown context is the
+// one given at creation and ctx is the one of the operation. The returned error wraps ErrShutdown or ErrTimeout and the
+// context.Cause of the context that ended, or only the cause if ctx was cancelled by the caller. It is nil if no context
+// aborted the operation.
+func abortCause(shutdown, ctx context.Context, err error) error {
+	switch {
+	case shutdown.Err() != nil:
+		return fmt.Errorf("%w: %w", errors.Join(ErrShutdown, context.Cause(shutdown)), err)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", errors.Join(ErrTimeout, context.Cause(ctx)), err)
+	case ctx.Err() != nil:
+		return fmt.Errorf("%w: %w", context.Cause(ctx), err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return nil
+}
+
+// refreshCause classifies the error of a refresh of a remote JWK Set as a shutdown, a timeout, or a remote failure.
+func refreshCause(shutdown, ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if cause := abortCause(shutdown, ctx, err); cause != nil {
+		return cause
+	}
+	return fmt.Errorf("%w: %w", ErrRemoteFailure, err)
+}
@@ -0,0 +1,107 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestContextCause(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	errStopping := errors.New("server is stopping")
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	var mode atomic.Value
+	mode.Store("")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch mode.Load() {
+		case "fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "hang":
+			<-r.Context().Done()
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:                 ctx,
+		RefreshErrorHandler: func(ctx context.Context, err error) {},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+
+	mode.Store("fail")
+	err = store.Refresh(context.Background())
+	if !errors.Is(err, ErrRemoteFailure) || errors.Is(err, ErrShutdown) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected a remote failure, got %v.", err)
+	}
+
+	mode.Store("hang")
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer timeoutCancel()
+	err = store.Refresh(timeoutCtx)
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRemoteFailure) {
+		t.Fatalf("Expected a timeout, got %v.", err)
+	}
+
+	k, err := New(Options{
+		Ctx:     ctx,
+		Storage: store,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+
+	cancel(errStopping)
+	err = store.Refresh(ctx)
+	if !errors.Is(err, ErrShutdown) || !errors.Is(err, errStopping) || errors.Is(err, ErrRemoteFailure) {
+		t.Fatalf("Expected a shutdown with its cause, got %v.", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, "unknown"), k.Keyfunc)
+	if !errors.Is(err, ErrShutdown) || !errors.Is(err, errStopping) {
+		t.Fatalf("Expected a lookup aborted by shutdown, got %v.", err)
+	}
+}
+
+func TestContextCauseDefault(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	errStopping := errors.New("server is stopping")
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(context.Background(), t, serverStore)
+	defer server.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	cancel(errStopping)
+	priv := writeEdDSAKey(context.Background(), t, serverStore, "unknown")
+	_, err = jwt.Parse(signEdDSA(t, priv, "unknown"), k.Keyfunc)
+	if !errors.Is(err, ErrShutdown) || !errors.Is(err, errStopping) {
+		t.Fatalf("Expected a lookup aborted by shutdown, got %v.", err)
+	}
+}
@@ -0,0 +1,56 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claimsKeyfunc is a Keyfunc for an identity provider that rejects JWTs with an unexpected "iss" or "aud" claim before
+// reading keys. The claims are not trusted until the signature is verified, but a JWT with a forged claim fails that
+// verification anyway.
+type claimsKeyfunc struct {
+	managedKeyfunc
+	audiences []string
+	issuers   []string
+}
+
+func (c claimsKeyfunc) Keyfunc(token *jwt.Token) (any, error) {
+	err := c.check(token)
+	if err != nil {
+		return nil, err
+	}
+	return c.managedKeyfunc.Keyfunc(token)
+}
+func (c claimsKeyfunc) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	keyfunc := c.managedKeyfunc.KeyfuncCtx(ctx)
+	return func(token *jwt.Token) (any, error) {
+		err := c.check(token)
+		if err != nil {
+			return nil, err
+		}
+		return keyfunc(token)
+	}
+}
+
+// check confirms the "iss" claim is one of the issuers and, if any audiences are set, the "aud" claim contains one.
+func (c claimsKeyfunc) check(token *jwt.Token) error {
+	if token.Claims == nil {
+		return fmt.Errorf("%w: JWT has no claims", ErrKeyfunc)
+	}
+	iss, err := token.Claims.GetIssuer()
+	if err != nil || !slices.Contains(c.issuers, iss) {
+		return fmt.Errorf(`%w: "iss" claim %q is not an expected issuer`, errors.Join(err, jwt.ErrTokenInvalidIssuer, ErrKeyfunc), iss)
+	}
+	if len(c.audiences) == 0 {
+		return nil
+	}
+	aud, err := token.Claims.GetAudience()
+	if err != nil || !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(c.audiences, a) }) {
+		return fmt.Errorf(`%w: "aud" claim %q does not contain an expected audience`, errors.Join(err, jwt.ErrTokenInvalidAudience, ErrKeyfunc), aud)
+	}
+	return nil
+}
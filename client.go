@@ -0,0 +1,833 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrHTTPClient is returned when a keyfunc HTTP client fails.
+	ErrHTTPClient = errors.New("failed HTTP JWK Set client")
+)
+
+// HTTPClientOptions are options for creating a new HTTPClient. They mirror jwkset.HTTPClientOptions.
+type HTTPClientOptions struct {
+	// Given contains keys known from outside HTTP URLs.
+	Given jwkset.Storage
+	// HTTPURLs are a mapping of HTTP URLs to JWK Set endpoints to storage implementations for the keys located at the
+	// URL. If a storage is nil, one is created with NewHTTPStorage. If empty, HTTP will not be used.
+	HTTPURLs map[string]jwkset.Storage
+	// Issuers are a mapping of HTTP URLs to the "iss" claim of the JWTs signed by the keys located at the URL. They are
+	// used by TargetedRefresh.
+	Issuers map[string]string
+	// PrioritizeHTTP is a flag that indicates whether keys from the HTTP URL should be prioritized over keys from the
+	// given storage.
+	PrioritizeHTTP bool
+	// RateLimitWaitMax is the timeout for waiting for rate limiting to end.
+	RateLimitWaitMax time.Duration
+	// RefreshUnknownKID is non-nil to indicate that remote HTTP resources should be refreshed if a key with an unknown
+	// key ID is trying to be read. This makes reading methods block until the context is over, a key with the matching
+	// key ID is found in a refreshed remote resource, or all refreshes complete. The remote resources are refreshed
+	// concurrently, and the remaining refreshes are cancelled once one has the key ID.
+	//
+	// Only storage with a Refresh method, such as HTTPStorage, is refreshed.
+	RefreshUnknownKID *rate.Limiter
+	// RefreshQueueDepth is the maximum number of reads of unknown key IDs that wait for the RefreshUnknownKID rate
+	// limiter or a refresh at once. Further reads are handled by RefreshQueueOverflow, so bursts of unknown key IDs
+	// during a key rotation behave predictably. If zero, reads are not limited.
+	RefreshQueueDepth int
+	// RefreshQueueOverflow determines what happens to a read of an unknown key ID when the refresh queue is full. It
+	// defaults to RefreshOverflowDrop.
+	RefreshQueueOverflow RefreshOverflowPolicy
+	// RefreshQueueOverflowHandler is called for every read of an unknown key ID that overflows the refresh queue.
+	RefreshQueueOverflowHandler RefreshOverflowHandler
+	// RefreshQueueTimeout is how long RefreshOverflowBlock waits for room in the refresh queue. If zero, only the
+	// context bounds the wait.
+	RefreshQueueTimeout time.Duration
+	// TargetedRefresh only refreshes the remote HTTP resources most likely to have an unknown key ID, instead of all of
+	// them. These are the resources configured in Issuers for the "iss" claim of the JWT, and the resource that last
+	// supplied the key ID. If neither is known, all remote HTTP resources are refreshed. This reduces the requests
+	// caused by each unknown key ID when there are many remote HTTP resources.
+	TargetedRefresh bool
+}
+
+// HTTPClient is a jwkset.Storage that combines given keys with the keys from one or more remote HTTP resources. Unlike
+// the client from jwkset.NewHTTPClient, the storage for each remote HTTP resource remains accessible.
+type HTTPClient interface {
+	jwkset.Storage
+	ThumbprintReader
+	// AddHTTPStorage starts using the storage for the given HTTP URL. It returns an error if the URL is already in use.
+	AddHTTPStorage(u string, store jwkset.Storage) error
+	// Given returns the storage for keys known from outside HTTP URLs. Writing keys to the HTTPClient writes them here.
+	Given() jwkset.Storage
+	// HTTPStorages returns a copy of the mapping of HTTP URLs to the storage for the keys located at the URL.
+	HTTPStorages() map[string]jwkset.Storage
+	// Provenance reports where the JWKs with the key ID came from, given keys first, then the HTTP storages in order.
+	Provenance(kid string) []KeyProvenance
+	// RefreshWithReport refreshes the storage for every HTTP URL and reports what each refresh did, sorted by URL.
+	RefreshWithReport(ctx context.Context) []RefreshReport
+	// RemoveHTTPStorage stops using the storage for the given HTTP URL and ends its background refreshes, such as the
+	// "refresh goroutine" of an HTTPStorage. It returns true if the URL was in use.
+	RemoveHTTPStorage(u string) bool
+	// SetRefreshUnknownKIDLimit changes the rate limit of refreshes for unknown key IDs while the HTTPClient is in use.
+	// To change how often each remote HTTP resource is refreshed, use the SetRefreshSettings method of its HTTPStorage.
+	SetRefreshUnknownKIDLimit(limit rate.Limit, burst int)
+	// Subscribe returns a channel of the events of every HTTP storage in use from now on, including those added later.
+	// See HTTPStorage. The subscription ends and the channel is closed when the context ends, because the HTTPClient
+	// has no lifetime of its own.
+	Subscribe(ctx context.Context) <-chan Event
+}
+
+type refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+type refreshErrorHandler interface {
+	handleRefreshError(ctx context.Context, err error)
+}
+
+type unknownKIDRefresher interface {
+	refreshUnknownKID() bool
+}
+
+type httpClient struct {
+	events            eventBus
+	given             jwkset.Storage
+	httpURLs          map[string]jwkset.Storage
+	issuers           map[string]string
+	kidSources        map[string]string
+	mux               sync.RWMutex
+	prioritizeHTTP    bool
+	rateLimitWaitMax  time.Duration
+	refreshQueue      *refreshQueue
+	refreshUnknownKID *rate.Limiter
+	targetedRefresh   bool
+}
+
+// NewHTTPClient creates a new HTTPClient from remote HTTP resources.
+func NewHTTPClient(options HTTPClientOptions) (HTTPClient, error) {
+	if options.Given == nil && len(options.HTTPURLs) == 0 {
+		return nil, fmt.Errorf("%w: no given keys or HTTP URLs", ErrHTTPClient)
+	}
+	httpURLs := make(map[string]jwkset.Storage, len(options.HTTPURLs))
+	for u, store := range options.HTTPURLs {
+		if store == nil {
+			var err error
+			store, err = NewHTTPStorage(u, HTTPStorageOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to create HTTP storage for %q", errors.Join(err, ErrHTTPClient), redact(u))
+			}
+		}
+		httpURLs[u] = store
+	}
+	given := options.Given
+	if given == nil {
+		given = jwkset.NewMemoryStorage()
+	}
+	c := &httpClient{
+		given:             given,
+		httpURLs:          httpURLs,
+		issuers:           maps.Clone(options.Issuers),
+		kidSources:        make(map[string]string),
+		prioritizeHTTP:    options.PrioritizeHTTP,
+		rateLimitWaitMax:  options.RateLimitWaitMax,
+		refreshQueue:      newRefreshQueue(options),
+		refreshUnknownKID: options.RefreshUnknownKID,
+		targetedRefresh:   options.TargetedRefresh,
+	}
+	for u, store := range httpURLs {
+		c.forwardEvents(u, store)
+	}
+	return c, nil
+}
+
+// URLOptions are per-URL options for NewDefaultURLOptionsCtx. The zero value has the same behavior as NewDefaultCtx.
+type URLOptions struct {
+	// Client is the HTTP client to use for requests to the remote HTTP resource. This allows each URL to use different
+	// proxies, timeouts, or authenticating transports.
+	//
+	// This defaults to http.DefaultClient.
+	Client *http.Client
+	// ContentTypes are the media types of the Content-Type header accepted in responses from the remote HTTP resource.
+	// See HTTPStorageOptions.
+	ContentTypes []string
+	// DeduplicateKeys shares one parsed cryptographic key between JWKs with identical key material. See
+	// HTTPStorageOptions.
+	DeduplicateKeys bool
+	// FailoverURLs are endpoints that serve the same JWK Set as the remote HTTP resource, in order of priority. See
+	// HTTPStorageOptions.
+	FailoverURLs []string
+	// FailoverCooldown is how long a failed endpoint is skipped. See HTTPStorageOptions.
+	FailoverCooldown time.Duration
+	// HealthCheckInterval probes the endpoints of the remote HTTP resource between refreshes. See HTTPStorageOptions.
+	HealthCheckInterval time.Duration
+	// HealthCheckMethod is the HTTP method of the probes. See HTTPStorageOptions.
+	HealthCheckMethod string
+	// FetchRateLimit limits the HTTP requests for the remote HTTP resource. Share one limiter between URLs and Keyfuncs
+	// to bound the aggregate traffic to an identity provider. See HTTPStorageOptions.
+	FetchRateLimit *rate.Limiter
+	// DuplicateKIDPolicy determines which JWKs are ingested when the remote HTTP resource contains the same key ID more
+	// than once. See HTTPStorageOptions.
+	DuplicateKIDPolicy DuplicateKIDPolicy
+	// HTTPTimeout is the timeout for each refresh of the remote HTTP resource.
+	//
+	// This defaults to time.Minute.
+	HTTPTimeout time.Duration
+	// HonorCacheControl schedules refreshes of the remote HTTP resource by its Cache-Control header. See
+	// HTTPStorageOptions.
+	HonorCacheControl bool
+	// HonorRefreshMetadata schedules refreshes of the remote HTTP resource by the "nextUpdate", "exp", and
+	// "refresh_hint" members of its JWK Set. See HTTPStorageOptions.
+	HonorRefreshMetadata bool
+	// HonorKeyExpiry treats expiry metadata on the JWKs in the remote HTTP resource as authoritative. See
+	// HTTPStorageOptions.
+	HonorKeyExpiry bool
+	// MinRefreshInterval is the minimum time between the starts of refreshes of the remote HTTP resource. See
+	// HTTPStorageOptions.
+	MinRefreshInterval time.Duration
+	// Issuer is the "iss" claim of the JWTs signed by the keys in the remote HTTP resource. If any URL has an Issuer,
+	// including a URL added later with AddURL, only the remote HTTP resources most likely to have an unknown key ID are
+	// refreshed. See HTTPClientOptions.TargetedRefresh.
+	Issuer string
+	// KeyTypePolicies filter the JWKs ingested from the remote HTTP resource by their key type. See
+	// HTTPStorageOptions.
+	KeyTypePolicies KeyTypePolicies
+	// LenientParsing also accepts a bare JSON array of JWKs from the remote HTTP resource. See HTTPStorageOptions.
+	LenientParsing bool
+	// NoRefreshUnknownKID prevents the remote HTTP resource from being refreshed when a key with an unknown key ID is
+	// trying to be read.
+	NoRefreshUnknownKID bool
+	// OnDemand fetches the remote HTTP resource synchronously during key reads instead of with a "refresh goroutine".
+	// RefreshInterval is then how long fetched keys are used. See HTTPStorageOptions.
+	OnDemand bool
+	// ParseWarningHandler is called for every JWK in the remote HTTP resource that is skipped because it cannot be
+	// parsed, and for every JWK with a duplicate key ID.
+	ParseWarningHandler ParseWarningHandler
+	// PinnedKIDs are key IDs that must exist in the remote HTTP resource. See HTTPStorageOptions.
+	PinnedKIDs []string
+	// PinnedThumbprints are RFC 7638 thumbprints of keys that must exist in the remote HTTP resource. See
+	// HTTPStorageOptions.
+	PinnedThumbprints []string
+	// RefreshErrorHandler consumes errors that happen during an HTTP refresh of the remote HTTP resource.
+	//
+	// This defaults to logging the error with slog.Default().
+	RefreshErrorHandler func(ctx context.Context, err error)
+	// RefreshInterval is the interval at which the remote HTTP resource is refreshed.
+	//
+	// This defaults to time.Hour.
+	RefreshInterval time.Duration
+	// ResponseDecoder converts the body of the remote HTTP resource to a JWK Set. See HTTPStorageOptions.
+	ResponseDecoder func(body []byte) (json.RawMessage, error)
+	// StalenessThreshold publishes EventStale when no refresh of the remote HTTP resource has succeeded for this long.
+	// See HTTPStorageOptions.
+	StalenessThreshold time.Duration
+	// StrictParsing fails a refresh of the remote HTTP resource if any JWK cannot be parsed. See HTTPStorageOptions.
+	StrictParsing bool
+	// StrictRFC7517 skips JWKs in the remote HTTP resource that deviate from RFC 7517. See HTTPStorageOptions.
+	StrictRFC7517 bool
+	// LenientNormalization fixes common deviations from RFC 7517 in the JWKs of the remote HTTP resource. See
+	// HTTPStorageOptions.
+	LenientNormalization bool
+	// X5CTrust validates the "x5c" certificate chains of the JWKs of the remote HTTP resource. See HTTPStorageOptions.
+	X5CTrust *X5CTrust
+}
+
+// newDefaultHTTPClient mirrors jwkset.NewDefaultHTTPClientCtx, but uses HTTPStorage for each remote HTTP resource.
+func newDefaultHTTPClient(ctx context.Context, urls map[string]URLOptions) (HTTPClient, error) {
+	httpURLs, err := newDefaultHTTPStorages(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+	issuers := make(map[string]string)
+	for u, urlOptions := range urls {
+		if urlOptions.Issuer != "" {
+			issuers[u] = urlOptions.Issuer
+		}
+	}
+	clientOptions := HTTPClientOptions{
+		HTTPURLs:          httpURLs,
+		Issuers:           issuers,
+		RateLimitWaitMax:  time.Minute,
+		RefreshUnknownKID: rate.NewLimiter(rate.Every(5*time.Minute), 1),
+		TargetedRefresh:   len(issuers) > 0,
+	}
+	return NewHTTPClient(clientOptions)
+}
+
+// newDefaultHTTPStorages creates an HTTPStorage with the default behavior for each remote HTTP resource. URLs with a
+// scheme registered with RegisterScheme use the storage from its factory instead.
+func newDefaultHTTPStorages(ctx context.Context, urls map[string]URLOptions) (map[string]jwkset.Storage, error) {
+	httpURLs := make(map[string]jwkset.Storage, len(urls))
+	for u, urlOptions := range urls {
+		store, ok, err := newSchemeStorage(ctx, u, urlOptions)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create storage for %q", errors.Join(err, ErrHTTPClient), redact(u))
+		}
+		if ok {
+			httpURLs[u] = store
+			continue
+		}
+		refreshErrorHandler := urlOptions.RefreshErrorHandler
+		if refreshErrorHandler == nil {
+			refreshErrorHandler = func(ctx context.Context, err error) {
+				slog.Default().ErrorContext(ctx, "Failed to refresh HTTP JWK Set from remote HTTP resource.",
+					"error", err,
+					"url", redact(u),
+				)
+			}
+		}
+		refreshInterval := urlOptions.RefreshInterval
+		if refreshInterval == 0 {
+			refreshInterval = time.Hour
+		}
+		options := HTTPStorageOptions{
+			Client:                    urlOptions.Client,
+			ContentTypes:              urlOptions.ContentTypes,
+			Ctx:                       ctx,
+			DeduplicateKeys:           urlOptions.DeduplicateKeys,
+			DuplicateKIDPolicy:        urlOptions.DuplicateKIDPolicy,
+			FailoverCooldown:          urlOptions.FailoverCooldown,
+			FailoverURLs:              urlOptions.FailoverURLs,
+			FetchRateLimit:            urlOptions.FetchRateLimit,
+			HealthCheckInterval:       urlOptions.HealthCheckInterval,
+			HealthCheckMethod:         urlOptions.HealthCheckMethod,
+			HTTPTimeout:               urlOptions.HTTPTimeout,
+			HonorCacheControl:         urlOptions.HonorCacheControl,
+			HonorKeyExpiry:            urlOptions.HonorKeyExpiry,
+			HonorRefreshMetadata:      urlOptions.HonorRefreshMetadata,
+			KeyTypePolicies:           urlOptions.KeyTypePolicies,
+			LenientNormalization:      urlOptions.LenientNormalization,
+			LenientParsing:            urlOptions.LenientParsing,
+			MinRefreshInterval:        urlOptions.MinRefreshInterval,
+			NoErrorReturnFirstHTTPReq: true,
+			NoRefreshUnknownKID:       urlOptions.NoRefreshUnknownKID,
+			OnDemand:                  urlOptions.OnDemand,
+			ParseWarningHandler:       urlOptions.ParseWarningHandler,
+			PinnedKIDs:                urlOptions.PinnedKIDs,
+			PinnedThumbprints:         urlOptions.PinnedThumbprints,
+			RefreshErrorHandler:       refreshErrorHandler,
+			RefreshInterval:           refreshInterval,
+			ResponseDecoder:           urlOptions.ResponseDecoder,
+			StalenessThreshold:        urlOptions.StalenessThreshold,
+			StrictParsing:             urlOptions.StrictParsing,
+			StrictRFC7517:             urlOptions.StrictRFC7517,
+			X5CTrust:                  urlOptions.X5CTrust,
+		}
+		store, err = NewHTTPStorage(u, options)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create HTTP storage for %q", errors.Join(err, ErrHTTPClient), redact(u))
+		}
+		httpURLs[u] = store
+	}
+	return httpURLs, nil
+}
+
+func (c *httpClient) AddHTTPStorage(u string, store jwkset.Storage) error {
+	if store == nil {
+		return fmt.Errorf("%w: no storage given for %q", ErrHTTPClient, redact(u))
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.httpURLs[u]; ok {
+		return fmt.Errorf("%w: HTTP URL %q is already in use", ErrHTTPClient, redact(u))
+	}
+	c.httpURLs[u] = store
+	c.forwardEvents(u, store)
+	return nil
+}
+func (c *httpClient) Given() jwkset.Storage {
+	return c.given
+}
+func (c *httpClient) HTTPStorages() map[string]jwkset.Storage {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return maps.Clone(c.httpURLs)
+}
+func (c *httpClient) RemoveHTTPStorage(u string) bool {
+	c.mux.Lock()
+	store, ok := c.httpURLs[u]
+	delete(c.httpURLs, u)
+	delete(c.issuers, u)
+	maps.DeleteFunc(c.kidSources, func(_, source string) bool { return source == u })
+	c.mux.Unlock()
+	if ok {
+		stopStorage(store)
+	}
+	return ok
+}
+
+// stores returns the HTTP storages in a consistent order so key IDs that appear in multiple remote resources resolve
+// the same way on every read.
+func (c *httpClient) stores() []jwkset.Storage {
+	_, stores := c.urlStores()
+	return stores
+}
+
+// urlStores is like stores, but also returns the HTTP URL of each storage.
+func (c *httpClient) urlStores() ([]string, []jwkset.Storage) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	urls := make([]string, 0, len(c.httpURLs))
+	for u := range c.httpURLs {
+		urls = append(urls, u)
+	}
+	slices.Sort(urls)
+	stores := make([]jwkset.Storage, len(urls))
+	for i, u := range urls {
+		stores[i] = c.httpURLs[u]
+	}
+	return urls, stores
+}
+
+// recordKIDSource remembers that the HTTP URL supplied the key ID, for TargetedRefresh.
+func (c *httpClient) recordKIDSource(keyID, u string) {
+	c.mux.RLock()
+	known := !c.targetedRefresh || c.kidSources[keyID] == u
+	c.mux.RUnlock()
+	if known {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.httpURLs[u]; ok {
+		c.kidSources[keyID] = u
+	}
+}
+
+// setIssuer sets the "iss" claim of the JWTs signed by the keys located at the HTTP URL and turns on TargetedRefresh,
+// so the issuer of a URL added at runtime is used like one given at creation.
+func (c *httpClient) setIssuer(u, iss string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.issuers == nil {
+		c.issuers = make(map[string]string)
+	}
+	c.issuers[u] = iss
+	c.targetedRefresh = true
+}
+
+// refreshTargets returns the indexes of the HTTP URLs to refresh for the unknown key ID. If TargetedRefresh is set,
+// these are the URLs of the issuer of the JWT and the URL that last supplied the key ID, when known.
+func (c *httpClient) refreshTargets(ctx context.Context, keyID string, urls []string) []int {
+	all := make([]int, len(urls))
+	for i := range urls {
+		all[i] = i
+	}
+	iss, _ := ctx.Value(issuerCtxKey{}).(string)
+	c.mux.RLock()
+	if !c.targetedRefresh {
+		c.mux.RUnlock()
+		return all
+	}
+	source := c.kidSources[keyID]
+	targets := make([]int, 0, 1)
+	for i, u := range urls {
+		if u == source || (iss != "" && c.issuers[u] == iss) {
+			targets = append(targets, i)
+		}
+	}
+	c.mux.RUnlock()
+	if len(targets) == 0 {
+		return all
+	}
+	return targets
+}
+
+func (c *httpClient) customKeyRead(ctx context.Context, match func(kid string) bool) (customKey, bool) {
+	if timeout, ok := unknownKIDRefreshTimeout(ctx); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for _, store := range append([]jwkset.Storage{c.given}, c.stores()...) {
+		r, ok := store.(customKeyReader)
+		if !ok {
+			continue
+		}
+		if key, ok := r.customKeyRead(ctx, match); ok {
+			return key, true
+		}
+	}
+	return customKey{}, false
+}
+
+// kidKeys reads the JWKs with a key ID from the given keys and every remote JWK Set, in the same order as KeyRead. The
+// JWKs of storage without an index of key IDs are found by reading all of its keys and have no time they were first
+// ingested.
+func (c *httpClient) kidKeys(ctx context.Context, kid string, match func(kid string) bool) ([]ingestedJWK, error) {
+	var keys []ingestedJWK
+	for _, store := range c.readOrder() {
+		if indexer, ok := store.(kidIndexer); ok {
+			k, err := indexer.kidKeys(ctx, kid, match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read keys with ID %q due to error: %w", kid, err)
+			}
+			keys = append(keys, k...)
+			continue
+		}
+		all, err := store.KeyReadAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys with ID %q due to error: %w", kid, err)
+		}
+		for _, jwk := range all {
+			if id := jwk.Marshal().KID; (match == nil && id == kid) || (match != nil && match(id)) {
+				keys = append(keys, ingestedJWK{jwk: jwk})
+			}
+		}
+	}
+	return keys, nil
+}
+
+// certificateKeys reads the JWKs with an X.509 certificate thumbprint from the given keys and every remote JWK Set, in
+// the same order as KeyRead. The JWKs of storage without an index are found by reading all of its keys.
+func (c *httpClient) certificateKeys(ctx context.Context, header, value string) ([]ingestedJWK, error) {
+	var keys []ingestedJWK
+	for _, store := range c.readOrder() {
+		if indexer, ok := store.(kidIndexer); ok {
+			k, err := indexer.certificateKeys(ctx, header, value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read keys with %s %q due to error: %w", header, value, err)
+			}
+			keys = append(keys, k...)
+			continue
+		}
+		all, err := store.KeyReadAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys with %s %q due to error: %w", header, value, err)
+		}
+		for _, jwk := range all {
+			if slices.Contains(certificateThumbprints(jwk.Marshal()), certificateThumbprint{header: header, value: value}) {
+				keys = append(keys, ingestedJWK{jwk: jwk})
+			}
+		}
+	}
+	return keys, nil
+}
+
+// readOrder returns the given keys and every remote JWK Set in the order KeyRead reads them.
+func (c *httpClient) readOrder() []jwkset.Storage {
+	stores := append([]jwkset.Storage{c.given}, c.stores()...)
+	if c.prioritizeHTTP {
+		stores = append(stores[1:], c.given)
+	}
+	return stores
+}
+
+func (c *httpClient) KeyDelete(ctx context.Context, keyID string) (ok bool, err error) {
+	ok, err = c.given.KeyDelete(ctx, keyID)
+	if err != nil && !errors.Is(err, jwkset.ErrKeyNotFound) {
+		return false, fmt.Errorf("failed to delete key with ID %q from given storage due to error: %w", keyID, err)
+	}
+	if ok {
+		return true, nil
+	}
+	for _, store := range c.stores() {
+		ok, err = store.KeyDelete(ctx, keyID)
+		if err != nil && !errors.Is(err, jwkset.ErrKeyNotFound) {
+			return false, fmt.Errorf("failed to delete key with ID %q from HTTP storage due to error: %w", keyID, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (c *httpClient) KeyRead(ctx context.Context, keyID string) (jwk jwkset.JWK, err error) {
+	timeout, ok := unknownKIDRefreshTimeout(ctx)
+	if !ok {
+		return c.keyRead(ctx, keyID, false)
+	}
+	boundedCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	jwk, err = c.keyRead(boundedCtx, keyID, true)
+	// A fetch of an OnDemand storage that timed out for an earlier key read may be reported before boundedCtx ends.
+	if err != nil && (boundedCtx.Err() != nil || errors.Is(err, context.DeadlineExceeded)) && ctx.Err() == nil {
+		return jwkset.JWK{}, fmt.Errorf("%w %q: not found by refreshes within the unknown key ID refresh timeout of %s", jwkset.ErrKeyNotFound, keyID, timeout)
+	}
+	return jwk, err
+}
+
+// keyRead reads the key ID from the given storage and the HTTP storages, then refreshes the HTTP storages if the key ID
+// is unknown. If detach is set, refreshes of storage in this package are not cancelled when ctx ends.
+func (c *httpClient) keyRead(ctx context.Context, keyID string, detach bool) (jwk jwkset.JWK, err error) {
+	if !c.prioritizeHTTP {
+		jwk, err = c.given.KeyRead(ctx, keyID)
+		traceDecision(ctx, DecisionStageSource, err, "given JWK Set storage")
+		switch {
+		case errors.Is(err, jwkset.ErrKeyNotFound):
+			// Do nothing.
+		case err != nil:
+			return jwkset.JWK{}, fmt.Errorf("failed to find JWT key with ID %q in given storage due to error: %w", keyID, err)
+		default:
+			return jwk, nil
+		}
+	}
+	urls, stores := c.urlStores()
+	for i, store := range stores {
+		jwk, err = store.KeyRead(ctx, keyID)
+		traceDecision(ctx, DecisionStageSource, err, "remote JWK Set %q", redact(urls[i]))
+		switch {
+		case errors.Is(err, jwkset.ErrKeyNotFound):
+			continue
+		case err != nil:
+			return jwkset.JWK{}, fmt.Errorf("failed to find JWT key with ID %q in HTTP storage due to error: %w", keyID, err)
+		default:
+			c.recordKIDSource(keyID, urls[i])
+			return jwk, nil
+		}
+	}
+	if c.prioritizeHTTP {
+		jwk, err = c.given.KeyRead(ctx, keyID)
+		traceDecision(ctx, DecisionStageSource, err, "given JWK Set storage")
+		switch {
+		case errors.Is(err, jwkset.ErrKeyNotFound):
+			// Do nothing.
+		case err != nil:
+			return jwkset.JWK{}, fmt.Errorf("failed to find JWT key with ID %q in given storage due to error: %w", keyID, err)
+		default:
+			return jwk, nil
+		}
+	}
+	if limiter := c.unknownKIDLimiter(); limiter != nil {
+		return c.unknownKIDKeyRead(ctx, limiter, keyID, urls, stores, detach)
+	}
+	return jwkset.JWK{}, fmt.Errorf("%w %q", jwkset.ErrKeyNotFound, keyID)
+}
+
+// unknownKIDKeyRead waits for the rate limit and queue of refreshes for the unknown key ID, then refreshes the HTTP
+// storages and reads the key ID. If detach is set, refreshes of storage in this package are not cancelled when ctx ends.
+func (c *httpClient) unknownKIDKeyRead(ctx context.Context, limiter *rate.Limiter, keyID string, urls []string, stores []jwkset.Storage, detach bool) (jwkset.JWK, error) {
+	entered, coalesce, err := c.refreshQueue.enter(ctx, keyID)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	if !entered {
+		select {
+		case <-coalesce:
+		case <-ctx.Done():
+			return jwkset.JWK{}, fmt.Errorf("%w %q: context ended while waiting for a queued refresh: %w", jwkset.ErrKeyNotFound, keyID, ctx.Err())
+		}
+		return c.storesKeyRead(ctx, keyID, urls, stores)
+	}
+	var cancel context.CancelFunc = func() {}
+	if c.rateLimitWaitMax > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.rateLimitWaitMax)
+	}
+	defer cancel()
+	err = limiter.Wait(ctx)
+	if err != nil {
+		c.refreshQueue.leave()
+		if detach {
+			// The wait for the rate limit would exceed the timeout of WithUnknownKIDRefreshTimeout.
+			return jwkset.JWK{}, fmt.Errorf("%w %q: failed to wait for JWK Set refresh rate limiter: %w", jwkset.ErrKeyNotFound, keyID, err)
+		}
+		return jwkset.JWK{}, fmt.Errorf("failed to wait for JWK Set refresh rate limiter due to error: %w", err)
+	}
+	// The room in the queue is kept until the refreshes complete, which may be after the read returns if detach is set.
+	return c.refreshKeyRead(ctx, keyID, urls, stores, detach, c.refreshQueue.leave)
+}
+
+// storesKeyRead reads the key ID from the HTTP storages without refreshing them.
+func (c *httpClient) storesKeyRead(ctx context.Context, keyID string, urls []string, stores []jwkset.Storage) (jwkset.JWK, error) {
+	for i, store := range stores {
+		jwk, err := store.KeyRead(ctx, keyID)
+		traceDecision(ctx, DecisionStageSource, err, "remote JWK Set %q after a queued refresh", redact(urls[i]))
+		switch {
+		case errors.Is(err, jwkset.ErrKeyNotFound):
+			continue
+		case err != nil:
+			return jwkset.JWK{}, fmt.Errorf("failed to find JWT key with ID %q in HTTP storage due to error: %w", keyID, err)
+		default:
+			c.recordKIDSource(keyID, urls[i])
+			return jwk, nil
+		}
+	}
+	return jwkset.JWK{}, fmt.Errorf("%w %q", jwkset.ErrKeyNotFound, keyID)
+}
+
+// refreshKeyRead concurrently refreshes the HTTP storages that are targets for the unknown key ID and reads the key ID
+// from each as its refresh completes. The first storage to have the key ID wins and the remaining refreshes are
+// cancelled. If detach is set, refreshes of storage in this package continue after the read returns, and the read
+// returns when ctx ends. The finished function is called once every refresh has completed.
+func (c *httpClient) refreshKeyRead(ctx context.Context, keyID string, urls []string, stores []jwkset.Storage, detach bool, finished func()) (jwkset.JWK, error) {
+	type result struct {
+		err error
+		i   int
+		jwk jwkset.JWK
+	}
+	refreshCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, len(stores))
+	launched := 0
+	var wg sync.WaitGroup
+	for _, i := range c.refreshTargets(ctx, keyID, urls) {
+		store := stores[i]
+		r, ok := store.(refresher)
+		if !ok {
+			continue
+		}
+		if u, ok := store.(unknownKIDRefresher); ok && !u.refreshUnknownKID() {
+			continue
+		}
+		launched++
+		wg.Add(1)
+		go func(i int, store jwkset.Storage) {
+			defer wg.Done()
+			storeCtx := refreshCtx
+			d, detached := store.(detachedRefresher)
+			if detached = detached && detach; detached {
+				var cancel context.CancelFunc
+				storeCtx, cancel = d.detachedContext()
+				defer cancel()
+			}
+			err := r.Refresh(storeCtx)
+			traceDecision(ctx, DecisionStageSource, redactError(err), "refreshed remote JWK Set %q for unknown kid", redact(urls[i]))
+			if err != nil {
+				// A refresh cancelled because another storage had the key ID is not an error.
+				if h, ok := store.(refreshErrorHandler); ok && (detached || refreshCtx.Err() == nil || ctx.Err() != nil) {
+					h.handleRefreshError(ctx, err)
+				}
+				results <- result{err: jwkset.ErrKeyNotFound, i: i}
+				return
+			}
+			jwk, err := store.KeyRead(storeCtx, keyID)
+			results <- result{err: err, i: i, jwk: jwk}
+		}(i, store)
+	}
+	go func() {
+		wg.Wait()
+		finished()
+	}()
+	var done <-chan struct{}
+	if detach {
+		done = ctx.Done()
+	}
+	var readErr error
+	for n := 0; n < launched; n++ {
+		var res result
+		select {
+		case res = <-results:
+		case <-done:
+			return jwkset.JWK{}, fmt.Errorf("%w %q: context ended while waiting for refreshes: %w", jwkset.ErrKeyNotFound, keyID, ctx.Err())
+		}
+		switch {
+		case errors.Is(res.err, jwkset.ErrKeyNotFound):
+			// Do nothing.
+		case res.err != nil:
+			if readErr == nil {
+				readErr = fmt.Errorf("failed to find JWT key with ID %q in HTTP storage due to error: %w", keyID, res.err)
+			}
+		default:
+			c.recordKIDSource(keyID, urls[res.i])
+			return res.jwk, nil
+		}
+	}
+	if readErr != nil {
+		return jwkset.JWK{}, readErr
+	}
+	return jwkset.JWK{}, fmt.Errorf("%w %q", jwkset.ErrKeyNotFound, keyID)
+}
+func (c *httpClient) KeyReadThumbprint(ctx context.Context, thumbprint string) (jwkset.JWK, error) {
+	stores := append([]jwkset.Storage{c.given}, c.stores()...)
+	if c.prioritizeHTTP {
+		stores = append(stores[1:], c.given)
+	}
+	for _, store := range stores {
+		jwk, err := KeyReadThumbprint(ctx, store, thumbprint)
+		switch {
+		case errors.Is(err, jwkset.ErrKeyNotFound):
+			continue
+		case err != nil:
+			return jwkset.JWK{}, fmt.Errorf("failed to find JWT key with thumbprint %q due to error: %w", thumbprint, err)
+		default:
+			return jwk, nil
+		}
+	}
+	return jwkset.JWK{}, fmt.Errorf("%w: thumbprint %q", jwkset.ErrKeyNotFound, thumbprint)
+}
+func (c *httpClient) KeyReadAll(ctx context.Context) ([]jwkset.JWK, error) {
+	jwks, err := c.given.KeyReadAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot given keys due to error: %w", err)
+	}
+	for _, store := range c.stores() {
+		j, err := store.KeyReadAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot HTTP keys due to error: %w", err)
+		}
+		jwks = append(jwks, j...)
+	}
+	return jwks, nil
+}
+func (c *httpClient) KeyWrite(ctx context.Context, jwk jwkset.JWK) error {
+	return c.given.KeyWrite(ctx, jwk)
+}
+
+func (c *httpClient) JSON(ctx context.Context) (json.RawMessage, error) {
+	m, err := c.combineStorage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine storage due to error: %w", err)
+	}
+	return m.JSON(ctx)
+}
+func (c *httpClient) JSONPublic(ctx context.Context) (json.RawMessage, error) {
+	m, err := c.combineStorage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine storage due to error: %w", err)
+	}
+	return m.JSONPublic(ctx)
+}
+func (c *httpClient) JSONPrivate(ctx context.Context) (json.RawMessage, error) {
+	m, err := c.combineStorage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine storage due to error: %w", err)
+	}
+	return m.JSONPrivate(ctx)
+}
+func (c *httpClient) JSONWithOptions(ctx context.Context, marshalOptions jwkset.JWKMarshalOptions, validationOptions jwkset.JWKValidateOptions) (json.RawMessage, error) {
+	m, err := c.combineStorage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine storage due to error: %w", err)
+	}
+	return m.JSONWithOptions(ctx, marshalOptions, validationOptions)
+}
+func (c *httpClient) Marshal(ctx context.Context) (jwkset.JWKSMarshal, error) {
+	m, err := c.combineStorage(ctx)
+	if err != nil {
+		return jwkset.JWKSMarshal{}, fmt.Errorf("failed to combine storage due to error: %w", err)
+	}
+	return m.Marshal(ctx)
+}
+func (c *httpClient) MarshalWithOptions(ctx context.Context, marshalOptions jwkset.JWKMarshalOptions, validationOptions jwkset.JWKValidateOptions) (jwkset.JWKSMarshal, error) {
+	m, err := c.combineStorage(ctx)
+	if err != nil {
+		return jwkset.JWKSMarshal{}, fmt.Errorf("failed to combine storage due to error: %w", err)
+	}
+	return m.MarshalWithOptions(ctx, marshalOptions, validationOptions)
+}
+
+func (c *httpClient) combineStorage(ctx context.Context) (jwkset.Storage, error) {
+	jwks, err := c.KeyReadAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot keys due to error: %w", err)
+	}
+	m := jwkset.NewMemoryStorage()
+	for _, jwk := range jwks {
+		err = m.KeyWrite(ctx, jwk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write key to memory storage due to error: %w", err)
+		}
+	}
+	return m, nil
+}
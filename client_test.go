@@ -0,0 +1,394 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestNewDefaultHTTPStorages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	client, ok := k.Storage().(HTTPClient)
+	if !ok {
+		t.Fatalf("Expected storage to be an HTTPClient, but got %T.", k.Storage())
+	}
+	stores := client.HTTPStorages()
+	if _, ok = stores[server.URL].(HTTPStorage); !ok {
+		t.Fatalf("Expected an HTTPStorage for %q.", server.URL)
+	}
+
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+
+	const givenKID = "given-key-id"
+	givenPriv := writeEdDSAKey(ctx, t, client.Given(), givenKID)
+	_, err = jwt.Parse(signEdDSA(t, givenPriv, givenKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed with given key. Error: %s", err)
+	}
+
+	if !client.RemoveHTTPStorage(server.URL) {
+		t.Fatalf("Expected HTTP storage to be removed.")
+	}
+	if client.RemoveHTTPStorage(server.URL) {
+		t.Fatalf("Expected HTTP storage to already be removed.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc after removing HTTP storage, but got %s.", err)
+	}
+}
+
+func TestRemoveHTTPStorageStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx, RefreshInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	client, err := NewHTTPClient(HTTPClientOptions{HTTPURLs: map[string]jwkset.Storage{server.URL: store}})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	if !client.RemoveHTTPStorage(server.URL) {
+		t.Fatalf("Expected HTTP storage to be removed.")
+	}
+	time.Sleep(20 * time.Millisecond)
+	removed := requests.Load()
+	time.Sleep(100 * time.Millisecond)
+	if n := requests.Load(); n != removed {
+		t.Fatalf("Expected no requests after the HTTP storage was removed, got %d.", n-removed)
+	}
+}
+
+func TestHTTPClientRefreshUnknownKID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	options := HTTPClientOptions{
+		HTTPURLs: map[string]jwkset.Storage{
+			server.URL: nil,
+		},
+		RateLimitWaitMax:  time.Second,
+		RefreshUnknownKID: rate.NewLimiter(rate.Every(time.Minute), 1),
+	}
+	client, err := NewHTTPClient(options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	_, err = client.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key after refresh for unknown key ID. Error: %s", err)
+	}
+
+	k, err := New(Options{Storage: client})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+}
+
+func TestHTTPClientTargetedRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stores := make(map[string]jwkset.Storage)
+	requests := make(map[string]*atomic.Int64)
+	issuers := make(map[string]string)
+	urls := make(map[string]string)
+	for _, name := range []string{"a", "b"} {
+		store := jwkset.NewMemoryStorage()
+		counter := &atomic.Int64{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter.Add(1)
+			rawJWKS, err := store.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+			}
+			_, _ = w.Write(rawJWKS)
+		}))
+		defer server.Close()
+		stores[name] = store
+		requests[name] = counter
+		urls[name] = server.URL
+		issuers[server.URL] = "https://" + name + ".example.com"
+	}
+	client, err := NewHTTPClient(HTTPClientOptions{
+		HTTPURLs:          map[string]jwkset.Storage{urls["a"]: nil, urls["b"]: nil},
+		Issuers:           issuers,
+		RefreshUnknownKID: rate.NewLimiter(rate.Inf, 1),
+		TargetedRefresh:   true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	k, err := New(Options{Storage: client})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	counts := func() (int64, int64) {
+		return requests["a"].Load(), requests["b"].Load()
+	}
+
+	priv := writeEdDSAKey(ctx, t, stores["b"], keyID)
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": "https://b.example.com"})
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	a, b := counts()
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if gotA, gotB := counts(); gotA != a || gotB != b+1 {
+		t.Fatalf("Expected only the issuer's JWK Set to be refreshed, got %d and %d requests.", gotA-a, gotB-b)
+	}
+
+	_, err = client.HTTPStorages()[urls["b"]].KeyDelete(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to delete key. Error: %s", err)
+	}
+	a, b = counts()
+	_, err = client.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key. Error: %s", err)
+	}
+	if gotA, gotB := counts(); gotA != a || gotB != b+1 {
+		t.Fatalf("Expected only the JWK Set that supplied the key ID to be refreshed, got %d and %d requests.", gotA-a, gotB-b)
+	}
+
+	a, b = counts()
+	_, err = client.KeyRead(ctx, "unknown-key-id")
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound. Error: %v", err)
+	}
+	if gotA, gotB := counts(); gotA != a+1 || gotB != b+1 {
+		t.Fatalf("Expected every JWK Set to be refreshed without a hint, got %d and %d requests.", gotA-a, gotB-b)
+	}
+}
+
+func TestHTTPClientParallelRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fastStore := jwkset.NewMemoryStorage()
+	fast := newJWKSServer(ctx, t, fastStore)
+	defer fast.Close()
+	var slowRequests atomic.Int64
+	slowCancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slowRequests.Add(1) == 1 {
+			_, _ = w.Write([]byte(`{"keys":[]}`))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			close(slowCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	var refreshErrors atomic.Int64
+	httpURLs := make(map[string]jwkset.Storage)
+	for _, u := range []string{fast.URL, slow.URL} {
+		store, err := NewHTTPStorage(u, HTTPStorageOptions{
+			Ctx: ctx,
+			RefreshErrorHandler: func(ctx context.Context, err error) {
+				refreshErrors.Add(1)
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+		}
+		httpURLs[u] = store
+	}
+	client, err := NewHTTPClient(HTTPClientOptions{
+		HTTPURLs:          httpURLs,
+		RefreshUnknownKID: rate.NewLimiter(rate.Inf, 1),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+
+	writeEdDSAKey(ctx, t, fastStore, keyID)
+	start := time.Now()
+	_, err = client.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key after refresh for unknown key ID. Error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Expected the read to return without waiting for the slow JWK Set, but it took %s.", elapsed)
+	}
+	select {
+	case <-slowCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the refresh of the slow JWK Set to be cancelled.")
+	}
+	if refreshErrors.Load() != 0 {
+		t.Fatalf("Expected a cancelled refresh to not be reported as an error, got %d errors.", refreshErrors.Load())
+	}
+}
+
+func TestNewHTTPClientErr(t *testing.T) {
+	_, err := NewHTTPClient(HTTPClientOptions{})
+	if !errors.Is(err, ErrHTTPClient) {
+		t.Fatalf("Expected ErrHTTPClient, but got %s.", err)
+	}
+}
+
+func newJWKSServer(ctx context.Context, t *testing.T, store jwkset.Storage) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawJWKS, err := store.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+}
+
+func TestNewDefaultURLOptionsCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	refreshedStore := jwkset.NewMemoryStorage()
+	refreshed := newJWKSServer(ctx, t, refreshedStore)
+	defer refreshed.Close()
+	var staticRequests atomic.Int64
+	static := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		staticRequests.Add(1)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer static.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	var handled error
+	urls := map[string]URLOptions{
+		refreshed.URL: {
+			RefreshInterval: 24 * time.Hour,
+		},
+		static.URL: {
+			NoRefreshUnknownKID: true,
+		},
+		failing.URL: {
+			NoRefreshUnknownKID: true,
+			RefreshErrorHandler: func(ctx context.Context, err error) {
+				handled = err
+			},
+		},
+	}
+	k, err := NewDefaultURLOptionsCtx(ctx, urls)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if !errors.Is(handled, jwkset.ErrInvalidHTTPStatusCode) {
+		t.Fatalf("Expected per-URL refresh error handler to be called, but got %v.", handled)
+	}
+
+	priv := writeEdDSAKey(ctx, t, refreshedStore, keyID)
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT after unknown key ID refresh. Error: %s", err)
+	}
+	if staticRequests.Load() != 1 {
+		t.Fatalf("Expected URL without unknown key ID refresh to be requested once, but got %d.", staticRequests.Load())
+	}
+}
+
+func TestNewDefaultURLOptionsCtxClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const authHeader = "Authorization"
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	jwks := newJWKSServer(ctx, t, serverStore)
+	defer jwks.Close()
+	authenticated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(authHeader) == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		jwks.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer authenticated.Close()
+
+	urls := map[string]URLOptions{
+		authenticated.URL: {
+			Client: &http.Client{
+				Transport: headerTransport{header: authHeader, value: "Bearer token"},
+			},
+			RefreshErrorHandler: func(ctx context.Context, err error) {
+				t.Errorf("Failed to refresh with per-URL HTTP client. Error: %s", err)
+			},
+		},
+	}
+	k, err := NewDefaultURLOptionsCtx(ctx, urls)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+}
+
+type headerTransport struct {
+	header string
+	value  string
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(h.header, h.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
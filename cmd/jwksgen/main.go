@@ -0,0 +1,215 @@
+// Command jwksgen converts PEM encoded public keys and certificates into a JWK Set for the file and embedded sources of
+// keyfunc, such as keyfunc.NewFileStorage and keyfunc.NewFromJSON. The key ID of each JWK is its RFC 7638 thumbprint.
+//
+// Usage:
+//
+//	jwksgen [-alg RS256] [-use sig] [-o jwks.json] [file.pem ...]
+//
+// PEM files are read from the arguments, or from standard input if there are none. Blocks of type PUBLIC KEY, RSA
+// PUBLIC KEY, and CERTIFICATE are converted. Private keys are converted to their public keys, so they are never
+// written. The first certificate of each file is a key, and any following certificates of the same file are its chain
+// in the "x5c" parameter. A key that is given more than once is only written once.
+//
+// The watch subcommand polls a remote JWK Set and writes a JSON line for every key that is added, removed, or changed,
+// and for every "x5c" leaf certificate that expires soon, to monitor the key rotation of an identity provider:
+//
+//	jwksgen watch [-interval 1m] [-expiry 720h] [-count 0] https://example.com/jwks.json
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/MicahParks/jwkset"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to run jwksgen.\nError: %s", err)
+	}
+}
+
+// options configure the generated JWKs.
+type options struct {
+	alg jwkset.ALG
+	use jwkset.USE
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "watch" {
+		return runWatch(ctx, args[1:], stdout)
+	}
+	flags := flag.NewFlagSet("jwksgen", flag.ContinueOnError)
+	alg := flags.String("alg", "", `The "alg" parameter of every JWK. If empty, it is omitted.`)
+	use := flags.String("use", string(jwkset.UseSig), `The "use" parameter of every JWK. If empty, it is omitted.`)
+	output := flags.String("o", "", "The file to write the JWK Set to. If empty, it is written to standard output.")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var files [][]byte
+	if flags.NArg() == 0 {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read standard input: %w", err)
+		}
+		files = append(files, b)
+	}
+	for _, name := range flags.Args() {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read PEM file: %w", err)
+		}
+		files = append(files, b)
+	}
+
+	raw, err := generate(files, options{alg: jwkset.ALG(*alg), use: jwkset.USE(*use)})
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = stdout.Write(raw)
+		return err
+	}
+	return os.WriteFile(*output, raw, 0o644)
+}
+
+// generate creates the indented JSON of a JWK Set from the content of PEM files.
+func generate(files [][]byte, options options) (json.RawMessage, error) {
+	jwks := jwkset.JWKSMarshal{Keys: make([]jwkset.JWKMarshal, 0)}
+	seen := make(map[string]bool)
+	for i, file := range files {
+		keys, err := parsePEM(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PEM file %d: %w", i+1, err)
+		}
+		for _, key := range keys {
+			marshal, err := newJWK(key, options)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create JWK from PEM file %d: %w", i+1, err)
+			}
+			if seen[marshal.KID] {
+				continue
+			}
+			seen[marshal.KID] = true
+			jwks.Keys = append(jwks.Keys, marshal)
+		}
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, errors.New("no public keys or certificates found")
+	}
+	raw, err := json.MarshalIndent(jwks, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JWK Set: %w", err)
+	}
+	return append(raw, '\n'), nil
+}
+
+// pemKey is a public key from a PEM file and the certificate chain it was taken from, if any.
+type pemKey struct {
+	chain []*x509.Certificate
+	key   crypto.PublicKey
+}
+
+// parsePEM reads the public keys from the blocks of a PEM file.
+func parsePEM(file []byte) ([]pemKey, error) {
+	var keys []pemKey
+	leaf := -1
+	rest := bytes.TrimSpace(file)
+	for len(rest) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("invalid PEM block")
+		}
+		rest = bytes.TrimSpace(rest)
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %w", err)
+			}
+			if leaf >= 0 {
+				keys[leaf].chain = append(keys[leaf].chain, cert)
+				continue
+			}
+			leaf = len(keys)
+			keys = append(keys, pemKey{chain: []*x509.Certificate{cert}, key: cert.PublicKey})
+			continue
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = publicKey(x509.ParsePKCS8PrivateKey(block.Bytes))
+		case "RSA PRIVATE KEY":
+			key, err = publicKey(x509.ParsePKCS1PrivateKey(block.Bytes))
+		case "EC PRIVATE KEY":
+			key, err = publicKey(x509.ParseECPrivateKey(block.Bytes))
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", block.Type, err)
+		}
+		keys = append(keys, pemKey{key: key})
+	}
+	return keys, nil
+}
+
+// publicKey returns the public key of a parsed private key.
+func publicKey[T any](priv T, err error) (crypto.PublicKey, error) {
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := any(priv).(interface{ Public() crypto.PublicKey })
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	return signer.Public(), nil
+}
+
+// newJWK creates the public JWK of a key. Its key ID is its RFC 7638 thumbprint.
+func newJWK(key pemKey, options options) (jwkset.JWKMarshal, error) {
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: options.alg,
+			USE: options.use,
+		},
+		X509: jwkset.JWKX509Options{
+			X5C: key.chain,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(key.key, jwkOptions)
+	if err != nil {
+		return jwkset.JWKMarshal{}, err
+	}
+	jwkOptions.Metadata.KID, err = keyfunc.Thumbprint(jwk)
+	if err != nil {
+		return jwkset.JWKMarshal{}, err
+	}
+	jwk, err = jwkset.NewJWKFromKey(key.key, jwkOptions)
+	if err != nil {
+		return jwkset.JWKMarshal{}, err
+	}
+	return jwk.Marshal(), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EdDSA key. Error: %s", err)
+	}
+	template := &x509.Certificate{
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jwksgen"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, edPriv.Public(), edPriv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate. Error: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key. Error: %s", err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(rsaPriv.Public())
+	if err != nil {
+		t.Fatalf("Failed to marshal RSA public key. Error: %s", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPriv)})
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	err = os.WriteFile(certFile, certPEM, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write PEM file. Error: %s", err)
+	}
+	output := filepath.Join(dir, "jwks.json")
+	err = run(ctx, []string{"-alg", "EdDSA", "-o", output, certFile}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run jwksgen. Error: %s", err)
+	}
+	raw, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read JWK Set. Error: %s", err)
+	}
+	var jwks jwkset.JWKSMarshal
+	err = json.Unmarshal(raw, &jwks)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK Set. Error: %s", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].ALG != jwkset.AlgEdDSA || len(jwks.Keys[0].X5C) != 1 {
+		t.Fatalf("Expected 1 EdDSA JWK with its certificate, got %+v.", jwks.Keys)
+	}
+
+	var stdout bytes.Buffer
+	err = run(ctx, nil, bytes.NewReader(append(publicPEM, privatePEM...)), &stdout)
+	if err != nil {
+		t.Fatalf("Failed to run jwksgen on standard input. Error: %s", err)
+	}
+	k, err := keyfunc.NewFromJSON(stdout.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from generated JWK Set. Error: %s", err)
+	}
+	snapshot, err := k.(keyfunc.KeyManager).Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Failed to snapshot keys. Error: %s", err)
+	}
+	if len(snapshot) != 1 {
+		t.Fatalf("Expected a public key and its private key to produce 1 JWK, got %d.", len(snapshot))
+	}
+	thumbprint, err := keyfunc.Thumbprint(snapshot[0])
+	if err != nil {
+		t.Fatalf("Failed to compute thumbprint. Error: %s", err)
+	}
+	if snapshot[0].Marshal().KID != thumbprint || snapshot[0].Marshal().D != "" {
+		t.Fatalf("Expected a public JWK whose key ID is its thumbprint.")
+	}
+
+	_, err = generate([][]byte{[]byte("not PEM")}, options{})
+	if err == nil {
+		t.Fatalf("Expected an error for a file that is not PEM.")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+// watchEvent is a line of the structured output of the watch subcommand.
+type watchEvent struct {
+	Error      string     `json:"error,omitempty"`
+	Event      string     `json:"event"`
+	KID        string     `json:"kid,omitempty"`
+	KTY        jwkset.KTY `json:"kty,omitempty"`
+	NotAfter   *time.Time `json:"not_after,omitempty"`
+	Thumbprint string     `json:"thumbprint,omitempty"`
+	Time       time.Time  `json:"time"`
+}
+
+const (
+	eventAdded    = "added"
+	eventChanged  = "changed"
+	eventError    = "error"
+	eventExpiring = "expiring"
+	eventRemoved  = "removed"
+)
+
+// watchedKey is what the watch subcommand compares between polls for a key ID.
+type watchedKey struct {
+	kty        jwkset.KTY
+	marshal    string
+	notAfter   time.Time
+	thumbprint string
+}
+
+// runWatch polls the JWK Set at a URL and writes a JSON line to stdout for every key that is added, removed, or
+// changed, and for every "x5c" leaf certificate that expires soon. The first poll reports every key as added.
+func runWatch(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("jwksgen watch", flag.ContinueOnError)
+	count := flags.Int("count", 0, "The number of polls before exiting. If zero, polls until interrupted.")
+	expiry := flags.Duration("expiry", 30*24*time.Hour, `Reports "x5c" leaf certificates that expire within this duration.`)
+	interval := flags.Duration("interval", time.Minute, "The interval between polls.")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one JWK Set URL, got %d arguments", flags.NArg())
+	}
+
+	store, err := keyfunc.NewHTTPStorage(flags.Arg(0), keyfunc.HTTPStorageOptions{
+		Ctx:                 ctx,
+		RefreshErrorHandler: func(ctx context.Context, err error) {},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP storage: %w", err)
+	}
+	encoder := json.NewEncoder(stdout)
+	var previous map[string]watchedKey
+	warned := make(map[string]bool)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for poll := 1; ; poll++ {
+		now := time.Now()
+		var events []watchEvent
+		// The storage already fetched the JWK Set when it was created.
+		current, err := watchPoll(ctx, store, poll > 1)
+		if err != nil {
+			events = append(events, watchEvent{Error: err.Error(), Event: eventError, Time: now})
+		} else {
+			events = diffWatchedKeys(previous, current, now)
+			for kid, key := range current {
+				if key.notAfter.IsZero() || key.notAfter.Sub(now) > *expiry || warned[kid+key.thumbprint] {
+					continue
+				}
+				warned[kid+key.thumbprint] = true
+				notAfter := key.notAfter
+				events = append(events, watchEvent{Event: eventExpiring, KID: kid, KTY: key.kty, NotAfter: &notAfter, Thumbprint: key.thumbprint, Time: now})
+			}
+			previous = current
+		}
+		slices.SortStableFunc(events, func(a, b watchEvent) int {
+			return strings.Compare(a.KID, b.KID)
+		})
+		for _, event := range events {
+			err = encoder.Encode(event)
+			if err != nil {
+				return fmt.Errorf("failed to write event: %w", err)
+			}
+		}
+		if poll == *count {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchPoll optionally refreshes the JWK Set and returns its keys by key ID.
+func watchPoll(ctx context.Context, store keyfunc.HTTPStorage, refresh bool) (map[string]watchedKey, error) {
+	if refresh {
+		err := store.Refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	jwks, err := store.KeyReadAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]watchedKey, len(jwks))
+	for _, jwk := range jwks {
+		marshal, err := json.Marshal(jwk.Marshal())
+		if err != nil {
+			return nil, err
+		}
+		key := watchedKey{
+			kty:     jwk.Marshal().KTY,
+			marshal: string(marshal),
+		}
+		key.thumbprint, _ = keyfunc.Thumbprint(jwk)
+		if leaf, ok := keyfunc.X5CLeaf(jwk); ok {
+			key.notAfter = leaf.NotAfter
+		}
+		keys[jwk.Marshal().KID] = key
+	}
+	return keys, nil
+}
+
+// diffWatchedKeys returns the events for the keys that were added, removed, or changed between polls.
+func diffWatchedKeys(previous, current map[string]watchedKey, now time.Time) []watchEvent {
+	var events []watchEvent
+	for kid, key := range current {
+		old, ok := previous[kid]
+		switch {
+		case !ok:
+			events = append(events, watchEvent{Event: eventAdded, KID: kid, KTY: key.kty, Thumbprint: key.thumbprint, Time: now})
+		case old.marshal != key.marshal:
+			events = append(events, watchEvent{Event: eventChanged, KID: kid, KTY: key.kty, Thumbprint: key.thumbprint, Time: now})
+		}
+	}
+	for kid, key := range previous {
+		if _, ok := current[kid]; !ok {
+			events = append(events, watchEvent{Event: eventRemoved, KID: kid, KTY: key.kty, Thumbprint: key.thumbprint, Time: now})
+		}
+	}
+	return events
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+
+	first := jwkset.JWKSMarshal{Keys: []jwkset.JWKMarshal{newWatchJWK(t, "rotated", false), newWatchJWK(t, "removed", false)}}
+	second := jwkset.JWKSMarshal{Keys: []jwkset.JWKMarshal{newWatchJWK(t, "rotated", false), newWatchJWK(t, "added", true)}}
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks := second
+		if requests.Add(1) == 1 {
+			jwks = first
+		}
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	defer server.Close()
+
+	var stdout bytes.Buffer
+	err := run(ctx, []string{"watch", "-count", "2", "-interval", "10ms", server.URL}, nil, &stdout)
+	if err != nil {
+		t.Fatalf("Failed to run watch subcommand. Error: %s", err)
+	}
+	var events []string
+	decoder := json.NewDecoder(&stdout)
+	for decoder.More() {
+		var event watchEvent
+		err = decoder.Decode(&event)
+		if err != nil {
+			t.Fatalf("Failed to decode event. Error: %s", err)
+		}
+		events = append(events, event.Event+" "+event.KID)
+	}
+	expected := []string{
+		"added removed", "added rotated",
+		"added added", "expiring added", "removed removed", "changed rotated",
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v.", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("Expected events %v, got %v.", expected, events)
+		}
+	}
+}
+
+func newWatchJWK(t *testing.T, kid string, expiring bool) jwkset.JWKMarshal {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EdDSA key. Error: %s", err)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			KID: kid,
+		},
+	}
+	if expiring {
+		template := &x509.Certificate{
+			NotAfter:     time.Now().Add(time.Hour),
+			NotBefore:    time.Now().Add(-time.Hour),
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: kid},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+		if err != nil {
+			t.Fatalf("Failed to create certificate. Error: %s", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("Failed to parse certificate. Error: %s", err)
+		}
+		jwkOptions.X509.X5C = []*x509.Certificate{cert}
+	}
+	jwk, err := jwkset.NewJWKFromKey(priv.Public(), jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	return jwk.Marshal()
+}
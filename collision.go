@@ -0,0 +1,185 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KIDCollisionPolicy determines how a Keyfunc chooses between multiple JWKs that share a key ID. This commonly happens
+// when multiple remote JWK Sets are combined and an identity provider reuses a key ID during key rotation.
+type KIDCollisionPolicy string
+
+const (
+	// KIDCollisionFirst uses the JWK returned by jwkset.Storage.KeyRead. This is the default behavior.
+	KIDCollisionFirst KIDCollisionPolicy = ""
+	// KIDCollisionPreferNewest uses every JWK with a matching key ID, ordered from the most recently ingested to the
+	// least recently ingested by storage in this package, such as HTTPStorage. The newest JWK is tried first when
+	// verifying the JWT's signature and older JWKs are used as a fallback. JWKs of other storage in an HTTPClient, such
+	// as given keys, are tried last. If the Keyfunc's storage is not from this package, JWKs are ordered by when the
+	// Keyfunc first observed them.
+	KIDCollisionPreferNewest KIDCollisionPolicy = "prefer-newest"
+)
+
+// ingestedJWK is a JWK with the time it was first ingested by storage in this package. The time is zero if the storage
+// does not record it.
+type ingestedJWK struct {
+	firstSeen time.Time
+	jwk       jwkset.JWK
+}
+
+// kidIndexer is implemented by storage in this package. It indexes JWKs by key ID and records when each JWK was first
+// ingested whenever its keys change, so JWKs that share a key ID are found without reading every key.
+type kidIndexer interface {
+	// kidKeys returns the JWKs with the key ID. If match is not nil, the JWKs with a key ID that satisfies it are
+	// returned instead.
+	kidKeys(ctx context.Context, kid string, match func(kid string) bool) ([]ingestedJWK, error)
+	// certificateKeys returns the JWKs with the X.509 certificate thumbprint given in the HeaderX5T or HeaderX5TS256
+	// header parameter.
+	certificateKeys(ctx context.Context, header, value string) ([]ingestedJWK, error)
+}
+
+// keyObservation records when a JWK was observed in the JWK Set storage by a Keyfunc.
+type keyObservation struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+type observationKey struct {
+	kid        string
+	thumbprint string
+}
+
+type keyObserver struct {
+	mux          sync.Mutex
+	now          func() time.Time
+	observations map[observationKey]keyObservation
+}
+
+func newKeyObserver() *keyObserver {
+	return &keyObserver{
+		now:          time.Now,
+		observations: make(map[observationKey]keyObservation),
+	}
+}
+
+// observe records a snapshot of all JWKs in storage. JWKs that are no longer in the snapshot are forgotten, so a JWK
+// that is removed and later published again is considered new.
+func (o *keyObserver) observe(snapshot []jwkset.JWK) map[observationKey]keyObservation {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	now := o.now()
+	current := make(map[observationKey]keyObservation, len(snapshot))
+	for _, jwk := range snapshot {
+		key := newObservationKey(jwk)
+		observation, ok := o.observations[key]
+		if !ok {
+			observation.FirstSeen = now
+		}
+		observation.LastSeen = now
+		current[key] = observation
+	}
+	o.observations = current
+	return current
+}
+
+func newObservationKey(jwk jwkset.JWK) observationKey {
+	t, err := Thumbprint(jwk)
+	if err != nil {
+		t = fmt.Sprintf("%s:%s", jwk.Marshal().KTY, jwk.Marshal().X5TS256)
+	}
+	return observationKey{
+		kid:        jwk.Marshal().KID,
+		thumbprint: t,
+	}
+}
+
+func (k keyfunc) preferNewest(ctx context.Context, kid, alg string) (any, error) {
+	candidates, err := k.collisionCandidates(ctx, kid)
+	if err != nil {
+		if k.storageErrorPolicy == StorageErrorFailOpen {
+			if known, ok := k.lastKnown.read(kid); ok {
+				return k.verificationKey(ctx, known, alg)
+			}
+		}
+		return nil, fmt.Errorf("%w: could not read JWKs for kid from storage", errors.Join(err, ErrKeyfunc))
+	}
+	traceDecision(ctx, DecisionStageSource, nil, "%d keys for kid %q", len(candidates), kid)
+	if len(candidates) == 0 {
+		// Reading the key ID allows the storage to perform any refresh for unknown key IDs.
+		jwk, err := k.readKey(ctx, kid)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not read JWK from storage", errors.Join(err, ErrKeyfunc))
+		}
+		return k.verificationKey(ctx, jwk, alg)
+	}
+	if k.storageErrorPolicy == StorageErrorFailOpen {
+		k.lastKnown.write(kid, candidates[0])
+	}
+
+	var errs []error
+	keys := make([]jwt.VerificationKey, 0, len(candidates))
+	for _, jwk := range candidates {
+		key, err := k.verificationKey(ctx, jwk, alg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	switch len(keys) {
+	case 0:
+		return nil, errors.Join(errs...)
+	case 1:
+		return keys[0], nil
+	}
+	return jwt.VerificationKeySet{Keys: keys}, nil
+}
+
+// collisionCandidates returns the JWKs for the normalized key ID, ordered from the newest to the oldest. Storage in this
+// package is read through its index of key IDs. Other storage is read in full and its JWKs are ordered by when the
+// Keyfunc first observed them.
+func (k keyfunc) collisionCandidates(ctx context.Context, kid string) ([]jwkset.JWK, error) {
+	if indexer, ok := k.storage.(kidIndexer); ok {
+		var match func(string) bool
+		if k.kidNormalizer != nil {
+			match = k.matchKID(kid)
+		}
+		keys, err := indexer.kidKeys(ctx, kid, match)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].firstSeen.After(keys[j].firstSeen)
+		})
+		candidates := make([]jwkset.JWK, 0, len(keys))
+		for _, key := range keys {
+			candidates = append(candidates, key.jwk)
+		}
+		return candidates, nil
+	}
+
+	snapshot, err := k.storage.KeyReadAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	observations := k.observer.observe(snapshot)
+	var candidates []jwkset.JWK
+	for _, jwk := range snapshot {
+		if k.normalizeKID(jwk.Marshal().KID) == kid {
+			candidates = append(candidates, jwk)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		first := observations[newObservationKey(candidates[i])].FirstSeen
+		second := observations[newObservationKey(candidates[j])].FirstSeen
+		return first.After(second)
+	})
+	return candidates, nil
+}
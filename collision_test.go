@@ -0,0 +1,173 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKIDCollisionPreferNewest(t *testing.T) {
+	ctx := context.Background()
+
+	store := jwkset.NewMemoryStorage()
+	oldPriv := writeEdDSAKey(ctx, t, store, keyID)
+
+	options := Options{
+		Storage:            store,
+		KIDCollisionPolicy: KIDCollisionPreferNewest,
+	}
+	k, err := New(options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	now := time.Now()
+	k.(keyfunc).observer.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	oldSigned := signEdDSA(t, oldPriv, keyID)
+	_, err = jwt.Parse(oldSigned, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed with the only key. Error: %s", err)
+	}
+
+	newPriv := writeEdDSAKey(ctx, t, store, keyID)
+	newSigned := signEdDSA(t, newPriv, keyID)
+
+	token, _, err := jwt.NewParser().ParseUnverified(newSigned, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse unverified JWT. Error: %s", err)
+	}
+	key, err := k.Keyfunc(token)
+	if err != nil {
+		t.Fatalf("Failed to get key for colliding key ID. Error: %s", err)
+	}
+	set, ok := key.(jwt.VerificationKeySet)
+	if !ok {
+		t.Fatalf("Expected jwt.VerificationKeySet, but got %T.", key)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("Expected 2 candidate keys, but got %d.", len(set.Keys))
+	}
+	newest, ok := set.Keys[0].(ed25519.PublicKey)
+	if !ok || !newest.Equal(newPriv.Public()) {
+		t.Fatalf("Expected the newest key to be tried first.")
+	}
+
+	_, err = jwt.Parse(newSigned, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed with the newest key. Error: %s", err)
+	}
+	_, err = jwt.Parse(oldSigned, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed with the older key via fallback. Error: %s", err)
+	}
+}
+
+func TestKIDCollisionPreferNewestIngested(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	oldPriv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	now := time.Now()
+	store.(*httpStorage).memoryStorage.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	k, err := New(Options{
+		Ctx:                ctx,
+		Storage:            store,
+		KIDCollisionPolicy: KIDCollisionPreferNewest,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	// The newer key is published after the older key, but neither is looked up before both are ingested.
+	newPriv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+	}
+	newSigned := signEdDSA(t, newPriv, keyID)
+	token, _, err := jwt.NewParser().ParseUnverified(newSigned, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse unverified JWT. Error: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		key, err := k.Keyfunc(token)
+		if err != nil {
+			t.Fatalf("Failed to get key for colliding key ID. Error: %s", err)
+		}
+		set, ok := key.(jwt.VerificationKeySet)
+		if !ok || len(set.Keys) != 2 {
+			t.Fatalf("Expected a jwt.VerificationKeySet with 2 candidate keys, but got %T.", key)
+		}
+		newest, ok := set.Keys[0].(ed25519.PublicKey)
+		if !ok || !newest.Equal(newPriv.Public()) {
+			t.Fatalf("Expected the most recently ingested key to be tried first.")
+		}
+	}
+
+	_, err = jwt.Parse(signEdDSA(t, oldPriv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed with the older key via fallback. Error: %s", err)
+	}
+}
+
+func TestKIDCollisionPolicyErr(t *testing.T) {
+	options := Options{
+		Storage:            jwkset.NewMemoryStorage(),
+		KIDCollisionPolicy: "unknown",
+	}
+	_, err := New(options)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for unknown policy, but got %s.", err)
+	}
+}
+
+func writeEdDSAKey(ctx context.Context, t *testing.T, store jwkset.Storage, kid string) ed25519.PrivateKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			KID: kid,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(priv.Public(), jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK from ED25519 public key. Error: %s", err)
+	}
+	err = store.KeyWrite(ctx, jwk)
+	if err != nil {
+		t.Fatalf("Failed to write ED25519 public key to store. Error: %s", err)
+	}
+	return priv
+}
+
+func signEdDSA(t *testing.T, priv ed25519.PrivateKey, kid string) string {
+	token := jwt.New(jwt.SigningMethodEdDSA)
+	token.Header[jwkset.HeaderKID] = kid
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	return signed
+}
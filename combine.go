@@ -0,0 +1,82 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Chain creates a jwt.Keyfunc that tries each of the given jwt.Keyfunc in order and returns the first key found. For
+// example, keys given at startup can be tried before keys from a remote JWK Set. If every jwt.Keyfunc fails, the
+// returned error wraps ErrKeyfunc and the errors of all jwt.Keyfunc in order, so errors.Is and errors.As work on any of
+// them.
+func Chain(keyfuncs ...jwt.Keyfunc) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		errs := make([]error, 0, len(keyfuncs))
+		for _, keyF := range keyfuncs {
+			key, err := keyF(token)
+			if err == nil {
+				return key, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, fmt.Errorf("%w: no chained keyfunc found a key", errors.Join(append([]error{ErrKeyfunc}, errs...)...))
+	}
+}
+
+// Fallback creates a jwt.Keyfunc that tries primary, then fallback if primary fails. It is the same as Chain with two
+// jwt.Keyfunc.
+func Fallback(primary, fallback jwt.Keyfunc) jwt.Keyfunc {
+	return Chain(primary, fallback)
+}
+
+// RaceChild is a Keyfunc queried by Race.
+type RaceChild struct {
+	Keyfunc Keyfunc
+	// Timeout bounds the key lookup of this child. If zero, only the context given to Race bounds it.
+	Timeout time.Duration
+}
+
+// Race creates a jwt.Keyfunc that queries all children concurrently and returns the first key found. The lookups of
+// the other children are then cancelled. This is useful for latency-sensitive applications with several independent
+// key sources. The given context bounds the lookups of every child and defaults to context.Background() if nil. If every
+// child fails, the returned error wraps ErrKeyfunc and the errors of all children in order.
+func Race(ctx context.Context, children ...RaceChild) jwt.Keyfunc {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return func(token *jwt.Token) (any, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		type result struct {
+			err   error
+			index int
+			key   any
+		}
+		results := make(chan result, len(children))
+		for i, child := range children {
+			go func(i int, child RaceChild) {
+				childCtx := ctx
+				if child.Timeout > 0 {
+					var childCancel context.CancelFunc
+					childCtx, childCancel = context.WithTimeout(ctx, child.Timeout)
+					defer childCancel()
+				}
+				key, err := child.Keyfunc.KeyfuncCtx(childCtx)(token)
+				results <- result{err: err, index: i, key: key}
+			}(i, child)
+		}
+		errs := make([]error, len(children))
+		for range children {
+			r := <-results
+			if r.err == nil {
+				return r.key, nil
+			}
+			errs[r.index] = r.err
+		}
+		return nil, fmt.Errorf("%w: no raced keyfunc found a key", errors.Join(append([]error{ErrKeyfunc}, errs...)...))
+	}
+}
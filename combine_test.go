@@ -0,0 +1,83 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	primaryStore := jwkset.NewMemoryStorage()
+	primaryPriv := writeEdDSAKey(ctx, t, primaryStore, keyID)
+	fallbackStore := jwkset.NewMemoryStorage()
+	const fallbackKID = "fallback-key-id"
+	fallbackPriv := writeEdDSAKey(ctx, t, fallbackStore, fallbackKID)
+
+	primary, err := New(Options{Storage: primaryStore})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	fallback, err := New(Options{Storage: fallbackStore})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	keyF := Fallback(primary.Keyfunc, fallback.Keyfunc)
+
+	_, err = jwt.Parse(signEdDSA(t, primaryPriv, keyID), keyF)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by primary key. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, fallbackPriv, fallbackKID), keyF)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by fallback key. Error: %s", err)
+	}
+
+	errCustom := errors.New("custom")
+	keyF = Chain(primary.Keyfunc, func(*jwt.Token) (any, error) {
+		return nil, errCustom
+	})
+	_, err = jwt.Parse(signEdDSA(t, fallbackPriv, fallbackKID), keyF)
+	if !errors.Is(err, ErrKeyfunc) || !errors.Is(err, jwkset.ErrKeyNotFound) || !errors.Is(err, errCustom) {
+		t.Fatalf("Expected errors from all chained keyfuncs, but got %s.", err)
+	}
+}
+
+func TestRace(t *testing.T) {
+	ctx := context.Background()
+	fastStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, fastStore, keyID)
+	slowStore := &blockingStorage{Storage: jwkset.NewMemoryStorage()}
+
+	fast, err := New(Options{Storage: fastStore})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	slow, err := New(Options{Storage: slowStore})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	keyF := Race(ctx, RaceChild{Keyfunc: slow}, RaceChild{Keyfunc: fast})
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), keyF)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with the fast child. Error: %s", err)
+	}
+
+	keyF = Race(ctx, RaceChild{Keyfunc: slow, Timeout: 10 * time.Millisecond})
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), keyF)
+	if !errors.Is(err, ErrKeyfunc) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected ErrKeyfunc and context.DeadlineExceeded from the child timeout, but got %s.", err)
+	}
+
+	var nilCtx context.Context
+	keyF = Race(nilCtx, RaceChild{Keyfunc: fast})
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), keyF)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with a nil context. Error: %s", err)
+	}
+}
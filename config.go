@@ -0,0 +1,373 @@
+package keyfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+// Config describes a Keyfunc so deployments can change key sources and policies without recompiling. It is encoded as
+// JSON. To use YAML, convert it to JSON first, such as with sigs.k8s.io/yaml.
+type Config struct {
+	// AlgWhitelist is the AlgWhitelist option.
+	AlgWhitelist []jwkset.ALG `json:"algWhitelist,omitempty"`
+	// Given are keys loaded from PEM files in addition to the keys from URLs.
+	Given []GivenKeyConfig `json:"given,omitempty"`
+	// KIDCollisionPolicy is the KIDCollisionPolicy option.
+	KIDCollisionPolicy KIDCollisionPolicy `json:"kidCollisionPolicy,omitempty"`
+	// KeyIDHeaders is the KeyIDHeaders option.
+	KeyIDHeaders []string `json:"keyIDHeaders,omitempty"`
+	// LookupTimeout is the LookupTimeout option.
+	LookupTimeout Duration `json:"lookupTimeout,omitempty"`
+	// NoRefreshUnknownKID prevents all remote HTTP resources from being refreshed when a key with an unknown key ID is
+	// trying to be read.
+	NoRefreshUnknownKID bool `json:"noRefreshUnknownKID,omitempty"`
+	// PrioritizeHTTP prioritizes keys from URLs over given keys with the same key ID.
+	PrioritizeHTTP bool `json:"prioritizeHTTP,omitempty"`
+	// RateLimitWaitMax is the maximum time to wait for the rate limit of refreshes for unknown key IDs.
+	//
+	// This defaults to one minute.
+	RateLimitWaitMax Duration `json:"rateLimitWaitMax,omitempty"`
+	// RefreshUnknownKIDInterval is the minimum time between refreshes for unknown key IDs.
+	//
+	// This defaults to five minutes.
+	RefreshUnknownKIDInterval Duration `json:"refreshUnknownKIDInterval,omitempty"`
+	// StorageErrorPolicy is the StorageErrorPolicy option.
+	StorageErrorPolicy StorageErrorPolicy `json:"storageErrorPolicy,omitempty"`
+	// URLs are the remote JWK Sets.
+	URLs []URLConfig `json:"urls,omitempty"`
+	// UseWhitelist is the UseWhitelist option.
+	UseWhitelist []jwkset.USE `json:"useWhitelist,omitempty"`
+}
+
+// GivenKeyConfig describes a key loaded from a PEM file. The file may contain a public key, a private key, or an X.509
+// certificate chain. Only the first PEM block is used for keys.
+type GivenKeyConfig struct {
+	ALG     jwkset.ALG `json:"alg,omitempty"`
+	KID     string     `json:"kid"`
+	PEMPath string     `json:"pemPath"`
+	USE     jwkset.USE `json:"use,omitempty"`
+}
+
+// URLConfig describes a remote JWK Set. Unset fields have the same defaults as URLOptions.
+type URLConfig struct {
+	URL                 string   `json:"url"`
+	HTTPTimeout         Duration `json:"httpTimeout,omitempty"`
+	NoRefreshUnknownKID bool     `json:"noRefreshUnknownKID,omitempty"`
+	PinnedKIDs          []string `json:"pinnedKIDs,omitempty"`
+	PinnedThumbprints   []string `json:"pinnedThumbprints,omitempty"`
+	RefreshInterval     Duration `json:"refreshInterval,omitempty"`
+}
+
+// Duration is a time.Duration that is encoded in JSON as a string accepted by time.ParseDuration, such as "5m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	err := json.Unmarshal(raw, &s)
+	if err != nil {
+		return fmt.Errorf("%w: duration must be a string", errors.Join(err, ErrKeyfunc))
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%w: could not parse duration %q", errors.Join(err, ErrKeyfunc), s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfig reads a JSON encoded Config from a file. Unknown fields are rejected so typos are not silently ignored.
+func LoadConfig(path string) (Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: could not read config file", errors.Join(err, ErrKeyfunc))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	var config Config
+	err = decoder.Decode(&config)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: could not decode config file %q", errors.Join(err, ErrKeyfunc), path)
+	}
+	return config, nil
+}
+
+// ConfigKeyfunc is a Keyfunc created from a Config that can be reconfigured at runtime.
+type ConfigKeyfunc interface {
+	Keyfunc
+	// AddURL starts using a remote JWK Set like the AddURL method of KeyManager. The next Update removes it unless the
+	// Config has it. If the Config has it, it keeps the options it was added with until an Update changes its URLConfig.
+	AddURL(u string, options URLOptions) error
+	// RemoveURL stops using a remote JWK Set like the RemoveURL method of KeyManager, including one from the Config until
+	// the next Update.
+	RemoveURL(u string) bool
+	// Update swaps the effective configuration. Remote HTTP resources that are new are fetched, removed ones stop being
+	// refreshed, and unchanged ones keep their cached keys. URLs added with AddURL are removed unless the Config has
+	// them. JWTs being verified during the update use the previous configuration. If an error is returned, the previous
+	// configuration remains in effect.
+	Update(config Config) error
+}
+
+type configSource struct {
+	// added is true for a source added with AddURL until an Update has its URL.
+	added  bool
+	cancel context.CancelFunc
+	config URLConfig
+	store  jwkset.Storage
+}
+
+type configKeyfunc struct {
+	ctx     context.Context
+	current atomic.Pointer[keyfunc]
+	mux     sync.Mutex
+	sources map[string]configSource
+}
+
+// NewConfigCtx creates a new ConfigKeyfunc from a Config. The context is used to end the "refresh goroutine" of each
+// remote HTTP resource.
+func NewConfigCtx(ctx context.Context, config Config) (ConfigKeyfunc, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := &configKeyfunc{
+		ctx:     ctx,
+		sources: make(map[string]configSource),
+	}
+	err := c.Update(config)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *configKeyfunc) Keyfunc(token *jwt.Token) (any, error) {
+	return c.current.Load().Keyfunc(token)
+}
+func (c *configKeyfunc) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		return c.current.Load().KeyfuncCtx(ctx)(token)
+	}
+}
+func (c *configKeyfunc) AddURL(u string, options URLOptions) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.sources[u]; ok {
+		return fmt.Errorf("%w: HTTP URL %q is already in use", ErrKeyfunc, redact(u))
+	}
+	store, err := c.current.Load().addURL(u, options)
+	if err != nil {
+		return err
+	}
+	c.sources[u] = configSource{
+		added: true,
+		cancel: func() {
+			stopStorage(store)
+		},
+		store: store,
+	}
+	return nil
+}
+func (c *configKeyfunc) RemoveURL(u string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	source, ok := c.sources[u]
+	if !ok {
+		return false
+	}
+	c.current.Load().RemoveURL(u)
+	source.cancel()
+	delete(c.sources, u)
+	return true
+}
+func (c *configKeyfunc) Storage() jwkset.Storage {
+	return c.current.Load().Storage()
+}
+func (c *configKeyfunc) Update(config Config) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	given := jwkset.NewMemoryStorage()
+	for _, g := range config.Given {
+		jwk, err := g.load()
+		if err != nil {
+			return err
+		}
+		err = given.KeyWrite(c.ctx, jwk)
+		if err != nil {
+			return fmt.Errorf("%w: could not write given key %q to storage", errors.Join(err, ErrKeyfunc), g.KID)
+		}
+	}
+
+	sources := make(map[string]configSource, len(config.URLs))
+	var created []configSource
+	stop := func(s []configSource) {
+		for _, source := range s {
+			source.cancel()
+		}
+	}
+	for _, u := range config.URLs {
+		if _, ok := sources[u.URL]; ok {
+			stop(created)
+			return fmt.Errorf("%w: duplicate URL %q in config", ErrKeyfunc, redact(u.URL))
+		}
+		old, ok := c.sources[u.URL]
+		if ok && (old.added || old.config.equal(u)) {
+			old.added = false
+			old.config = u
+			sources[u.URL] = old
+			continue
+		}
+		source, err := c.newSource(u, old.store)
+		if err != nil {
+			stop(created)
+			return err
+		}
+		created = append(created, source)
+		sources[u.URL] = source
+	}
+	httpURLs := make(map[string]jwkset.Storage, len(sources))
+	for u, source := range sources {
+		httpURLs[u] = source.store
+	}
+
+	clientOptions := HTTPClientOptions{
+		Given:            given,
+		HTTPURLs:         httpURLs,
+		PrioritizeHTTP:   config.PrioritizeHTTP,
+		RateLimitWaitMax: time.Duration(config.RateLimitWaitMax),
+	}
+	if clientOptions.RateLimitWaitMax == 0 {
+		clientOptions.RateLimitWaitMax = time.Minute
+	}
+	if !config.NoRefreshUnknownKID {
+		interval := time.Duration(config.RefreshUnknownKIDInterval)
+		if interval == 0 {
+			interval = 5 * time.Minute
+		}
+		clientOptions.RefreshUnknownKID = rate.NewLimiter(rate.Every(interval), 1)
+	}
+	client, err := NewHTTPClient(clientOptions)
+	if err != nil {
+		stop(created)
+		return err
+	}
+
+	options := Options{
+		Ctx:                c.ctx,
+		Storage:            client,
+		AlgWhitelist:       config.AlgWhitelist,
+		KIDCollisionPolicy: config.KIDCollisionPolicy,
+		KeyIDHeaders:       config.KeyIDHeaders,
+		LookupTimeout:      time.Duration(config.LookupTimeout),
+		StorageErrorPolicy: config.StorageErrorPolicy,
+		UseWhitelist:       config.UseWhitelist,
+	}
+	k, err := New(options)
+	if err != nil {
+		stop(created)
+		return err
+	}
+	kf := k.(keyfunc)
+	c.current.Store(&kf)
+
+	for u, old := range c.sources {
+		if source, ok := sources[u]; !ok || source.store != old.store {
+			old.cancel()
+		}
+	}
+	c.sources = sources
+	return nil
+}
+
+// newSource creates the storage for a remote HTTP resource. If the first refresh fails, the keys from the previous
+// storage for the same URL are kept.
+func (c *configKeyfunc) newSource(u URLConfig, previous jwkset.Storage) (configSource, error) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	urlOptions := URLOptions{
+		HTTPTimeout:         time.Duration(u.HTTPTimeout),
+		NoRefreshUnknownKID: u.NoRefreshUnknownKID,
+		PinnedKIDs:          u.PinnedKIDs,
+		PinnedThumbprints:   u.PinnedThumbprints,
+		RefreshInterval:     time.Duration(u.RefreshInterval),
+	}
+	stores, err := newDefaultHTTPStorages(ctx, map[string]URLOptions{u.URL: urlOptions})
+	if err != nil {
+		cancel()
+		return configSource{}, err
+	}
+	store := stores[u.URL]
+	if s, ok := store.(*httpStorage); ok && s.Status().LastSuccess.IsZero() {
+		if p, ok := previous.(*httpStorage); ok {
+			s.replace(p.keys())
+		}
+	}
+	return configSource{
+		cancel: func() {
+			cancel()
+			stopStorage(store)
+		},
+		config: u,
+		store:  store,
+	}, nil
+}
+
+func (u URLConfig) equal(other URLConfig) bool {
+	return u.URL == other.URL &&
+		u.HTTPTimeout == other.HTTPTimeout &&
+		u.NoRefreshUnknownKID == other.NoRefreshUnknownKID &&
+		slices.Equal(u.PinnedKIDs, other.PinnedKIDs) &&
+		slices.Equal(u.PinnedThumbprints, other.PinnedThumbprints) &&
+		u.RefreshInterval == other.RefreshInterval
+}
+
+func (g GivenKeyConfig) load() (jwkset.JWK, error) {
+	raw, err := os.ReadFile(g.PEMPath)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not read PEM file for given key %q", errors.Join(err, ErrKeyfunc), g.KID)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: no PEM block found for given key %q", ErrKeyfunc, g.KID)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: g.ALG,
+			KID: g.KID,
+			USE: g.USE,
+		},
+	}
+	var key any
+	if block.Type == "CERTIFICATE" {
+		certs, err := jwkset.LoadCertificates(raw)
+		if err != nil {
+			return jwkset.JWK{}, fmt.Errorf("%w: could not load certificates for given key %q", errors.Join(err, ErrKeyfunc), g.KID)
+		}
+		key = certs[0].PublicKey
+		jwkOptions.X509.X5C = certs
+	} else {
+		key, err = jwkset.LoadX509KeyInfer(block)
+		if err != nil {
+			return jwkset.JWK{}, fmt.Errorf("%w: could not load key for given key %q", errors.Join(err, ErrKeyfunc), g.KID)
+		}
+	}
+	jwk, err := jwkset.NewJWKFromKey(key, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not create JWK for given key %q", errors.Join(err, ErrKeyfunc), g.KID)
+	}
+	return jwk, nil
+}
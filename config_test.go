@@ -0,0 +1,244 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewConfigCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	remotePriv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	dir := t.TempDir()
+	_, givenPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(givenPriv)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key. Error: %s", err)
+	}
+	pemPath := filepath.Join(dir, "given.pem")
+	err = os.WriteFile(pemPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write PEM file. Error: %s", err)
+	}
+
+	const givenKID = "given-key-id"
+	config := Config{
+		Given: []GivenKeyConfig{
+			{KID: givenKID, PEMPath: pemPath},
+		},
+		LookupTimeout: Duration(time.Second),
+		URLs: []URLConfig{
+			{URL: server.URL, PinnedKIDs: []string{keyID}, RefreshInterval: Duration(time.Hour)},
+		},
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("Failed to marshal config. Error: %s", err)
+	}
+	configPath := filepath.Join(dir, "config.json")
+	err = os.WriteFile(configPath, raw, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write config file. Error: %s", err)
+	}
+
+	loaded, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config. Error: %s", err)
+	}
+	if loaded.URLs[0].RefreshInterval != Duration(time.Hour) {
+		t.Fatalf("Expected refresh interval %s, but got %s.", time.Hour, time.Duration(loaded.URLs[0].RefreshInterval))
+	}
+	k, err := NewConfigCtx(ctx, loaded)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from config. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, remotePriv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by remote key. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, givenPriv, givenKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by given key. Error: %s", err)
+	}
+
+	err = os.WriteFile(configPath, []byte(`{"url":"typo"}`), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write config file. Error: %s", err)
+	}
+	_, err = LoadConfig(configPath)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for unknown field, but got %s.", err)
+	}
+}
+
+func TestConfigUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	firstStore := jwkset.NewMemoryStorage()
+	firstPriv := writeEdDSAKey(ctx, t, firstStore, keyID)
+	first := newJWKSServer(ctx, t, firstStore)
+	defer first.Close()
+	const secondKID = "second-key-id"
+	secondStore := jwkset.NewMemoryStorage()
+	secondPriv := writeEdDSAKey(ctx, t, secondStore, secondKID)
+	second := newJWKSServer(ctx, t, secondStore)
+	defer second.Close()
+
+	config := Config{
+		NoRefreshUnknownKID: true,
+		URLs:                []URLConfig{{URL: first.URL}},
+	}
+	k, err := NewConfigCtx(ctx, config)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from config. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, firstPriv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by first key. Error: %s", err)
+	}
+
+	config.URLs = []URLConfig{{URL: second.URL}}
+	err = k.Update(config)
+	if err != nil {
+		t.Fatalf("Failed to update config. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, firstPriv, keyID), k.Keyfunc)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound after removing URL, but got %s.", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by second key. Error: %s", err)
+	}
+	before := k.Storage().(HTTPClient).HTTPStorages()[second.URL]
+
+	config.UseWhitelist = []jwkset.USE{jwkset.UseSig}
+	err = k.Update(config)
+	if err != nil {
+		t.Fatalf("Failed to update config. Error: %s", err)
+	}
+	if k.Storage().(HTTPClient).HTTPStorages()[second.URL] != before {
+		t.Fatalf("Expected storage for unchanged URL to be reused.")
+	}
+
+	// Keys are kept when the storage for a changed URL cannot be refreshed.
+	second.Close()
+	config.URLs[0].RefreshInterval = Duration(time.Hour)
+	err = k.Update(config)
+	if err != nil {
+		t.Fatalf("Failed to update config. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) || errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected ErrKeyfunc from use whitelist with cached key, but got %s.", err)
+	}
+
+	config.URLs = append(config.URLs, config.URLs[0])
+	err = k.Update(config)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for duplicate URL, but got %s.", err)
+	}
+}
+
+func TestConfigAddURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := newJWKSServer(ctx, t, jwkset.NewMemoryStorage())
+	defer first.Close()
+	const secondKID = "second-key-id"
+	secondStore := jwkset.NewMemoryStorage()
+	secondPriv := writeEdDSAKey(ctx, t, secondStore, secondKID)
+	second := newJWKSServer(ctx, t, secondStore)
+	defer second.Close()
+
+	k, err := NewConfigCtx(nil, Config{URLs: []URLConfig{{URL: first.URL}}})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from config with a nil context. Error: %s", err)
+	}
+	err = k.AddURL(second.URL, URLOptions{RefreshInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to add URL. Error: %s", err)
+	}
+	added := k.Storage().(HTTPClient).HTTPStorages()[second.URL]
+
+	err = k.Update(Config{URLs: []URLConfig{{URL: first.URL}, {URL: second.URL}}})
+	if err != nil {
+		t.Fatalf("Failed to update config. Error: %s", err)
+	}
+	store, ok := k.Storage().(HTTPClient).HTTPStorages()[second.URL].(HTTPStorage)
+	if !ok || store != added {
+		t.Fatalf("Expected an update with the added URL to keep its HTTP storage.")
+	}
+	if interval := store.RefreshSettings().RefreshInterval; interval != time.Hour {
+		t.Fatalf("Expected the added URL to keep its refresh interval %s, got %s.", time.Hour, interval)
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by key from added URL. Error: %s", err)
+	}
+
+	err = k.Update(Config{URLs: []URLConfig{{URL: first.URL}, {URL: second.URL, RefreshInterval: Duration(time.Minute)}}})
+	if err != nil {
+		t.Fatalf("Failed to update config. Error: %s", err)
+	}
+	store = k.Storage().(HTTPClient).HTTPStorages()[second.URL].(HTTPStorage)
+	if interval := store.RefreshSettings().RefreshInterval; interval != time.Minute {
+		t.Fatalf("Expected a changed URLConfig to replace the options of the added URL, got refresh interval %s.", interval)
+	}
+}
+
+func TestConfigAddFileURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fileStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, fileStore, keyID)
+	raw, err := fileStore.JSONPublic(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set JSON. Error: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	err = os.WriteFile(path, raw, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write JWK Set file. Error: %s", err)
+	}
+
+	k, err := NewConfigCtx(ctx, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from config. Error: %s", err)
+	}
+	u := "file://" + path
+	err = k.AddURL(u, URLOptions{})
+	if err != nil {
+		t.Fatalf("Failed to add file URL. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by key from file URL. Error: %s", err)
+	}
+	if !k.RemoveURL(u) {
+		t.Fatalf("Expected the added file URL to be removed.")
+	}
+}
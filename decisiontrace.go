@@ -0,0 +1,115 @@
+package keyfunc
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DecisionStage is the kind of a step in a DecisionTrace.
+type DecisionStage string
+
+const (
+	// DecisionStageKeyID is a key ID extracted from a JWT header parameter, or normalized.
+	DecisionStageKeyID DecisionStage = "kid"
+	// DecisionStageSource is a JWK Set storage or remote JWK Set that was consulted, or refreshed, for the key ID.
+	DecisionStageSource DecisionStage = "source"
+	// DecisionStageKey is a key that was considered to verify the JWT.
+	DecisionStageKey DecisionStage = "key"
+	// DecisionStageFilter is a policy or whitelist that was applied to a key that was considered.
+	DecisionStageFilter DecisionStage = "filter"
+)
+
+// DecisionStep is a step of the decision of a Keyfunc for a JWT.
+type DecisionStep struct {
+	// Detail describes the step, such as the name of a JWT header parameter and the key ID it contains.
+	Detail string
+	// Err is the error of the step. It is nil if the step succeeded.
+	Err error
+	// Stage is the kind of the step.
+	Stage DecisionStage
+}
+
+// DecisionTrace is how a Keyfunc decided which key verifies a JWT, or why it found none, when the DecisionTrace option
+// is set. The steps are in the order they happened.
+type DecisionTrace struct {
+	// Alg is the "alg" header parameter of the JWT.
+	Alg string
+	// Err is the outcome of the decision. It is nil if a key was found.
+	Err error
+	// Steps are the steps of the decision in order.
+	Steps []DecisionStep
+}
+
+// String formats the trace with one line per step, for logs.
+func (t DecisionTrace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "alg %q", t.Alg)
+	for _, step := range t.Steps {
+		fmt.Fprintf(&b, "\n%s: %s", step.Stage, step.Detail)
+		if step.Err != nil {
+			fmt.Fprintf(&b, ": %s", step.Err)
+		}
+	}
+	if t.Err != nil {
+		fmt.Fprintf(&b, "\nrejected: %s", t.Err)
+	} else {
+		b.WriteString("\naccepted")
+	}
+	return b.String()
+}
+
+// DecisionTraceError is the error of a Keyfunc that found no key for a JWT when the DecisionTrace option is set. Use
+// errors.As to get the trace from the error returned by jwt.Parse.
+type DecisionTraceError struct {
+	Trace DecisionTrace
+}
+
+func (e *DecisionTraceError) Error() string {
+	return e.Trace.Err.Error()
+}
+func (e *DecisionTraceError) Unwrap() error {
+	return e.Trace.Err
+}
+
+type decisionTraceCtxKey struct{}
+
+// decisionRecorder collects the steps of a decision. Steps may be recorded concurrently, such as by the refreshes of
+// an HTTPClient.
+type decisionRecorder struct {
+	mux   sync.Mutex
+	steps []DecisionStep
+}
+
+// traceDecision records a step of the decision if the context is tracing one.
+func traceDecision(ctx context.Context, stage DecisionStage, err error, format string, args ...any) {
+	r, ok := ctx.Value(decisionTraceCtxKey{}).(*decisionRecorder)
+	if !ok {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.steps = append(r.steps, DecisionStep{Detail: fmt.Sprintf(format, args...), Err: err, Stage: stage})
+}
+
+// tracedLookup performs the lookup of a key for the JWT while recording a trace of the decision. The trace is given to
+// the DecisionTraceHandler option and returned with the error of a failed lookup.
+func (k keyfunc) tracedLookup(ctx context.Context, token *jwt.Token) (any, error) {
+	r := &decisionRecorder{}
+	key, err := k.lookup(context.WithValue(ctx, decisionTraceCtxKey{}, r), token)
+	alg, _ := token.Header["alg"].(string)
+	r.mux.Lock()
+	trace := DecisionTrace{Alg: alg, Err: err, Steps: slices.Clone(r.steps)}
+	r.mux.Unlock()
+	if k.decisionTraceHandler != nil {
+		k.decisionTraceHandler(ctx, trace)
+	}
+	if err != nil {
+		return nil, &DecisionTraceError{Trace: trace}
+	}
+	return key, nil
+}
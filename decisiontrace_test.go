@@ -0,0 +1,79 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDecisionTrace(t *testing.T) {
+	ctx := context.Background()
+
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	signed := signEdDSA(t, priv, keyID)
+
+	var traces []DecisionTrace
+	k, err := New(Options{
+		AlgWhitelist:  []jwkset.ALG{jwkset.AlgRS256},
+		DecisionTrace: true,
+		DecisionTraceHandler: func(ctx context.Context, trace DecisionTrace) {
+			traces = append(traces, trace)
+		},
+		Storage: store,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	var traceErr *DecisionTraceError
+	if !errors.As(err, &traceErr) || !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected a decision trace error, got %v.", err)
+	}
+	trace := traceErr.Trace
+	if trace.Alg != jwkset.AlgEdDSA.String() || trace.Err == nil {
+		t.Fatalf("Expected a rejected trace for the EdDSA JWT, got %s.", trace)
+	}
+	stages := make([]DecisionStage, 0, len(trace.Steps))
+	for _, step := range trace.Steps {
+		stages = append(stages, step.Stage)
+	}
+	expected := []DecisionStage{DecisionStageKeyID, DecisionStageSource, DecisionStageKey, DecisionStageFilter}
+	if len(stages) != len(expected) {
+		t.Fatalf("Expected stages %v, got %v.", expected, stages)
+	}
+	for i := range expected {
+		if stages[i] != expected[i] {
+			t.Fatalf("Expected stages %v, got %v.", expected, stages)
+		}
+	}
+	last := trace.Steps[len(trace.Steps)-1]
+	if last.Err == nil || !strings.Contains(trace.String(), "not in whitelist") {
+		t.Fatalf("Expected the alg whitelist to reject the key, got %s.", trace)
+	}
+	if len(traces) != 1 {
+		t.Fatalf("Expected the handler to be called once, got %d.", len(traces))
+	}
+
+	k, err = New(Options{
+		DecisionTrace: true,
+		DecisionTraceHandler: func(ctx context.Context, trace DecisionTrace) {
+			traces = append(traces, trace)
+		},
+		Storage: store,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if len(traces) != 2 || traces[1].Err != nil || !strings.HasSuffix(traces[1].String(), "accepted") {
+		t.Fatalf("Expected the handler to be called with an accepted trace.")
+	}
+}
@@ -0,0 +1,69 @@
+package keyfunc
+
+import (
+	"strings"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// keyDeduplicator shares one parsed cryptographic key between JWKs of a JWK Set with identical key material, such as
+// when a federation publishes the same RSA key under several key IDs.
+type keyDeduplicator struct {
+	seen map[string]jwkset.JWK
+}
+
+func newKeyDeduplicator() *keyDeduplicator {
+	return &keyDeduplicator{
+		seen: make(map[string]jwkset.JWK),
+	}
+}
+
+// material identifies the key material of the JWK by the members of its RFC 7638 thumbprint and its "x5c" certificate
+// chain. JWKs with private key material other than a symmetric key are never deduplicated.
+func (d *keyDeduplicator) material(marshal jwkset.JWKMarshal) (string, bool) {
+	if marshal.D != "" || marshal.P != "" || marshal.Q != "" || marshal.DP != "" || marshal.DQ != "" || marshal.QI != "" || len(marshal.OTH) != 0 {
+		return "", false
+	}
+	return strings.Join([]string{
+		string(marshal.KTY),
+		string(marshal.CRV),
+		marshal.E,
+		marshal.K,
+		marshal.N,
+		marshal.X,
+		marshal.Y,
+		strings.Join(marshal.X5C, "."),
+	}, "|"), true
+}
+
+// parse creates a JWK like jwkset.NewJWKFromMarshal, but reuses the cryptographic key and certificate chain of a JWK
+// previously parsed with identical key material.
+func (d *keyDeduplicator) parse(marshal jwkset.JWKMarshal, marshalOptions jwkset.JWKMarshalOptions, validate jwkset.JWKValidateOptions) (jwkset.JWK, error) {
+	material, ok := d.material(marshal)
+	if !ok {
+		return jwkset.NewJWKFromMarshal(marshal, marshalOptions, validate)
+	}
+	if prev, ok := d.seen[material]; ok {
+		options := jwkset.JWKOptions{
+			Marshal: marshalOptions,
+			Metadata: jwkset.JWKMetadataOptions{
+				ALG:    marshal.ALG,
+				KID:    marshal.KID,
+				KEYOPS: marshal.KEYOPS,
+				USE:    marshal.USE,
+			},
+			Validate: validate,
+			X509: jwkset.JWKX509Options{
+				X5C: prev.X509().X5C,
+				X5U: marshal.X5U,
+			},
+		}
+		return jwkset.NewJWKFromKey(prev.Key(), options)
+	}
+	jwk, err := jwkset.NewJWKFromMarshal(marshal, marshalOptions, validate)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	d.seen[material] = jwk
+	return jwk, nil
+}
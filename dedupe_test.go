@@ -0,0 +1,88 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDeduplicateKeys(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key. Error: %s", err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	newJWK := func(key any, kid string, alg jwkset.ALG) json.RawMessage {
+		jwk, err := jwkset.NewJWKFromKey(key, jwkset.JWKOptions{Metadata: jwkset.JWKMetadataOptions{ALG: alg, KID: kid, USE: jwkset.UseSig}})
+		if err != nil {
+			t.Fatalf("Failed to create JWK. Error: %s", err)
+		}
+		raw, err := json.Marshal(jwk.Marshal())
+		if err != nil {
+			t.Fatalf("Failed to marshal JWK. Error: %s", err)
+		}
+		return raw
+	}
+	raw := jwksJSON(t,
+		newJWK(&rsaPriv.PublicKey, "rsa-1", jwkset.AlgRS256),
+		newJWK(&rsaPriv.PublicKey, "rsa-2", jwkset.AlgRS256),
+		newJWK(&rsaPriv.PublicKey, "rsa-3", ""),
+		newJWK(&ecPriv.PublicKey, "ec", jwkset.AlgES256),
+	)
+
+	for _, dedupe := range []bool{false, true} {
+		k, err := NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{DeduplicateKeys: dedupe})
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+		}
+		keys := make(map[string]any)
+		for _, kid := range []string{"rsa-1", "rsa-2", "rsa-3", "ec"} {
+			jwk, err := k.(KeyManager).KeyByKID(context.Background(), kid)
+			if err != nil {
+				t.Fatalf("Failed to read JWK %q. Error: %s", kid, err)
+			}
+			if jwk.Marshal().KID != kid {
+				t.Fatalf("Expected key ID %q, got %q.", kid, jwk.Marshal().KID)
+			}
+			keys[kid] = jwk.Key()
+
+			signed := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{})
+			var signKey any = rsaPriv
+			if kid == "ec" {
+				signed = jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{})
+				signKey = ecPriv
+			}
+			signed.Header["kid"] = kid
+			token, err := signed.SignedString(signKey)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			_, err = jwt.Parse(token, k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT signed with %q. Error: %s", kid, err)
+			}
+		}
+
+		shared := keys["rsa-1"].(*rsa.PublicKey) == keys["rsa-2"].(*rsa.PublicKey) && keys["rsa-1"].(*rsa.PublicKey) == keys["rsa-3"].(*rsa.PublicKey)
+		if shared != dedupe {
+			t.Fatalf("Expected the RSA key to be shared %t, but it was %t.", dedupe, shared)
+		}
+		all, err := k.(KeyManager).Snapshot(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to read snapshot. Error: %s", err)
+		}
+		if len(all) != 4 {
+			t.Fatalf("Expected 4 JWKs, got %d.", len(all))
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrDIDWeb is returned when a did:web identifier cannot be resolved or is not allowed.
+	ErrDIDWeb = errors.New("failed did:web resolution")
+)
+
+const didWebPrefix = "did:web:"
+
+// DIDWebOptions configure NewDIDWeb.
+type DIDWebOptions struct {
+	// AllowedDIDs are the did:web identifiers whose keys are trusted. Anyone can host a DID document, so JWTs for other
+	// identifiers are rejected without resolving them. It must not be empty.
+	AllowedDIDs []string
+	// Ctx ends the refresh goroutines of every DID document when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// HTTPStorageOptions configure the storage of each DID document. The Ctx and ResponseDecoder options are not used.
+	//
+	// The RefreshInterval defaults to one hour.
+	HTTPStorageOptions HTTPStorageOptions
+	// NewDIDRateLimit limits how often the DID document of a DID that is not cached is fetched, including retries of DID
+	// documents that failed to resolve. JWTs for DIDs over the limit are rejected without a request.
+	//
+	// This defaults to 10 new DIDs per minute with a burst of 10.
+	NewDIDRateLimit *rate.Limiter
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of a DID document caused by JWTs with an unknown
+	// key ID.
+	//
+	// This defaults to five minutes.
+	UnknownKIDRefreshInterval time.Duration
+}
+
+// DIDWeb resolves the keys for JWTs from did:web identifiers. The DID is read from the "kid" header if it is a DID URL,
+// such as "did:web:example.com#key-1", or from the "iss" claim otherwise. The DID document is fetched the first time
+// a JWT for the DID is seen and is cached and refreshed like any other remote JWK Set. The "publicKeyJwk" of each
+// verification method is used as a key, with the fragment of the verification method's DID URL as its key ID.
+type DIDWeb interface {
+	// Keyfunc resolves the key for the JWT with the context given at creation.
+	Keyfunc(token *jwt.Token) (any, error)
+	// KeyfuncCtx returns a jwt.Keyfunc that resolves the key for the JWT with the given context.
+	KeyfuncCtx(ctx context.Context) jwt.Keyfunc
+}
+
+type didWeb struct {
+	allowed []string
+	cache   *keyfuncCache
+	ctx     context.Context
+	options DIDWebOptions
+}
+
+// NewDIDWeb creates a new DIDWeb for the allowed did:web identifiers.
+func NewDIDWeb(options DIDWebOptions) (DIDWeb, error) {
+	if len(options.AllowedDIDs) == 0 {
+		return nil, fmt.Errorf("%w: at least one allowed DID is required", ErrDIDWeb)
+	}
+	for _, did := range options.AllowedDIDs {
+		_, err := didWebURL(did)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.HTTPStorageOptions.RefreshInterval == 0 {
+		options.HTTPStorageOptions.RefreshInterval = time.Hour
+	}
+	if options.NewDIDRateLimit == nil {
+		options.NewDIDRateLimit = rate.NewLimiter(rate.Every(6*time.Second), 10)
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = 5 * time.Minute
+	}
+	return &didWeb{
+		allowed: slices.Clone(options.AllowedDIDs),
+		cache:   newKeyfuncCache(options.Ctx, 0, options.NewDIDRateLimit),
+		ctx:     options.Ctx,
+		options: options,
+	}, nil
+}
+
+func (d *didWeb) Keyfunc(token *jwt.Token) (any, error) {
+	return d.KeyfuncCtx(d.ctx)(token)
+}
+func (d *didWeb) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		did, err := didWebTokenDID(token)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(d.allowed, did) {
+			return nil, fmt.Errorf("%w: DID %q is not allowed", ErrDIDWeb, did)
+		}
+		k, err := d.cache.get(ctx, did, func(ctx context.Context) (Keyfunc, error) {
+			return d.keyfunc(ctx, did)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: no Keyfunc for DID %q", errors.Join(err, ErrDIDWeb), did)
+		}
+		return k.KeyfuncCtx(ctx)(token)
+	}
+}
+
+// keyfunc creates the Keyfunc for the DID document of the DID. The context ends the refresh goroutine of the DID
+// document.
+func (d *didWeb) keyfunc(ctx context.Context, did string) (Keyfunc, error) {
+	u, err := didWebURL(did)
+	if err != nil {
+		return nil, err
+	}
+	storageOptions := d.options.HTTPStorageOptions
+	storageOptions.Ctx = ctx
+	store, err := newHTTPStorage(u, storageOptions, didDocumentDecoder(did))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to fetch DID document for %q", errors.Join(err, ErrDIDWeb), did)
+	}
+	clientOptions := HTTPClientOptions{
+		HTTPURLs:          map[string]jwkset.Storage{u: store},
+		RateLimitWaitMax:  d.options.UnknownKIDRefreshInterval,
+		RefreshUnknownKID: rate.NewLimiter(rate.Every(d.options.UnknownKIDRefreshInterval), 1),
+	}
+	client, err := NewHTTPClient(clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	return New(Options{
+		Ctx:           ctx,
+		Storage:       client,
+		KIDNormalizer: didURLFragment,
+	})
+}
+
+// didWebTokenDID reads the DID of the JWT from its "kid" header or "iss" claim. If both are DIDs, they must match.
+func didWebTokenDID(token *jwt.Token) (string, error) {
+	var kidDID, issDID string
+	if kid, ok := token.Header[jwkset.HeaderKID].(string); ok && strings.HasPrefix(kid, didWebPrefix) {
+		kidDID, _, _ = strings.Cut(kid, "#")
+	}
+	if token.Claims != nil {
+		if iss, err := token.Claims.GetIssuer(); err == nil && strings.HasPrefix(iss, didWebPrefix) {
+			issDID = iss
+		}
+	}
+	switch {
+	case kidDID != "" && issDID != "" && kidDID != issDID:
+		return "", fmt.Errorf(`%w: "kid" header DID %q does not match "iss" claim DID %q`, ErrDIDWeb, kidDID, issDID)
+	case kidDID != "":
+		return kidDID, nil
+	case issDID != "":
+		return issDID, nil
+	}
+	return "", fmt.Errorf(`%w: JWT has no did:web identifier in its "kid" header or "iss" claim`, ErrDIDWeb)
+}
+
+// didURLFragment is the KIDNormalizer for keys from a single DID document. The DID URL "did:web:example.com#key-1",
+// the relative DID URL "#key-1", and "key-1" all become "key-1".
+func didURLFragment(kid string) string {
+	if _, fragment, ok := strings.Cut(kid, "#"); ok {
+		return fragment
+	}
+	return kid
+}
+
+// didWebURL returns the URL of the DID document for a did:web identifier, as described by the did:web method
+// specification.
+func didWebURL(did string) (string, error) {
+	id, ok := strings.CutPrefix(did, didWebPrefix)
+	if !ok || id == "" || strings.ContainsAny(id, "/?#") {
+		return "", fmt.Errorf("%w: %q is not a did:web identifier", ErrDIDWeb, did)
+	}
+	segments := strings.Split(id, ":")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil || unescaped == "" {
+			return "", fmt.Errorf("%w: %q is not a did:web identifier", errors.Join(err, ErrDIDWeb), did)
+		}
+		segments[i] = unescaped
+	}
+	path := "/.well-known"
+	if len(segments) > 1 {
+		path = "/" + strings.Join(segments[1:], "/")
+	}
+	u := url.URL{
+		Scheme: "https",
+		Host:   segments[0],
+		Path:   path + "/did.json",
+	}
+	return u.String(), nil
+}
+
+// didDocumentDecoder converts the DID document of the DID to a JWK Set of the "publicKeyJwk" of each verification
+// method. The key IDs are the fragments of the verification method IDs, so they are found without a refresh when the
+// JWT key ID is normalized by didURLFragment. Verification methods with other key formats are skipped.
+func didDocumentDecoder(did string) responseDecoder {
+	return func(body []byte) (json.RawMessage, time.Duration, error) {
+		var document struct {
+			ID                 string `json:"id"`
+			VerificationMethod []struct {
+				ID           string         `json:"id"`
+				PublicKeyJWK map[string]any `json:"publicKeyJwk"`
+			} `json:"verificationMethod"`
+		}
+		err := json.Unmarshal(body, &document)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: could not unmarshal DID document", errors.Join(err, ErrDIDWeb))
+		}
+		if document.ID != did {
+			return nil, 0, fmt.Errorf("%w: DID document is for %q, not %q", ErrDIDWeb, document.ID, did)
+		}
+		keys := make([]map[string]any, 0, len(document.VerificationMethod))
+		for _, method := range document.VerificationMethod {
+			if method.PublicKeyJWK == nil {
+				continue
+			}
+			method.PublicKeyJWK["kid"] = didURLFragment(method.ID)
+			keys = append(keys, method.PublicKeyJWK)
+		}
+		raw, err := json.Marshal(map[string]any{"keys": keys})
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: could not marshal JWK Set", errors.Join(err, ErrDIDWeb))
+		}
+		return raw, 0, nil
+	}
+}
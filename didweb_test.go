@@ -0,0 +1,195 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDIDWeb(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rawJWK, priv := expiringJWK(t, "ignored", nil)
+	var did string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/did.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		document := map[string]any{
+			"@context": []string{"https://www.w3.org/ns/did/v1"},
+			"id":       did,
+			"verificationMethod": []map[string]any{
+				{"id": "#key-1", "type": "JsonWebKey2020", "controller": did, "publicKeyJwk": json.RawMessage(rawJWK)},
+				{"id": did + "#key-2", "type": "Ed25519VerificationKey2020", "controller": did, "publicKeyMultibase": "z6Mk"},
+			},
+		}
+		_ = json.NewEncoder(w).Encode(document)
+	}))
+	defer server.Close()
+	did = "did:web:" + strings.ReplaceAll(strings.TrimPrefix(server.URL, "https://"), ":", "%3A")
+
+	options := DIDWebOptions{
+		AllowedDIDs: []string{did},
+		Ctx:         ctx,
+		HTTPStorageOptions: HTTPStorageOptions{
+			Client: server.Client(),
+		},
+	}
+	d, err := NewDIDWeb(options)
+	if err != nil {
+		t.Fatalf("Failed to create DIDWeb. Error: %s", err)
+	}
+
+	tc := []struct {
+		name string
+		kid  string
+		iss  string
+		err  error
+	}{
+		{name: "DIDURL", kid: did + "#key-1"},
+		{name: "Issuer", kid: "#key-1", iss: did},
+		{name: "Fragment", kid: "key-1", iss: did},
+		{name: "Mismatch", kid: did + "#key-1", iss: "did:web:example.com", err: ErrDIDWeb},
+		{name: "NotAllowed", kid: "did:web:example.com#key-1", err: ErrDIDWeb},
+		{name: "NoDID", kid: "key-1", err: ErrDIDWeb},
+		{name: "UnknownKey", kid: did + "#key-2", err: jwkset.ErrKeyNotFound},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			if c.iss != "" {
+				claims["iss"] = c.iss
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+			token.Header[jwkset.HeaderKID] = c.kid
+			signed, err := token.SignedString(priv)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			_, err = jwt.Parse(signed, d.Keyfunc)
+			if c.err == nil && err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected error to be %q. Error: %s", c.err, err)
+			}
+		})
+	}
+}
+
+func TestDIDWebURL(t *testing.T) {
+	tc := []struct {
+		did string
+		url string
+	}{
+		{did: "did:web:w3c-ccg.github.io", url: "https://w3c-ccg.github.io/.well-known/did.json"},
+		{did: "did:web:w3c-ccg.github.io:user:alice", url: "https://w3c-ccg.github.io/user/alice/did.json"},
+		{did: "did:web:example.com%3A3000:user:alice", url: "https://example.com:3000/user/alice/did.json"},
+		{did: "did:web:"},
+		{did: "did:key:z6Mk"},
+		{did: "did:web:example.com::alice"},
+	}
+	for _, c := range tc {
+		t.Run(c.did, func(t *testing.T) {
+			u, err := didWebURL(c.did)
+			if c.url == "" {
+				if !errors.Is(err, ErrDIDWeb) {
+					t.Fatalf("Expected error to be ErrDIDWeb. Error: %s", err)
+				}
+				return
+			}
+			if err != nil || u != c.url {
+				t.Fatalf("Expected %q, got %q. Error: %v", c.url, u, err)
+			}
+		})
+	}
+}
+
+func TestDIDWebResolution(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rawJWK, priv := expiringJWK(t, "ignored", nil)
+	var host string
+	var failed atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow/did.json":
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/failed/did.json":
+			failed.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/fast/did.json":
+			did := "did:web:" + host + ":fast"
+			document := map[string]any{
+				"id": did,
+				"verificationMethod": []map[string]any{
+					{"id": did + "#key-1", "type": "JsonWebKey2020", "controller": did, "publicKeyJwk": json.RawMessage(rawJWK)},
+				},
+			}
+			_ = json.NewEncoder(w).Encode(document)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	host = strings.ReplaceAll(strings.TrimPrefix(server.URL, "https://"), ":", "%3A")
+	slowDID, failedDID, fastDID := "did:web:"+host+":slow", "did:web:"+host+":failed", "did:web:"+host+":fast"
+
+	d, err := NewDIDWeb(DIDWebOptions{
+		AllowedDIDs: []string{slowDID, failedDID, fastDID},
+		Ctx:         ctx,
+		HTTPStorageOptions: HTTPStorageOptions{
+			Client: server.Client(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create DIDWeb. Error: %s", err)
+	}
+	sign := func(did string) string {
+		token := jwt.New(jwt.SigningMethodEdDSA)
+		token.Header[jwkset.HeaderKID] = did + "#key-1"
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		return signed
+	}
+
+	go func() {
+		_, _ = jwt.Parse(sign(slowDID), d.Keyfunc)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	_, err = jwt.Parse(sign(fastDID), d.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT for DID. Error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected a slow DID host to not block other DIDs, took %s.", elapsed)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = jwt.Parse(sign(failedDID), d.Keyfunc)
+		if !errors.Is(err, ErrDIDWeb) {
+			t.Fatalf("Expected ErrDIDWeb for a DID document that failed to resolve. Error: %v", err)
+		}
+	}
+	if n := failed.Load(); n != 1 {
+		t.Fatalf("Expected the failure to resolve the DID document to be cached, got %d requests.", n)
+	}
+}
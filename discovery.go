@@ -0,0 +1,136 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrOIDCDiscovery is returned when an OIDC discovery document cannot be used to find a JWK Set.
+	ErrOIDCDiscovery = errors.New("failed OIDC discovery")
+)
+
+// discoveryClient returns the HTTP client and timeout to use for a discovery request for the remote HTTP resource.
+func (u URLOptions) discoveryClient() (*http.Client, time.Duration) {
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := u.HTTPTimeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	return client, timeout
+}
+
+// jwksSource is where the JWK Set of an OIDC discovery document is read from.
+type jwksSource struct {
+	// issuer is the "issuer" of the discovery document.
+	issuer string
+	// url is the "jwks_uri" of the discovery document, or the URL of the discovery document itself if the JWK Set is
+	// inline.
+	url    string
+	inline bool
+}
+
+// urlOptions returns the URLOptions for the remote HTTP resource at the url of the source. For an inline JWK Set, the
+// discovery document is refreshed and its "jwks" member is decoded.
+func (s jwksSource) urlOptions(options URLOptions) URLOptions {
+	if s.inline {
+		options.ResponseDecoder = decodeInlineJWKS
+	}
+	return options
+}
+
+// decodeInlineJWKS reads the "jwks" member of an OIDC discovery document.
+func decodeInlineJWKS(body []byte) (json.RawMessage, error) {
+	var discovery struct {
+		JWKS json.RawMessage `json:"jwks"`
+	}
+	err := json.Unmarshal(body, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode discovery document", errors.Join(err, ErrOIDCDiscovery))
+	}
+	if len(discovery.JWKS) == 0 || string(discovery.JWKS) == "null" {
+		return nil, fmt.Errorf(`%w: discovery document has no "jwks"`, ErrOIDCDiscovery)
+	}
+	return discovery.JWKS, nil
+}
+
+// fetchJWKSSource reads where the JWK Set is from an OIDC discovery document. The "jwks_uri" is preferred. If there is
+// none, a JWK Set embedded in the "jwks" member is used. It returns false without an error if the discovery document
+// does not exist.
+func fetchJWKSSource(ctx context.Context, client *http.Client, discoveryURL string) (source jwksSource, found bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return jwksSource{}, false, redactError(fmt.Errorf("%w: failed to create discovery request", errors.Join(err, ErrOIDCDiscovery)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return jwksSource{}, false, redactError(fmt.Errorf("%w: failed to perform discovery request", errors.Join(err, ErrOIDCDiscovery)))
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return jwksSource{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return jwksSource{}, false, fmt.Errorf("%w: discovery request to %q returned status code %d", ErrOIDCDiscovery, redact(discoveryURL), resp.StatusCode)
+	}
+	var discovery struct {
+		Issuer  string          `json:"issuer"`
+		JWKS    json.RawMessage `json:"jwks"`
+		JWKSURI string          `json:"jwks_uri"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&discovery)
+	if err != nil {
+		return jwksSource{}, false, fmt.Errorf("%w: failed to decode discovery document", errors.Join(err, ErrOIDCDiscovery))
+	}
+	if discovery.JWKSURI != "" {
+		return jwksSource{issuer: discovery.Issuer, url: discovery.JWKSURI}, true, nil
+	}
+	if len(discovery.JWKS) != 0 && string(discovery.JWKS) != "null" {
+		return jwksSource{inline: true, issuer: discovery.Issuer, url: discoveryURL}, true, nil
+	}
+	return jwksSource{}, false, fmt.Errorf(`%w: discovery document at %q has no "jwks_uri" or "jwks"`, ErrOIDCDiscovery, redact(discoveryURL))
+}
+
+// newProviderKeyfunc creates a Keyfunc for the JWK Set of an identity provider. The JWK Set is refreshed when a JWT
+// with an unknown key ID is seen, at most once per unknownKIDRefreshInterval.
+func newProviderKeyfunc(ctx context.Context, jwksURI string, urlOptions URLOptions, unknownKIDRefreshInterval time.Duration) (managedKeyfunc, error) {
+	httpURLs, err := newDefaultHTTPStorages(ctx, map[string]URLOptions{jwksURI: urlOptions})
+	if err != nil {
+		return nil, err
+	}
+	return newRefreshingKeyfunc(ctx, httpURLs, unknownKIDRefreshInterval)
+}
+
+// newRefreshingKeyfunc creates a Keyfunc for the HTTP storages that refreshes them when a JWT with an unknown key ID is
+// seen, at most once per unknownKIDRefreshInterval.
+func newRefreshingKeyfunc(ctx context.Context, httpURLs map[string]jwkset.Storage, unknownKIDRefreshInterval time.Duration) (managedKeyfunc, error) {
+	clientOptions := HTTPClientOptions{
+		HTTPURLs:          httpURLs,
+		RateLimitWaitMax:  unknownKIDRefreshInterval,
+		RefreshUnknownKID: rate.NewLimiter(rate.Every(unknownKIDRefreshInterval), 1),
+	}
+	storage, err := NewHTTPClient(clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	k, err := New(Options{
+		Ctx:     ctx,
+		Storage: storage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.(managedKeyfunc), nil
+}
@@ -0,0 +1,93 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFetchJWKSSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte(`{"jwks_uri":"https://example.com/keys"}`))
+		case "/both":
+			_, _ = w.Write([]byte(`{"jwks_uri":"https://example.com/keys","jwks":{"keys":[]}}`))
+		case "/inline":
+			_, _ = w.Write([]byte(`{"jwks":{"keys":[]}}`))
+		case "/empty":
+			_, _ = w.Write([]byte(`{}`))
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	for _, path := range []string{"/ok", "/both"} {
+		source, found, err := fetchJWKSSource(ctx, server.Client(), server.URL+path)
+		if err != nil || !found || source != (jwksSource{url: "https://example.com/keys"}) {
+			t.Fatalf("Unexpected result %+v, %t for %q. Error: %v", source, found, path, err)
+		}
+	}
+	source, found, err := fetchJWKSSource(ctx, server.Client(), server.URL+"/inline")
+	if err != nil || !found || source != (jwksSource{inline: true, url: server.URL + "/inline"}) {
+		t.Fatalf("Unexpected result %+v, %t for an inline JWK Set. Error: %v", source, found, err)
+	}
+	_, found, err = fetchJWKSSource(ctx, server.Client(), server.URL+"/missing")
+	if err != nil || found {
+		t.Fatalf("Expected a missing discovery document to not be found. Error: %v", err)
+	}
+	for _, path := range []string{"/empty", "/error"} {
+		_, _, err = fetchJWKSSource(ctx, server.Client(), server.URL+path)
+		if !errors.Is(err, ErrOIDCDiscovery) {
+			t.Fatalf("Expected error to be ErrOIDCDiscovery for %q. Error: %s", path, err)
+		}
+	}
+}
+
+func TestInlineJWKS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	var discoveryURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write([]byte(`{"issuer":"` + discoveryURL + `","jwks":` + string(rawJWKS) + `}`))
+	}))
+	defer server.Close()
+	discoveryURL = server.URL + "/.well-known/openid-configuration"
+
+	source, found, err := fetchJWKSSource(ctx, server.Client(), discoveryURL)
+	if err != nil || !found {
+		t.Fatalf("Failed to fetch discovery document. Error: %v", err)
+	}
+	k, err := newProviderKeyfunc(ctx, source.url, source.urlOptions(URLOptions{}), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	// A key added to the inline JWK Set is found by refreshing the discovery document for the unknown key ID.
+	const rotatedKID = "rotated-key-id"
+	rotatedPriv := writeEdDSAKey(ctx, t, serverStore, rotatedKID)
+	for kid, p := range map[string]ed25519.PrivateKey{keyID: priv, rotatedKID: rotatedPriv} {
+		_, err = jwt.Parse(signEdDSA(t, p, kid), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT signed with %q. Error: %s", kid, err)
+		}
+	}
+}
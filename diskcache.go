@@ -0,0 +1,109 @@
+package keyfunc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// ErrDiskCacheTampered is returned when the HMAC of a JWK Set persisted to disk does not match. The file is not used.
+	ErrDiskCacheTampered = errors.New("JWK Set disk cache failed integrity check")
+)
+
+// DiskCacheOptions configure persisting a remote JWK Set to disk so it can be used at startup when the remote HTTP
+// resource is unavailable.
+type DiskCacheOptions struct {
+	// HMACKey is a locally held secret used to authenticate the persisted JWK Set with HMAC-SHA256. Files that fail
+	// verification are refused, so an attacker with filesystem write access cannot inject keys. It is required when
+	// Path is set.
+	HMACKey []byte
+	// MaxAge is how long after it was written a persisted JWK Set may be used. If zero, its age is not limited.
+	MaxAge time.Duration
+	// Path is the file the JWK Set is persisted to after every successful refresh. If empty, nothing is persisted.
+	Path string
+}
+
+// diskCacheFile is the persisted JWK Set. The HMAC authenticates the URL it was fetched for and when it was written
+// along with the JWK Set, so a file cannot be moved between storages or replayed as if it were newer. The URL is not
+// written to the file, as it may contain credentials.
+type diskCacheFile struct {
+	JWKS    json.RawMessage `json:"jwks"`
+	MAC     []byte          `json:"mac"`
+	URL     string          `json:"-"`
+	Written time.Time       `json:"written"`
+}
+
+// mac computes the HMAC of the file. Each field is prefixed with its length, so fields cannot be shifted into each
+// other.
+func (d DiskCacheOptions) mac(file diskCacheFile) []byte {
+	h := hmac.New(sha256.New, d.HMACKey)
+	for _, field := range [][]byte{[]byte(file.URL), []byte(file.Written.UTC().Format(time.RFC3339Nano)), file.JWKS} {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
+
+// load reads and verifies the JWK Set persisted for the URL. A JWK Set persisted for another URL, written after now,
+// or, if the MaxAge option is set, written too long before now is refused.
+func (d DiskCacheOptions) load(u string, now time.Time) (json.RawMessage, error) {
+	contents, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read JWK Set disk cache", errors.Join(err, ErrHTTPStorage))
+	}
+	file := diskCacheFile{URL: u}
+	err = json.Unmarshal(contents, &file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode JWK Set disk cache", errors.Join(err, ErrDiskCacheTampered))
+	}
+	if !hmac.Equal(file.MAC, d.mac(file)) {
+		return nil, fmt.Errorf("%w: HMAC mismatch for %q", ErrDiskCacheTampered, d.Path)
+	}
+	if file.Written.After(now) {
+		return nil, fmt.Errorf("%w: %q was written in the future", ErrDiskCacheTampered, d.Path)
+	}
+	if d.MaxAge > 0 && now.Sub(file.Written) > d.MaxAge {
+		return nil, fmt.Errorf("%w: JWK Set disk cache %q is older than %s", ErrHTTPStorage, d.Path, d.MaxAge)
+	}
+	return file.JWKS, nil
+}
+
+// save atomically persists the JWK Set fetched for the URL with the time it was written and its HMAC.
+func (d DiskCacheOptions) save(u string, written time.Time, raw json.RawMessage) error {
+	file := diskCacheFile{
+		JWKS:    raw,
+		URL:     u,
+		Written: written,
+	}
+	file.MAC = d.mac(file)
+	contents, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode JWK Set disk cache", errors.Join(err, ErrHTTPStorage))
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(d.Path), filepath.Base(d.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%w: failed to create JWK Set disk cache", errors.Join(err, ErrHTTPStorage))
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to write JWK Set disk cache", errors.Join(err, ErrHTTPStorage))
+	}
+	err = os.Rename(tmp.Name(), d.Path)
+	if err != nil {
+		return fmt.Errorf("%w: failed to replace JWK Set disk cache", errors.Join(err, ErrHTTPStorage))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package keyfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHTTPStorageDiskCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	options := HTTPStorageOptions{
+		Ctx: ctx,
+		DiskCache: DiskCacheOptions{
+			HMACKey: []byte("local secret"),
+			Path:    filepath.Join(t.TempDir(), "jwks.json"),
+		},
+	}
+	_, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+
+	failing.Store(true)
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage from disk cache. Error: %s", err)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with key from disk cache. Error: %s", err)
+	}
+
+	contents, err := os.ReadFile(options.DiskCache.Path)
+	if err != nil {
+		t.Fatalf("Failed to read disk cache. Error: %s", err)
+	}
+	tampered := bytes.Replace(contents, []byte(keyID), []byte("attacker-key-id"), 1)
+	err = os.WriteFile(options.DiskCache.Path, tampered, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write disk cache. Error: %s", err)
+	}
+	_, err = NewHTTPStorage(server.URL, options)
+	if !errors.Is(err, ErrDiskCacheTampered) {
+		t.Fatalf("Expected ErrDiskCacheTampered, but got %s.", err)
+	}
+
+	failing.Store(false)
+	_, err = NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	failing.Store(true)
+	_, err = NewHTTPStorage(server.URL+"/other", options)
+	if !errors.Is(err, ErrDiskCacheTampered) {
+		t.Fatalf("Expected ErrDiskCacheTampered for a JWK Set persisted for another URL, but got %s.", err)
+	}
+	contents, err = os.ReadFile(options.DiskCache.Path)
+	if err != nil {
+		t.Fatalf("Failed to read disk cache. Error: %s", err)
+	}
+	var file map[string]any
+	err = json.Unmarshal(contents, &file)
+	if err != nil {
+		t.Fatalf("Failed to decode disk cache. Error: %s", err)
+	}
+	written, err := time.Parse(time.RFC3339Nano, file["written"].(string))
+	if err != nil {
+		t.Fatalf("Failed to parse write time of disk cache. Error: %s", err)
+	}
+	replayed := bytes.Replace(contents, []byte(file["written"].(string)), []byte(written.Add(time.Hour).Format(time.RFC3339Nano)), 1)
+	err = os.WriteFile(options.DiskCache.Path, replayed, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write disk cache. Error: %s", err)
+	}
+	_, err = NewHTTPStorage(server.URL, options)
+	if !errors.Is(err, ErrDiskCacheTampered) {
+		t.Fatalf("Expected ErrDiskCacheTampered for a changed write time, but got %s.", err)
+	}
+	err = os.WriteFile(options.DiskCache.Path, contents, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write disk cache. Error: %s", err)
+	}
+	options.DiskCache.MaxAge = time.Nanosecond
+	_, err = NewHTTPStorage(server.URL, options)
+	if !errors.Is(err, ErrHTTPStorage) || errors.Is(err, ErrDiskCacheTampered) {
+		t.Fatalf("Expected ErrHTTPStorage for a disk cache older than MaxAge, but got %s.", err)
+	}
+	options.DiskCache.MaxAge = 0
+
+	options.DiskCache.HMACKey = nil
+	_, err = NewHTTPStorage(server.URL, options)
+	if !errors.Is(err, ErrHTTPStorage) {
+		t.Fatalf("Expected ErrHTTPStorage without an HMAC key, but got %s.", err)
+	}
+}
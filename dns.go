@@ -0,0 +1,128 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DNSOptions configure how the host names of remote JWK Sets are resolved by NewDNSHTTPClient.
+type DNSOptions struct {
+	// CacheTTL is how long the addresses from a successful lookup are cached. If zero, lookups are not cached.
+	CacheTTL time.Duration
+	// Dialer is used to connect to the resolved addresses.
+	//
+	// This defaults to a net.Dialer with the same settings as http.DefaultTransport.
+	Dialer *net.Dialer
+	// Resolver is used to look up the addresses of host names. This is useful for split-horizon DNS or when the system
+	// resolver is unreliable.
+	//
+	// This defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// NewDNSHTTPClient creates an *http.Client that resolves host names with the given DNS options. Use it for the Client
+// option of HTTPStorageOptions to avoid building a bespoke *http.Client.
+func NewDNSHTTPClient(options DNSOptions) *http.Client {
+	return newDNSDialer(options).client()
+}
+
+func newDNSDialer(options DNSOptions) *dnsDialer {
+	if options.Dialer == nil {
+		options.Dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+	}
+	if options.Resolver == nil {
+		options.Resolver = net.DefaultResolver
+	}
+	return &dnsDialer{
+		cache:   make(map[string]dnsCacheEntry),
+		now:     time.Now,
+		options: options,
+	}
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+type dnsDialer struct {
+	cache   map[string]dnsCacheEntry
+	mux     sync.Mutex
+	now     func() time.Time
+	options DNSOptions
+}
+
+func (d *dnsDialer) client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.dialContext
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+func (d *dnsDialer) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split host and port of %q: %w", address, err)
+	}
+	if net.ParseIP(host) != nil {
+		return d.options.Dialer.DialContext(ctx, network, address)
+	}
+	addrs, cached, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := d.options.Dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if cached {
+		d.evict(host)
+	}
+	return nil, fmt.Errorf("failed to dial any address for %q: %w", host, errors.Join(errs...))
+}
+
+func (d *dnsDialer) lookup(ctx context.Context, host string) (addrs []string, cached bool, err error) {
+	if d.options.CacheTTL > 0 {
+		d.mux.Lock()
+		entry, ok := d.cache[host]
+		d.mux.Unlock()
+		if ok && d.now().Before(entry.expires) {
+			return entry.addrs, true, nil
+		}
+	}
+	addrs, err = d.options.Resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to look up host %q: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, false, fmt.Errorf("no addresses found for host %q", host)
+	}
+	if d.options.CacheTTL > 0 {
+		d.mux.Lock()
+		d.cache[host] = dnsCacheEntry{
+			addrs:   addrs,
+			expires: d.now().Add(d.options.CacheTTL),
+		}
+		d.mux.Unlock()
+	}
+	return addrs, false, nil
+}
+
+func (d *dnsDialer) evict(host string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	delete(d.cache, host)
+}
@@ -0,0 +1,67 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewDNSHTTPClient(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL. Error: %s", err)
+	}
+
+	errResolver := errors.New("resolver unavailable")
+	options := DNSOptions{
+		CacheTTL: time.Minute,
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return nil, errResolver
+			},
+		},
+	}
+	dialer := newDNSDialer(options)
+	client := dialer.client()
+
+	now := time.Now()
+	dialer.now = func() time.Time {
+		return now
+	}
+	const host = "jwks.keyfunc.invalid"
+	dialer.cache[host] = dnsCacheEntry{
+		addrs:   []string{u.Hostname()},
+		expires: now.Add(time.Minute),
+	}
+	_, err = NewHTTPStorage("http://"+net.JoinHostPort(host, u.Port()), HTTPStorageOptions{Client: client})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage with cached DNS lookup. Error: %s", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = dialer.dialContext(ctx, "tcp", net.JoinHostPort(host, u.Port()))
+	if err == nil {
+		t.Fatalf("Expected lookup to fail after the cache expired.")
+	}
+
+	conn, err := dialer.dialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		t.Fatalf("Failed to dial IP address directly. Error: %s", err)
+	}
+	_ = conn.Close()
+
+	if NewDNSHTTPClient(DNSOptions{}).Transport == nil {
+		t.Fatalf("Expected a transport with the default DNS options.")
+	}
+}
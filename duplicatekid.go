@@ -0,0 +1,84 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDuplicateKID is the reason given to a ParseWarningHandler for a JWK whose key ID appears more than once in a
+	// single JWK Set. It is returned when the DuplicateKIDPolicy is DuplicateKIDError.
+	ErrDuplicateKID = errors.New("duplicate key ID in JWK Set")
+)
+
+// DuplicateKIDPolicy determines which JWKs are ingested when a single JWK Set contains the same key ID more than once,
+// which is seen from misconfigured identity providers. The ParseWarningHandler is called with ErrDuplicateKID for every
+// such JWK other than the one that is kept, whatever the policy.
+type DuplicateKIDPolicy string
+
+const (
+	// DuplicateKIDKeepBoth ingests every JWK with the key ID. Which one verifies a JWT is determined by the
+	// KIDCollisionPolicy of the Keyfunc. This is the default behavior.
+	DuplicateKIDKeepBoth DuplicateKIDPolicy = ""
+	// DuplicateKIDError rejects the JWK Set. For a remote JWK Set, the refresh fails and the previous keys are kept.
+	DuplicateKIDError DuplicateKIDPolicy = "error"
+	// DuplicateKIDFirst ingests only the first JWK with the key ID in the JWK Set. The others are filtered.
+	DuplicateKIDFirst DuplicateKIDPolicy = "first"
+	// DuplicateKIDLast ingests only the last JWK with the key ID in the JWK Set. The others are filtered.
+	DuplicateKIDLast DuplicateKIDPolicy = "last"
+)
+
+// kidOccurrences records where a key ID appears in the JWKs of a JWK Set.
+type kidOccurrences struct {
+	count int
+	first int
+	last  int
+}
+
+// keep returns the index of the JWK with the key ID that is not a duplicate under the policy.
+func (o kidOccurrences) keep(policy DuplicateKIDPolicy) int {
+	if policy == DuplicateKIDLast {
+		return o.last
+	}
+	return o.first
+}
+
+// reason returns the error given to a ParseWarningHandler for a duplicate JWK with the key ID.
+func (o kidOccurrences) reason(kid string, policy DuplicateKIDPolicy) error {
+	switch policy {
+	case DuplicateKIDFirst, DuplicateKIDLast:
+		return fmt.Errorf("%w: kid %q appears %d times, only the %s is kept", ErrDuplicateKID, kid, o.count, policy)
+	case DuplicateKIDError:
+		return fmt.Errorf("%w: kid %q appears %d times", ErrDuplicateKID, kid, o.count)
+	}
+	return fmt.Errorf("%w: kid %q appears %d times, all are kept", ErrDuplicateKID, kid, o.count)
+}
+
+// duplicateKIDs returns the occurrences of each non-empty key ID that appears more than once in the raw JWKs.
+func duplicateKIDs(keys []json.RawMessage) map[string]kidOccurrences {
+	occurrences := make(map[string]kidOccurrences, len(keys))
+	for i, rawJWK := range keys {
+		var header struct {
+			KID any `json:"kid"`
+		}
+		_ = json.Unmarshal(rawJWK, &header)
+		kid, _ := header.KID.(string)
+		if kid == "" {
+			continue
+		}
+		o, ok := occurrences[kid]
+		if !ok {
+			o.first = i
+		}
+		o.count++
+		o.last = i
+		occurrences[kid] = o
+	}
+	for kid, o := range occurrences {
+		if o.count < 2 {
+			delete(occurrences, kid)
+		}
+	}
+	return occurrences
+}
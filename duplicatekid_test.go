@@ -0,0 +1,76 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDuplicateKIDPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	firstJWK, firstPriv := expiringJWK(t, keyID, nil)
+	lastJWK, lastPriv := expiringJWK(t, keyID, nil)
+	otherJWK, _ := expiringJWK(t, "other", nil)
+	raw := jwksJSON(t, firstJWK, otherJWK, lastJWK)
+	first := signEdDSA(t, firstPriv, keyID)
+	last := signEdDSA(t, lastPriv, keyID)
+
+	tc := []struct {
+		policy    DuplicateKIDPolicy
+		keys      int
+		verifies  string
+		rejects   string
+		errorsOut bool
+	}{
+		{policy: DuplicateKIDKeepBoth, keys: 3, verifies: first},
+		{policy: DuplicateKIDFirst, keys: 2, verifies: first, rejects: last},
+		{policy: DuplicateKIDLast, keys: 2, verifies: last, rejects: first},
+		{policy: DuplicateKIDError, errorsOut: true},
+	}
+	for _, c := range tc {
+		var warnings []error
+		k, err := NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{
+			DuplicateKIDPolicy: c.policy,
+			ParseWarningHandler: func(kid string, kty jwkset.KTY, reason error) {
+				if kid != keyID || kty != jwkset.KtyOKP {
+					t.Errorf("Unexpected warning for kid %q with kty %q.", kid, kty)
+				}
+				warnings = append(warnings, reason)
+			},
+		})
+		if len(warnings) != 1 || !errors.Is(warnings[0], ErrDuplicateKID) {
+			t.Fatalf("Expected 1 warning with ErrDuplicateKID for policy %q, got %v.", c.policy, warnings)
+		}
+		if c.errorsOut {
+			if !errors.Is(err, ErrDuplicateKID) {
+				t.Fatalf("Expected ErrDuplicateKID for policy %q. Error: %v", c.policy, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc with policy %q. Error: %s", c.policy, err)
+		}
+		snapshot, err := k.(KeyManager).Snapshot(ctx)
+		if err != nil {
+			t.Fatalf("Failed to snapshot keys. Error: %s", err)
+		}
+		if len(snapshot) != c.keys {
+			t.Fatalf("Expected %d keys for policy %q, got %d.", c.keys, c.policy, len(snapshot))
+		}
+		_, err = jwt.Parse(c.verifies, k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT with policy %q. Error: %s", c.policy, err)
+		}
+		if c.rejects != "" {
+			_, err = jwt.Parse(c.rejects, k.Keyfunc)
+			if err == nil {
+				t.Fatalf("Expected the JWT signed by the dropped duplicate to be rejected with policy %q.", c.policy)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package keyfunc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// EventType is the kind of an Event.
+type EventType string
+
+const (
+	// EventRefreshStarted is published when a refresh of a remote JWK Set starts.
+	EventRefreshStarted EventType = "refresh_started"
+	// EventRefreshSucceeded is published when a refresh of a remote JWK Set succeeds.
+	EventRefreshSucceeded EventType = "refresh_succeeded"
+	// EventRefreshFailed is published when a refresh of a remote JWK Set fails. The Err of the Event is the error.
+	EventRefreshFailed EventType = "refresh_failed"
+	// EventKeyAdded is published for every key ID that a refresh added. A key ID whose key material changed is both
+	// added and removed.
+	EventKeyAdded EventType = "key_added"
+	// EventKeyRemoved is published for every key ID that a refresh removed.
+	EventKeyRemoved EventType = "key_removed"
+	// EventCircuitOpened is published when the number of consecutive refresh failures reaches the FailureThreshold
+	// option, at the same time as the FailureThresholdHandler option is called. It is published again only after a
+	// successful refresh resets the count.
+	EventCircuitOpened EventType = "circuit_opened"
+	// EventStale is published when no refresh has succeeded for the StalenessThreshold option. It is published again
+	// only after a refresh succeeds.
+	EventStale EventType = "stale"
+)
+
+// eventBufferSize is the capacity of the channel of each subscriber.
+const eventBufferSize = 64
+
+// Event is something that happened to a remote JWK Set.
+type Event struct {
+	// Err is the error of a failed refresh for EventRefreshFailed and EventCircuitOpened, and the error of the most
+	// recent refresh, if it failed, for EventStale.
+	Err error
+	// KID is the key ID for EventKeyAdded and EventKeyRemoved.
+	KID string
+	// Time is when the event happened.
+	Time time.Time
+	// Type is the kind of the event.
+	Type EventType
+	// URL is the URL of the remote JWK Set with any credentials redacted.
+	URL string
+}
+
+// eventListener is implemented by storage in this package that publishes events, so an HTTPClient can forward them to
+// its own subscribers.
+type eventListener interface {
+	listen(f func(e Event))
+}
+
+// eventBus delivers events to subscribers without blocking the publisher. An event is dropped for a subscriber whose
+// channel is full.
+type eventBus struct {
+	closed      bool
+	listeners   []func(e Event)
+	mux         sync.Mutex
+	subscribers []eventSubscriber
+}
+
+// eventSubscriber is the channel of a subscriber and the function that stops removing it when its context ends.
+type eventSubscriber struct {
+	ch   chan Event
+	stop func() bool
+}
+
+// subscribe returns a channel of the events published after the call. The channel is closed when the context ends or
+// the bus is closed.
+func (b *eventBus) subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, eventBufferSize)
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed || ctx.Err() != nil {
+		close(ch)
+		return ch
+	}
+	stop := context.AfterFunc(ctx, func() {
+		b.unsubscribe(ch)
+	})
+	b.subscribers = append(b.subscribers, eventSubscriber{ch: ch, stop: stop})
+	return ch
+}
+
+// unsubscribe removes the subscriber with the channel and closes the channel, unless the bus already closed it.
+func (b *eventBus) unsubscribe(ch chan Event) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for i, sub := range b.subscribers {
+		if sub.ch == ch {
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// listen calls the function with every event published after the call until the bus is closed.
+func (b *eventBus) listen(f func(e Event)) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if !b.closed {
+		b.listeners = append(b.listeners, f)
+	}
+}
+
+// publish delivers the event to every subscriber with room in its channel, then calls every listener.
+func (b *eventBus) publish(e Event) {
+	b.mux.Lock()
+	if b.closed {
+		b.mux.Unlock()
+		return
+	}
+	for _, sub := range b.subscribers {
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+	listeners := b.listeners
+	b.mux.Unlock()
+	for _, f := range listeners {
+		f(e)
+	}
+}
+
+// close closes the channel of every subscriber. Later events are not published.
+func (b *eventBus) close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, sub := range b.subscribers {
+		sub.stop()
+		close(sub.ch)
+	}
+	b.listeners = nil
+	b.subscribers = nil
+}
+
+func (s *httpStorage) Subscribe(ctx context.Context) <-chan Event {
+	return s.events.subscribe(ctx)
+}
+func (s *httpStorage) listen(f func(e Event)) {
+	s.events.listen(f)
+}
+
+// publish publishes an event about the remote JWK Set.
+func (s *httpStorage) publish(typ EventType, kid string, err error) {
+	s.events.publish(Event{Err: err, KID: kid, Time: s.now(), Type: typ, URL: redact(s.url)})
+}
+
+// publishKeyChanges publishes the key IDs that a refresh added or removed.
+func (s *httpStorage) publishKeyChanges(report RefreshReport) {
+	for _, kid := range report.Added {
+		s.publish(EventKeyAdded, kid, nil)
+	}
+	for _, kid := range report.Removed {
+		s.publish(EventKeyRemoved, kid, nil)
+	}
+}
+
+// publishStale publishes EventStale when the StalenessThreshold option passes without a successful refresh.
+func (s *httpStorage) publishStale() {
+	s.publish(EventStale, "", s.Status().LastError)
+}
+
+// closeEvents stops the staleness timer and closes the channels of the subscribers once the Ctx option ends.
+func (s *httpStorage) closeEvents() {
+	s.statusMux.Lock()
+	if s.stale != nil {
+		s.stale.Stop()
+	}
+	s.statusMux.Unlock()
+	s.events.close()
+}
+
+func (c *httpClient) Subscribe(ctx context.Context) <-chan Event {
+	return c.events.subscribe(ctx)
+}
+
+// forwardEvents publishes the events of the HTTP storage for the URL to the subscribers of the HTTPClient while the
+// storage is in use.
+func (c *httpClient) forwardEvents(u string, store jwkset.Storage) {
+	l, ok := store.(eventListener)
+	if !ok {
+		return
+	}
+	l.listen(func(e Event) {
+		c.mux.RLock()
+		current := c.httpURLs[u] == store
+		c.mux.RUnlock()
+		if current {
+			c.events.publish(e)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:                 ctx,
+		FailureThreshold:    1,
+		RefreshErrorHandler: func(ctx context.Context, err error) {},
+		StalenessThreshold:  100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	client, err := NewHTTPClient(HTTPClientOptions{
+		HTTPURLs: map[string]jwkset.Storage{server.URL: store},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	events := store.Subscribe(ctx)
+	clientEvents := client.Subscribe(ctx)
+
+	expect := func(events <-chan Event, types ...EventType) {
+		t.Helper()
+		for _, typ := range types {
+			select {
+			case e := <-events:
+				if e.Type != typ || e.URL != server.URL {
+					t.Fatalf("Expected event %q, got %+v.", typ, e)
+				}
+				if typ == EventKeyAdded && e.KID != "new" {
+					t.Fatalf("Expected key ID %q to be added, got %q.", "new", e.KID)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for event %q.", typ)
+			}
+		}
+	}
+
+	writeEdDSAKey(ctx, t, serverStore, "new")
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	expect(events, EventRefreshStarted, EventRefreshSucceeded, EventKeyAdded)
+	expect(clientEvents, EventRefreshStarted, EventRefreshSucceeded, EventKeyAdded)
+
+	failing.Store(true)
+	_ = store.Refresh(ctx)
+	expect(events, EventRefreshStarted, EventRefreshFailed, EventCircuitOpened, EventStale)
+	expect(clientEvents, EventRefreshStarted, EventRefreshFailed, EventCircuitOpened, EventStale)
+
+	if !client.RemoveHTTPStorage(server.URL) {
+		t.Fatalf("Expected the HTTP storage to be removed.")
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatalf("Expected no more events after the HTTP storage was removed.")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the channel to be closed when the HTTP storage was removed and stopped.")
+	}
+	select {
+	case e := <-clientEvents:
+		t.Fatalf("Expected no events from a removed HTTP storage, got %+v.", e)
+	default:
+	}
+
+	cancel()
+	select {
+	case _, ok := <-clientEvents:
+		if ok {
+			t.Fatalf("Expected no more events after the context ended.")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the channel to be closed when the context ended.")
+	}
+}
+
+func TestSubscribeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newJWKSServer(ctx, t, jwkset.NewMemoryStorage())
+	defer server.Close()
+	k, err := NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	client := k.Storage().(*httpClient)
+	store := client.HTTPStorages()[server.URL].(*httpStorage)
+
+	subCtx, subCancel := context.WithCancel(ctx)
+	events := store.Subscribe(subCtx)
+	clientEvents := client.Subscribe(subCtx)
+	subCancel()
+	for _, ch := range []<-chan Event{events, clientEvents} {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatalf("Expected no events after the context of the subscription ended.")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the channel to be closed when the context of the subscription ended.")
+		}
+	}
+	for _, bus := range []*eventBus{&store.events, &client.events} {
+		bus.mux.Lock()
+		subscribers := len(bus.subscribers)
+		bus.mux.Unlock()
+		if subscribers != 0 {
+			t.Fatalf("Expected the subscriber to be removed, got %d subscribers.", subscribers)
+		}
+	}
+
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh after the subscription ended. Error: %s", err)
+	}
+	_, ok := <-store.Subscribe(subCtx)
+	if ok {
+		t.Fatalf("Expected the channel of a subscription with an ended context to be closed.")
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"log"
 
 	"github.com/MicahParks/jwkset"
@@ -11,47 +10,22 @@ import (
 )
 
 func main() {
-	// Create a context that, when cancelled, ends the JWK Set background refresh goroutine.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	// Create the given keys.
 	hmacSecret := []byte("example secret")
 	const givenKID = "givenKID"
 
 	// Turn the given HMAC key into a jwkset.JWK.
-	marshalOptions := jwkset.JWKMarshalOptions{
-		Private: true,
-	}
-	metadata := jwkset.JWKMetadataOptions{
-		ALG: jwkset.AlgHS256,
-		KID: givenKID, // Required for keyfunc.
-		USE: jwkset.UseSig,
-	}
-	jwkOptions := jwkset.JWKOptions{
-		Marshal:  marshalOptions,
-		Metadata: metadata,
-	}
-	jwk, err := jwkset.NewJWKFromKey(hmacSecret, jwkOptions)
+	jwk, err := keyfunc.NewGivenHMAC(givenKID, hmacSecret, keyfunc.GivenKeyOptions{
+		Algorithm: jwkset.AlgHS256,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create a JWK from the given HMAC secret.\nError: %s", err)
 	}
 
-	// Create JWK Set storage. This implements the jwkset.Storage interface.
-	store := jwkset.NewMemoryStorage()
-	err = store.KeyWrite(ctx, jwk)
-	if err != nil {
-		log.Fatalf("Failed to write the given JWK to the store.\nError: %s", err)
-	}
-
 	// Create the keyfunc.Keyfunc.
-	options := keyfunc.Options{
-		Storage: store,
-		Ctx:     ctx,
-	}
-	jwks, err := keyfunc.New(options)
+	jwks, err := keyfunc.NewGiven(jwk)
 	if err != nil {
-		log.Fatalf("Failed to create JWK Set from resource at the given URL.\nError: %s", err)
+		log.Fatalf("Failed to create a keyfunc.Keyfunc from the given JWK.\nError: %s", err)
 	}
 
 	// Create a JWT signed by the give HMAC key.
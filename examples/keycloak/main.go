@@ -9,15 +9,15 @@ import (
 )
 
 func main() {
-	// Get the JWK Set URL.
-	//
-	// This is a local Keycloak JWK Set endpoint for the master realm.
-	jwksURL := "http://localhost:8080/auth/realms/master/protocol/openid-connect/certs"
-
-	// Create the keyfunc.Keyfunc.
-	jwks, err := keyfunc.NewDefault([]string{jwksURL})
+	// Create the keyfunc.Keyfunc for the master realm of a local Keycloak server. The JWK Set URL is read from the
+	// realm's OIDC discovery document.
+	options := keyfunc.KeycloakOptions{
+		BaseURL: "http://localhost:8080",
+		Realm:   "master",
+	}
+	jwks, err := keyfunc.NewKeycloak(options)
 	if err != nil {
-		log.Fatalf("Failed to create JWK Set from resource at the given URL.\nError: %s", err)
+		log.Fatalf("Failed to create JWK Set from Keycloak realm.\nError: %s", err)
 	}
 
 	// Get a JWT to parse.
@@ -0,0 +1,79 @@
+package keyfunc
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyValidity is the period in which a JWK may be used according to its expiry metadata. A zero time is unbounded.
+type keyValidity struct {
+	expires   time.Time
+	notBefore time.Time
+}
+
+func (v keyValidity) valid(now time.Time) bool {
+	if !v.notBefore.IsZero() && now.Before(v.notBefore) {
+		return false
+	}
+	if !v.expires.IsZero() && !now.Before(v.expires) {
+		return false
+	}
+	return true
+}
+
+// readKeyValidity reads the "exp" and "nbf" parameters of a raw JWK as NumericDate values, like the claims of a JWT.
+func readKeyValidity(rawJWK json.RawMessage) (keyValidity, error) {
+	var params struct {
+		EXP *jwt.NumericDate `json:"exp"`
+		NBF *jwt.NumericDate `json:"nbf"`
+	}
+	err := json.Unmarshal(rawJWK, &params)
+	if err != nil {
+		return keyValidity{}, fmt.Errorf(`could not read "exp" or "nbf" parameter: %w`, err)
+	}
+	var v keyValidity
+	if params.EXP != nil {
+		v.expires = params.EXP.Time
+	}
+	if params.NBF != nil {
+		v.notBefore = params.NBF.Time
+	}
+	return v, nil
+}
+
+// narrow limits the validity to the validity of the first X.509 certificate in the chain, if any.
+func (v keyValidity) narrow(chain []*x509.Certificate) keyValidity {
+	if len(chain) == 0 {
+		return v
+	}
+	cert := chain[0]
+	if v.expires.IsZero() || cert.NotAfter.Before(v.expires) {
+		v.expires = cert.NotAfter
+	}
+	if cert.NotBefore.After(v.notBefore) {
+		v.notBefore = cert.NotBefore
+	}
+	return v
+}
+
+// nextExpiry returns the earliest expiry after now of the keys in the result. It returns false if no key expires
+// after now.
+func (r ingestResult) nextExpiry(now time.Time) (time.Time, bool) {
+	var next time.Time
+	consider := func(v keyValidity) {
+		if v.expires.After(now) && (next.IsZero() || v.expires.Before(next)) {
+			next = v.expires
+		}
+	}
+	for _, v := range r.validity {
+		consider(v)
+	}
+	for _, c := range r.custom {
+		consider(c.validity)
+	}
+	return next, !next.IsZero()
+}
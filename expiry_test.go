@@ -0,0 +1,180 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHonorKeyExpiry(t *testing.T) {
+	now := time.Now()
+	expired, expiredPriv := expiringJWK(t, "expired", map[string]any{"exp": now.Add(-time.Hour).Unix()})
+	future, futurePriv := expiringJWK(t, "future", map[string]any{"nbf": now.Add(time.Hour).Unix()})
+	valid, validPriv := expiringJWK(t, "valid", map[string]any{"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(-time.Hour).Unix()})
+	raw := jwksJSON(t, expired, future, valid)
+
+	tc := []struct {
+		kid     string
+		priv    ed25519.PrivateKey
+		honored bool
+	}{
+		{kid: "expired", priv: expiredPriv},
+		{kid: "future", priv: futurePriv},
+		{kid: "valid", priv: validPriv, honored: true},
+	}
+
+	ignored, err := NewJWKSetJSON(raw)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	honored, err := NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{HonorKeyExpiry: true})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	for _, c := range tc {
+		t.Run(c.kid, func(t *testing.T) {
+			signed := signEdDSA(t, c.priv, c.kid)
+			_, err := jwt.Parse(signed, ignored.Keyfunc)
+			if err != nil {
+				t.Fatalf("Expected the key to be used when expiry metadata is ignored. Error: %s", err)
+			}
+			_, err = jwt.Parse(signed, honored.Keyfunc)
+			if c.honored && err != nil {
+				t.Fatalf("Expected the key to be used. Error: %s", err)
+			}
+			if !c.honored && !errors.Is(err, jwkset.ErrKeyNotFound) {
+				t.Fatalf("Expected error to be jwkset.ErrKeyNotFound. Error: %s", err)
+			}
+		})
+	}
+
+	all, err := honored.Storage().KeyReadAll(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read all keys. Error: %s", err)
+	}
+	if len(all) != 1 || all[0].Marshal().KID != "valid" {
+		t.Fatalf("Expected only the valid key to be read.")
+	}
+}
+
+func TestHonorKeyExpiryUnreadable(t *testing.T) {
+	bad, _ := expiringJWK(t, "bad", map[string]any{"exp": "tomorrow"})
+	_, err := NewJWKSetJSONWithOptions(jwksJSON(t, bad), JWKSetJSONOptions{HonorKeyExpiry: true})
+	if !errors.Is(err, ErrUnparsableJWK) {
+		t.Fatalf("Expected error to be ErrUnparsableJWK. Error: %s", err)
+	}
+	_, err = NewJWKSetJSON(jwksJSON(t, bad))
+	if err != nil {
+		t.Fatalf("Expected expiry metadata to be ignored. Error: %s", err)
+	}
+}
+
+func TestKeyValidityNarrow(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	}
+	v := keyValidity{expires: now.Add(2 * time.Hour)}.narrow([]*x509.Certificate{cert})
+	if !v.expires.Equal(cert.NotAfter) || !v.notBefore.Equal(cert.NotBefore) {
+		t.Fatalf("Expected the validity to be narrowed to the certificate.")
+	}
+	v = keyValidity{expires: now.Add(time.Minute)}.narrow([]*x509.Certificate{cert})
+	if !v.expires.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Expected the earlier expiry to be kept.")
+	}
+	if v.valid(now.Add(2*time.Minute)) || v.valid(now.Add(-2*time.Hour)) || !v.valid(now) {
+		t.Fatalf("Unexpected validity.")
+	}
+}
+
+func TestHTTPStorageKeyExpiryRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		jwk, _ := expiringJWK(t, keyID, map[string]any{"exp": time.Now().Add(3 * time.Second).Unix()})
+		_, _ = w.Write(jwksJSON(t, jwk))
+	}))
+	defer server.Close()
+
+	options := HTTPStorageOptions{
+		Ctx:                  ctx,
+		HonorKeyExpiry:       true,
+		KeyExpiryRefreshLead: 1900 * time.Millisecond,
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key. Error: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for requests.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if requests.Load() < 3 {
+		t.Fatalf("Expected refreshes to be scheduled before the key expires, got %d requests.", requests.Load())
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Expected the refreshed key to be read. Error: %s", err)
+	}
+}
+
+func expiringJWK(t *testing.T, kid string, params map[string]any) (json.RawMessage, ed25519.PrivateKey) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			KID: kid,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(priv.Public(), jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK from ED25519 public key. Error: %s", err)
+	}
+	raw, err := json.Marshal(jwk.Marshal())
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	var m map[string]any
+	err = json.Unmarshal(raw, &m)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	for k, v := range params {
+		m[k] = v
+	}
+	raw, err = json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	return raw, priv
+}
+
+func jwksJSON(t *testing.T, keys ...json.RawMessage) json.RawMessage {
+	raw, err := json.Marshal(map[string][]json.RawMessage{"keys": keys})
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK Set. Error: %s", err)
+	}
+	return raw
+}
@@ -0,0 +1,70 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"maps"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// standardJWKParameters are the JWK parameters registered by RFC 7517, RFC 7518, and RFC 8037. All other parameters
+// of a JWK are preserved as extra fields.
+var standardJWKParameters = map[string]bool{
+	"alg": true, "crv": true, "d": true, "dp": true, "dq": true, "e": true, "k": true, "key_ops": true, "kid": true,
+	"kty": true, "n": true, "oth": true, "p": true, "q": true, "qi": true, "use": true, "x": true, "x5c": true,
+	"x5t": true, "x5t#S256": true, "x5u": true, "y": true,
+}
+
+// extraFields returns the nonstandard parameters of the raw JWK, such as "issuer", "exp", or the custom labels some
+// identity providers attach. It returns nil if there are none.
+func extraFields(raw json.RawMessage) map[string]json.RawMessage {
+	var params map[string]json.RawMessage
+	err := json.Unmarshal(raw, &params)
+	if err != nil {
+		return nil
+	}
+	var extra map[string]json.RawMessage
+	for name, value := range params {
+		if standardJWKParameters[name] {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]json.RawMessage)
+		}
+		extra[name] = value
+	}
+	return extra
+}
+
+// extraFieldsReader is implemented by storage in this package that preserves the nonstandard parameters of the JWKs it
+// ingests.
+type extraFieldsReader interface {
+	ExtraFields(kid string) map[string]json.RawMessage
+}
+
+func (m *memoryStorage) ExtraFields(kid string) map[string]json.RawMessage {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return maps.Clone(m.extra[kid])
+}
+
+func (c *httpClient) ExtraFields(kid string) map[string]json.RawMessage {
+	for _, store := range append([]jwkset.Storage{c.given}, c.stores()...) {
+		r, ok := store.(extraFieldsReader)
+		if !ok {
+			continue
+		}
+		if extra := r.ExtraFields(kid); extra != nil {
+			return extra
+		}
+	}
+	return nil
+}
+
+func (k keyfunc) ExtraFields(kid string) map[string]json.RawMessage {
+	r, ok := k.storage.(extraFieldsReader)
+	if !ok {
+		return nil
+	}
+	return r.ExtraFields(kid)
+}
@@ -0,0 +1,56 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtraFields(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rawJWK, _ := expiringJWK(t, keyID, map[string]any{
+		"issuer": "https://issuer.example.com",
+		"labels": []string{"primary"},
+	})
+	raw := jwksJSON(t, rawJWK)
+
+	k, err := NewJWKSetJSON(raw)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	extra := k.(KeyManager).ExtraFields(keyID)
+	if len(extra) != 2 {
+		t.Fatalf("Expected 2 extra fields, got %d.", len(extra))
+	}
+	if string(extra["issuer"]) != `"https://issuer.example.com"` || string(extra["labels"]) != `["primary"]` {
+		t.Fatalf("Unexpected extra fields %s and %s.", extra["issuer"], extra["labels"])
+	}
+	if _, ok := extra["kty"]; ok {
+		t.Fatalf("Expected standard parameters to be excluded from extra fields.")
+	}
+	if k.(KeyManager).ExtraFields("unknown") != nil {
+		t.Fatalf("Expected no extra fields for an unknown key ID.")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(raw)
+	}))
+	defer server.Close()
+	k, err = NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if string(k.(KeyManager).ExtraFields(keyID)["issuer"]) != `"https://issuer.example.com"` {
+		t.Fatalf("Expected the extra fields of the remote JWK Set to be preserved.")
+	}
+	_, err = k.(KeyManager).RemoveKey(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to remove key. Error: %s", err)
+	}
+	if k.(KeyManager).ExtraFields(keyID) != nil {
+		t.Fatalf("Expected the extra fields to be removed with the key.")
+	}
+}
@@ -0,0 +1,75 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// StorageErrorPolicy determines what a Keyfunc does when the JWK Set storage returns an error other than
+// jwkset.ErrKeyNotFound. For example, when a remote storage backend is unavailable or the context is cancelled.
+type StorageErrorPolicy string
+
+const (
+	// StorageErrorFailClosed returns an error when the JWK Set storage returns an error. This is the default behavior.
+	StorageErrorFailClosed StorageErrorPolicy = ""
+	// StorageErrorFailOpen uses the last JWK successfully read from the JWK Set storage for the key ID when the JWK Set
+	// storage returns an error. This favors availability over strictness. JWKs that the storage later reports as not
+	// found are forgotten, so removed keys are not used.
+	StorageErrorFailOpen StorageErrorPolicy = "fail-open"
+)
+
+type lastKnownKeys struct {
+	keys map[string]jwkset.JWK
+	mux  sync.RWMutex
+}
+
+func newLastKnownKeys() *lastKnownKeys {
+	return &lastKnownKeys{
+		keys: make(map[string]jwkset.JWK),
+	}
+}
+
+func (l *lastKnownKeys) read(kid string) (jwkset.JWK, bool) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	jwk, ok := l.keys[kid]
+	return jwk, ok
+}
+
+func (l *lastKnownKeys) write(kid string, jwk jwkset.JWK) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.keys[kid] = jwk
+}
+
+func (l *lastKnownKeys) forget(kid string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	delete(l.keys, kid)
+}
+
+// readKey reads the JWK for the key ID from storage while applying the StorageErrorPolicy.
+func (k keyfunc) readKey(ctx context.Context, kid string) (jwkset.JWK, error) {
+	jwk, err := k.keyRead(ctx, kid)
+	traceDecision(ctx, DecisionStageSource, err, "read kid %q from JWK Set storage", kid)
+	if k.storageErrorPolicy != StorageErrorFailOpen {
+		return jwk, err
+	}
+	switch {
+	case errors.Is(err, jwkset.ErrKeyNotFound):
+		k.lastKnown.forget(kid)
+		return jwkset.JWK{}, err
+	case err != nil:
+		if known, ok := k.lastKnown.read(kid); ok {
+			traceDecision(ctx, DecisionStageSource, err, "last known JWK used by StorageErrorFailOpen")
+			return known, nil
+		}
+		return jwkset.JWK{}, fmt.Errorf("%w: no last known JWK to fail open with", err)
+	}
+	k.lastKnown.write(kid, jwk)
+	return jwk, nil
+}
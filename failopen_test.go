@@ -0,0 +1,94 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var errBackend = errors.New("backend unavailable")
+
+func TestStorageErrorPolicy(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStorage{Storage: jwkset.NewMemoryStorage()}
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	signed := signEdDSA(t, priv, keyID)
+
+	closed, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	options := Options{
+		Storage:            store,
+		StorageErrorPolicy: StorageErrorFailOpen,
+	}
+	open, err := New(options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	store.failing.Store(true)
+	_, err = jwt.Parse(signed, open.Keyfunc)
+	if !errors.Is(err, errBackend) {
+		t.Fatalf("Expected backend error without a last known key, but got %s.", err)
+	}
+
+	store.failing.Store(false)
+	_, err = jwt.Parse(signed, open.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+
+	store.failing.Store(true)
+	_, err = jwt.Parse(signed, open.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected fail open to use the last known key. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, closed.Keyfunc)
+	if !errors.Is(err, errBackend) || !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected fail closed to return the backend error, but got %s.", err)
+	}
+
+	store.failing.Store(false)
+	_, err = store.KeyDelete(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to delete key. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, open.Keyfunc)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound for deleted key, but got %s.", err)
+	}
+	store.failing.Store(true)
+	_, err = jwt.Parse(signed, open.Keyfunc)
+	if !errors.Is(err, errBackend) {
+		t.Fatalf("Expected deleted key to be forgotten, but got %s.", err)
+	}
+
+	_, err = New(Options{Storage: store, StorageErrorPolicy: "unknown"})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for unknown policy, but got %s.", err)
+	}
+}
+
+type flakyStorage struct {
+	jwkset.Storage
+	failing atomic.Bool
+}
+
+func (f *flakyStorage) KeyRead(ctx context.Context, keyID string) (jwkset.JWK, error) {
+	if f.failing.Load() {
+		return jwkset.JWK{}, errBackend
+	}
+	return f.Storage.KeyRead(ctx, keyID)
+}
+
+func (f *flakyStorage) KeyReadAll(ctx context.Context) ([]jwkset.JWK, error) {
+	if f.failing.Load() {
+		return nil, errBackend
+	}
+	return f.Storage.KeyReadAll(ctx)
+}
@@ -0,0 +1,111 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EndpointStatus is the health of one of the endpoints of an HTTPStorage with the FailoverURLs or HealthCheckInterval
+// options.
+type EndpointStatus struct {
+	// ConsecutiveFailures is the number of refreshes and health checks of the endpoint that have failed since the last
+	// successful one.
+	ConsecutiveFailures int
+	// Healthy is false after a refresh or health check of the endpoint fails, until one succeeds. An unhealthy endpoint
+	// is only tried before the endpoints after it once the FailoverCooldown option has passed since its last failure.
+	Healthy bool
+	// LastError is the error from the most recent failed refresh or health check of the endpoint. It is nil after a
+	// successful one.
+	LastError error
+	// LastFailure is when the most recent failed refresh or health check of the endpoint completed.
+	LastFailure time.Time
+	// LastHealthCheck is when the most recent health check of the endpoint completed.
+	LastHealthCheck time.Time
+	// LastSuccess is when the most recent successful refresh from the endpoint completed.
+	LastSuccess time.Time
+	// URL is the URL of the endpoint with any credentials redacted.
+	URL string
+}
+
+// endpoints returns the URL given to NewHTTPStorage followed by the FailoverURLs option.
+func (s *httpStorage) endpoints() []string {
+	return append([]string{s.url}, s.options.FailoverURLs...)
+}
+
+// failoverOrder returns the indexes of the endpoints in the order they are tried: healthy endpoints, and unhealthy
+// endpoints whose cooldown has passed, in priority order, followed by the other unhealthy endpoints in priority order
+// as a last resort.
+func (s *httpStorage) failoverOrder(now time.Time) []int {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	var ready, cooling []int
+	for i, endpoint := range s.status.Endpoints {
+		if endpoint.Healthy || now.Sub(endpoint.LastFailure) >= s.options.FailoverCooldown {
+			ready = append(ready, i)
+		} else {
+			cooling = append(cooling, i)
+		}
+	}
+	return append(ready, cooling...)
+}
+
+// refreshFailover refreshes from the first endpoint that succeeds, in failover order, and records the health of each
+// endpoint that was tried.
+func (s *httpStorage) refreshFailover(ctx context.Context, report *RefreshReport) error {
+	endpoints := s.endpoints()
+	var errs []error
+	for _, i := range s.failoverOrder(s.now()) {
+		err := s.refreshFrom(ctx, report, endpoints[i])
+		s.recordEndpoint(i, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("endpoint %q: %w", redact(endpoints[i]), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("%w: all endpoints failed: %w", ErrHTTPStorage, errors.Join(errs...))
+}
+
+// recordEndpoint updates the health of the endpoint after a refresh from it.
+func (s *httpStorage) recordEndpoint(i int, err error) {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	endpoint := &s.status.Endpoints[i]
+	now := s.now()
+	endpoint.record(redactError(err), now)
+	if err == nil {
+		endpoint.LastSuccess = now
+		s.status.ActiveURL = endpoint.URL
+	}
+}
+
+// record updates the health of the endpoint after a refresh or health check.
+func (e *EndpointStatus) record(err error, now time.Time) {
+	if err != nil {
+		e.ConsecutiveFailures++
+		e.Healthy = false
+		e.LastError = err
+		e.LastFailure = now
+		return
+	}
+	e.ConsecutiveFailures = 0
+	e.Healthy = true
+	e.LastError = nil
+}
+
+// newEndpointStatuses returns the initial health of the endpoints, or nil if neither the FailoverURLs nor the
+// HealthCheckInterval option is set.
+func newEndpointStatuses(u string, options HTTPStorageOptions) []EndpointStatus {
+	if len(options.FailoverURLs) == 0 && options.HealthCheckInterval <= 0 {
+		return nil
+	}
+	statuses := make([]EndpointStatus, 0, len(options.FailoverURLs)+1)
+	for _, endpoint := range append([]string{u}, options.FailoverURLs...) {
+		statuses = append(statuses, EndpointStatus{Healthy: true, URL: redact(endpoint)})
+	}
+	return statuses
+}
@@ -0,0 +1,96 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFailoverURLs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	newServer := func(failing *atomic.Bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			rawJWKS, err := serverStore.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+			}
+			_, _ = w.Write(rawJWKS)
+		}))
+	}
+	var primaryFailing, mirrorFailing atomic.Bool
+	primaryFailing.Store(true)
+	primary := newServer(&primaryFailing)
+	defer primary.Close()
+	mirror := newServer(&mirrorFailing)
+	defer mirror.Close()
+
+	store, err := NewHTTPStorage(primary.URL, HTTPStorageOptions{
+		Ctx:              ctx,
+		FailoverCooldown: 50 * time.Millisecond,
+		FailoverURLs:     []string{mirror.URL},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage with a failing primary endpoint. Error: %s", err)
+	}
+	k, err := New(Options{Ctx: ctx, Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with keys from the mirror. Error: %s", err)
+	}
+	status := store.Status()
+	if status.ActiveURL != mirror.URL || len(status.Endpoints) != 2 {
+		t.Fatalf("Expected the mirror to be active, got %+v.", status)
+	}
+	if status.Endpoints[0].Healthy || status.Endpoints[0].ConsecutiveFailures != 1 || status.Endpoints[0].LastError == nil {
+		t.Fatalf("Expected the primary endpoint to be unhealthy, got %+v.", status.Endpoints[0])
+	}
+	if !status.Endpoints[1].Healthy || status.Endpoints[1].LastSuccess.IsZero() {
+		t.Fatalf("Expected the mirror endpoint to be healthy, got %+v.", status.Endpoints[1])
+	}
+
+	primaryFailing.Store(false)
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	if store.Status().ActiveURL != mirror.URL {
+		t.Fatalf("Expected the primary endpoint to be skipped during its cooldown.")
+	}
+	time.Sleep(50 * time.Millisecond)
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	status = store.Status()
+	if status.ActiveURL != primary.URL || !status.Endpoints[0].Healthy {
+		t.Fatalf("Expected the primary endpoint to be active again after its cooldown, got %+v.", status)
+	}
+
+	primaryFailing.Store(true)
+	mirrorFailing.Store(true)
+	err = store.Refresh(ctx)
+	if err == nil {
+		t.Fatalf("Expected an error when every endpoint fails.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with the keys kept from before every endpoint failed. Error: %s", err)
+	}
+}
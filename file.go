@@ -0,0 +1,178 @@
+package keyfunc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrFileStorage is returned when a keyfunc file storage fails to read or process a local JWK Set file.
+	ErrFileStorage = errors.New("failed file JWK Set storage")
+)
+
+// FileStorageOptions are used to configure the behavior of NewFileStorage.
+type FileStorageOptions struct {
+	// Ctx ends the watch goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+
+	// DuplicateKIDPolicy determines which JWKs are ingested when the file contains the same key ID more than once. It
+	// defaults to DuplicateKIDKeepBoth.
+	DuplicateKIDPolicy DuplicateKIDPolicy
+
+	// NoWatch reads the file only when the storage is created or refreshed, without launching a "watch goroutine".
+	NoWatch bool
+
+	// ParseWarningHandler is called for every JWK in the file that is skipped because it cannot be parsed, and for every
+	// JWK with a duplicate key ID.
+	ParseWarningHandler ParseWarningHandler
+
+	// PollInterval is the interval at which the file is checked for changes by the watch goroutine. The keys are only
+	// replaced when the content of the file changes.
+	//
+	// This defaults to five seconds.
+	PollInterval time.Duration
+
+	// RefreshErrorHandler consumes errors that happen when the watch goroutine reads the file. The previous keys are
+	// kept.
+	RefreshErrorHandler func(ctx context.Context, err error)
+
+	// StrictParsing fails the refresh if any JWK in the file cannot be parsed, keeping the previous keys.
+	StrictParsing bool
+
+	// StrictRFC7517 skips JWKs in the file that deviate from RFC 7517. See HTTPStorageOptions.
+	StrictRFC7517 bool
+
+	// LenientNormalization fixes common deviations from RFC 7517 in the JWKs of the file. See HTTPStorageOptions.
+	LenientNormalization bool
+
+	// ValidateOptions are the options to use when validating the JWKs.
+	ValidateOptions jwkset.JWKValidateOptions
+}
+
+// FileStorage is a jwkset.Storage for a JWK Set file on the local file system, such as the local_jwks file of an Envoy
+// JWT authentication filter that an Istio sidecar or another control plane keeps up to date. Sharing the keys the mesh
+// has already fetched avoids duplicate requests to the identity provider. The file is watched for changes, including
+// the atomic symbolic link swaps used for Kubernetes ConfigMap and Secret volumes.
+type FileStorage interface {
+	jwkset.Storage
+	ThumbprintReader
+	// Path is the path of the JWK Set file.
+	Path() string
+	// Refresh reads the file and replaces the keys in storage with the result if the content changed.
+	Refresh(ctx context.Context) error
+	// SkippedKeys returns the JWKs that were skipped because they could not be parsed in the most recent content of the
+	// file that was processed.
+	SkippedKeys() []SkippedKey
+	// Stop ends the "watch goroutine", as if the Ctx option was cancelled. The keys already read from the file can still
+	// be read.
+	Stop()
+}
+
+type fileStorage struct {
+	*memoryStorage
+	cancel  context.CancelFunc
+	last    []byte
+	mux     sync.Mutex
+	options FileStorageOptions
+	path    string
+	skipped []SkippedKey
+}
+
+// NewFileStorage creates a new FileStorage for the JWK Set file at the given path. The file must exist and hold a JWK
+// Set. Unless the NoWatch option is set, a "watch goroutine" is launched to reload the file when it changes.
+func NewFileStorage(path string, options FileStorageOptions) (FileStorage, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.PollInterval == 0 {
+		options.PollInterval = 5 * time.Second
+	}
+	var cancel context.CancelFunc
+	options.Ctx, cancel = context.WithCancel(options.Ctx)
+	s := &fileStorage{
+		cancel:        cancel,
+		memoryStorage: newMemoryStorage(),
+		options:       options,
+		path:          path,
+	}
+	err := s.Refresh(options.Ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%w: failed to perform first read of JWK Set file", err)
+	}
+	if !options.NoWatch {
+		go s.watch()
+	}
+	return s, nil
+}
+
+func (s *fileStorage) Path() string {
+	return s.path
+}
+func (s *fileStorage) Refresh(_ context.Context) error {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read JWK Set file %q", errors.Join(err, ErrFileStorage), s.path)
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.last != nil && bytes.Equal(raw, s.last) {
+		return nil
+	}
+	ingestOpts := ingestOptions{
+		duplicateKIDs: s.options.DuplicateKIDPolicy,
+		normalize:     s.options.LenientNormalization,
+		rfc7517:       s.options.StrictRFC7517,
+		strict:        s.options.StrictParsing,
+		validate:      s.options.ValidateOptions,
+		warn:          s.options.ParseWarningHandler,
+	}
+	result, err := ingest(raw, ingestOpts)
+	s.skipped = result.skipped
+	if err != nil {
+		return fmt.Errorf("%w: failed to process JWK Set file %q", errors.Join(err, ErrFileStorage), s.path)
+	}
+	s.replaceIngested(result)
+	s.last = raw
+	return nil
+}
+func (s *fileStorage) SkippedKeys() []SkippedKey {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return slices.Clone(s.skipped)
+}
+func (s *fileStorage) Stop() {
+	s.cancel()
+}
+
+func (s *fileStorage) watch() {
+	ticker := time.NewTicker(s.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.options.Ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.Refresh(s.options.Ctx)
+			if err != nil {
+				s.handleRefreshError(s.options.Ctx, err)
+			}
+		}
+	}
+}
+
+func (s *fileStorage) handleRefreshError(ctx context.Context, err error) {
+	if s.options.RefreshErrorHandler != nil {
+		s.options.RefreshErrorHandler(ctx, err)
+	}
+}
@@ -0,0 +1,129 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFileStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Mimic the layout of a Kubernetes volume, where the file is a symbolic link that is atomically swapped.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jwks.json")
+	swap := func(name string, raw []byte) {
+		target := filepath.Join(dir, name)
+		err := os.WriteFile(target, raw, 0600)
+		if err != nil {
+			t.Fatalf("Failed to write JWK Set file. Error: %s", err)
+		}
+		link := filepath.Join(dir, name+".link")
+		err = os.Symlink(target, link)
+		if err != nil {
+			t.Fatalf("Failed to create symbolic link. Error: %s", err)
+		}
+		err = os.Rename(link, path)
+		if err != nil {
+			t.Fatalf("Failed to swap symbolic link. Error: %s", err)
+		}
+	}
+
+	original, originalPriv := expiringJWK(t, "original", nil)
+	swap("first", jwksJSON(t, original))
+
+	refreshErrs := make(chan error, 10)
+	options := FileStorageOptions{
+		Ctx:          ctx,
+		PollInterval: 10 * time.Millisecond,
+		RefreshErrorHandler: func(ctx context.Context, err error) {
+			select {
+			case refreshErrs <- err:
+			default:
+			}
+		},
+	}
+	store, err := NewFileStorage(path, options)
+	if err != nil {
+		t.Fatalf("Failed to create file storage. Error: %s", err)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, originalPriv, "original"), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+
+	swap("second", []byte("{"))
+	select {
+	case err = <-refreshErrs:
+		if !errors.Is(err, ErrFileStorage) {
+			t.Fatalf("Expected error to be ErrFileStorage. Error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for refresh error.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, originalPriv, "original"), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT after invalid file content. Error: %s", err)
+	}
+
+	rotated, rotatedPriv := expiringJWK(t, "rotated", nil)
+	swap("third", jwksJSON(t, rotated))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err = jwt.Parse(signEdDSA(t, rotatedPriv, "rotated"), k.Keyfunc)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for rotated key. Error: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = jwt.Parse(signEdDSA(t, originalPriv, "original"), k.Keyfunc)
+	if err == nil {
+		t.Fatal("Expected original key to be removed.")
+	}
+}
+
+func TestFileStorageMissing(t *testing.T) {
+	_, err := NewFileStorage(filepath.Join(t.TempDir(), "missing.json"), FileStorageOptions{NoWatch: true})
+	if !errors.Is(err, ErrFileStorage) {
+		t.Fatalf("Expected error to be ErrFileStorage. Error: %s", err)
+	}
+}
+
+func TestFileStorageStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	original, _ := expiringJWK(t, "original", nil)
+	err := os.WriteFile(path, jwksJSON(t, original), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write JWK Set file. Error: %s", err)
+	}
+	store, err := NewFileStorage(path, FileStorageOptions{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create file storage. Error: %s", err)
+	}
+	store.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	rotated, _ := expiringJWK(t, "rotated", nil)
+	err = os.WriteFile(path, jwksJSON(t, rotated), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write JWK Set file. Error: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_, err = store.KeyRead(context.Background(), "original")
+	if err != nil {
+		t.Fatalf("Expected the keys to not be reloaded after the storage was stopped. Error: %s", err)
+	}
+}
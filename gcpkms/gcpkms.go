@@ -0,0 +1,271 @@
+// Package gcpkms resolves JWT key IDs to Google Cloud KMS asymmetric signing key versions, so JWTs signed by keys held in
+// Google Cloud KMS can be verified through the same keyfunc.Keyfunc as keys from other sources.
+//
+// It is a separate module, so the Google Cloud SDK is only a dependency of programs that use Google Cloud KMS.
+package gcpkms
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/MicahParks/jwkset"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	// ErrKMS is returned when a Google Cloud KMS key version cannot be used to verify JWTs.
+	ErrKMS = errors.New("failed Google Cloud KMS key resolution")
+)
+
+// Client is the subset of the Google Cloud KMS API used by this package. *kms.KeyManagementClient implements it.
+type Client interface {
+	GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error)
+	ListCryptoKeyVersions(ctx context.Context, req *kmspb.ListCryptoKeyVersionsRequest, opts ...gax.CallOption) *kms.CryptoKeyVersionIterator
+}
+
+// Key is a Google Cloud KMS asymmetric signing key version.
+type Key struct {
+	// KID is the key ID of the JWT header that is resolved to the key version.
+	KID string
+	// Version is the resource name of the key version, in the format
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*.
+	Version string
+}
+
+// Options configure NewStorage.
+type Options struct {
+	// Client is the Google Cloud KMS client. It must not be nil.
+	Client Client
+	// CryptoKeys are resource names of asymmetric signing keys, in the format
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*. Every enabled version of each key is resolved for the key ID equal
+	// to the resource name of the version, so JWTs signed by a new version after rotation are verified after the next
+	// refresh and JWTs signed by a disabled or destroyed version are rejected.
+	CryptoKeys []string
+	// Ctx is used for the requests to Google Cloud KMS and ends the refresh goroutine when it's done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Keys are the key versions and the JWT key IDs they are resolved for.
+	Keys []Key
+	// RefreshErrorHandler is a function that consumes errors that happen during a refresh after the first one. Keys
+	// whose refresh failed are kept until a later refresh succeeds.
+	RefreshErrorHandler func(ctx context.Context, err error)
+	// RefreshInterval is the interval at which the enabled versions of CryptoKeys are listed again. The public key of a
+	// key version never changes, so it is only fetched once. It has no effect without CryptoKeys.
+	//
+	// This defaults to 1 hour.
+	RefreshInterval time.Duration
+	// Timeout bounds each refresh.
+	//
+	// This defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// algorithms are the JWT equivalents of the Google Cloud KMS signing algorithms. Algorithms without one, such as
+// EC_SIGN_SECP256K1_SHA256 and the raw RSA PKCS#1 algorithms, cannot be used to verify JWTs.
+var algorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]jwkset.ALG{
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:        jwkset.AlgES256,
+	kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:        jwkset.AlgES384,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256: jwkset.AlgRS256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256: jwkset.AlgRS256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256: jwkset.AlgRS256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512: jwkset.AlgRS512,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256:   jwkset.AlgPS256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256:   jwkset.AlgPS256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256:   jwkset.AlgPS256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:   jwkset.AlgPS512,
+}
+
+// crc32c is the table for the CRC32C checksums of Google Cloud KMS responses.
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// storage is a jwkset.Storage whose keys are refreshed from Google Cloud KMS.
+type storage struct {
+	jwkset.Storage
+	// list lists the resource names of the enabled versions of a key. It is replaced in tests, as the iterator of the
+	// Google Cloud KMS client cannot be faked.
+	list    func(ctx context.Context, cryptoKey string) ([]string, error)
+	mux     sync.Mutex
+	options Options
+	// versions are the resource names of the key versions of the keys in storage, by key ID.
+	versions map[string]string
+}
+
+// NewStorage creates a jwkset.Storage for the Google Cloud KMS key versions. Use it as the Storage option of a
+// keyfunc.Keyfunc or as the Given storage of a keyfunc.HTTPClient.
+//
+// The public keys of all key versions are fetched before NewStorage returns. If CryptoKeys is set, a goroutine lists
+// their enabled versions at the RefreshInterval. Provide the Ctx option to end it when it's no longer needed.
+func NewStorage(options Options) (jwkset.Storage, error) {
+	if options.Client == nil {
+		return nil, fmt.Errorf("%w: no Google Cloud KMS client given in options", ErrKMS)
+	}
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.RefreshInterval == 0 {
+		options.RefreshInterval = time.Hour
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 10 * time.Second
+	}
+	s := &storage{
+		Storage:  jwkset.NewMemoryStorage(),
+		options:  options,
+		versions: make(map[string]string),
+	}
+	s.list = s.listEnabledVersions
+
+	ctx, cancel := context.WithTimeout(options.Ctx, options.Timeout)
+	defer cancel()
+	err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(options.CryptoKeys) != 0 {
+		go s.refreshLoop()
+	}
+	return s, nil
+}
+
+func (s *storage) refreshLoop() {
+	ticker := time.NewTicker(s.options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.options.Ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(s.options.Ctx, s.options.Timeout)
+			err := s.refresh(ctx)
+			cancel()
+			if err != nil && s.options.RefreshErrorHandler != nil {
+				s.options.RefreshErrorHandler(ctx, err)
+			}
+		}
+	}
+}
+
+// refresh resolves the key versions for all key IDs, fetches the public keys of new key versions, and deletes the keys
+// of key versions that are no longer resolved. A key whose refresh failed is kept.
+func (s *storage) refresh(ctx context.Context) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var errs []error
+	versions := make(map[string]string, len(s.options.Keys))
+	for _, key := range s.options.Keys {
+		versions[key.KID] = key.Version
+	}
+	for _, cryptoKey := range s.options.CryptoKeys {
+		names, err := s.list(ctx, cryptoKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: could not list versions of key %q", errors.Join(err, ErrKMS), cryptoKey))
+			for kid, version := range s.versions {
+				if strings.HasPrefix(version, cryptoKey+"/") {
+					versions[kid] = version
+				}
+			}
+			continue
+		}
+		for _, name := range names {
+			versions[name] = name
+		}
+	}
+
+	for kid, version := range versions {
+		if s.versions[kid] == version {
+			continue
+		}
+		jwk, err := s.fetchPublicKey(ctx, kid, version)
+		if err == nil {
+			err = s.KeyWrite(ctx, jwk)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if _, ok := s.versions[kid]; ok {
+				versions[kid] = s.versions[kid]
+			} else {
+				delete(versions, kid)
+			}
+		}
+	}
+	for kid := range s.versions {
+		if _, ok := versions[kid]; !ok {
+			_, err := s.KeyDelete(ctx, kid)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%w: could not delete key ID %q from storage", errors.Join(err, ErrKMS), kid))
+				versions[kid] = s.versions[kid]
+			}
+		}
+	}
+	s.versions = versions
+	return errors.Join(errs...)
+}
+
+// fetchPublicKey fetches the public key of the key version as a JWK and verifies its checksum.
+func (s *storage) fetchPublicKey(ctx context.Context, kid, version string) (jwkset.JWK, error) {
+	resp, err := s.options.Client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: version})
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not get public key of key version %q", errors.Join(err, ErrKMS), version)
+	}
+	if resp.Name != version {
+		return jwkset.JWK{}, fmt.Errorf("%w: got public key of key version %q instead of %q", ErrKMS, resp.Name, version)
+	}
+	if resp.PemCrc32C != nil && int64(crc32.Checksum([]byte(resp.Pem), crc32c)) != resp.PemCrc32C.Value {
+		return jwkset.JWK{}, fmt.Errorf("%w: public key of key version %q was corrupted in transit", ErrKMS, version)
+	}
+	alg, ok := algorithms[resp.Algorithm]
+	if !ok {
+		return jwkset.JWK{}, fmt.Errorf("%w: key version %q has algorithm %s without a JWT equivalent", ErrKMS, version, resp.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not decode PEM public key of key version %q", ErrKMS, version)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not parse public key of key version %q", errors.Join(err, ErrKMS), version)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: alg,
+			KID: kid,
+			USE: jwkset.UseSig,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not create JWK for key version %q", errors.Join(err, ErrKMS), version)
+	}
+	return jwk, nil
+}
+
+// listEnabledVersions lists the resource names of the enabled versions of the key.
+func (s *storage) listEnabledVersions(ctx context.Context, cryptoKey string) ([]string, error) {
+	it := s.options.Client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
+		Filter: "state=ENABLED",
+		Parent: cryptoKey,
+	})
+	var names []string
+	for {
+		version, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, version.Name)
+	}
+}
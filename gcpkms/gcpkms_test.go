@@ -0,0 +1,165 @@
+package gcpkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+const (
+	cryptoKey = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	keyID     = "my-key-id"
+)
+
+// fakeClient is a Client backed by in-memory ECDSA keys, by key version resource name.
+type fakeClient struct {
+	getPublicKey int
+	keys         map[string]*ecdsa.PrivateKey
+}
+
+func (c *fakeClient) GetPublicKey(_ context.Context, req *kmspb.GetPublicKeyRequest, _ ...gax.CallOption) (*kmspb.PublicKey, error) {
+	c.getPublicKey++
+	priv, ok := c.keys[req.Name]
+	if !ok {
+		return nil, errors.New("key version not found")
+	}
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	p := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return &kmspb.PublicKey{
+		Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+		Name:      req.Name,
+		Pem:       p,
+		PemCrc32C: wrapperspb.Int64(int64(crc32.Checksum([]byte(p), crc32c))),
+	}, nil
+}
+
+func (c *fakeClient) ListCryptoKeyVersions(context.Context, *kmspb.ListCryptoKeyVersionsRequest, ...gax.CallOption) *kms.CryptoKeyVersionIterator {
+	panic("replaced in tests")
+}
+
+func TestNewStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v1, v2 := cryptoKey+"/cryptoKeyVersions/1", cryptoKey+"/cryptoKeyVersions/2"
+	client := &fakeClient{keys: map[string]*ecdsa.PrivateKey{v1: newKey(t), v2: newKey(t)}}
+
+	store, err := NewStorage(Options{
+		Client: client,
+		Ctx:    ctx,
+		Keys:   []Key{{KID: keyID, Version: v1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create storage. Error: %s", err)
+	}
+	k, err := keyfunc.New(keyfunc.Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signES256(t, client.keys[v1], keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+
+	_, err = NewStorage(Options{Client: client, Keys: []Key{{KID: keyID, Version: cryptoKey + "/cryptoKeyVersions/3"}}})
+	if !errors.Is(err, ErrKMS) {
+		t.Fatalf("Expected ErrKMS for a missing key version. Error: %v", err)
+	}
+}
+
+func TestStorageRotation(t *testing.T) {
+	v1, v2 := cryptoKey+"/cryptoKeyVersions/1", cryptoKey+"/cryptoKeyVersions/2"
+	client := &fakeClient{keys: map[string]*ecdsa.PrivateKey{v1: newKey(t), v2: newKey(t)}}
+	enabled := []string{v1}
+	var listErr error
+	s := &storage{
+		Storage: jwkset.NewMemoryStorage(),
+		list: func(context.Context, string) ([]string, error) {
+			return enabled, listErr
+		},
+		options:  Options{Client: client, CryptoKeys: []string{cryptoKey}},
+		versions: make(map[string]string),
+	}
+	ctx := context.Background()
+	k, err := keyfunc.New(keyfunc.Options{Storage: s})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	parse := func(version string) error {
+		_, err := jwt.Parse(signES256(t, client.keys[version], version), k.Keyfunc)
+		return err
+	}
+
+	err = s.refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	if parse(v1) != nil || parse(v2) == nil {
+		t.Fatalf("Expected only version 1 to be resolved.")
+	}
+
+	enabled = []string{v1, v2}
+	err = s.refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	if parse(v1) != nil || parse(v2) != nil {
+		t.Fatalf("Expected both versions to be resolved after rotation.")
+	}
+	if client.getPublicKey != 2 {
+		t.Fatalf("Expected the public key of each version to be fetched once, got %d requests.", client.getPublicKey)
+	}
+
+	listErr = errors.New("unavailable")
+	err = s.refresh(ctx)
+	if !errors.Is(err, ErrKMS) {
+		t.Fatalf("Expected ErrKMS when listing fails. Error: %v", err)
+	}
+	if parse(v1) != nil || parse(v2) != nil {
+		t.Fatalf("Expected keys to be kept when listing fails.")
+	}
+
+	enabled, listErr = []string{v2}, nil
+	err = s.refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	if !errors.Is(parse(v1), jwkset.ErrKeyNotFound) || parse(v2) != nil {
+		t.Fatalf("Expected the disabled version 1 to be deleted.")
+	}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	return priv
+}
+
+func signES256(t *testing.T, priv *ecdsa.PrivateKey, kid string) string {
+	token := jwt.New(jwt.SigningMethodES256)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	return signed
+}
@@ -0,0 +1,99 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// GivenKeyOptions are used to create a JWK from a given key with NewGivenCustomWithOptions and the other NewGiven
+// functions. Consider the options carefully as each field may have a security implication.
+type GivenKeyOptions struct {
+	// Algorithm is the given key's signing algorithm. Its value will be compared to unverified tokens' "alg" header.
+	//
+	// See RFC 8725 Section 3.1 for details.
+	// https://www.rfc-editor.org/rfc/rfc8725#section-3.1
+	//
+	// For a list of possible values, please see:
+	// https://www.rfc-editor.org/rfc/rfc7518#section-3.1
+	// https://www.iana.org/assignments/jose/jose.xhtml#web-signature-encryption-algorithms
+	Algorithm jwkset.ALG
+	// USE is the "use" parameter of the JWK.
+	//
+	// This defaults to jwkset.UseSig.
+	USE jwkset.USE
+}
+
+// NewGivenCustomWithOptions creates a JWK with the key ID from a given key, such as an HMAC secret or a public key, so
+// it can be used without building jwkset.JWKOptions by hand. The key must be a type supported by
+// github.com/MicahParks/jwkset. The JWK's "alg" and "use" parameters are set from the options, and a []byte key is
+// treated as a symmetric key.
+func NewGivenCustomWithOptions(kid string, key any, options GivenKeyOptions) (jwkset.JWK, error) {
+	if kid == "" {
+		return jwkset.JWK{}, fmt.Errorf("%w: given key must have a key ID", ErrKeyfunc)
+	}
+	if options.USE == "" {
+		options.USE = jwkset.UseSig
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: options.Algorithm,
+			KID: kid,
+			USE: options.USE,
+		},
+	}
+	if _, ok := key.([]byte); ok {
+		// Symmetric keys have no public part, so jwkset only accepts them as private.
+		jwkOptions.Marshal.Private = true
+	}
+	jwk, err := jwkset.NewJWKFromKey(key, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not create JWK for given key %q", errors.Join(err, ErrKeyfunc), kid)
+	}
+	return jwk, nil
+}
+
+// NewGivenECDSA creates a JWK with the key ID from a given ECDSA public key. The JWK's "alg" and "use" parameters are
+// set from the options.
+func NewGivenECDSA(kid string, key *ecdsa.PublicKey, options GivenKeyOptions) (jwkset.JWK, error) {
+	return NewGivenCustomWithOptions(kid, key, options)
+}
+
+// NewGivenEdDSA creates a JWK with the key ID from a given EdDSA public key. The JWK's "alg" and "use" parameters are
+// set from the options.
+func NewGivenEdDSA(kid string, key ed25519.PublicKey, options GivenKeyOptions) (jwkset.JWK, error) {
+	return NewGivenCustomWithOptions(kid, key, options)
+}
+
+// NewGivenHMAC creates a JWK with the key ID from a given HMAC key in a byte slice. The JWK's "alg" and "use"
+// parameters are set from the options, and the secret is kept as a symmetric key.
+func NewGivenHMAC(kid string, key []byte, options GivenKeyOptions) (jwkset.JWK, error) {
+	return NewGivenCustomWithOptions(kid, key, options)
+}
+
+// NewGivenRSA creates a JWK with the key ID from a given RSA public key. The JWK's "alg" and "use" parameters are
+// set from the options.
+func NewGivenRSA(kid string, key *rsa.PublicKey, options GivenKeyOptions) (jwkset.JWK, error) {
+	return NewGivenCustomWithOptions(kid, key, options)
+}
+
+// NewGiven creates a new Keyfunc from given JWKs, such as those created by NewGivenHMAC. It does not launch any
+// goroutines or make any network requests. To use given keys in addition to remote JWK Sets, use the AddGivenKey method
+// of KeyManager or the WithStorage option of NewWith.
+func NewGiven(given ...jwkset.JWK) (Keyfunc, error) {
+	store := jwkset.NewMemoryStorage()
+	for _, jwk := range given {
+		err := store.KeyWrite(context.Background(), jwk)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not write given JWK to storage", errors.Join(err, ErrKeyfunc))
+		}
+	}
+	return New(Options{
+		Storage: store,
+	})
+}
@@ -0,0 +1,63 @@
+package keyfunc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewGiven(t *testing.T) {
+	const (
+		edKID   = "given-eddsa"
+		hmacKID = "given-hmac"
+	)
+	secret := []byte("my-hmac-secret")
+	hmacJWK, err := NewGivenHMAC(hmacKID, secret, GivenKeyOptions{Algorithm: jwkset.AlgHS256})
+	if err != nil {
+		t.Fatalf("Failed to create given HMAC JWK. Error: %s", err)
+	}
+	if hmacJWK.Marshal().USE != jwkset.UseSig {
+		t.Fatalf("Expected the given JWK to default to %q, got %q.", jwkset.UseSig, hmacJWK.Marshal().USE)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	edJWK, err := NewGivenEdDSA(edKID, pub, GivenKeyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create given EdDSA JWK. Error: %s", err)
+	}
+
+	k, err := NewGiven(hmacJWK, edJWK)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signHMAC(t, secret, hmacKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the given HMAC key. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, edKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the given EdDSA key. Error: %s", err)
+	}
+
+	token := jwt.New(jwt.SigningMethodHS512)
+	token.Header[jwkset.HeaderKID] = hmacKID
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for a mismatched algorithm. Error: %v", err)
+	}
+
+	_, err = NewGivenHMAC("", secret, GivenKeyOptions{})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for a given key without a key ID. Error: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+module github.com/MicahParks/keyfunc/v3/gojose
+
+go 1.21
+
+require (
+	github.com/MicahParks/jwkset v0.8.0
+	github.com/MicahParks/keyfunc/v3 v3.3.8
+	github.com/go-jose/go-jose/v4 v4.0.5
+	github.com/golang-jwt/jwt/v5 v5.2.1
+)
+
+require (
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/time v0.9.0 // indirect
+)
+
+// This module uses APIs of keyfunc that are newer than v3.3.8. Until they are tagged, build against the parent module.
+replace github.com/MicahParks/keyfunc/v3 => ../
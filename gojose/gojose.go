@@ -0,0 +1,87 @@
+// Package gojose converts the JSON Web Keys of github.com/go-jose/go-jose/v4 into JWK Set storage, so services that
+// already hold keys as a jose.JSONWebKeySet can verify JWTs through a keyfunc.Keyfunc without encoding them to JSON
+// first.
+//
+// It is a separate module, so go-jose is only a dependency of programs that use it. Keys of the deprecated
+// gopkg.in/square/go-jose.v2 package have a different type; marshal them to JSON and use keyfunc.NewJWKSetJSON.
+package gojose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+var (
+	// ErrGoJOSE is returned when a go-jose JSON Web Key cannot be converted.
+	ErrGoJOSE = errors.New("failed go-jose key conversion")
+)
+
+// NewJWK converts a go-jose JSON Web Key into a jwkset.JWK. Private asymmetric keys are converted to their public key,
+// as only the public key is needed to verify JWTs. Symmetric keys are kept as they are.
+func NewJWK(key jose.JSONWebKey) (jwkset.JWK, error) {
+	if key.KeyID == "" {
+		return jwkset.JWK{}, fmt.Errorf("%w: key must have a key ID", ErrGoJOSE)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: jwkset.ALG(key.Algorithm),
+			KID: key.KeyID,
+			USE: jwkset.USE(key.Use),
+		},
+		X509: jwkset.JWKX509Options{
+			X5C: key.Certificates,
+		},
+	}
+	if key.CertificatesURL != nil {
+		jwkOptions.X509.X5U = key.CertificatesURL.String()
+	}
+	inter := key.Key
+	if _, ok := inter.([]byte); ok {
+		jwkOptions.Marshal.Private = true
+	} else if !key.IsPublic() {
+		inter = key.Public().Key
+	}
+	if inter == nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: unsupported key type %T for key ID %q", ErrGoJOSE, key.Key, key.KeyID)
+	}
+	jwk, err := jwkset.NewJWKFromKey(inter, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not create JWK for key ID %q", errors.Join(err, ErrGoJOSE), key.KeyID)
+	}
+	return jwk, nil
+}
+
+// NewStorage creates a jwkset.Storage with the go-jose JSON Web Keys. Use it as the Storage option of a keyfunc.Keyfunc
+// or as the Given storage of a keyfunc.HTTPClient.
+func NewStorage(keys ...jose.JSONWebKey) (jwkset.Storage, error) {
+	store := jwkset.NewMemoryStorage()
+	for _, key := range keys {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		err = store.KeyWrite(context.Background(), jwk)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not write JWK for key ID %q to storage", errors.Join(err, ErrGoJOSE), key.KeyID)
+		}
+	}
+	return store, nil
+}
+
+// New creates a keyfunc.Keyfunc from a go-jose JSON Web Key Set. It does not launch any goroutines or make any network
+// requests.
+func New(set jose.JSONWebKeySet) (keyfunc.Keyfunc, error) {
+	store, err := NewStorage(set.Keys...)
+	if err != nil {
+		return nil, err
+	}
+	return keyfunc.New(keyfunc.Options{
+		Storage: store,
+	})
+}
@@ -0,0 +1,89 @@
+package gojose
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	edKID   = "my-eddsa-key-id"
+	hmacKID = "my-hmac-key-id"
+	rsaKID  = "my-rsa-key-id"
+)
+
+func TestNew(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key. Error: %s", err)
+	}
+	secret := []byte("my-hmac-secret")
+	set := jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{Key: edPub, KeyID: edKID, Use: "sig"},
+			{Key: rsaPriv, KeyID: rsaKID, Algorithm: string(jose.RS256), Use: "sig"},
+			{Key: secret, KeyID: hmacKID, Algorithm: string(jose.HS256)},
+		},
+	}
+
+	k, err := New(set)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	rsaJWK, err := k.Storage().KeyRead(context.Background(), rsaKID)
+	if err != nil {
+		t.Fatalf("Failed to read RSA JWK. Error: %s", err)
+	}
+	if _, ok := rsaJWK.Key().(*rsa.PublicKey); !ok {
+		t.Fatalf("Expected the private RSA key to be converted to a public key, got %T.", rsaJWK.Key())
+	}
+
+	tests := []struct {
+		kid    string
+		key    any
+		method jwt.SigningMethod
+	}{
+		{kid: edKID, key: edPriv, method: jwt.SigningMethodEdDSA},
+		{kid: rsaKID, key: rsaPriv, method: jwt.SigningMethodRS256},
+		{kid: hmacKID, key: secret, method: jwt.SigningMethodHS256},
+	}
+	for _, tc := range tests {
+		token := jwt.New(tc.method)
+		token.Header[jwkset.HeaderKID] = tc.kid
+		signed, err := token.SignedString(tc.key)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		_, err = jwt.Parse(signed, k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT with key ID %q. Error: %s", tc.kid, err)
+		}
+	}
+}
+
+func TestNewJWKErrors(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	_, err = NewJWK(jose.JSONWebKey{Key: edPub})
+	if !errors.Is(err, ErrGoJOSE) {
+		t.Fatalf("Expected ErrGoJOSE for a key without a key ID. Error: %v", err)
+	}
+	_, err = NewJWK(jose.JSONWebKey{Key: "not a key", KeyID: edKID})
+	if !errors.Is(err, ErrGoJOSE) {
+		t.Fatalf("Expected ErrGoJOSE for an unsupported key type. Error: %v", err)
+	}
+}
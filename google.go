@@ -0,0 +1,140 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+const (
+	// GoogleIssuerURL is the issuer of Google ID tokens.
+	GoogleIssuerURL = "https://accounts.google.com"
+	// GoogleLegacyPEMURL is Google's legacy endpoint of PEM encoded X.509 certificates for ID tokens.
+	GoogleLegacyPEMURL = "https://www.googleapis.com/oauth2/v1/certs"
+)
+
+// GoogleOptions configure NewGoogle.
+type GoogleOptions struct {
+	// ClientIDs are the OAuth client IDs of the application. If set, the "aud" claim of a JWT must contain one of them.
+	ClientIDs []string
+	// Ctx is used for the discovery request and ends the refresh goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// IssuerURL is the issuer whose OIDC discovery document is used. The "iss" claim of a JWT must be the issuer, with
+	// or without the "https://" scheme, as Google issues both forms.
+	//
+	// This defaults to GoogleIssuerURL.
+	IssuerURL string
+	// LegacyPEMURL is a legacy endpoint of PEM encoded X.509 certificates, such as GoogleLegacyPEMURL, to read keys from
+	// instead of the JWK Set from discovery.
+	LegacyPEMURL string
+	// UnknownKIDRefreshInterval is the minimum time between refreshes caused by JWTs with an unknown key ID.
+	//
+	// This defaults to one minute.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the remote resource of the keys. The Client and HTTPTimeout are also used for the discovery
+	// request. Google rotates keys according to the Cache-Control header of the remote resource, so HonorCacheControl
+	// is always set.
+	URLOptions URLOptions
+}
+
+// NewGoogle creates a new Keyfunc for Google ID tokens. The JWK Set is found with OIDC discovery and refreshed as its
+// Cache-Control header expires. JWTs that are not issued by Google, or not for one of the ClientIDs if set, are
+// rejected with jwt.ErrTokenInvalidIssuer or jwt.ErrTokenInvalidAudience.
+func NewGoogle(options GoogleOptions) (Keyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.IssuerURL == "" {
+		options.IssuerURL = GoogleIssuerURL
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = time.Minute
+	}
+	options.URLOptions.HonorCacheControl = true
+	issuer := strings.TrimSuffix(options.IssuerURL, "/")
+	_, err := url.ParseRequestURI(issuer)
+	if err != nil {
+		return nil, redactError(fmt.Errorf("%w: failed to parse Google issuer URL %q", errors.Join(err, ErrKeyfunc), redact(options.IssuerURL)))
+	}
+
+	keysURL := options.LegacyPEMURL
+	if keysURL != "" {
+		options.URLOptions.ResponseDecoder = DecodePEMCertificates
+	} else {
+		client, timeout := options.URLOptions.discoveryClient()
+		ctx, cancel := context.WithTimeout(options.Ctx, timeout)
+		defer cancel()
+		discoveryURL := issuer + "/.well-known/openid-configuration"
+		source, found, err := fetchJWKSSource(ctx, client, discoveryURL)
+		if err != nil {
+			return nil, errors.Join(err, ErrKeyfunc)
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: no OIDC discovery document at %q", errors.Join(ErrOIDCDiscovery, ErrKeyfunc), redact(discoveryURL))
+		}
+		keysURL = source.url
+		options.URLOptions = source.urlOptions(options.URLOptions)
+	}
+	k, err := newProviderKeyfunc(options.Ctx, keysURL, options.URLOptions, options.UnknownKIDRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return claimsKeyfunc{
+		managedKeyfunc: k,
+		audiences:      options.ClientIDs,
+		issuers:        []string{issuer, strings.TrimPrefix(issuer, "https://")},
+	}, nil
+}
+
+// DecodePEMCertificates converts a JSON object of key IDs to PEM encoded X.509 certificates, the format of legacy
+// endpoints such as GoogleLegacyPEMURL, to JWK Set JSON. Use it as the ResponseDecoder option of HTTPStorageOptions.
+func DecodePEMCertificates(body []byte) (json.RawMessage, error) {
+	var certs map[string]string
+	err := json.Unmarshal(body, &certs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not unmarshal PEM certificates", errors.Join(err, ErrKeyfunc))
+	}
+	kids := make([]string, 0, len(certs))
+	for kid := range certs {
+		kids = append(kids, kid)
+	}
+	slices.Sort(kids)
+	jwks := jwkset.JWKSMarshal{
+		Keys: make([]jwkset.JWKMarshal, 0, len(kids)),
+	}
+	for _, kid := range kids {
+		block, _ := pem.Decode([]byte(certs[kid]))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("%w: kid %q is not a PEM encoded certificate", ErrKeyfunc, kid)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not parse certificate for kid %q", errors.Join(err, ErrKeyfunc), kid)
+		}
+		jwkOptions := jwkset.JWKOptions{
+			Metadata: jwkset.JWKMetadataOptions{
+				KID: kid,
+			},
+			X509: jwkset.JWKX509Options{
+				X5C: []*x509.Certificate{cert},
+			},
+		}
+		jwk, err := jwkset.NewJWKFromX5C(jwkOptions)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not create JWK for kid %q", errors.Join(err, ErrKeyfunc), kid)
+		}
+		jwks.Keys = append(jwks.Keys, jwk.Marshal())
+	}
+	return json.Marshal(jwks)
+}
@@ -0,0 +1,144 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewGoogle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": server.URL + "/oauth2/v3/certs"})
+		case "/oauth2/v3/certs":
+			raw, err := store.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON. Error: %s", err)
+			}
+			w.Header().Set("Cache-Control", "public, max-age=3600, must-revalidate, no-transform")
+			w.Header().Set("Age", "600")
+			_, _ = w.Write(raw)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	options := GoogleOptions{
+		ClientIDs: []string{"client.apps.googleusercontent.com"},
+		Ctx:       ctx,
+		IssuerURL: server.URL,
+	}
+	k, err := NewGoogle(options)
+	if err != nil {
+		t.Fatalf("Failed to create Google keyfunc. Error: %s", err)
+	}
+
+	tc := []struct {
+		name   string
+		claims jwt.MapClaims
+		err    error
+	}{
+		{name: "Valid", claims: jwt.MapClaims{"iss": server.URL, "aud": "client.apps.googleusercontent.com"}},
+		{name: "MultipleAudiences", claims: jwt.MapClaims{"iss": server.URL, "aud": []string{"other", "client.apps.googleusercontent.com"}}},
+		{name: "WrongIssuer", claims: jwt.MapClaims{"iss": "https://example.com", "aud": "client.apps.googleusercontent.com"}, err: jwt.ErrTokenInvalidIssuer},
+		{name: "WrongAudience", claims: jwt.MapClaims{"iss": server.URL, "aud": "other"}, err: jwt.ErrTokenInvalidAudience},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, c.claims)
+			token.Header[jwkset.HeaderKID] = keyID
+			signed, err := token.SignedString(priv)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			_, err = jwt.Parse(signed, k.Keyfunc)
+			if c.err == nil && err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected error to be %q. Error: %s", c.err, err)
+			}
+		})
+	}
+
+	for _, s := range k.Storage().(HTTPClient).HTTPStorages() {
+		next := s.(HTTPStorage).Status().NextScheduledRefresh
+		if until := time.Until(next); until < 49*time.Minute || until > 50*time.Minute {
+			t.Fatalf("Expected a refresh to be scheduled when the Cache-Control max-age expires, got %s.", until)
+		}
+	}
+}
+
+func TestNewGoogleLegacyPEM(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "keyfunc"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate. Error: %s", err)
+	}
+	certs := map[string]string{
+		keyID: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(certs)
+	}))
+	defer server.Close()
+
+	options := GoogleOptions{
+		Ctx:          ctx,
+		LegacyPEMURL: server.URL,
+	}
+	k, err := NewGoogle(options)
+	if err != nil {
+		t.Fatalf("Failed to create Google keyfunc. Error: %s", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": "accounts.google.com"})
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+}
+
+func TestDecodePEMCertificates(t *testing.T) {
+	_, err := DecodePEMCertificates([]byte(`{"kid":"not a certificate"}`))
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected error to be ErrKeyfunc. Error: %s", err)
+	}
+}
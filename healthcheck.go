@@ -0,0 +1,112 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrHealthCheck is the LastError of an endpoint whose health check failed.
+	ErrHealthCheck = errors.New("failed health check")
+)
+
+// validators are the HTTP cache validators of the most recent successful refresh from an endpoint, sent with
+// conditional GET health checks.
+type validators struct {
+	etag         string
+	lastModified string
+}
+
+// recordValidators remembers the cache validators of a successful refresh from the endpoint at the URL.
+func (s *httpStorage) recordValidators(u string, header http.Header) {
+	if s.options.HealthCheckInterval <= 0 {
+		return
+	}
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	if s.validators == nil {
+		s.validators = make(map[string]validators)
+	}
+	s.validators[u] = validators{
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+	}
+}
+
+// healthCheckLoop probes every endpoint at the HealthCheckInterval option until the Ctx option ends. If a probe
+// succeeds while the most recent refresh failed, the remote JWK Set is refreshed without waiting for the next refresh.
+func (s *httpStorage) healthCheckLoop() {
+	ticker := time.NewTicker(s.options.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.options.Ctx.Done():
+			return
+		case <-ticker.C:
+			recovered := false
+			for i, u := range s.endpoints() {
+				ctx, cancel := context.WithTimeout(s.options.Ctx, s.options.HTTPTimeout)
+				err := s.probe(ctx, u)
+				cancel()
+				s.recordProbe(i, err)
+				recovered = recovered || err == nil
+			}
+			if recovered && s.Status().LastError != nil {
+				ctx, cancel := context.WithTimeout(s.options.Ctx, s.options.HTTPTimeout)
+				err := s.Refresh(ctx)
+				if err != nil {
+					s.handleRefreshError(ctx, err)
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+// probe performs a health check of the endpoint at the URL without downloading the JWK Set, unless the HealthCheckMethod
+// option is GET and the endpoint ignores the cache validators.
+func (s *httpStorage) probe(ctx context.Context, u string) error {
+	req, err := http.NewRequestWithContext(ctx, s.options.HealthCheckMethod, u, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create HTTP request", errors.Join(err, ErrHealthCheck))
+	}
+	if s.options.HealthCheckMethod == http.MethodGet {
+		s.statusMux.Lock()
+		v := s.validators[u]
+		s.statusMux.Unlock()
+		if v.etag != "" {
+			req.Header.Set("If-None-Match", v.etag)
+		}
+		if v.lastModified != "" {
+			req.Header.Set("If-Modified-Since", v.lastModified)
+		}
+	}
+	if s.options.RequestHook != nil {
+		err = s.options.RequestHook(req)
+		if err != nil {
+			return fmt.Errorf("%w: request hook failed", errors.Join(err, ErrHealthCheck))
+		}
+	}
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to perform HTTP request", errors.Join(err, ErrHealthCheck))
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != s.options.HTTPExpectedStatus && resp.StatusCode != http.StatusNotModified {
+		return fmt.Errorf("%w: received status code %d", ErrHealthCheck, resp.StatusCode)
+	}
+	return nil
+}
+
+// recordProbe updates the health of the endpoint after a health check.
+func (s *httpStorage) recordProbe(i int, err error) {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	endpoint := &s.status.Endpoints[i]
+	endpoint.LastHealthCheck = s.now()
+	endpoint.record(redactError(err), endpoint.LastHealthCheck)
+}
@@ -0,0 +1,117 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestHealthCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	const etag = `"v1"`
+	type counts struct {
+		downloads, heads, notModified atomic.Int64
+	}
+	newServer := func(failing *atomic.Bool, c *counts) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			switch {
+			case r.Method == http.MethodHead:
+				c.heads.Add(1)
+				return
+			case r.Header.Get("If-None-Match") == etag:
+				c.notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			c.downloads.Add(1)
+			rawJWKS, err := serverStore.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+			}
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write(rawJWKS)
+		}))
+	}
+
+	var primaryFailing, mirrorFailing atomic.Bool
+	var primaryCounts, mirrorCounts counts
+	primaryFailing.Store(true)
+	primary := newServer(&primaryFailing, &primaryCounts)
+	defer primary.Close()
+	mirror := newServer(&mirrorFailing, &mirrorCounts)
+	defer mirror.Close()
+
+	store, err := NewHTTPStorage(primary.URL, HTTPStorageOptions{
+		Ctx:                 ctx,
+		FailoverURLs:        []string{mirror.URL},
+		HealthCheckInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	if store.Status().ActiveURL != mirror.URL {
+		t.Fatalf("Expected the mirror to be active while the primary endpoint fails.")
+	}
+	primaryFailing.Store(false)
+	time.Sleep(50 * time.Millisecond)
+	status := store.Status()
+	if !status.Endpoints[0].Healthy || status.Endpoints[0].LastHealthCheck.IsZero() {
+		t.Fatalf("Expected a health check to find the primary endpoint healthy, got %+v.", status.Endpoints[0])
+	}
+	if primaryCounts.heads.Load() == 0 || primaryCounts.downloads.Load() != 0 {
+		t.Fatalf("Expected health checks to not download the JWK Set.")
+	}
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	if store.Status().ActiveURL != primary.URL {
+		t.Fatalf("Expected the primary endpoint to be used before its cooldown because a health check found it healthy.")
+	}
+
+	mirrorFailing.Store(true)
+	time.Sleep(50 * time.Millisecond)
+	if store.Status().Endpoints[1].Healthy {
+		t.Fatalf("Expected a health check to find the mirror endpoint unhealthy.")
+	}
+
+	var failing atomic.Bool
+	var c counts
+	failing.Store(true)
+	server := newServer(&failing, &c)
+	defer server.Close()
+	store, err = NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:                       ctx,
+		HealthCheckInterval:       10 * time.Millisecond,
+		HealthCheckMethod:         http.MethodGet,
+		NoErrorReturnFirstHTTPReq: true,
+		RefreshErrorHandler:       func(ctx context.Context, err error) {},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	failing.Store(false)
+	time.Sleep(50 * time.Millisecond)
+	_, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Expected a successful health check to refresh the failed JWK Set. Error: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	// The first health check has no cache validators, then the refresh records them.
+	if c.downloads.Load() != 2 || c.notModified.Load() == 0 {
+		t.Fatalf("Expected conditional health checks after the JWK Set was refreshed, got %d downloads.", c.downloads.Load())
+	}
+}
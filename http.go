@@ -0,0 +1,862 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrHTTPStorage is returned when a keyfunc HTTP storage fails to get or process a remote JWK Set.
+	ErrHTTPStorage = errors.New("failed HTTP JWK Set storage")
+	// ErrSkipRefresh can be returned by a ResponseHook to keep the keys currently in storage without processing the
+	// HTTP response. The refresh is considered successful.
+	ErrSkipRefresh = errors.New("skip JWK Set refresh")
+	// ErrPinnedKeyMissing is returned when a refreshed JWK Set does not contain a pinned key. The keys in storage are
+	// not replaced.
+	ErrPinnedKeyMissing = errors.New("pinned key missing from JWK Set")
+	// ErrUnexpectedContentType is returned when the Content-Type of a refresh response is not one of the ContentTypes
+	// option.
+	ErrUnexpectedContentType = errors.New("unexpected Content-Type of JWK Set response")
+)
+
+const (
+	// ContentTypeJWK is the media type of a single JWK registered by RFC 7517.
+	ContentTypeJWK = "application/jwk+json"
+	// ContentTypeJWKSet is the media type of a JWK Set registered by RFC 7517.
+	ContentTypeJWKSet = "application/jwk-set+json"
+)
+
+// HTTPStorageOptions are used to configure the behavior of NewHTTPStorage. They mirror
+// jwkset.HTTPClientStorageOptions.
+type HTTPStorageOptions struct {
+	// Client is the HTTP client to use for requests.
+	//
+	// This defaults to http.DefaultClient.
+	Client *http.Client
+
+	// ContentTypes are the media types of the Content-Type header accepted in refresh responses, compared
+	// case-insensitively and without parameters. A response with another media type, such as the HTML error page of a
+	// proxy or captive portal, fails the refresh with ErrUnexpectedContentType before its body is read. A typical value
+	// is []string{ContentTypeJWKSet, "application/json"}. If empty, any Content-Type is accepted.
+	ContentTypes []string
+
+	// Ctx is used when performing HTTP requests. It is also used to end the refresh goroutine when it's no longer
+	// needed.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+
+	// DiskCache persists each successfully refreshed JWK Set to disk. If the first HTTP request fails, the persisted JWK
+	// Set is used instead.
+	DiskCache DiskCacheOptions
+
+	// FetchRateLimit limits the HTTP requests for the remote JWK Set, including retries. Each request waits for the
+	// limiter until the context of the refresh ends. Share one limiter between the storages of many Keyfuncs, such as
+	// the per-tenant Keyfuncs of a TenantKeyfunc, to bound the aggregate traffic to an identity provider. If nil,
+	// requests are not limited.
+	FetchRateLimit *rate.Limiter
+
+	// HTTPExpectedStatus is the expected HTTP status code for the HTTP request.
+	//
+	// This defaults to http.StatusOK.
+	HTTPExpectedStatus int
+
+	// DuplicateKIDPolicy determines which JWKs are ingested when the remote JWK Set contains the same key ID more than
+	// once. It defaults to DuplicateKIDKeepBoth.
+	DuplicateKIDPolicy DuplicateKIDPolicy
+
+	// HTTPMethod is the HTTP method to use for the HTTP request.
+	//
+	// This defaults to http.MethodGet.
+	HTTPMethod string
+
+	// HTTPTimeout is the timeout for the HTTP request. When the Ctx option is also provided, this value is used for a
+	// child context.
+	//
+	// This defaults to time.Minute.
+	HTTPTimeout time.Duration
+
+	// NoErrorReturnFirstHTTPReq will create the storage without error if the first HTTP request fails.
+	NoErrorReturnFirstHTTPReq bool
+
+	// OnDemand launches no goroutines or timers, for environments such as serverless functions that freeze background
+	// work between invocations. NewHTTPStorage does not fetch the remote JWK Set. Instead, it is fetched synchronously
+	// by the first key read, and again by the first key read after the RefreshInterval option or a refresh scheduled by
+	// the HonorCacheControl, HonorKeyExpiry, or HonorRefreshMetadata options is due. Concurrent key reads wait for the
+	// same refresh, and MinRefreshInterval still applies. If a refresh fails, the previous keys keep being used and the
+	// error is given to RefreshErrorHandler. A key read fails only if the remote JWK Set was never fetched. The
+	// HealthCheckInterval and StalenessThreshold options are ignored. This is the mechanism of OnDemandStorage.
+	OnDemand bool
+
+	// NoRefreshUnknownKID prevents an HTTPClient from refreshing this storage when a key with an unknown key ID is
+	// trying to be read.
+	NoRefreshUnknownKID bool
+
+	// ParseWarningHandler is called for every JWK in the remote JWK Set that is skipped because it cannot be parsed, and
+	// for every JWK with a duplicate key ID.
+	ParseWarningHandler ParseWarningHandler
+
+	// PinnedKIDs are key IDs that must all exist in the remote JWK Set. A refresh result without all of them is rejected
+	// with ErrPinnedKeyMissing and the previous keys are kept. This protects against an attacker who can alter the
+	// remote JWK Set swapping in only their own keys.
+	PinnedKIDs []string
+
+	// PinnedThumbprints are RFC 7638 SHA-256 thumbprints, base64url encoded without padding, of keys that must exist in
+	// the remote JWK Set. They are checked like PinnedKIDs, so a refresh result without all of them is rejected.
+	PinnedThumbprints []string
+
+	// HonorCacheControl schedules a refresh when the max-age of the Cache-Control header of a successful response
+	// expires, less the Age header. This follows identity providers, such as Google, that rotate keys according to the
+	// caching headers of their JWK Set. Responses with a no-cache or no-store directive or without a max-age do not
+	// schedule a refresh. Refreshes are scheduled at most once per minute.
+	HonorCacheControl bool
+
+	// HonorKeyExpiry treats expiry metadata on the JWKs in the remote JWK Set as authoritative. The "exp" and "nbf"
+	// parameters are read as NumericDate values, like the claims of a JWT, and the validity period of the first X.509
+	// certificate in the "x5c" parameter also applies. Keys are not read before they are valid or after they expire. A
+	// refresh is scheduled KeyExpiryRefreshLead before the earliest upcoming expiry, so replacement keys can be loaded
+	// in time. JWKs with an "exp" or "nbf" parameter that is not a number are skipped.
+	HonorKeyExpiry bool
+
+	// HonorRefreshMetadata schedules a refresh according to top-level members of the remote JWK Set that some
+	// federations publish: "nextUpdate" or "exp", as a NumericDate or an RFC 3339 timestamp, and "refresh_hint", as a
+	// number of seconds. The earliest applies, bounded by RefreshMetadataMin and RefreshMetadataMax. A JWK Set without
+	// these members does not schedule a refresh.
+	HonorRefreshMetadata bool
+
+	// RefreshMetadataMin is the shortest wait for a refresh scheduled by HonorRefreshMetadata, including when the time
+	// in the remote JWK Set has already passed.
+	//
+	// This defaults to one minute.
+	RefreshMetadataMin time.Duration
+
+	// RefreshMetadataMax is the longest wait for a refresh scheduled by HonorRefreshMetadata.
+	//
+	// This defaults to 24 hours.
+	RefreshMetadataMax time.Duration
+
+	// KeyExpiryRefreshLead is how long before the earliest upcoming key expiry a refresh is scheduled when
+	// HonorKeyExpiry is set.
+	//
+	// This defaults to one minute.
+	KeyExpiryRefreshLead time.Duration
+
+	// KeyWhitelist filters the JWKs ingested from the remote JWK Set. Filtered JWKs are reported by SkippedKeys.
+	KeyWhitelist KeyWhitelist
+
+	// KeyTypePolicies filter the JWKs ingested from the remote JWK Set by their key type. JWKs of a key type with a
+	// GivenOnly policy are always filtered. Filtered JWKs are reported by SkippedKeys.
+	KeyTypePolicies KeyTypePolicies
+
+	// DeduplicateKeys shares one parsed cryptographic key between JWKs with identical key material, as identified by the
+	// members of their RFC 7638 thumbprint and their "x5c" certificate chain. This reduces memory and parse time for
+	// large JWK Sets of federations that publish the same key under several key IDs. JWKs with private asymmetric key
+	// material are not deduplicated.
+	DeduplicateKeys bool
+
+	// LenientParsing also accepts a remote JWK Set that is a bare JSON array of JWKs instead of an object with a "keys"
+	// member, as returned by some homegrown issuers. The array is converted to a JWK Set before it is processed and
+	// persisted to the DiskCache.
+	LenientParsing bool
+
+	// StrictParsing fails the refresh if any JWK in the remote JWK Set cannot be parsed, keeping the previous keys. This
+	// is for environments where a partially loaded JWK Set is worse than an explicit error.
+	StrictParsing bool
+
+	// StrictRFC7517 skips JWKs in the remote JWK Set that deviate from RFC 7517, such as with padded base64url values or
+	// an uppercase "kty" parameter, as if they could not be parsed, with ErrRFC7517. This detects noncompliant issuers,
+	// especially along with ParseWarningHandler or StrictParsing. By default, such deviations are tolerated.
+	StrictRFC7517 bool
+
+	// LenientNormalization fixes common deviations from RFC 7517 in the JWKs of the remote JWK Set from sloppy issuers
+	// before they are parsed: whitespace in base64 values, standard base64 encoding or padding in base64url values,
+	// base64url encoding in "x5c" certificates, and a "kty" or "crv" parameter with the wrong case, such as "ed25519".
+	// Each fix is reported to ParseWarningHandler with ErrJWKNormalized.
+	LenientNormalization bool
+
+	// Retry configures retries within a single refresh. The zero value does not retry.
+	Retry RetryOptions
+
+	// RequestHook is called with each HTTP request for the remote JWK Set before it is sent. It may modify the request,
+	// for example, to add a correlation ID header. Returning an error aborts the refresh.
+	RequestHook func(req *http.Request) error
+
+	// ResponseDecoder converts the body of a successful response to JWK Set JSON before it is processed, for remote
+	// resources in another format, such as a map of key IDs to PEM encoded X.509 certificates. See
+	// DecodePEMCertificates. The decoded JWK Set is what is persisted to the DiskCache. If nil, the body must be a JWK
+	// Set.
+	ResponseDecoder func(body []byte) (json.RawMessage, error)
+
+	// ResponseHook is called with each HTTP response for the remote JWK Set before the status code is checked and the
+	// body is processed. The body must not be consumed. Returning ErrSkipRefresh keeps the keys currently in storage,
+	// which is useful for custom caching logic. Returning any other error aborts the refresh.
+	ResponseHook func(resp *http.Response) error
+
+	// FailureThreshold is the number of consecutive refresh failures after which FailureThresholdHandler is called. This
+	// allows alerting on sustained outages rather than single failures. If zero, the handler is never called.
+	FailureThreshold int
+
+	// FailureThresholdHandler is called when the number of consecutive refresh failures reaches FailureThreshold. It is
+	// called again only after a successful refresh resets the count. This is distinct from RefreshErrorHandler, which
+	// is called for every failure.
+	FailureThresholdHandler func(ctx context.Context, failures int, err error)
+
+	// FailureThresholdUnhealthy marks the storage as unhealthy in its Status while the number of consecutive refresh
+	// failures is at or above FailureThreshold.
+	FailureThresholdUnhealthy bool
+
+	// FailoverURLs are endpoints that serve the same JWK Set as the URL given to NewHTTPStorage, in order of priority,
+	// such as a regional mirror and a static backup. Each refresh uses the first healthy endpoint and fails over to the
+	// next when a refresh from it fails, including its retries. The health of each endpoint is reported by the
+	// Endpoints of Status. Keys are attributed to the URL given to NewHTTPStorage regardless of the endpoint.
+	FailoverURLs []string
+
+	// FailoverCooldown is how long an endpoint is skipped in favor of the endpoints after it once a refresh from it
+	// fails. When every endpoint is skipped, they are all tried in order of priority.
+	//
+	// This defaults to time.Minute.
+	FailoverCooldown time.Duration
+
+	// HealthCheckInterval launches a "health check goroutine" that probes the URL given to NewHTTPStorage and the
+	// FailoverURLs option at the interval, which is typically shorter than the RefreshInterval option. A probe does
+	// not download the JWK Set. It succeeds with the HTTPExpectedStatus option or 304 Not Modified and updates the
+	// Endpoints of Status, so failover reacts to outages and recoveries between refreshes. If a probe succeeds while
+	// the most recent refresh failed, the remote JWK Set is refreshed right away. If zero, endpoints are not probed.
+	//
+	// Provide the Ctx option to end the goroutine when it's no longer needed.
+	HealthCheckInterval time.Duration
+
+	// HealthCheckMethod is the HTTP method of the probes of the HealthCheckInterval option. With http.MethodGet, the
+	// probe is a conditional GET request with the ETag and Last-Modified headers of the most recent successful refresh
+	// from the endpoint, so an unchanged JWK Set is not downloaded.
+	//
+	// This defaults to http.MethodHead.
+	HealthCheckMethod string
+
+	// StalenessThreshold publishes EventStale to the subscribers of Subscribe when no refresh has succeeded for this
+	// long, counted from the creation of the storage or its most recent successful refresh. If zero, EventStale is
+	// never published.
+	StalenessThreshold time.Duration
+
+	// RefreshErrorHandler is a function that consumes errors that happen during an HTTP refresh.
+	//
+	// If NoErrorReturnFirstHTTPReq is set, this function will be called when if the first HTTP request fails.
+	RefreshErrorHandler func(ctx context.Context, err error)
+
+	// RefreshTimingHandler is called with the timing of every refresh, successful or not. Use it to record refresh
+	// latency histograms with a metrics library.
+	RefreshTimingHandler func(ctx context.Context, timing RefreshTiming)
+
+	// MinRefreshInterval is the minimum time between the starts of refreshes of any kind, from the RefreshInterval,
+	// HonorCacheControl, HonorKeyExpiry, and HonorRefreshMetadata options, unknown key IDs, or calls to Refresh. This
+	// protects the remote resource from misconfiguration. A refresh requested while another is in progress waits for it
+	// and returns its result. Any other refresh requested sooner is suppressed and keeps the current keys. Both are
+	// counted by the SuppressedRefreshes of Status. If zero, refreshes are not limited.
+	//
+	// With the OnDemand option, this defaults to one minute.
+	MinRefreshInterval time.Duration
+
+	// RefreshInterval is the interval at which the HTTP URL is refreshed and the JWK Set is processed. This option will
+	// launch a "refresh goroutine" to refresh the remote HTTP resource at the given interval.
+	//
+	// Provide the Ctx option to end the goroutine when it's no longer needed.
+	RefreshInterval time.Duration
+
+	// ValidateOptions are the options to use when validating the JWKs.
+	ValidateOptions jwkset.JWKValidateOptions
+
+	// X5CTrust validates the "x5c" certificate chains of the JWKs in the remote JWK Set. JWKs that fail validation are
+	// filtered and reported by SkippedKeys. If nil, certificate chains are not validated.
+	X5CTrust *X5CTrust
+}
+
+// RetryOptions configure retries within a single refresh of a remote JWK Set. Only connection errors, timeouts of a
+// single attempt, and HTTP status codes of 500 or above are retried.
+type RetryOptions struct {
+	// AttemptTimeout is the timeout for each attempt. It is applied to a child of the refresh's context, so it should be
+	// shorter than HTTPTimeout for retries to happen.
+	//
+	// If zero, only the refresh's context bounds each attempt.
+	AttemptTimeout time.Duration
+	// Delay is the time to wait between attempts.
+	Delay time.Duration
+	// Retries is the number of times to retry after the first attempt fails.
+	Retries int
+}
+
+// HTTPStorage is a jwkset.Storage for a remote HTTP resource. Unlike jwkset.NewStorageFromHTTP, keys with custom key
+// types are parsed with the parsers given to RegisterKeyType.
+type HTTPStorage interface {
+	jwkset.Storage
+	ThumbprintReader
+	// Refresh performs an HTTP request for the remote JWK Set and replaces the keys in storage with the result.
+	Refresh(ctx context.Context) error
+	// RefreshWithReport is like Refresh, but reports the HTTP status code, timing, error, and which key IDs were added,
+	// removed, or unchanged, so operational tooling that triggers refreshes can log exactly what changed.
+	RefreshWithReport(ctx context.Context) RefreshReport
+	// SkippedKeys returns the JWKs that were skipped because they could not be parsed or were filtered by the
+	// KeyWhitelist option in the most recent JWK Set that was processed.
+	SkippedKeys() []SkippedKey
+	// Provenance reports when the key ID was first and last seen in the remote JWK Set. It is empty if the key ID is
+	// not in the most recent JWK Set that was processed.
+	Provenance(kid string) []KeyProvenance
+	// Status reports the health of the remote JWK Set based on recent refreshes.
+	Status() HTTPStorageStatus
+	// URL is the URL of the remote JWK Set.
+	URL() string
+	// RefreshSettings returns the options that control how often the remote JWK Set is fetched.
+	RefreshSettings() RefreshSettings
+	// SetRefreshSettings changes the options that control how often the remote JWK Set is fetched. It is safe to call
+	// while the HTTPStorage is in use. A changed RefreshInterval restarts the interval from the time of the call,
+	// launching the "refresh goroutine" if needed. The other settings apply to the next refresh.
+	SetRefreshSettings(settings RefreshSettings)
+	// Subscribe returns a channel of the events of the remote JWK Set from now on, so applications can react to
+	// refreshes, key rotations, and outages without polling Status. Events are dropped rather than block refreshes
+	// when the channel is full, so receive from it promptly. The subscription ends and the channel is closed when the
+	// context or the Ctx option ends.
+	Subscribe(ctx context.Context) <-chan Event
+}
+
+// responseDecoder converts the body of a remote resource to JWK Set JSON. If the returned refresh hint is positive, a
+// refresh is scheduled after it.
+type responseDecoder func(body []byte) (raw json.RawMessage, refreshHint time.Duration, err error)
+
+type httpStorage struct {
+	*memoryStorage
+	cancel     context.CancelFunc
+	decode     responseDecoder
+	events     eventBus
+	gate       refreshGate
+	leaves     *x5cLeafCache
+	options    HTTPStorageOptions
+	provenance map[string]KeyProvenance
+	scheduled  *time.Timer
+	settings   *refreshSettings
+	skipped    []SkippedKey
+	stale      *time.Timer
+	status     HTTPStorageStatus
+	statusMux  sync.Mutex
+	url        string
+	validators map[string]validators
+}
+
+// NewHTTPStorage creates a new HTTPStorage for the remote JWK Set at the given URL. If the RefreshInterval option is
+// set, a "refresh goroutine" is launched to refresh the remote HTTP resource at the given interval.
+//
+// A remote resource with a single JWK, identified by the ContentTypeJWK media type or by a "kty" member without a
+// "keys" member, is treated as a JWK Set with one key.
+func NewHTTPStorage(remoteJWKSetURL string, options HTTPStorageOptions) (HTTPStorage, error) {
+	var decode responseDecoder
+	if options.ResponseDecoder != nil {
+		decode = func(body []byte) (json.RawMessage, time.Duration, error) {
+			raw, err := options.ResponseDecoder(body)
+			return raw, 0, err
+		}
+	}
+	return newHTTPStorage(remoteJWKSetURL, options, decode)
+}
+
+// newHTTPStorage is NewHTTPStorage with a decoder for remote resources that are not a JWK Set. It takes precedence
+// over the ResponseDecoder option.
+func newHTTPStorage(remoteJWKSetURL string, options HTTPStorageOptions, decode responseDecoder) (HTTPStorage, error) {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.HTTPExpectedStatus == 0 {
+		options.HTTPExpectedStatus = http.StatusOK
+	}
+	if options.HTTPTimeout == 0 {
+		options.HTTPTimeout = time.Minute
+	}
+	if options.HTTPMethod == "" {
+		options.HTTPMethod = http.MethodGet
+	}
+	if options.KeyExpiryRefreshLead == 0 {
+		options.KeyExpiryRefreshLead = time.Minute
+	}
+	if options.RefreshMetadataMin == 0 {
+		options.RefreshMetadataMin = minScheduledRefresh
+	}
+	if options.RefreshMetadataMax == 0 {
+		options.RefreshMetadataMax = 24 * time.Hour
+	}
+	if options.FailoverCooldown == 0 {
+		options.FailoverCooldown = time.Minute
+	}
+	if options.HealthCheckMethod == "" {
+		options.HealthCheckMethod = http.MethodHead
+	}
+	if options.OnDemand && options.MinRefreshInterval == 0 {
+		options.MinRefreshInterval = time.Minute
+	}
+	var err error
+	for _, u := range append([]string{remoteJWKSetURL}, options.FailoverURLs...) {
+		_, err = url.ParseRequestURI(u)
+		if err != nil {
+			return nil, redactError(fmt.Errorf("%w: failed to parse given URL %q", errors.Join(err, ErrHTTPStorage), u))
+		}
+	}
+	if options.DiskCache.Path != "" && len(options.DiskCache.HMACKey) == 0 {
+		return nil, fmt.Errorf("%w: an HMAC key is required for the disk cache", ErrHTTPStorage)
+	}
+	var cancel context.CancelFunc
+	options.Ctx, cancel = context.WithCancel(options.Ctx)
+	s := &httpStorage{
+		cancel:        cancel,
+		decode:        decode,
+		leaves:        newX5CLeafCache(),
+		memoryStorage: newMemoryStorage(),
+		options:       options,
+		settings:      newRefreshSettings(options),
+		status: HTTPStorageStatus{
+			Endpoints: newEndpointStatuses(remoteJWKSetURL, options),
+			Healthy:   true,
+		},
+		url: remoteJWKSetURL,
+	}
+
+	context.AfterFunc(options.Ctx, s.closeEvents)
+	if options.OnDemand {
+		return s, nil
+	}
+	if options.StalenessThreshold > 0 {
+		s.stale = time.AfterFunc(options.StalenessThreshold, s.publishStale)
+	}
+
+	if options.RefreshInterval != 0 {
+		s.startRefreshLoop()
+	}
+	if options.HealthCheckInterval > 0 {
+		go s.healthCheckLoop()
+	}
+
+	ctx, cancelFirst := context.WithTimeout(options.Ctx, options.HTTPTimeout)
+	defer cancelFirst()
+	err = s.Refresh(ctx)
+	if err != nil && options.DiskCache.Path != "" {
+		diskErr := s.loadDiskCache()
+		if diskErr == nil {
+			s.handleRefreshError(ctx, err)
+			return s, nil
+		}
+		err = errors.Join(err, diskErr)
+	}
+	if err != nil {
+		if options.NoErrorReturnFirstHTTPReq {
+			s.handleRefreshError(ctx, err)
+			return s, nil
+		}
+		s.stop()
+		return nil, fmt.Errorf("%w: failed to perform first HTTP request for JWK Set", err)
+	}
+
+	return s, nil
+}
+
+// refreshGate runs one refresh at a time and starts refreshes at most once per minimum interval. A refresh requested
+// while another is in progress waits for it and gets its report. Any other refresh requested sooner is suppressed.
+type refreshGate struct {
+	inflight  *refreshCall
+	lastStart time.Time
+	mux       sync.Mutex
+}
+
+// refreshCall is a refresh in progress that other refreshes wait for.
+type refreshCall struct {
+	done   chan struct{}
+	report RefreshReport
+}
+
+// do runs refresh unless it waits for a refresh in progress or is suppressed, in which case suppressed is called first
+// and the report is of the refresh in progress or has Suppressed set. An error is only returned if ctx ends while
+// waiting.
+func (g *refreshGate) do(ctx context.Context, now time.Time, minInterval time.Duration, refresh func(ctx context.Context) RefreshReport, suppressed func()) (RefreshReport, error) {
+	g.mux.Lock()
+	if call := g.inflight; call != nil {
+		g.mux.Unlock()
+		suppressed()
+		select {
+		case <-call.done:
+			return call.report, nil
+		case <-ctx.Done():
+			return RefreshReport{}, ctx.Err()
+		}
+	}
+	if !g.lastStart.IsZero() && now.Sub(g.lastStart) < minInterval {
+		g.mux.Unlock()
+		suppressed()
+		return RefreshReport{Suppressed: true}, nil
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	g.inflight = call
+	g.lastStart = now
+	g.mux.Unlock()
+
+	call.report = refresh(ctx)
+	g.mux.Lock()
+	g.inflight = nil
+	g.mux.Unlock()
+	close(call.done)
+	return call.report, nil
+}
+
+func (s *httpStorage) Refresh(ctx context.Context) error {
+	return s.RefreshWithReport(ctx).Err
+}
+func (s *httpStorage) RefreshWithReport(ctx context.Context) RefreshReport {
+	minInterval := s.settings.get().MinRefreshInterval
+	if minInterval <= 0 && !s.options.OnDemand {
+		return s.refreshNow(ctx)
+	}
+	report, err := s.gate.do(ctx, s.now(), minInterval, s.refreshNow, s.recordSuppressed)
+	if err != nil {
+		return RefreshReport{
+			Err: fmt.Errorf("%w: context ended while waiting for refresh in progress", errors.Join(err, ErrHTTPStorage)),
+			URL: redact(s.url),
+		}
+	}
+	if report.Suppressed {
+		set, custom := s.keys()
+		report.Unchanged = keyIDs(set, custom)
+		report.URL = redact(s.url)
+	}
+	return report
+}
+
+// refreshNow performs a refresh and records its status and timing.
+func (s *httpStorage) refreshNow(ctx context.Context) RefreshReport {
+	report := RefreshReport{URL: redact(s.url)}
+	beforeSet, beforeCustom := s.keys()
+	start := time.Now()
+	s.publish(EventRefreshStarted, "", nil)
+	report.Err = redactError(refreshCause(s.options.Ctx, ctx, s.refresh(ctx, &report)))
+	report.Timing.Total = time.Since(start)
+	s.recordRefresh(ctx, report.Err, report.Timing)
+	if s.options.RefreshTimingHandler != nil {
+		s.options.RefreshTimingHandler(ctx, report.Timing)
+	}
+	afterSet, afterCustom := s.keys()
+	report.diff(beforeSet, beforeCustom, afterSet, afterCustom)
+	s.publishKeyChanges(report)
+	return report
+}
+func (s *httpStorage) SkippedKeys() []SkippedKey {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	return slices.Clone(s.skipped)
+}
+func (s *httpStorage) Status() HTTPStorageStatus {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	status := s.status
+	status.Endpoints = slices.Clone(status.Endpoints)
+	return status
+}
+func (s *httpStorage) URL() string {
+	return s.url
+}
+
+// stop ends the "refresh goroutine" and any scheduled refresh, as if the Ctx option was cancelled.
+func (s *httpStorage) stop() {
+	s.cancel()
+}
+
+func (s *httpStorage) refresh(ctx context.Context, report *RefreshReport) error {
+	if len(s.options.FailoverURLs) > 0 {
+		return s.refreshFailover(ctx, report)
+	}
+	err := s.refreshFrom(ctx, report, s.url)
+	if s.options.HealthCheckInterval > 0 {
+		s.recordEndpoint(0, err)
+	}
+	return err
+}
+
+// refreshFrom refreshes the keys in storage from the endpoint at the URL.
+func (s *httpStorage) refreshFrom(ctx context.Context, report *RefreshReport, u string) error {
+	timing := &report.Timing
+	var raw []byte
+	var header http.Header
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		timing.Attempts++
+		raw, header, retryable, err = s.attempt(ctx, report, u)
+		if err == nil || !retryable || attempt >= s.options.Retry.Retries || ctx.Err() != nil {
+			break
+		}
+		if s.options.Retry.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: context ended while waiting to retry", errors.Join(err, ctx.Err()))
+			case <-time.After(s.options.Retry.Delay):
+			}
+		}
+	}
+	if errors.Is(err, ErrSkipRefresh) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var hint time.Duration
+	if s.decode != nil {
+		raw, hint, err = s.decode(raw)
+		if err != nil {
+			return fmt.Errorf("%w: failed to decode JWK Set response", errors.Join(err, ErrHTTPStorage))
+		}
+	}
+	raw, err = wrapSingleJWK(raw, header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("%w: failed to process single JWK response", errors.Join(err, ErrHTTPStorage))
+	}
+	if s.options.LenientParsing {
+		raw = wrapJWKArray(raw)
+	}
+	result, err := s.ingest(raw)
+	if err != nil {
+		return fmt.Errorf("%w: failed to process JWK Set response", err)
+	}
+	var after time.Duration
+	if maxAge, ok := cacheControlMaxAge(header); s.options.HonorCacheControl && ok && maxAge > 0 {
+		after = max(maxAge, minScheduledRefresh)
+	}
+	if hint > 0 && (after == 0 || hint < after) {
+		after = hint
+	}
+	if s.options.HonorRefreshMetadata {
+		if wait, ok := s.refreshMetadataWait(raw); ok && (after == 0 || wait < after) {
+			after = wait
+		}
+	}
+	s.scheduleRefresh(result, after)
+	s.recordValidators(u, header)
+	if s.options.DiskCache.Path != "" {
+		err = s.options.DiskCache.save(s.url, s.now(), raw)
+		if err != nil {
+			s.handleRefreshError(ctx, err)
+		}
+	}
+	return nil
+}
+
+// loadDiskCache replaces the keys in storage with the JWK Set persisted to disk.
+func (s *httpStorage) loadDiskCache() error {
+	raw, err := s.options.DiskCache.load(s.url, s.now())
+	if err != nil {
+		return err
+	}
+	result, err := s.ingest(raw)
+	if err != nil {
+		return fmt.Errorf("%w: failed to process JWK Set disk cache", err)
+	}
+	s.scheduleRefresh(result, 0)
+	return nil
+}
+
+// ingest replaces the keys in storage with the keys parsed from the raw JWK Set, unless it is rejected.
+func (s *httpStorage) ingest(raw []byte) (ingestResult, error) {
+	ingestOpts := ingestOptions{
+		dedupe:        s.options.DeduplicateKeys,
+		duplicateKIDs: s.options.DuplicateKIDPolicy,
+		expiry:        s.options.HonorKeyExpiry,
+		keyTypes:      s.options.KeyTypePolicies,
+		leaves:        s.leaves,
+		normalize:     s.options.LenientNormalization,
+		rfc7517:       s.options.StrictRFC7517,
+		strict:        s.options.StrictParsing,
+		trust:         s.options.X5CTrust,
+		validate:      s.options.ValidateOptions,
+		warn:          s.options.ParseWarningHandler,
+		whitelist:     s.options.KeyWhitelist,
+	}
+	result, err := ingest(raw, ingestOpts)
+	s.statusMux.Lock()
+	s.skipped = result.skipped
+	s.statusMux.Unlock()
+	if err != nil {
+		return ingestResult{}, errors.Join(err, ErrHTTPStorage)
+	}
+	err = result.checkPins(s.options.PinnedKIDs, s.options.PinnedThumbprints)
+	if err != nil {
+		return ingestResult{}, errors.Join(err, ErrHTTPStorage)
+	}
+	s.replaceIngested(result)
+	s.recordProvenance(result)
+	return result, nil
+}
+
+// scheduleRefresh replaces any scheduled refresh with one at the earliest of KeyExpiryRefreshLead before the earliest
+// upcoming key expiry, if HonorKeyExpiry is set, and the given duration, if it is positive. A key expiry that is
+// already within KeyExpiryRefreshLead is not used, so a JWK Set with a key about to expire does not cause repeated
+// refreshes.
+func (s *httpStorage) scheduleRefresh(result ingestResult, after time.Duration) {
+	now := s.now()
+	wait := after
+	if s.options.HonorKeyExpiry {
+		expiry, ok := result.nextExpiry(now)
+		if untilLead := expiry.Add(-s.options.KeyExpiryRefreshLead).Sub(now); ok && untilLead > 0 && (wait == 0 || untilLead < wait) {
+			wait = untilLead
+		}
+	}
+
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	if s.scheduled != nil {
+		s.scheduled.Stop()
+		s.scheduled = nil
+	}
+	s.status.NextScheduledRefresh = time.Time{}
+	if wait == 0 {
+		return
+	}
+	s.status.NextScheduledRefresh = now.Add(wait)
+	if s.options.OnDemand {
+		return
+	}
+	s.scheduled = time.AfterFunc(wait, func() {
+		if s.options.Ctx.Err() != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(s.options.Ctx, s.options.HTTPTimeout)
+		defer cancel()
+		err := s.Refresh(ctx)
+		if err != nil {
+			s.handleRefreshError(ctx, err)
+		}
+	})
+}
+
+func (s *httpStorage) refreshLoop() {
+	// The RefreshInterval may have been set to zero since the "refresh goroutine" was launched, so the ticker starts
+	// stopped and is paused while the interval is not positive.
+	ticker := time.NewTicker(time.Hour)
+	ticker.Stop()
+	defer ticker.Stop()
+	if interval := s.settings.get().RefreshInterval; interval > 0 {
+		ticker.Reset(interval)
+	}
+	for {
+		select {
+		case <-s.options.Ctx.Done():
+			return
+		case <-s.settings.reschedule:
+			interval := s.settings.get().RefreshInterval
+			if interval <= 0 {
+				ticker.Stop()
+				continue
+			}
+			ticker.Reset(interval)
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(s.options.Ctx, s.options.HTTPTimeout)
+			err := s.Refresh(ctx)
+			cancel()
+			if err != nil {
+				s.handleRefreshError(ctx, err)
+			}
+		}
+	}
+}
+
+func (s *httpStorage) handleRefreshError(ctx context.Context, err error) {
+	if s.options.RefreshErrorHandler != nil {
+		s.options.RefreshErrorHandler(ctx, err)
+	}
+}
+
+func (s *httpStorage) refreshUnknownKID() bool {
+	return !s.options.NoRefreshUnknownKID
+}
+
+// attempt performs a single HTTP request for the remote JWK Set and returns the response body and header. The returned
+// boolean indicates if the error is transient and the request may be retried. The timing and HTTP status code of the
+// attempt are written to the report.
+func (s *httpStorage) attempt(ctx context.Context, report *RefreshReport, u string) (raw []byte, header http.Header, retryable bool, err error) {
+	if s.options.Retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.options.Retry.AttemptTimeout)
+		defer cancel()
+	}
+	trace := &refreshTrace{}
+	defer trace.write(&report.Timing)
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	if limiter := s.settings.get().FetchRateLimit; limiter != nil {
+		err = limiter.Wait(ctx)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%w: failed to wait for JWK Set fetch rate limiter", errors.Join(err, ErrHTTPStorage))
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, s.options.HTTPMethod, u, nil)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("%w: failed to create HTTP request for JWK Set refresh", errors.Join(err, ErrHTTPStorage))
+	}
+	if s.options.RequestHook != nil {
+		err = s.options.RequestHook(req)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%w: request hook failed", errors.Join(err, ErrHTTPStorage))
+		}
+	}
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("%w: failed to perform HTTP request for JWK Set refresh", errors.Join(err, ErrHTTPStorage))
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	report.StatusCode = resp.StatusCode
+	if s.options.ResponseHook != nil {
+		err = s.options.ResponseHook(resp)
+		if errors.Is(err, ErrSkipRefresh) {
+			return nil, nil, false, ErrSkipRefresh
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%w: response hook failed", errors.Join(err, ErrHTTPStorage))
+		}
+	}
+	if resp.StatusCode != s.options.HTTPExpectedStatus {
+		retryable = resp.StatusCode >= http.StatusInternalServerError
+		return nil, nil, retryable, fmt.Errorf("%w: %d", errors.Join(jwkset.ErrInvalidHTTPStatusCode, ErrHTTPStorage), resp.StatusCode)
+	}
+	err = s.checkContentType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	raw, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("%w: failed to read JWK Set response", errors.Join(err, ErrHTTPStorage))
+	}
+	return raw, resp.Header, false, nil
+}
+
+// checkContentType confirms the Content-Type header value is one of the ContentTypes option.
+func (s *httpStorage) checkContentType(contentType string) error {
+	if len(s.options.ContentTypes) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: could not parse Content-Type %q", errors.Join(err, ErrUnexpectedContentType, ErrHTTPStorage), contentType)
+	}
+	for _, allowed := range s.options.ContentTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: got %q, want one of %q", errors.Join(ErrUnexpectedContentType, ErrHTTPStorage), mediaType, s.options.ContentTypes)
+}
@@ -0,0 +1,478 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestNewHTTPStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	options := HTTPStorageOptions{
+		Ctx: ctx,
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	if store.URL() != server.URL {
+		t.Fatalf("Expected URL %q, but got %q.", server.URL, store.URL())
+	}
+
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+
+	const otherKID = "other-key-id"
+	otherPriv := writeEdDSAKey(ctx, t, serverStore, otherKID)
+	_, err = jwt.Parse(signEdDSA(t, otherPriv, otherKID), k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc before refresh, but got %s.", err)
+	}
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, otherPriv, otherKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT after refresh. Error: %s", err)
+	}
+}
+
+func TestNewHTTPStorageErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPStorage(server.URL, HTTPStorageOptions{})
+	if !errors.Is(err, ErrHTTPStorage) || !errors.Is(err, jwkset.ErrInvalidHTTPStatusCode) {
+		t.Fatalf("Expected ErrHTTPStorage for unexpected status code, but got %s.", err)
+	}
+
+	_, err = NewHTTPStorage(server.URL, HTTPStorageOptions{NoErrorReturnFirstHTTPReq: true})
+	if err != nil {
+		t.Fatalf("Expected no error with NoErrorReturnFirstHTTPReq, but got %s.", err)
+	}
+}
+
+func TestHTTPStorageHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const (
+		correlationHeader = "X-Correlation-ID"
+		etag              = `"v1"`
+	)
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(correlationHeader) == "" {
+			t.Errorf("Expected correlation ID header to be set by request hook.")
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	var lastETag string
+	var statuses []int
+	options := HTTPStorageOptions{
+		Ctx: ctx,
+		RequestHook: func(req *http.Request) error {
+			req.Header.Set(correlationHeader, "correlation")
+			if lastETag != "" {
+				req.Header.Set("If-None-Match", lastETag)
+			}
+			return nil
+		},
+		ResponseHook: func(resp *http.Response) error {
+			statuses = append(statuses, resp.StatusCode)
+			if resp.StatusCode == http.StatusNotModified {
+				return ErrSkipRefresh
+			}
+			lastETag = resp.Header.Get("ETag")
+			return nil
+		},
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh with not modified response. Error: %s", err)
+	}
+	if len(statuses) != 2 || statuses[0] != http.StatusOK || statuses[1] != http.StatusNotModified {
+		t.Fatalf("Unexpected statuses recorded by response hook: %v.", statuses)
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Expected keys to be kept after skipped refresh. Error: %s", err)
+	}
+
+	hookErr := errors.New("hook error")
+	options.RequestHook = func(req *http.Request) error {
+		return hookErr
+	}
+	_, err = NewHTTPStorage(server.URL, options)
+	if !errors.Is(err, hookErr) || !errors.Is(err, ErrHTTPStorage) {
+		t.Fatalf("Expected request hook error, but got %s.", err)
+	}
+}
+
+func TestHTTPStorageRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int64
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	options := HTTPStorageOptions{
+		Ctx: ctx,
+		Retry: RetryOptions{
+			AttemptTimeout: time.Second,
+			Delay:          time.Millisecond,
+			Retries:        2,
+		},
+	}
+	_, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Expected refresh to succeed after retries. Error: %s", err)
+	}
+	if requests.Load() != 3 {
+		t.Fatalf("Expected 3 requests, but got %d.", requests.Load())
+	}
+
+	requests.Store(0)
+	status = http.StatusNotFound
+	_, err = NewHTTPStorage(server.URL, options)
+	if !errors.Is(err, jwkset.ErrInvalidHTTPStatusCode) {
+		t.Fatalf("Expected jwkset.ErrInvalidHTTPStatusCode, but got %s.", err)
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("Expected client errors not to be retried, but got %d requests.", requests.Load())
+	}
+}
+
+func TestHTTPStorageStrictParsing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	var bad atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bad.Load() {
+			_, _ = w.Write([]byte(`{"keys":[{"kty":"EC","crv":"P-0","kid":"bad-curve","x":"AA","y":"AA"}]}`))
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx, StrictParsing: true})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	bad.Store(true)
+	err = store.Refresh(ctx)
+	if !errors.Is(err, ErrUnparsableJWK) {
+		t.Fatalf("Expected ErrUnparsableJWK for strict refresh, but got %s.", err)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected previous keys to be kept. Error: %s", err)
+	}
+}
+
+func TestHTTPStorageSkippedKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"EC","crv":"P-0","kid":"bad-curve","x":"AA","y":"AA","use":"sig"},{"kty":"oct","kid":"filtered","k":"c2VjcmV0"},{"kty":"oct","kid":"good","k":"c2VjcmV0","use":"sig"}]}`))
+	}))
+	defer server.Close()
+
+	options := HTTPStorageOptions{
+		Ctx: ctx,
+		KeyWhitelist: KeyWhitelist{
+			USE: []jwkset.USE{jwkset.UseSig},
+		},
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	skipped := store.SkippedKeys()
+	if len(skipped) != 2 {
+		t.Fatalf("Expected 2 skipped keys, but got %d.", len(skipped))
+	}
+	if skipped[0].KID != "bad-curve" || skipped[0].Filtered || skipped[0].Reason == nil {
+		t.Fatalf("Expected unparsable key to be reported, but got %+v.", skipped[0])
+	}
+	if skipped[1].KID != "filtered" || !skipped[1].Filtered || skipped[1].Reason == nil {
+		t.Fatalf("Expected filtered key to be reported, but got %+v.", skipped[1])
+	}
+	_, err = store.KeyRead(ctx, "good")
+	if err != nil {
+		t.Fatalf("Failed to read key allowed by whitelist. Error: %s", err)
+	}
+}
+
+func TestHTTPStorageContentTypes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	var contentType atomic.Value
+	contentType.Store("application/jwk-set+json; charset=utf-8")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType.Load().(string))
+		if contentType.Load().(string) == "text/html" {
+			_, _ = w.Write([]byte("<html>Sign in to the network</html>"))
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{ContentTypes: []string{ContentTypeJWKSet, "application/json"}, Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	contentType.Store("text/html")
+	err = store.Refresh(ctx)
+	if !errors.Is(err, ErrUnexpectedContentType) {
+		t.Fatalf("Expected ErrUnexpectedContentType for an HTML response, but got %v.", err)
+	}
+	contentType.Store("")
+	err = store.Refresh(ctx)
+	if !errors.Is(err, ErrUnexpectedContentType) {
+		t.Fatalf("Expected ErrUnexpectedContentType for a missing Content-Type, but got %v.", err)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected previous keys to be kept. Error: %s", err)
+	}
+	contentType.Store("Application/JSON")
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Expected media types to be compared case-insensitively. Error: %s", err)
+	}
+}
+
+func TestHTTPStorageLenientParsing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := serverStore.Marshal(ctx)
+		if err != nil {
+			t.Errorf("Failed to marshal JWK Set from server store. Error: %s", err)
+		}
+		rawKeys, err := json.Marshal(jwks.Keys)
+		if err != nil {
+			t.Errorf("Failed to marshal JWKs. Error: %s", err)
+		}
+		_, _ = w.Write(rawKeys)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err == nil {
+		t.Fatalf("Expected an error for a bare JSON array of JWKs without LenientParsing.")
+	}
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx, LenientParsing: true})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+}
+
+func TestHTTPStorageSingleJWK(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwk, err := serverStore.KeyRead(ctx, keyID)
+		if err != nil {
+			t.Errorf("Failed to read JWK from server store. Error: %s", err)
+		}
+		rawJWK, err := json.Marshal(jwk.Marshal())
+		if err != nil {
+			t.Errorf("Failed to marshal JWK. Error: %s", err)
+		}
+		w.Header().Set("Content-Type", ContentTypeJWK)
+		_, _ = w.Write(rawJWK)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{ContentTypes: []string{ContentTypeJWK}, Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+}
+
+func TestHTTPStorageMinRefreshInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:                ctx,
+		MinRefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Expected a suppressed refresh to succeed. Error: %s", err)
+	}
+	if requests.Load() != 1 || store.Status().SuppressedRefreshes != 1 {
+		t.Fatalf("Expected the refresh to be suppressed, got %d requests and status %+v.", requests.Load(), store.Status())
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	store.(*httpStorage).now = func() time.Time { return later }
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- store.Refresh(ctx)
+		}()
+	}
+	for store.Status().SuppressedRefreshes != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		err = <-errs
+		if err != nil {
+			t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+		}
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("Expected concurrent refreshes to be coalesced, got %d requests.", requests.Load())
+	}
+}
+
+func TestHTTPStorageFetchRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 2)
+	stores := make([]HTTPStorage, 2)
+	for i := range stores {
+		var err error
+		stores[i], err = NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx, FetchRateLimit: limiter})
+		if err != nil {
+			t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+		}
+	}
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer timeoutCancel()
+	err := stores[0].Refresh(timeoutCtx)
+	if !errors.Is(err, ErrHTTPStorage) {
+		t.Fatalf("Expected the shared rate limit to block the refresh. Error: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("Expected 2 requests within the shared rate limit, got %d.", requests.Load())
+	}
+}
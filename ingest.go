@@ -0,0 +1,259 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrUnparsableJWK is returned when a JWK Set contains a JWK that cannot be parsed and such JWKs are not skipped.
+	ErrUnparsableJWK = errors.New("unparsable JWK in JWK Set")
+)
+
+// ParseWarningHandler is called for every JWK that is skipped while a JWK Set is ingested, such as a JWK with a bad
+// curve or missing parameters. The key ID and key type are empty if they could not be read. It is also called for JWKs
+// that are kept despite a problem: with ErrDuplicateKID for a duplicate key ID and with ErrJWKNormalized for each fix
+// made by lenient normalization.
+type ParseWarningHandler func(kid string, kty jwkset.KTY, reason error)
+
+// KeyWhitelist filters the JWKs ingested from a JWK Set by their parameters. An empty field allows any value.
+type KeyWhitelist struct {
+	ALG []jwkset.ALG
+	KTY []jwkset.KTY
+	USE []jwkset.USE
+}
+
+func (w KeyWhitelist) check(marshal jwkset.JWKMarshal) error {
+	if len(w.ALG) > 0 && !slices.Contains(w.ALG, marshal.ALG) {
+		return fmt.Errorf(`"alg" parameter value %q is not in whitelist`, marshal.ALG)
+	}
+	if len(w.KTY) > 0 && !slices.Contains(w.KTY, marshal.KTY) {
+		return fmt.Errorf(`"kty" parameter value %q is not in whitelist`, marshal.KTY)
+	}
+	if len(w.USE) > 0 && !slices.Contains(w.USE, marshal.USE) {
+		return fmt.Errorf(`"use" parameter value %q is not in whitelist`, marshal.USE)
+	}
+	return nil
+}
+
+// SkippedKey describes a JWK from a JWK Set that was not loaded.
+type SkippedKey struct {
+	// Filtered is true if the JWK was excluded by a KeyWhitelist, KeyTypePolicies, or an X5CTrust and false if it could
+	// not be parsed.
+	Filtered bool
+	KID      string
+	KTY      jwkset.KTY
+	Reason   error
+}
+
+// ingestOptions are used to configure how a raw JWK Set is turned into keys.
+type ingestOptions struct {
+	dedupe        bool
+	duplicateKIDs DuplicateKIDPolicy
+	expiry        bool
+	keyTypes      KeyTypePolicies
+	leaves        *x5cLeafCache
+	normalize     bool
+	rfc7517       bool
+	strict        bool
+	validate      jwkset.JWKValidateOptions
+	trust         *X5CTrust
+	warn          ParseWarningHandler
+	whitelist     KeyWhitelist
+}
+
+// ingestResult holds the keys parsed from a raw JWK Set.
+type ingestResult struct {
+	custom []customKey
+	// extra are the nonstandard parameters of the JWKs by key ID. The first JWK with a key ID is used.
+	extra   map[string]map[string]json.RawMessage
+	set     []jwkset.JWK
+	skipped []SkippedKey
+	// validity is the validity of each JWK in set. It is nil unless expiry metadata is honored.
+	validity []keyValidity
+}
+
+// ingest parses a raw JWK Set. Keys that cannot be parsed are skipped and reported to the warning handler. In strict
+// mode, an error is returned instead if any key cannot be parsed, along with the skipped keys. Keys not allowed by the
+// whitelist or the key type policies, which treat the JWK Set as remote, or whose "x5c" certificate chain is not
+// trusted are filtered. If expiry metadata is honored, keys with an unreadable "exp" or "nbf" parameter are skipped.
+// Keys whose key ID appears more than once are handled by the DuplicateKIDPolicy. If strict RFC 7517 parsing is
+// enabled, noncompliant keys are skipped as if they could not be parsed. If lenient normalization is enabled, common
+// deviations are fixed first and reported to the warning handler.
+func ingest(raw json.RawMessage, options ingestOptions) (ingestResult, error) {
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	err := json.Unmarshal(raw, &jwks)
+	if err != nil {
+		return ingestResult{}, fmt.Errorf("%w: could not unmarshal raw JWK Set JSON", errors.Join(err, ErrKeyfunc))
+	}
+	var result ingestResult
+	if options.expiry {
+		result.validity = make([]keyValidity, 0, len(jwks.Keys))
+	}
+	var dedupe *keyDeduplicator
+	if options.dedupe {
+		dedupe = newKeyDeduplicator()
+	}
+	duplicates := duplicateKIDs(jwks.Keys)
+	var unparsable []error
+	skip := func(kid string, kty jwkset.KTY, reason error) {
+		if options.warn != nil {
+			options.warn(kid, kty, reason)
+		}
+		unparsable = append(unparsable, fmt.Errorf("kid %q with kty %q: %w", kid, kty, reason))
+		result.skipped = append(result.skipped, SkippedKey{KID: kid, KTY: kty, Reason: reason})
+	}
+	keepExtra := func(kid string, rawJWK json.RawMessage) {
+		if _, ok := result.extra[kid]; ok {
+			return
+		}
+		extra := extraFields(rawJWK)
+		if extra == nil {
+			return
+		}
+		if result.extra == nil {
+			result.extra = make(map[string]map[string]json.RawMessage)
+		}
+		result.extra[kid] = extra
+	}
+	for i, rawJWK := range jwks.Keys {
+		var fixes []error
+		if options.normalize {
+			rawJWK, fixes = normalizeJWK(rawJWK)
+		}
+		var marshal jwkset.JWKMarshal
+		err = json.Unmarshal(rawJWK, &marshal)
+		if err != nil {
+			var header struct {
+				KID any `json:"kid"`
+				KTY any `json:"kty"`
+			}
+			_ = json.Unmarshal(rawJWK, &header)
+			kid, _ := header.KID.(string)
+			kty, _ := header.KTY.(string)
+			skip(kid, jwkset.KTY(kty), fmt.Errorf("could not unmarshal JWK: %w", err))
+			continue
+		}
+		if options.warn != nil {
+			for _, fix := range fixes {
+				options.warn(marshal.KID, marshal.KTY, fix)
+			}
+		}
+		if o, ok := duplicates[marshal.KID]; ok && i != o.keep(options.duplicateKIDs) {
+			reason := o.reason(marshal.KID, options.duplicateKIDs)
+			if options.warn != nil {
+				options.warn(marshal.KID, marshal.KTY, reason)
+			}
+			if options.duplicateKIDs != DuplicateKIDKeepBoth {
+				result.skipped = append(result.skipped, SkippedKey{Filtered: true, KID: marshal.KID, KTY: marshal.KTY, Reason: reason})
+				continue
+			}
+		}
+		if options.rfc7517 {
+			err = checkRFC7517(rawJWK)
+			if err != nil {
+				skip(marshal.KID, marshal.KTY, err)
+				continue
+			}
+		}
+		err = options.whitelist.check(marshal)
+		if err != nil {
+			result.skipped = append(result.skipped, SkippedKey{Filtered: true, KID: marshal.KID, KTY: marshal.KTY, Reason: err})
+			continue
+		}
+		err = options.keyTypes.check(marshal.KTY, marshal.USE, true)
+		if err != nil {
+			result.skipped = append(result.skipped, SkippedKey{Filtered: true, KID: marshal.KID, KTY: marshal.KTY, Reason: err})
+			continue
+		}
+		if options.trust != nil {
+			err = options.trust.check(marshal)
+			if err != nil {
+				result.skipped = append(result.skipped, SkippedKey{Filtered: true, KID: marshal.KID, KTY: marshal.KTY, Reason: err})
+				continue
+			}
+		}
+		var validity keyValidity
+		if options.expiry {
+			validity, err = readKeyValidity(rawJWK)
+			if err != nil {
+				skip(marshal.KID, marshal.KTY, err)
+				continue
+			}
+		}
+		if marshal.KTY == jwkset.KtyOKP && marshal.CRV == jwkset.CrvX448 {
+			key, err := parseX448(marshal)
+			if err != nil {
+				skip(marshal.KID, marshal.KTY, err)
+				continue
+			}
+			c := newCustomKey(marshal, key)
+			c.validity = validity
+			result.custom = append(result.custom, c)
+			keepExtra(c.kid, rawJWK)
+			continue
+		}
+		if parser, ok := keyTypeParser(marshal.KTY); ok {
+			key, err := parser(rawJWK)
+			if err != nil {
+				skip(marshal.KID, marshal.KTY, fmt.Errorf("custom key type parser failed: %w", err))
+				continue
+			}
+			c := newCustomKey(marshal, key)
+			c.validity = validity
+			result.custom = append(result.custom, c)
+			keepExtra(c.kid, rawJWK)
+			continue
+		}
+		marshalOptions := jwkset.JWKMarshalOptions{
+			Private: true,
+		}
+		var jwk jwkset.JWK
+		if x5cOnly(marshal) {
+			jwk, err = x5cLeafJWK(marshal, options.leaves, options.validate)
+		} else if dedupe != nil {
+			jwk, err = dedupe.parse(marshal, marshalOptions, options.validate)
+		} else {
+			jwk, err = jwkset.NewJWKFromMarshal(marshal, marshalOptions, options.validate)
+		}
+		if err != nil {
+			skip(marshal.KID, marshal.KTY, err)
+			continue
+		}
+		if options.expiry {
+			result.validity = append(result.validity, validity.narrow(jwk.X509().X5C))
+		}
+		result.set = append(result.set, jwk)
+		keepExtra(marshal.KID, rawJWK)
+	}
+	options.leaves.commit()
+	if options.duplicateKIDs == DuplicateKIDError && len(duplicates) > 0 {
+		return result, fmt.Errorf("%w: %d key IDs appear more than once", errors.Join(ErrDuplicateKID, ErrKeyfunc), len(duplicates))
+	}
+	if options.strict && len(unparsable) > 0 {
+		return result, fmt.Errorf("%w: %d of %d JWKs could not be parsed", errors.Join(append([]error{ErrUnparsableJWK, ErrKeyfunc}, unparsable...)...), len(unparsable), len(jwks.Keys))
+	}
+	return result, nil
+}
+
+func newCustomKey(marshal jwkset.JWKMarshal, key any) customKey {
+	return customKey{
+		alg: marshal.ALG,
+		key: key,
+		kid: marshal.KID,
+		kty: marshal.KTY,
+		use: marshal.USE,
+	}
+}
+
+func (r ingestResult) toStorage() *memoryStorage {
+	store := newMemoryStorage()
+	store.replaceIngested(r)
+	return store
+}
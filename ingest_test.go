@@ -0,0 +1,61 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestParseWarningHandler(t *testing.T) {
+	jwksJSON := json.RawMessage(`{"keys":[{"kty":"EC","crv":"P-0","kid":"bad-curve","x":"AA","y":"AA"},{"kty":"RSA","kid":"missing-n","e":"AQAB"},{"kty":5},{"kty":"oct","kid":"good","k":"c2VjcmV0"}]}`)
+	type warning struct {
+		kid string
+		kty jwkset.KTY
+	}
+	var warnings []warning
+	options := JWKSetJSONOptions{
+		SkipUnparsable: true,
+		ParseWarningHandler: func(kid string, kty jwkset.KTY, reason error) {
+			if reason == nil {
+				t.Errorf("Expected a reason for skipped key %q.", kid)
+			}
+			warnings = append(warnings, warning{kid: kid, kty: kty})
+		},
+	}
+	k, err := NewJWKSetJSONWithOptions(jwksJSON, options)
+	if err != nil {
+		t.Fatalf("Failed to create a keyfunc.Keyfunc.\nError: %s", err)
+	}
+	expected := []warning{
+		{kid: "bad-curve", kty: jwkset.KtyEC},
+		{kid: "missing-n", kty: jwkset.KtyRSA},
+		{},
+	}
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, but got %d: %v.", len(expected), len(warnings), warnings)
+	}
+	for i, w := range expected {
+		if warnings[i] != w {
+			t.Fatalf("Expected warning %v, but got %v.", w, warnings[i])
+		}
+	}
+	all, err := k.Storage().KeyReadAll(context.Background())
+	if err != nil || len(all) != 1 {
+		t.Fatalf("Expected 1 parsed key, but got %d. Error: %v", len(all), err)
+	}
+}
+
+func TestStrictParsing(t *testing.T) {
+	jwksJSON := json.RawMessage(`{"keys":[{"kty":"EC","crv":"P-0","kid":"bad-curve","x":"AA","y":"AA"},{"kty":"oct","kid":"good","k":"c2VjcmV0"}]}`)
+	_, err := NewJWKSetJSON(jwksJSON)
+	if !errors.Is(err, ErrUnparsableJWK) || !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrUnparsableJWK by default, but got %s.", err)
+	}
+	_, err = NewJWKSetJSONWithOptions(jwksJSON, JWKSetJSONOptions{SkipUnparsable: true})
+	if err != nil {
+		t.Fatalf("Expected no error when skipping unparsable JWKs, but got %s.", err)
+	}
+}
@@ -0,0 +1,252 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrIssuerDiscovery is returned when the JWK Set of the issuer of a JWT cannot be discovered.
+	ErrIssuerDiscovery = errors.New("failed issuer discovery")
+)
+
+// IssuerDiscoveryOptions configure NewIssuerDiscovery.
+type IssuerDiscoveryOptions struct {
+	// AllowPrivateNetworks allows issuers and JWK Sets on loopback, private, link-local, and other non-public addresses.
+	// Only use it for testing or when every issuer that matches the IssuerPatterns is trusted.
+	AllowPrivateNetworks bool
+	// Ctx ends the refresh goroutines of the discovered JWK Sets when it is done and is used by the Keyfunc method.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// IssuerPatterns are the issuers whose JWK Sets may be discovered. The "iss" claim of a JWT must match one of them in
+	// full. At least one is required.
+	IssuerPatterns []*regexp.Regexp
+	// Keyfunc resolves keys before issuer discovery is tried. Discovery is only tried if it does not find the key ID of
+	// the JWT. If nil, the key of every JWT is read from the JWK Set of its issuer.
+	Keyfunc Keyfunc
+	// MaxIssuers is the maximum number of issuers whose JWK Sets are cached. The least recently used issuer is evicted
+	// and its refresh goroutine ended when it is exceeded.
+	//
+	// This defaults to 100.
+	MaxIssuers int
+	// NewIssuerRateLimit limits how often an issuer that is not cached is discovered. JWTs for issuers over the limit
+	// are rejected without a request.
+	//
+	// This defaults to 10 new issuers per minute with a burst of 10.
+	NewIssuerRateLimit *rate.Limiter
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the JWK Set of each issuer caused by JWTs with
+	// an unknown key ID.
+	//
+	// This defaults to one minute.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the JWK Set of each issuer. The Client and HTTPTimeout are also used for the discovery
+	// request.
+	//
+	// The Client defaults to one that does not use a proxy and refuses to connect to non-public addresses, unless
+	// AllowPrivateNetworks is set. A custom Client must enforce this itself.
+	URLOptions URLOptions
+}
+
+// IssuerDiscovery resolves the keys for JWTs by discovering the JWK Set of their issuer. This enables APIs that accept
+// JWTs from issuers that are not known upfront. The "iss" claim is read before the signature is verified, so only
+// issuers that match the configured patterns are discovered, and only over HTTPS on public addresses.
+type IssuerDiscovery interface {
+	// Keyfunc resolves the key for the JWT with the context given at creation.
+	Keyfunc(token *jwt.Token) (any, error)
+	// KeyfuncCtx returns a jwt.Keyfunc that resolves the key for the JWT with the given context.
+	KeyfuncCtx(ctx context.Context) jwt.Keyfunc
+}
+
+type issuerDiscovery struct {
+	cache    *keyfuncCache
+	options  IssuerDiscoveryOptions
+	patterns []*regexp.Regexp
+}
+
+// NewIssuerDiscovery creates a new IssuerDiscovery.
+func NewIssuerDiscovery(options IssuerDiscoveryOptions) (IssuerDiscovery, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.MaxIssuers <= 0 {
+		options.MaxIssuers = 100
+	}
+	if options.NewIssuerRateLimit == nil {
+		options.NewIssuerRateLimit = rate.NewLimiter(rate.Every(6*time.Second), 10)
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = time.Minute
+	}
+	if len(options.IssuerPatterns) == 0 {
+		return nil, fmt.Errorf("%w: at least one issuer pattern is required", ErrIssuerDiscovery)
+	}
+	d := &issuerDiscovery{
+		cache:    newKeyfuncCache(options.Ctx, options.MaxIssuers, options.NewIssuerRateLimit),
+		patterns: make([]*regexp.Regexp, len(options.IssuerPatterns)),
+	}
+	for i, pattern := range options.IssuerPatterns {
+		var err error
+		d.patterns[i], err = regexp.Compile(`^(?:` + pattern.String() + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to anchor issuer pattern %q", errors.Join(err, ErrIssuerDiscovery), pattern)
+		}
+	}
+	if options.URLOptions.Client == nil && !options.AllowPrivateNetworks {
+		options.URLOptions.Client = newPublicHTTPClient(d.checkURL)
+	}
+	d.options = options
+	return d, nil
+}
+
+func (d *issuerDiscovery) Keyfunc(token *jwt.Token) (any, error) {
+	return d.KeyfuncCtx(d.options.Ctx)(token)
+}
+func (d *issuerDiscovery) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		if d.options.Keyfunc != nil {
+			key, err := d.options.Keyfunc.KeyfuncCtx(ctx)(token)
+			if err == nil || !errors.Is(err, jwkset.ErrKeyNotFound) {
+				return key, err
+			}
+		}
+		iss, err := d.issuer(token)
+		if err != nil {
+			return nil, err
+		}
+		k, err := d.cache.get(ctx, iss, func(ctx context.Context) (Keyfunc, error) {
+			return d.discover(ctx, iss)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: no Keyfunc for issuer %q", errors.Join(err, ErrIssuerDiscovery, ErrKeyfunc), redact(iss))
+		}
+		return k.KeyfuncCtx(ctx)(token)
+	}
+}
+
+// issuer reads the "iss" claim of the JWT and confirms it is an issuer that may be discovered.
+func (d *issuerDiscovery) issuer(token *jwt.Token) (string, error) {
+	if token.Claims == nil {
+		return "", fmt.Errorf("%w: JWT has no claims", errors.Join(jwt.ErrTokenInvalidIssuer, ErrKeyfunc))
+	}
+	iss, err := token.Claims.GetIssuer()
+	if err != nil {
+		return "", fmt.Errorf(`%w: could not read "iss" claim`, errors.Join(err, jwt.ErrTokenInvalidIssuer, ErrKeyfunc))
+	}
+	matched := false
+	for _, pattern := range d.patterns {
+		if pattern.MatchString(iss) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return "", fmt.Errorf(`%w: "iss" claim %q does not match an issuer pattern`, errors.Join(jwt.ErrTokenInvalidIssuer, ErrKeyfunc), redact(iss))
+	}
+	err = d.checkURL(iss)
+	if err != nil {
+		return "", redactError(fmt.Errorf(`%w: "iss" claim %q`, errors.Join(err, jwt.ErrTokenInvalidIssuer, ErrKeyfunc), iss))
+	}
+	return iss, nil
+}
+
+// discover creates a Keyfunc for the JWK Set in the OIDC discovery document of the issuer.
+func (d *issuerDiscovery) discover(ctx context.Context, iss string) (Keyfunc, error) {
+	client, timeout := d.options.URLOptions.discoveryClient()
+	discoveryCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	discoveryURL := strings.TrimSuffix(iss, "/") + "/.well-known/openid-configuration"
+	source, found, err := fetchJWKSSource(discoveryCtx, client, discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: no OIDC discovery document at %q", ErrIssuerDiscovery, redact(discoveryURL))
+	}
+	if source.issuer != iss {
+		return nil, fmt.Errorf(`%w: discovery document at %q has "issuer" %q`, ErrIssuerDiscovery, redact(discoveryURL), redact(source.issuer))
+	}
+	err = d.checkURL(source.url)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: "jwks_uri" %q`, errors.Join(err, ErrIssuerDiscovery), redact(source.url))
+	}
+	return newProviderKeyfunc(ctx, source.url, source.urlOptions(d.options.URLOptions), d.options.UnknownKIDRefreshInterval)
+}
+
+// checkURL confirms the URL uses HTTPS, has no user information, query, or fragment, and, unless AllowPrivateNetworks
+// is set, is not a non-public IP address.
+func (d *issuerDiscovery) checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redactError(fmt.Errorf("%w: failed to parse URL", errors.Join(err, ErrIssuerDiscovery)))
+	}
+	if u.Scheme != "https" || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%w: URL must be HTTPS without user information, query, or fragment", ErrIssuerDiscovery)
+	}
+	if d.options.AllowPrivateNetworks {
+		return nil
+	}
+	addr, err := netip.ParseAddr(strings.Trim(u.Hostname(), "[]"))
+	if err == nil && !publicAddr(addr) {
+		return fmt.Errorf("%w: URL host %q is not a public address", ErrIssuerDiscovery, u.Hostname())
+	}
+	return nil
+}
+
+// newPublicHTTPClient creates an HTTP client that does not use a proxy and refuses to connect to non-public addresses.
+// The address is checked after DNS resolution, so a public host name that resolves to a private address is refused.
+// Redirects are only followed to URLs accepted by checkURL.
+func newPublicHTTPClient(checkURL func(raw string) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: failed to parse dial address %q", errors.Join(err, ErrIssuerDiscovery), address)
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: refusing to connect to non-public address %q", ErrIssuerDiscovery, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("%w: stopped after 10 redirects", ErrIssuerDiscovery)
+			}
+			err := checkURL(req.URL.String())
+			if err != nil {
+				return fmt.Errorf("%w: refusing to follow redirect", err)
+			}
+			return nil
+		},
+		Transport: transport,
+	}
+}
+
+// cgnat is the shared address space of RFC 6598, which is not reachable from the public internet.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports if the IP address is reachable from the public internet.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnat.Contains(addr)
+}
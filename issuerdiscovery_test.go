@@ -0,0 +1,197 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIssuerDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	var discoveries atomic.Int64
+	var issuer string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			discoveries.Add(1)
+			_, _ = w.Write([]byte(`{"issuer":"` + issuer + `","jwks_uri":"` + issuer + `/keys"}`))
+		case "/rogue/.well-known/openid-configuration":
+			_, _ = w.Write([]byte(`{"issuer":"https://idp.example.com","jwks_uri":"` + issuer + `/keys"}`))
+		case "/keys":
+			rawJWKS, err := serverStore.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+			}
+			_, _ = w.Write(rawJWKS)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	issuer = server.URL
+
+	sign := func(priv ed25519.PrivateKey, iss string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": iss})
+		token.Header[jwkset.HeaderKID] = keyID
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		return signed
+	}
+
+	givenStore := jwkset.NewMemoryStorage()
+	const givenKID = "given-key-id"
+	givenPriv := writeEdDSAKey(ctx, t, givenStore, givenKID)
+	given, err := New(Options{Storage: givenStore})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	d, err := NewIssuerDiscovery(IssuerDiscoveryOptions{
+		AllowPrivateNetworks: true,
+		Ctx:                  ctx,
+		IssuerPatterns:       []*regexp.Regexp{regexp.MustCompile(regexp.QuoteMeta(server.URL) + `(/rogue)?`)},
+		Keyfunc:              given,
+		URLOptions:           URLOptions{Client: server.Client()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create IssuerDiscovery. Error: %s", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": server.URL})
+	token.Header[jwkset.HeaderKID] = givenKID
+	signed, err := token.SignedString(givenPriv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, d.Keyfunc)
+	if err != nil || discoveries.Load() != 0 {
+		t.Fatalf("Expected a key found by the Keyfunc option to not trigger discovery. Error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = jwt.Parse(sign(priv, server.URL), d.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT with a discovered issuer. Error: %s", err)
+		}
+	}
+	if discoveries.Load() != 1 {
+		t.Fatalf("Expected the discovered issuer to be cached, but it was discovered %d times.", discoveries.Load())
+	}
+
+	for _, iss := range []string{"https://attacker.example.com", server.URL + "/other", server.URL + "?q=1", ""} {
+		_, err = jwt.Parse(sign(priv, iss), d.Keyfunc)
+		if !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+			t.Fatalf("Expected jwt.ErrTokenInvalidIssuer for %q. Error: %v", iss, err)
+		}
+	}
+	_, err = jwt.Parse(sign(priv, server.URL+"/rogue"), d.Keyfunc)
+	if !errors.Is(err, ErrIssuerDiscovery) {
+		t.Fatalf("Expected ErrIssuerDiscovery for a discovery document with another issuer. Error: %v", err)
+	}
+
+	guarded, err := NewIssuerDiscovery(IssuerDiscoveryOptions{
+		Ctx:            ctx,
+		IssuerPatterns: []*regexp.Regexp{regexp.MustCompile(`https://.*`)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create IssuerDiscovery. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(priv, server.URL), guarded.Keyfunc)
+	if !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+		t.Fatalf("Expected jwt.ErrTokenInvalidIssuer for a loopback issuer. Error: %v", err)
+	}
+	_, err = newPublicHTTPClient(guarded.(*issuerDiscovery).checkURL).Get(server.URL)
+	if !errors.Is(err, ErrIssuerDiscovery) {
+		t.Fatalf("Expected the public HTTP client to refuse a loopback address. Error: %v", err)
+	}
+
+	_, err = NewIssuerDiscovery(IssuerDiscoveryOptions{})
+	if !errors.Is(err, ErrIssuerDiscovery) {
+		t.Fatalf("Expected ErrIssuerDiscovery without issuer patterns. Error: %v", err)
+	}
+}
+
+func TestIssuerDiscoveryPatternAlternation(t *testing.T) {
+	d, err := NewIssuerDiscovery(IssuerDiscoveryOptions{
+		IssuerPatterns: []*regexp.Regexp{regexp.MustCompile(`https://example\.com|https://example\.com/tenant`)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create IssuerDiscovery. Error: %s", err)
+	}
+	for iss, allowed := range map[string]bool{
+		"https://example.com":              true,
+		"https://example.com/tenant":       true,
+		"https://example.com/tenant/other": false,
+		"https://attacker.example.com":     false,
+	} {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": iss})
+		_, err = d.(*issuerDiscovery).issuer(token)
+		if allowed && err != nil {
+			t.Fatalf("Expected %q to match an issuer pattern. Error: %s", iss, err)
+		}
+		if !allowed && !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+			t.Fatalf("Expected jwt.ErrTokenInvalidIssuer for %q. Error: %v", iss, err)
+		}
+	}
+}
+
+func TestPublicHTTPClientRedirect(t *testing.T) {
+	d, err := NewIssuerDiscovery(IssuerDiscoveryOptions{
+		IssuerPatterns: []*regexp.Regexp{regexp.MustCompile(`https://example\.com`)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create IssuerDiscovery. Error: %s", err)
+	}
+	client := d.(*issuerDiscovery).options.URLOptions.Client
+	via := []*http.Request{httptest.NewRequest(http.MethodGet, "https://example.com/.well-known/openid-configuration", nil)}
+	for target, allowed := range map[string]bool{
+		"https://example.com/jwks.json":         true,
+		"http://example.com/jwks.json":          false,
+		"https://127.0.0.1/jwks.json":           false,
+		"https://169.254.169.254/latest/meta":   false,
+		"https://user@example.com/jwks.json":    false,
+		"https://example.com/jwks.json?debug=1": false,
+	} {
+		err = client.CheckRedirect(httptest.NewRequest(http.MethodGet, target, nil), via)
+		if allowed && err != nil {
+			t.Fatalf("Expected a redirect to %q to be followed. Error: %s", target, err)
+		}
+		if !allowed && !errors.Is(err, ErrIssuerDiscovery) {
+			t.Fatalf("Expected ErrIssuerDiscovery for a redirect to %q. Error: %v", target, err)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"8.8.8.8":              true,
+		"2001:4860:4860::8888": true,
+		"127.0.0.1":            false,
+		"10.0.0.1":             false,
+		"100.64.0.1":           false,
+		"169.254.169.254":      false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"0.0.0.0":              false,
+		"fe80::1":              false,
+		"100.128.0.1":          true,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != public {
+			t.Fatalf("Expected publicAddr(%q) to be %t.", addr, public)
+		}
+	}
+}
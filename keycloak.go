@@ -0,0 +1,101 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrKeycloak is returned when the OIDC discovery document of a Keycloak realm cannot be used.
+	ErrKeycloak = errors.New("failed Keycloak realm discovery")
+)
+
+// KeycloakOptions configure NewKeycloak.
+type KeycloakOptions struct {
+	// Audiences are the client IDs the JWTs are for. If set, the "aud" claim of a JWT must contain one of them.
+	Audiences []string
+	// BaseURL is the URL of the Keycloak server, with or without the "/auth" prefix used before Keycloak 17. Both forms
+	// are tried, so the same configuration works across Keycloak versions.
+	BaseURL string
+	// Ctx is used for the discovery request and ends the refresh goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Realm is the name of the Keycloak realm.
+	Realm string
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the realm's JWK Set caused by JWTs with an
+	// unknown key ID. Keycloak publishes a new key as soon as it is rotated in and signs new JWTs with it right away,
+	// so this is shorter than the default for other remote JWK Sets.
+	//
+	// This defaults to 30 seconds.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the realm's remote JWK Set. The Client and HTTPTimeout are also used for the discovery
+	// request.
+	URLOptions URLOptions
+}
+
+// NewKeycloak creates a new Keyfunc for a Keycloak realm. The "jwks_uri" of the realm is read from its OIDC discovery
+// document. JWTs with an "iss" claim other than the "issuer" of the document, or not for one of the Audiences if set,
+// are rejected with jwt.ErrTokenInvalidIssuer or jwt.ErrTokenInvalidAudience.
+func NewKeycloak(options KeycloakOptions) (Keyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.Realm == "" {
+		return nil, fmt.Errorf("%w: a realm is required", ErrKeycloak)
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = 30 * time.Second
+	}
+	client, timeout := options.URLOptions.discoveryClient()
+	ctx, cancel := context.WithTimeout(options.Ctx, timeout)
+	defer cancel()
+	source, err := keycloakDiscover(ctx, client, options.BaseURL, options.Realm)
+	if err != nil {
+		return nil, err
+	}
+	if source.issuer == "" {
+		return nil, fmt.Errorf(`%w: the OIDC discovery document of realm %q has no "issuer"`, ErrKeycloak, options.Realm)
+	}
+	k, err := newProviderKeyfunc(options.Ctx, source.url, source.urlOptions(options.URLOptions), options.UnknownKIDRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return claimsKeyfunc{
+		managedKeyfunc: k,
+		audiences:      options.Audiences,
+		issuers:        []string{source.issuer},
+	}, nil
+}
+
+// keycloakDiscover reads where the JWK Set is from the OIDC discovery document of the realm. The base URL is tried as
+// given, then with the "/auth" prefix added or removed, if the document is not found.
+func keycloakDiscover(ctx context.Context, client *http.Client, baseURL, realm string) (jwksSource, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	_, err := url.ParseRequestURI(baseURL)
+	if err != nil {
+		return jwksSource{}, redactError(fmt.Errorf("%w: failed to parse Keycloak base URL %q", errors.Join(err, ErrKeycloak), redact(baseURL)))
+	}
+	bases := []string{baseURL, baseURL + "/auth"}
+	if trimmed, ok := strings.CutSuffix(baseURL, "/auth"); ok {
+		bases[1] = trimmed
+	}
+	var errs []error
+	for _, base := range bases {
+		discoveryURL := base + "/realms/" + url.PathEscape(realm) + "/.well-known/openid-configuration"
+		source, found, err := fetchJWKSSource(ctx, client, discoveryURL)
+		if err != nil {
+			return jwksSource{}, errors.Join(err, ErrKeycloak)
+		}
+		if found {
+			return source, nil
+		}
+		errs = append(errs, fmt.Errorf("no OIDC discovery document at %q", redact(discoveryURL)))
+	}
+	return jwksSource{}, fmt.Errorf("%w: realm %q not found", errors.Join(append([]error{ErrKeycloak}, errs...)...), realm)
+}
@@ -0,0 +1,108 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewKeycloak(t *testing.T) {
+	tc := []struct {
+		name       string
+		prefix     string
+		basePrefix string
+	}{
+		{name: "Current", prefix: "", basePrefix: ""},
+		{name: "Legacy", prefix: "/auth", basePrefix: "/auth"},
+		{name: "AddAuth", prefix: "/auth", basePrefix: ""},
+		{name: "RemoveAuth", prefix: "", basePrefix: "/auth"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			store := jwkset.NewMemoryStorage()
+			priv := writeEdDSAKey(ctx, t, store, "original")
+			server := newKeycloakServer(ctx, t, c.prefix, "test", store)
+			defer server.Close()
+
+			options := KeycloakOptions{
+				BaseURL: server.URL + c.basePrefix + "/",
+				Ctx:     ctx,
+				Realm:   "test",
+			}
+			k, err := NewKeycloak(options)
+			if err != nil {
+				t.Fatalf("Failed to create Keycloak keyfunc. Error: %s", err)
+			}
+			sign := func(priv ed25519.PrivateKey, kid, iss string) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": iss})
+				token.Header[jwkset.HeaderKID] = kid
+				signed, err := token.SignedString(priv)
+				if err != nil {
+					t.Fatalf("Failed to sign JWT. Error: %s", err)
+				}
+				return signed
+			}
+			issuer := server.URL + c.prefix + "/realms/test"
+			_, err = jwt.Parse(sign(priv, "original", issuer), k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			_, err = jwt.Parse(sign(priv, "original", server.URL+c.prefix+"/realms/other"), k.Keyfunc)
+			if !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+				t.Fatalf("Expected error to be jwt.ErrTokenInvalidIssuer. Error: %v", err)
+			}
+
+			rotated := writeEdDSAKey(ctx, t, store, "rotated")
+			_, err = jwt.Parse(sign(rotated, "rotated", issuer), k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT signed with rotated key. Error: %s", err)
+			}
+		})
+	}
+}
+
+func TestNewKeycloakRealmNotFound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := newKeycloakServer(ctx, t, "", "test", jwkset.NewMemoryStorage())
+	defer server.Close()
+
+	_, err := NewKeycloak(KeycloakOptions{BaseURL: server.URL, Ctx: ctx, Realm: "other"})
+	if !errors.Is(err, ErrKeycloak) {
+		t.Fatalf("Expected error to be ErrKeycloak. Error: %s", err)
+	}
+}
+
+func newKeycloakServer(ctx context.Context, t *testing.T, prefix, realm string, store jwkset.Storage) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realmPath := prefix + "/realms/" + realm
+		switch r.URL.Path {
+		case realmPath + "/.well-known/openid-configuration":
+			discovery := map[string]string{
+				"issuer":   server.URL + realmPath,
+				"jwks_uri": server.URL + realmPath + "/protocol/openid-connect/certs",
+			}
+			_ = json.NewEncoder(w).Encode(discovery)
+		case realmPath + "/protocol/openid-connect/certs":
+			raw, err := store.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON. Error: %s", err)
+			}
+			_, _ = w.Write(raw)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
@@ -6,9 +6,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/MicahParks/jwkset"
 	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
 )
 
 var (
@@ -19,22 +23,128 @@ var (
 // Keyfunc is meant to be used as the jwt.Keyfunc function for github.com/golang-jwt/jwt/v5. It uses
 // github.com/MicahParks/jwkset as a JWK Set storage.
 type Keyfunc interface {
+	// Keyfunc reads keys from the JWK Set storage with the context given at creation.
 	Keyfunc(token *jwt.Token) (any, error)
+	// KeyfuncCtx returns a jwt.Keyfunc that reads keys from the JWK Set storage with the given context. Use it with the
+	// context of an inbound request so cancellation, deadlines, and trace context flow through key resolution.
 	KeyfuncCtx(ctx context.Context) jwt.Keyfunc
+	// Storage returns the underlying JWK Set storage for advanced use. Prefer the methods of KeyManager for common
+	// operations.
 	Storage() jwkset.Storage
 }
 
+// KeyManager reads and changes the keys of a Keyfunc. It is implemented by the Keyfunc values created by this package,
+// except for a ConfigKeyfunc, which has its own AddURL and RemoveURL methods. Use a type assertion on a Keyfunc to
+// access it.
+type KeyManager interface {
+	// Snapshot returns all JWKs in the JWK Set storage.
+	Snapshot(ctx context.Context) ([]jwkset.JWK, error)
+	// KeyByKID returns the JWK for the key ID, applying the KIDNormalizer option. Like a JWT with an unknown key ID, it
+	// may trigger a refresh of remote JWK Sets.
+	KeyByKID(ctx context.Context, kid string) (jwkset.JWK, error)
+	// AddGivenKey adds a JWK with a key ID. If the JWK Set storage is an HTTPClient, the JWK is added to its given
+	// storage, so it is kept across refreshes of the remote JWK Sets.
+	AddGivenKey(ctx context.Context, jwk jwkset.JWK) error
+	// RemoveKey removes the JWK with the key ID and reports if it was present. A JWK removed from a remote JWK Set is
+	// added again by the next refresh if it is still published.
+	RemoveKey(ctx context.Context, kid string) (bool, error)
+	// AddURL starts using a remote JWK Set while the Keyfunc is in use, such as to onboard a new issuer without a
+	// restart. It behaves like the URLs given to NewDefaultURLOptionsCtx: its keys are fetched before AddURL returns, and
+	// its "refresh goroutine" ends with the context given at creation. It returns an error if the URL is already in use
+	// or the JWK Set storage is not an HTTPClient.
+	AddURL(u string, options URLOptions) error
+	// RemoveURL stops using a remote JWK Set. Its refreshes stop and its keys are no longer used to verify JWTs. It
+	// returns true if the URL was in use.
+	RemoveURL(u string) bool
+	// Provenance reports where the JWKs with the key ID came from, such as the URL of a remote JWK Set and when the key
+	// ID was first and last seen there. It does not refresh remote JWK Sets. It is empty if the key ID is unknown or the
+	// JWK Set storage does not record provenance.
+	Provenance(kid string) []KeyProvenance
+	// ExtraFields returns the nonstandard parameters of the JWK with the key ID by name, such as "issuer", "exp", or
+	// custom labels that identity providers attach, so policy callbacks can use them. It does not refresh remote JWK
+	// Sets. It is nil if the JWK has no such parameters, the key ID is unknown, or the JWK Set storage does not
+	// preserve them.
+	ExtraFields(kid string) map[string]json.RawMessage
+	// KeyMetadata returns everything known about the JWK for the key ID except the cryptographic key, including its
+	// parameters, certificate chain, extra fields, and provenance. It applies the KIDNormalizer option and, like KeyByKID,
+	// may trigger a refresh of remote JWK Sets.
+	KeyMetadata(ctx context.Context, kid string) (KeyMetadata, error)
+}
+
+// managedKeyfunc is a Keyfunc that is also a KeyManager. Types that wrap one embed it to implement both interfaces.
+type managedKeyfunc interface {
+	Keyfunc
+	KeyManager
+}
+
 // Options are used to create a new Keyfunc.
 type Options struct {
-	Ctx          context.Context
-	Storage      jwkset.Storage
-	UseWhitelist []jwkset.USE
+	Ctx     context.Context
+	Storage jwkset.Storage
+	// AlgWhitelist limits the "alg" header values of JWTs that are accepted. If empty, any "alg" value that matches the
+	// JWK is accepted.
+	AlgWhitelist []jwkset.ALG
+	// DecisionTrace records how the key for each JWT is decided: the key IDs extracted, the sources consulted, the keys
+	// considered, the filters applied, and the outcome. If no key is found, the error is a *DecisionTraceError with the
+	// trace. Recording has a cost, so enable it to diagnose why a valid JWT is rejected.
+	DecisionTrace bool
+	// DecisionTraceHandler is called with the trace of every JWT when DecisionTrace is set, whether a key is found or
+	// not.
+	DecisionTraceHandler func(ctx context.Context, trace DecisionTrace)
+	// KIDCollisionPolicy determines how to choose between multiple JWKs that share the key ID from a JWT header. It
+	// defaults to KIDCollisionFirst.
+	KIDCollisionPolicy KIDCollisionPolicy
+	// KIDNormalizer is applied to the key ID from a JWT header and to the key IDs in the JWK Set storage before they are
+	// compared. This reconciles identity providers that emit key IDs with different casing or stray whitespace in the
+	// JWK Set and the JWT header, such as with strings.TrimSpace or strings.ToLower. If nil, key IDs must match
+	// exactly.
+	KIDNormalizer func(kid string) string
+	// KeyTypePolicies restrict the keys of each key type that are accepted. A policy with GivenOnly rejects JWKs of the
+	// key type that are read from an HTTPStorage, or from the HTTP storages of an HTTPClient. The source of keys with
+	// custom key types is not known, so only the "use" parameter of such keys is checked. To filter keys from remote
+	// JWK Sets when they are ingested instead, use the KeyTypePolicies option of HTTPStorageOptions or URLOptions.
+	KeyTypePolicies KeyTypePolicies
+	// KeyIDHeaders are the JWT header parameters tried in order to identify the key. The values of HeaderX5T and
+	// HeaderX5TS256 are first matched against the X.509 certificate thumbprints of the JWKs, then used as a key ID.
+	// Values of other header parameters, including proprietary ones, are used as a key ID. The next header parameter
+	// is tried when no key is found.
+	//
+	// This defaults to []string{jwkset.HeaderKID}.
+	KeyIDHeaders []string
+	// LookupTimeout is the maximum duration of reading a key from the JWK Set storage for a single JWT, including any
+	// refresh the read triggers. If zero, only the context bounds the read.
+	LookupTimeout time.Duration
+	// StorageErrorPolicy determines what happens when the JWK Set storage returns an error other than
+	// jwkset.ErrKeyNotFound. It defaults to StorageErrorFailClosed.
+	StorageErrorPolicy StorageErrorPolicy
+	// UnknownKIDRateLimit limits how often each key ID that was not found in the JWK Set storage is looked up again.
+	// Lookups over the limit fail with jwkset.ErrKeyNotFound without a key read that could refresh the JWK Set storage,
+	// so JWTs with fabricated key IDs cannot cause excessive storage traffic or starve refreshes for legitimate unknown
+	// key IDs. A key ID that is already in the JWK Set storage is never limited. If zero, lookups are not limited.
+	UnknownKIDRateLimit rate.Limit
+	// UnknownKIDRateLimitBurst is the burst size for UnknownKIDRateLimit.
+	//
+	// This defaults to 1.
+	UnknownKIDRateLimitBurst int
+	UseWhitelist             []jwkset.USE
 }
 
 type keyfunc struct {
-	ctx          context.Context
-	storage      jwkset.Storage
-	useWhitelist []jwkset.USE
+	ctx                  context.Context
+	storage              jwkset.Storage
+	algWhitelist         []jwkset.ALG
+	decisionTrace        bool
+	decisionTraceHandler func(ctx context.Context, trace DecisionTrace)
+	kidCollisionPolicy   KIDCollisionPolicy
+	kidNormalizer        func(kid string) string
+	keyIDHeaders         []string
+	keyTypePolicies      KeyTypePolicies
+	lastKnown            *lastKnownKeys
+	lookupTimeout        time.Duration
+	observer             *keyObserver
+	storageErrorPolicy   StorageErrorPolicy
+	unknownKIDs          *unknownKIDLimiter
+	useWhitelist         []jwkset.USE
 }
 
 // New creates a new Keyfunc.
@@ -46,10 +156,35 @@ func New(options Options) (Keyfunc, error) {
 	if options.Storage == nil {
 		return nil, fmt.Errorf("%w: no JWK Set storage given in options", ErrKeyfunc)
 	}
+	switch options.KIDCollisionPolicy {
+	case KIDCollisionFirst, KIDCollisionPreferNewest:
+	default:
+		return nil, fmt.Errorf("%w: unknown kid collision policy %q", ErrKeyfunc, options.KIDCollisionPolicy)
+	}
+	switch options.StorageErrorPolicy {
+	case StorageErrorFailClosed, StorageErrorFailOpen:
+	default:
+		return nil, fmt.Errorf("%w: unknown storage error policy %q", ErrKeyfunc, options.StorageErrorPolicy)
+	}
+	if len(options.KeyIDHeaders) == 0 {
+		options.KeyIDHeaders = []string{jwkset.HeaderKID}
+	}
 	k := keyfunc{
-		ctx:          ctx,
-		storage:      options.Storage,
-		useWhitelist: options.UseWhitelist,
+		ctx:                  ctx,
+		storage:              options.Storage,
+		algWhitelist:         options.AlgWhitelist,
+		decisionTrace:        options.DecisionTrace,
+		decisionTraceHandler: options.DecisionTraceHandler,
+		kidCollisionPolicy:   options.KIDCollisionPolicy,
+		kidNormalizer:        options.KIDNormalizer,
+		keyIDHeaders:         options.KeyIDHeaders,
+		keyTypePolicies:      options.KeyTypePolicies,
+		lastKnown:            newLastKnownKeys(),
+		lookupTimeout:        options.LookupTimeout,
+		observer:             newKeyObserver(),
+		storageErrorPolicy:   options.StorageErrorPolicy,
+		unknownKIDs:          newUnknownKIDLimiter(options.UnknownKIDRateLimit, options.UnknownKIDRateLimitBurst),
+		useWhitelist:         options.UseWhitelist,
 	}
 	return k, nil
 }
@@ -65,23 +200,49 @@ func NewDefault(urls []string) (Keyfunc, error) {
 // "refresh goroutine".
 //
 // This will launch "refresh goroutine" to automatically refresh the remote HTTP resources.
+//
+// The JWK Set storage is an HTTPClient with the same default behavior as jwkset.NewDefaultHTTPClientCtx. Use a type
+// assertion on the result of the Storage method to access the storage for each URL. URLs with a scheme other than
+// "http" or "https", such as "file", use the storage from the factory registered for the scheme with RegisterScheme.
 func NewDefaultCtx(ctx context.Context, urls []string) (Keyfunc, error) {
-	client, err := jwkset.NewDefaultHTTPClientCtx(ctx, urls)
+	urlOptions := make(map[string]URLOptions, len(urls))
+	for _, u := range urls {
+		urlOptions[u] = URLOptions{}
+	}
+	return NewDefaultURLOptionsCtx(ctx, urlOptions)
+}
+
+// NewDefaultURLOptionsCtx is like NewDefaultCtx, but the behavior for each remote HTTP resource can be configured. This
+// is useful when identity providers rotate keys at different cadences.
+func NewDefaultURLOptionsCtx(ctx context.Context, urls map[string]URLOptions) (Keyfunc, error) {
+	client, err := newDefaultHTTPClient(ctx, urls)
 	if err != nil {
 		return nil, err
 	}
 	options := Options{
+		Ctx:     ctx,
 		Storage: client,
 	}
 	return New(options)
 }
 
-// NewJWKJSON creates a new Keyfunc from raw JWK JSON.
+// NewJWKJSON creates a new Keyfunc from raw JWK JSON. A JWK whose public key is only given by its "x5c" parameter uses
+// the public key of the leaf certificate.
 func NewJWKJSON(raw json.RawMessage) (Keyfunc, error) {
 	marshalOptions := jwkset.JWKMarshalOptions{
 		Private: true,
 	}
-	jwk, err := jwkset.NewJWKFromRawJSON(raw, marshalOptions, jwkset.JWKValidateOptions{})
+	var marshal jwkset.JWKMarshal
+	err := json.Unmarshal(raw, &marshal)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not unmarshal raw JWK JSON", errors.Join(err, ErrKeyfunc))
+	}
+	var jwk jwkset.JWK
+	if x5cOnly(marshal) {
+		jwk, err = x5cLeafJWK(marshal, nil, jwkset.JWKValidateOptions{})
+	} else {
+		jwk, err = jwkset.NewJWKFromMarshal(marshal, marshalOptions, jwkset.JWKValidateOptions{})
+	}
 	if err != nil {
 		return nil, fmt.Errorf("%w: could not create JWK from raw JSON", errors.Join(err, ErrKeyfunc))
 	}
@@ -96,82 +257,301 @@ func NewJWKJSON(raw json.RawMessage) (Keyfunc, error) {
 	return New(options)
 }
 
-// NewJWKSetJSON creates a new Keyfunc from raw JWK Set JSON.
+// NewJWKSetJSON creates a new Keyfunc from raw JWK Set JSON. Keys with custom key types are parsed with the parsers
+// given to RegisterKeyType. If any other key cannot be parsed, an error with ErrUnparsableJWK is returned. Use the
+// SkipUnparsable option of NewJWKSetJSONWithOptions to skip those keys instead.
 func NewJWKSetJSON(raw json.RawMessage) (Keyfunc, error) {
-	var jwks jwkset.JWKSMarshal
+	return NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{})
+}
+
+// JWKSetJSONOptions are used to configure NewJWKSetJSONWithOptions.
+type JWKSetJSONOptions struct {
+	// DeduplicateKeys shares one parsed cryptographic key between JWKs with identical key material. See
+	// HTTPStorageOptions.
+	DeduplicateKeys bool
+	// DuplicateKIDPolicy determines which JWKs are ingested when the JWK Set contains the same key ID more than once. It
+	// defaults to DuplicateKIDKeepBoth.
+	DuplicateKIDPolicy DuplicateKIDPolicy
+	// HonorKeyExpiry treats the "exp" and "nbf" parameters and the "x5c" certificate validity of the JWKs as
+	// authoritative. Keys are not read before they are valid or after they expire. See HTTPStorageOptions.
+	HonorKeyExpiry bool
+	// KeyWhitelist filters the JWKs ingested from the JWK Set.
+	KeyWhitelist KeyWhitelist
+	// ParseWarningHandler is called for every JWK that is skipped because it cannot be parsed, and for every JWK with a
+	// duplicate key ID.
+	ParseWarningHandler ParseWarningHandler
+	// SkipUnparsable skips JWKs that cannot be parsed and reports them to the ParseWarningHandler, instead of returning
+	// an error with ErrUnparsableJWK.
+	SkipUnparsable bool
+	// StrictRFC7517 skips JWKs that deviate from RFC 7517. See HTTPStorageOptions.
+	StrictRFC7517 bool
+	// LenientNormalization fixes common deviations from RFC 7517 in the JWKs. See HTTPStorageOptions.
+	LenientNormalization bool
+	// ValidateOptions are the options to use when validating the JWKs.
+	ValidateOptions jwkset.JWKValidateOptions
+	// X5CTrust validates the "x5c" certificate chains of the JWKs. JWKs that fail validation are filtered. If nil,
+	// certificate chains are not validated.
+	X5CTrust *X5CTrust
+}
+
+// NewJWKSetJSONWithOptions is like NewJWKSetJSON, but the ingestion of the JWK Set can be configured.
+func NewJWKSetJSONWithOptions(raw json.RawMessage, options JWKSetJSONOptions) (Keyfunc, error) {
+	ingestOpts := ingestOptions{
+		dedupe:        options.DeduplicateKeys,
+		duplicateKIDs: options.DuplicateKIDPolicy,
+		expiry:        options.HonorKeyExpiry,
+		normalize:     options.LenientNormalization,
+		rfc7517:       options.StrictRFC7517,
+		strict:        !options.SkipUnparsable,
+		trust:         options.X5CTrust,
+		validate:      options.ValidateOptions,
+		warn:          options.ParseWarningHandler,
+		whitelist:     options.KeyWhitelist,
+	}
+	result, err := ingest(raw, ingestOpts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not create JWK Set storage", err)
+	}
+	return New(Options{
+		Storage: result.toStorage(),
+	})
+}
+
+// NewFromJSON creates a new Keyfunc from raw JWK Set JSON or raw JWK JSON that is known ahead of time, like the JSON
+// JWK Set of version 2's NewJSON. It pairs with go:embed for a fully offline Keyfunc without any goroutines or network
+// requests, for CLIs, tests, and air-gapped verification:
+//
+//	//go:embed jwks.json
+//	var jwksJSON []byte
+//
+//	k, err := keyfunc.NewFromJSON(jwksJSON)
+//
+// Because the JSON is fixed at build time, any JWK that cannot be parsed is an error with ErrUnparsableJWK, as is JSON
+// without any keys.
+func NewFromJSON(raw json.RawMessage) (Keyfunc, error) {
+	var jwks struct {
+		Keys json.RawMessage `json:"keys"`
+	}
 	err := json.Unmarshal(raw, &jwks)
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not unmarshal raw JWK Set JSON", errors.Join(err, ErrKeyfunc))
+		return nil, fmt.Errorf("%w: could not unmarshal raw JSON", errors.Join(err, ErrKeyfunc))
+	}
+	if jwks.Keys == nil {
+		raw, err = json.Marshal(map[string][]json.RawMessage{"keys": {raw}})
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not marshal JWK Set JSON", errors.Join(err, ErrKeyfunc))
+		}
 	}
-	store, err := jwks.ToStorage()
+	result, err := ingest(raw, ingestOptions{strict: true})
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not create JWK Set storage", errors.Join(err, ErrKeyfunc))
+		return nil, fmt.Errorf("%w: could not create JWK Set storage", err)
 	}
-	options := Options{
-		Storage: store,
+	if len(result.set) == 0 && len(result.custom) == 0 {
+		return nil, fmt.Errorf("%w: no keys in raw JSON", errors.Join(ErrUnparsableJWK, ErrKeyfunc))
 	}
-	return New(options)
+	return New(Options{
+		Storage: result.toStorage(),
+	})
 }
 
+// issuerCtxKey is the context key for the "iss" claim of the JWT whose key is being read from storage.
+type issuerCtxKey struct{}
+
 func (k keyfunc) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
 	return func(token *jwt.Token) (any, error) {
-		kidInter, ok := token.Header[jwkset.HeaderKID]
-		if !ok {
-			return nil, fmt.Errorf("%w: could not find kid in JWT header", ErrKeyfunc)
+		if k.decisionTrace {
+			return k.tracedLookup(ctx, token)
 		}
-		kid, ok := kidInter.(string)
-		if !ok {
-			return nil, fmt.Errorf("%w: could not convert kid in JWT header to string", ErrKeyfunc)
+		return k.lookup(ctx, token)
+	}
+}
+
+// lookup finds the key to verify the JWT with.
+func (k keyfunc) lookup(ctx context.Context, token *jwt.Token) (any, error) {
+	algInter, ok := token.Header["alg"]
+	if !ok {
+		return nil, fmt.Errorf("%w: could not find alg in JWT header", ErrKeyfunc)
+	}
+	alg, ok := algInter.(string)
+	if !ok {
+		// For test coverage purposes, this should be impossible to reach because the JWT package rejects a token
+		// without an alg parameter in the header before calling jwt.Keyfunc.
+		return nil, fmt.Errorf(`%w: the JWT header did not contain the "alg" parameter, which is required by RFC 7515 section 4.1.1`, ErrKeyfunc)
+	}
+
+	if token.Claims != nil {
+		// The "iss" claim is not trusted, it only hints which remote JWK Set to refresh for an unknown key ID.
+		if iss, err := token.Claims.GetIssuer(); err == nil && iss != "" {
+			ctx = context.WithValue(ctx, issuerCtxKey{}, iss)
 		}
-		algInter, ok := token.Header["alg"]
+	}
+	if k.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, k.lookupTimeout)
+		defer cancel()
+	}
+
+	var err error
+	found := false
+	for _, header := range k.keyIDHeaders {
+		valueInter, ok := token.Header[header]
 		if !ok {
-			return nil, fmt.Errorf("%w: could not find alg in JWT header", ErrKeyfunc)
+			continue
 		}
-		alg, ok := algInter.(string)
+		value, ok := valueInter.(string)
 		if !ok {
-			// For test coverage purposes, this should be impossible to reach because the JWT package rejects a token
-			// without an alg parameter in the header before calling jwt.Keyfunc.
-			return nil, fmt.Errorf(`%w: the JWT header did not contain the "alg" parameter, which is required by RFC 7515 section 4.1.1`, ErrKeyfunc)
+			return nil, fmt.Errorf("%w: could not convert %s in JWT header to string", ErrKeyfunc, header)
+		}
+		found = true
+		traceDecision(ctx, DecisionStageKeyID, nil, "%q header parameter %q", header, value)
+		var key any
+		key, err = k.resolve(ctx, header, value, alg)
+		if err == nil {
+			return key, nil
 		}
+		if !errors.Is(err, jwkset.ErrKeyNotFound) {
+			return nil, k.lookupCause(ctx, err)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: could not find %s in JWT header", ErrKeyfunc, strings.Join(k.keyIDHeaders, " or "))
+	}
+	return nil, k.lookupCause(ctx, err)
+}
+func (k keyfunc) Keyfunc(token *jwt.Token) (any, error) {
+	keyF := k.KeyfuncCtx(k.ctx)
+	return keyF(token)
+}
+func (k keyfunc) Storage() jwkset.Storage {
+	return k.storage
+}
 
-		jwk, err := k.storage.KeyRead(ctx, kid)
-		if err != nil {
+// lookupCause wraps the error of a lookup with ErrShutdown or ErrTimeout if the context given at creation or the
+// context of the lookup ended.
+func (k keyfunc) lookupCause(ctx context.Context, err error) error {
+	if cause := abortCause(k.ctx, ctx, err); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// resolve finds the verification key identified by the value of the given JWT header parameter.
+func (k keyfunc) resolve(ctx context.Context, header, value, alg string) (any, error) {
+	if header == HeaderX5T || header == HeaderX5TS256 {
+		jwk, ok, err := k.readCertificateThumbprint(ctx, header, value)
+		traceDecision(ctx, DecisionStageSource, err, "certificate thumbprint lookup in JWK Set storage, found %t", ok)
+		if err != nil && k.storageErrorPolicy != StorageErrorFailOpen {
 			return nil, fmt.Errorf("%w: could not read JWK from storage", errors.Join(err, ErrKeyfunc))
 		}
-
-		if a := jwk.Marshal().ALG.String(); a != "" && a != alg {
-			return nil, fmt.Errorf(`%w: JWK "alg" parameter value %q does not match token "alg" parameter value %q`, ErrKeyfunc, a, alg)
+		if ok {
+			return k.verificationKey(ctx, jwk, alg)
 		}
-		if len(k.useWhitelist) > 0 {
-			found := false
-			for _, u := range k.useWhitelist {
-				if jwk.Marshal().USE == u {
-					found = true
-					break
-				}
+	}
+
+	kid := k.normalizeKID(value)
+	if kid != value {
+		traceDecision(ctx, DecisionStageKeyID, nil, "normalized to %q", kid)
+	}
+	if r, ok := k.storage.(customKeyReader); ok {
+		if c, ok := r.customKeyRead(ctx, k.matchKID(kid)); ok {
+			traceDecision(ctx, DecisionStageKey, nil, "custom key with kty %q, alg %q, and use %q", c.kty, c.alg, c.use)
+			err := k.keyTypePolicies.check(c.kty, c.use, false)
+			if err != nil {
+				err = fmt.Errorf("%w: %w", ErrKeyfunc, err)
+				traceDecision(ctx, DecisionStageFilter, err, "key type policies")
+				return nil, err
+			}
+			key, err := k.acceptKey(c.alg, c.use, c.key, alg)
+			traceDecision(ctx, DecisionStageFilter, err, "alg and use whitelists")
+			if err != nil {
+				return nil, err
 			}
-			if !found {
-				return nil, fmt.Errorf(`%w: JWK "use" parameter value %q is not in whitelist`, ErrKeyfunc, jwk.Marshal().USE)
+			if r, ok := resolvedKeys(ctx); ok {
+				r.add(k.customKeyMetadata(c))
 			}
+			return key, nil
 		}
+	}
 
-		type publicKeyer interface {
-			Public() crypto.PublicKey
-		}
+	allowed := k.unknownKIDs.allow(kid, func() bool {
+		return k.storedKID(ctx, kid)
+	})
+	if !allowed {
+		err := fmt.Errorf("%w: lookups of unknown kid %q are rate limited", errors.Join(jwkset.ErrKeyNotFound, ErrKeyfunc), kid)
+		traceDecision(ctx, DecisionStageSource, err, "UnknownKIDRateLimit")
+		return nil, err
+	}
+	key, err := k.resolveKID(ctx, kid, alg)
+	if errors.Is(err, jwkset.ErrKeyNotFound) {
+		k.unknownKIDs.miss(kid)
+	} else {
+		k.unknownKIDs.found(kid)
+	}
+	return key, err
+}
 
-		key := jwk.Key()
-		pk, ok := key.(publicKeyer)
-		if ok {
-			key = pk.Public()
-		}
+func (k keyfunc) resolveKID(ctx context.Context, kid, alg string) (any, error) {
+	if k.kidCollisionPolicy == KIDCollisionPreferNewest {
+		return k.preferNewest(ctx, kid, alg)
+	}
 
-		return key, nil
+	jwk, err := k.readKey(ctx, kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read JWK from storage", errors.Join(err, ErrKeyfunc))
 	}
+
+	return k.verificationKey(ctx, jwk, alg)
 }
-func (k keyfunc) Keyfunc(token *jwt.Token) (any, error) {
-	keyF := k.KeyfuncCtx(k.ctx)
-	return keyF(token)
+
+// verificationKey confirms the JWK is acceptable for the token's "alg" header and the configured whitelists, then
+// returns the public cryptographic key to verify the token with.
+func (k keyfunc) verificationKey(ctx context.Context, jwk jwkset.JWK, alg string) (any, error) {
+	marshal := jwk.Marshal()
+	traceDecision(ctx, DecisionStageKey, nil, "JWK with kid %q, kty %q, alg %q, and use %q", marshal.KID, marshal.KTY, marshal.ALG, marshal.USE)
+	err := k.checkKeyType(ctx, jwk)
+	if err != nil {
+		traceDecision(ctx, DecisionStageFilter, err, "key type policies")
+		return nil, err
+	}
+	key, err := k.acceptKey(marshal.ALG, marshal.USE, jwk.Key(), alg)
+	traceDecision(ctx, DecisionStageFilter, err, "alg and use whitelists")
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := resolvedKeys(ctx); ok {
+		r.add(k.jwkMetadata(jwk))
+	}
+	return key, nil
 }
-func (k keyfunc) Storage() jwkset.Storage {
-	return k.storage
+
+func (k keyfunc) acceptKey(keyAlg jwkset.ALG, use jwkset.USE, key any, alg string) (any, error) {
+	if len(k.algWhitelist) > 0 && !slices.Contains(k.algWhitelist, jwkset.ALG(alg)) {
+		return nil, fmt.Errorf(`%w: token "alg" parameter value %q is not in whitelist`, ErrKeyfunc, alg)
+	}
+	if a := keyAlg.String(); a != "" && a != alg {
+		return nil, fmt.Errorf(`%w: JWK "alg" parameter value %q does not match token "alg" parameter value %q`, ErrKeyfunc, a, alg)
+	}
+	if len(k.useWhitelist) > 0 {
+		found := false
+		for _, u := range k.useWhitelist {
+			if use == u {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf(`%w: JWK "use" parameter value %q is not in whitelist`, ErrKeyfunc, use)
+		}
+	}
+
+	type publicKeyer interface {
+		Public() crypto.PublicKey
+	}
+
+	pk, ok := key.(publicKeyer)
+	if ok {
+		key = pk.Public()
+	}
+
+	return key, nil
 }
@@ -0,0 +1,60 @@
+package keyfunc
+
+import (
+	"context"
+
+	"github.com/MicahParks/jwkset"
+)
+
+const (
+	// HeaderX5T is the JWT header parameter for the base64url-encoded SHA-1 thumbprint of the signer's X.509
+	// certificate. Older Azure AD tokens identify the key with it.
+	// https://www.rfc-editor.org/rfc/rfc7515#section-4.1.7
+	HeaderX5T = "x5t"
+	// HeaderX5TS256 is the JWT header parameter for the base64url-encoded SHA-256 thumbprint of the signer's X.509
+	// certificate.
+	// https://www.rfc-editor.org/rfc/rfc7515#section-4.1.8
+	HeaderX5TS256 = "x5t#S256"
+)
+
+// certificateThumbprint is the value of the HeaderX5T or HeaderX5TS256 parameter of a JWK.
+type certificateThumbprint struct {
+	header string
+	value  string
+}
+
+// certificateThumbprints returns the X.509 certificate thumbprints of the JWK.
+func certificateThumbprints(m jwkset.JWKMarshal) []certificateThumbprint {
+	var certs []certificateThumbprint
+	if m.X5T != "" {
+		certs = append(certs, certificateThumbprint{header: HeaderX5T, value: m.X5T})
+	}
+	if m.X5TS256 != "" {
+		certs = append(certs, certificateThumbprint{header: HeaderX5TS256, value: m.X5TS256})
+	}
+	return certs
+}
+
+// readCertificateThumbprint finds the JWK with the X.509 certificate thumbprint given in the header parameter. The
+// returned boolean is false if no JWK matches. Storage in this package is searched with its index, other storage by
+// reading every key.
+func (k keyfunc) readCertificateThumbprint(ctx context.Context, header, value string) (jwkset.JWK, bool, error) {
+	if indexer, ok := k.storage.(kidIndexer); ok {
+		keys, err := indexer.certificateKeys(ctx, header, value)
+		if err != nil || len(keys) == 0 {
+			return jwkset.JWK{}, false, err
+		}
+		return keys[0].jwk, true, nil
+	}
+	all, err := k.storage.KeyReadAll(ctx)
+	if err != nil {
+		return jwkset.JWK{}, false, err
+	}
+	for _, jwk := range all {
+		m := jwk.Marshal()
+		if header == HeaderX5T && m.X5T == value || header == HeaderX5TS256 && m.X5TS256 == value {
+			return jwk, true, nil
+		}
+	}
+	return jwkset.JWK{}, false, nil
+}
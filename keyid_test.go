@@ -0,0 +1,133 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyIDHeaders(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "keyfunc"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate. Error: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate. Error: %s", err)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			KID: keyID,
+		},
+		X509: jwkset.JWKX509Options{
+			X5C: []*x509.Certificate{cert},
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	store := jwkset.NewMemoryStorage()
+	err = store.KeyWrite(ctx, jwk)
+	if err != nil {
+		t.Fatalf("Failed to write JWK. Error: %s", err)
+	}
+
+	sign := func(header map[string]any) string {
+		token := jwt.New(jwt.SigningMethodEdDSA)
+		for name, value := range header {
+			token.Header[name] = value
+		}
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		return signed
+	}
+
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(map[string]any{HeaderX5T: jwk.Marshal().X5T}), k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc without kid by default, but got %s.", err)
+	}
+
+	indexed := &scanCountingStorage{memoryStorage: newMemoryStorage()}
+	err = indexed.KeyWrite(ctx, jwk)
+	if err != nil {
+		t.Fatalf("Failed to write JWK. Error: %s", err)
+	}
+	for storeName, store := range map[string]jwkset.Storage{"jwkset": store, "indexed": indexed} {
+		k, err = New(Options{Storage: store, KeyIDHeaders: []string{jwkset.HeaderKID, HeaderX5T, HeaderX5TS256, "x-key"}})
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+		}
+		tc := map[string]map[string]any{
+			"x5t":             {HeaderX5T: jwk.Marshal().X5T},
+			"x5t#S256":        {HeaderX5TS256: jwk.Marshal().X5TS256},
+			"custom":          {"x-key": keyID},
+			"unknown kid":     {jwkset.HeaderKID: "unknown", HeaderX5T: jwk.Marshal().X5T},
+			"x5t equal kid":   {HeaderX5T: keyID},
+			"proprietary kid": {jwkset.HeaderKID: "unknown", "x-key": keyID},
+		}
+		for name, header := range tc {
+			t.Run(storeName+"/"+name, func(t *testing.T) {
+				_, err := jwt.Parse(sign(header), k.Keyfunc)
+				if err != nil {
+					t.Fatalf("Failed to parse JWT. Error: %s", err)
+				}
+			})
+		}
+
+		_, err = jwt.Parse(sign(map[string]any{HeaderX5T: "unknown"}), k.Keyfunc)
+		if !errors.Is(err, jwkset.ErrKeyNotFound) {
+			t.Fatalf("Expected jwkset.ErrKeyNotFound for unknown thumbprint, but got %s.", err)
+		}
+	}
+	if indexed.scans.Load() != 0 {
+		t.Fatalf("Expected certificate thumbprints to be found with the index, but all keys were read %d times.", indexed.scans.Load())
+	}
+
+	_, err = indexed.KeyDelete(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to delete JWK. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(map[string]any{HeaderX5T: jwk.Marshal().X5T}), k.Keyfunc)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound for the thumbprint of a deleted key, but got %s.", err)
+	}
+}
+
+// scanCountingStorage counts how often all keys of an indexed storage are read.
+type scanCountingStorage struct {
+	*memoryStorage
+	scans atomic.Int64
+}
+
+func (s *scanCountingStorage) KeyReadAll(ctx context.Context) ([]jwkset.JWK, error) {
+	s.scans.Add(1)
+	return s.memoryStorage.KeyReadAll(ctx)
+}
@@ -0,0 +1,92 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// KeyTypePolicy restricts the keys of a key type.
+type KeyTypePolicy struct {
+	// GivenOnly only accepts keys of the key type from given keys, never from remote JWK Sets. Accepting symmetric keys
+	// from a remote JWK Set is almost always a misconfiguration, as anyone who can read the JWK Set can sign JWTs.
+	GivenOnly bool
+	// USE are the "use" parameter values allowed for keys of the key type. If empty, any value is allowed.
+	USE []jwkset.USE
+}
+
+// KeyTypePolicies are the policies for each key type. Key types without a policy are not restricted. For example, the
+// following only accepts symmetric keys from given keys with the "use" parameter value "sig":
+//
+//	KeyTypePolicies{jwkset.KtyOct: {GivenOnly: true, USE: []jwkset.USE{jwkset.UseSig}}}
+type KeyTypePolicies map[jwkset.KTY]KeyTypePolicy
+
+// check confirms a key of the key type with the "use" parameter value is allowed. Remote is true if the key is from a
+// remote JWK Set.
+func (p KeyTypePolicies) check(kty jwkset.KTY, use jwkset.USE, remote bool) error {
+	policy, ok := p[kty]
+	if !ok {
+		return nil
+	}
+	if remote && policy.GivenOnly {
+		return fmt.Errorf("key type %q is only accepted from given keys", kty)
+	}
+	if len(policy.USE) > 0 && !slices.Contains(policy.USE, use) {
+		return fmt.Errorf(`"use" parameter value %q is not allowed for key type %q`, use, kty)
+	}
+	return nil
+}
+
+// checkKeyType applies the KeyTypePolicies option to the JWK. A JWK is remote if the JWK Set storage is an HTTPStorage,
+// or if the JWK Set storage is an HTTPClient and the given storage does not hold a JWK with the same key ID and RFC
+// 7638 thumbprint.
+func (k keyfunc) checkKeyType(ctx context.Context, jwk jwkset.JWK) error {
+	marshal := jwk.Marshal()
+	policy, ok := k.keyTypePolicies[marshal.KTY]
+	if !ok {
+		return nil
+	}
+	remote := false
+	if policy.GivenOnly {
+		var err error
+		remote, err = k.remoteJWK(ctx, jwk)
+		if err != nil {
+			return fmt.Errorf("%w: could not determine the source of the JWK", errors.Join(err, ErrKeyfunc))
+		}
+	}
+	err := k.keyTypePolicies.check(marshal.KTY, marshal.USE, remote)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyfunc, err)
+	}
+	return nil
+}
+
+// remoteJWK reports if the JWK is from a remote JWK Set.
+func (k keyfunc) remoteJWK(ctx context.Context, jwk jwkset.JWK) (bool, error) {
+	switch s := k.storage.(type) {
+	case HTTPStorage:
+		return true, nil
+	case givenStorer:
+		given, err := s.Given().KeyRead(ctx, jwk.Marshal().KID)
+		if errors.Is(err, jwkset.ErrKeyNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		want, err := Thumbprint(jwk)
+		if err != nil {
+			return false, err
+		}
+		got, err := Thumbprint(given)
+		if err != nil {
+			return false, err
+		}
+		return want != got, nil
+	default:
+		return false, nil
+	}
+}
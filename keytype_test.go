@@ -0,0 +1,123 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyTypePolicies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	remoteSecret := writeHMACKey(ctx, t, serverStore, "remote-hmac", jwkset.UseSig)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawJWKS, err := serverStore.JSONPrivate(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	policies := KeyTypePolicies{jwkset.KtyOct: {GivenOnly: true, USE: []jwkset.USE{jwkset.UseSig}}}
+
+	t.Run("Ingest", func(t *testing.T) {
+		k, err := NewDefaultURLOptionsCtx(ctx, map[string]URLOptions{server.URL: {KeyTypePolicies: policies}})
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+		}
+		_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT. Error: %s", err)
+		}
+		_, err = jwt.Parse(signHMAC(t, remoteSecret, "remote-hmac"), k.Keyfunc)
+		if !errors.Is(err, jwkset.ErrKeyNotFound) {
+			t.Fatalf("Expected the remote symmetric key to be filtered. Error: %v", err)
+		}
+		skipped := k.Storage().(HTTPClient).HTTPStorages()[server.URL].(HTTPStorage).SkippedKeys()
+		if len(skipped) != 1 || !skipped[0].Filtered || skipped[0].KID != "remote-hmac" {
+			t.Fatalf("Expected the remote symmetric key to be reported as filtered, got %v.", skipped)
+		}
+	})
+
+	t.Run("Keyfunc", func(t *testing.T) {
+		given := jwkset.NewMemoryStorage()
+		givenSecret := writeHMACKey(ctx, t, given, "given-hmac", jwkset.UseSig)
+		noUseSecret := writeHMACKey(ctx, t, given, "given-hmac-no-use", "")
+		client, err := NewHTTPClient(HTTPClientOptions{
+			Given:    given,
+			HTTPURLs: map[string]jwkset.Storage{server.URL: nil},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create HTTP client. Error: %s", err)
+		}
+		k, err := New(Options{KeyTypePolicies: policies, Storage: client})
+		if err != nil {
+			t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+		}
+
+		_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT signed with a remote asymmetric key. Error: %s", err)
+		}
+		_, err = jwt.Parse(signHMAC(t, givenSecret, "given-hmac"), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT signed with a given symmetric key. Error: %s", err)
+		}
+		_, err = jwt.Parse(signHMAC(t, remoteSecret, "remote-hmac"), k.Keyfunc)
+		if !errors.Is(err, ErrKeyfunc) {
+			t.Fatalf("Expected the remote symmetric key to be rejected. Error: %v", err)
+		}
+		_, err = jwt.Parse(signHMAC(t, noUseSecret, "given-hmac-no-use"), k.Keyfunc)
+		if !errors.Is(err, ErrKeyfunc) {
+			t.Fatalf(`Expected the given symmetric key without "use" to be rejected. Error: %v`, err)
+		}
+	})
+}
+
+// writeHMACKey writes a new symmetric JWK with the key ID and "use" parameter value to the storage.
+func writeHMACKey(ctx context.Context, t *testing.T, store jwkset.Storage, kid string, use jwkset.USE) []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		t.Fatalf("Failed to generate secret. Error: %s", err)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Marshal: jwkset.JWKMarshalOptions{
+			Private: true,
+		},
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: jwkset.AlgHS256,
+			KID: kid,
+			USE: use,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(secret, jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	err = store.KeyWrite(ctx, jwk)
+	if err != nil {
+		t.Fatalf("Failed to write JWK to storage. Error: %s", err)
+	}
+	return secret
+}
+
+func signHMAC(t *testing.T, secret []byte, kid string) string {
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	return signed
+}
@@ -0,0 +1,120 @@
+package keyfunc
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// maxTrackedUnknownKIDs bounds the memory used to rate limit unknown key IDs. Once reached, idle key IDs are forgotten
+// and any other new unknown key IDs share a single limiter.
+const maxTrackedUnknownKIDs = 10000
+
+// unknownKIDLimiter limits lookups of each key ID that was not found in the JWK Set storage.
+type unknownKIDLimiter struct {
+	burst    int
+	limit    rate.Limit
+	limiters map[string]*rate.Limiter
+	mux      sync.Mutex
+	overflow *rate.Limiter
+}
+
+func newUnknownKIDLimiter(limit rate.Limit, burst int) *unknownKIDLimiter {
+	if limit == 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &unknownKIDLimiter{
+		burst:    burst,
+		limit:    limit,
+		limiters: make(map[string]*rate.Limiter),
+		overflow: rate.NewLimiter(limit, burst),
+	}
+}
+
+// allow reports if the key ID may be looked up in the JWK Set storage. Before a lookup is limited, known reports if the
+// key ID is already in storage, so only key IDs confirmed missing are limited and key IDs that are known are never
+// starved by a flood of unknown key IDs.
+func (u *unknownKIDLimiter) allow(kid string, known func() bool) bool {
+	if u == nil {
+		return true
+	}
+	u.mux.Lock()
+	limiter, tracked := u.limiters[kid]
+	overflow := !tracked && len(u.limiters) >= maxTrackedUnknownKIDs
+	u.mux.Unlock()
+	if !tracked && !overflow {
+		return true
+	}
+	if known() {
+		return true
+	}
+	if tracked {
+		return limiter.Allow()
+	}
+	return u.overflow.Allow()
+}
+
+// miss records that the key ID was not found in the JWK Set storage.
+func (u *unknownKIDLimiter) miss(kid string) {
+	if u == nil {
+		return
+	}
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	if _, ok := u.limiters[kid]; ok {
+		return
+	}
+	if len(u.limiters) >= maxTrackedUnknownKIDs {
+		for k, limiter := range u.limiters {
+			if limiter.Tokens() >= float64(u.burst) {
+				delete(u.limiters, k)
+			}
+		}
+		if len(u.limiters) >= maxTrackedUnknownKIDs {
+			return
+		}
+	}
+	limiter := rate.NewLimiter(u.limit, u.burst)
+	limiter.Allow() // The lookup that missed counts against the limit.
+	u.limiters[kid] = limiter
+}
+
+// found records that the key ID was found in the JWK Set storage.
+func (u *unknownKIDLimiter) found(kid string) {
+	if u == nil {
+		return
+	}
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	delete(u.limiters, kid)
+}
+
+// storedKID reports if a JWK for the normalized key ID is in storage, without refreshing the storage for an unknown key
+// ID. Storage in this package is read through its index of key IDs.
+func (k keyfunc) storedKID(ctx context.Context, kid string) bool {
+	var match func(string) bool
+	if k.kidNormalizer != nil {
+		match = k.matchKID(kid)
+	}
+	if indexer, ok := k.storage.(kidIndexer); ok {
+		keys, err := indexer.kidKeys(ctx, kid, nil)
+		if err == nil && len(keys) == 0 && match != nil {
+			keys, err = indexer.kidKeys(ctx, kid, match)
+		}
+		return err == nil && len(keys) > 0
+	}
+	all, err := k.storage.KeyReadAll(ctx)
+	if err != nil {
+		return false
+	}
+	for _, jwk := range all {
+		if stored := jwk.Marshal().KID; stored == kid || (match != nil && match(stored)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestUnknownKIDRateLimit(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStorage{Storage: jwkset.NewMemoryStorage()}
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+
+	options := Options{
+		Storage:                  store,
+		UnknownKIDRateLimit:      rate.Limit(1e-9),
+		UnknownKIDRateLimitBurst: 1,
+	}
+	k, err := New(options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	const unknownKID = "unknown-key-id"
+	for i := 0; i < 3; i++ {
+		_, err = jwt.Parse(signEdDSA(t, priv, unknownKID), k.Keyfunc)
+		if !errors.Is(err, jwkset.ErrKeyNotFound) {
+			t.Fatalf("Expected jwkset.ErrKeyNotFound, but got %s.", err)
+		}
+	}
+	if store.reads != 1 {
+		t.Fatalf("Expected 1 storage read for a rate limited unknown key ID, but got %d.", store.reads)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT with known key ID. Error: %s", err)
+		}
+	}
+	if store.reads != 4 {
+		t.Fatalf("Expected known key IDs not to be rate limited, but got %d storage reads.", store.reads)
+	}
+}
+
+func TestUnknownKIDRateLimitOverflow(t *testing.T) {
+	ctx := context.Background()
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+
+	options := Options{
+		Storage:                  store,
+		UnknownKIDRateLimit:      rate.Limit(1e-9),
+		UnknownKIDRateLimitBurst: 1,
+	}
+	k, err := New(options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	limiter := k.(keyfunc).unknownKIDs
+	for i := 0; i < maxTrackedUnknownKIDs; i++ {
+		limiter.miss(fmt.Sprintf("unknown-key-id-%d", i))
+	}
+	for i := 0; i < 3; i++ {
+		_, err = jwt.Parse(signEdDSA(t, priv, fmt.Sprintf("untracked-key-id-%d", i)), k.Keyfunc)
+		if !errors.Is(err, jwkset.ErrKeyNotFound) {
+			t.Fatalf("Expected jwkset.ErrKeyNotFound, but got %s.", err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Expected a known key ID to not be rate limited once unknown key IDs overflow. Error: %s", err)
+		}
+	}
+}
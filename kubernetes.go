@@ -0,0 +1,208 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrKubernetes is returned when the service account issuer of a Kubernetes cluster cannot be discovered.
+	ErrKubernetes = errors.New("failed Kubernetes service account issuer discovery")
+)
+
+const (
+	// KubernetesCAFile is the CA bundle of the API server mounted into every pod with a service account.
+	KubernetesCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	// KubernetesTokenFile is the service account token mounted into every pod with a service account.
+	KubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// KubernetesOptions configure NewKubernetes.
+type KubernetesOptions struct {
+	// APIServerURL is the URL of the Kubernetes API server.
+	//
+	// This defaults to the URL given by the KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT environment variables
+	// of the pod.
+	APIServerURL string
+	// Audiences are the audiences the projected service account tokens are requested for. If set, the "aud" claim of a
+	// JWT must contain one of them.
+	Audiences []string
+	// CAFile is the PEM encoded CA bundle used to verify the API server. It is not used if the Client of the
+	// HTTPStorageOptions is set.
+	//
+	// This defaults to KubernetesCAFile.
+	CAFile string
+	// Ctx is used for the discovery request and ends the refresh goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// HTTPStorageOptions configure the storage of the JWK Set. The Client and HTTPTimeout are also used for the
+	// discovery request. The Ctx option is not used. A RequestHook is called after the service account token is added.
+	//
+	// The RefreshInterval defaults to one hour.
+	HTTPStorageOptions HTTPStorageOptions
+	// TokenFile is the service account token used to authenticate to the API server, as the discovery endpoints may
+	// require authentication. It is read for every request, so rotated projected tokens are used.
+	//
+	// This defaults to KubernetesTokenFile.
+	TokenFile string
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the JWK Set caused by JWTs with an unknown key
+	// ID.
+	//
+	// This defaults to one minute.
+	UnknownKIDRefreshInterval time.Duration
+}
+
+// NewKubernetes creates a new Keyfunc for projected service account tokens of the Kubernetes cluster the program runs
+// in. The issuer is read from the service account issuer discovery document and the keys from the "/openid/v1/jwks"
+// endpoint of the API server, using the in-cluster service account credentials. The "jwks_uri" of the discovery
+// document is not used, because it may point to an external address that is not reachable from within the cluster.
+// JWTs with another "iss" claim, or not for one of the Audiences if set, are rejected with jwt.ErrTokenInvalidIssuer or
+// jwt.ErrTokenInvalidAudience.
+func NewKubernetes(options KubernetesOptions) (Keyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.APIServerURL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("%w: no API server URL given and not running in a Kubernetes cluster", ErrKubernetes)
+		}
+		options.APIServerURL = "https://" + net.JoinHostPort(host, port)
+	}
+	if options.CAFile == "" {
+		options.CAFile = KubernetesCAFile
+	}
+	if options.TokenFile == "" {
+		options.TokenFile = KubernetesTokenFile
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = time.Minute
+	}
+	storageOptions := options.HTTPStorageOptions
+	if storageOptions.Client == nil {
+		client, err := kubernetesClient(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		storageOptions.Client = client
+	}
+	if storageOptions.HTTPTimeout == 0 {
+		storageOptions.HTTPTimeout = time.Minute
+	}
+	if storageOptions.RefreshInterval == 0 {
+		storageOptions.RefreshInterval = time.Hour
+	}
+	storageOptions.Ctx = options.Ctx
+	authorize := kubernetesAuthorizer(options.TokenFile)
+	requestHook := storageOptions.RequestHook
+	storageOptions.RequestHook = func(req *http.Request) error {
+		err := authorize(req)
+		if err != nil {
+			return err
+		}
+		if requestHook != nil {
+			return requestHook(req)
+		}
+		return nil
+	}
+
+	apiServerURL := strings.TrimSuffix(options.APIServerURL, "/")
+	ctx, cancel := context.WithTimeout(options.Ctx, storageOptions.HTTPTimeout)
+	defer cancel()
+	issuer, err := fetchKubernetesIssuer(ctx, storageOptions.Client, apiServerURL, authorize)
+	if err != nil {
+		return nil, err
+	}
+
+	jwksURL := apiServerURL + "/openid/v1/jwks"
+	store, err := NewHTTPStorage(jwksURL, storageOptions)
+	if err != nil {
+		return nil, redactError(fmt.Errorf("%w: failed to create HTTP storage for %q", errors.Join(err, ErrKubernetes), redact(jwksURL)))
+	}
+	httpURLs := map[string]jwkset.Storage{jwksURL: store}
+	k, err := newRefreshingKeyfunc(options.Ctx, httpURLs, options.UnknownKIDRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return claimsKeyfunc{
+		managedKeyfunc: k,
+		audiences:      options.Audiences,
+		issuers:        []string{issuer},
+	}, nil
+}
+
+// kubernetesClient returns an HTTP client that trusts the CA bundle of the API server.
+func kubernetesClient(caFile string) (*http.Client, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read CA file", errors.Join(err, ErrKubernetes))
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("%w: no PEM encoded certificates in CA file %q", ErrKubernetes, caFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// kubernetesAuthorizer returns a function that adds the service account token in the token file to a request.
+func kubernetesAuthorizer(tokenFile string) func(req *http.Request) error {
+	return func(req *http.Request) error {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read service account token", errors.Join(err, ErrKubernetes))
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		return nil
+	}
+}
+
+// fetchKubernetesIssuer reads the "issuer" from the service account issuer discovery document of the API server.
+func fetchKubernetesIssuer(ctx context.Context, client *http.Client, apiServerURL string, authorize func(req *http.Request) error) (string, error) {
+	discoveryURL := apiServerURL + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to create discovery request", errors.Join(err, ErrKubernetes))
+	}
+	err = authorize(req)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", redactError(fmt.Errorf("%w: failed to perform discovery request", errors.Join(err, ErrKubernetes)))
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: discovery request to %q returned status code %d", ErrKubernetes, redact(discoveryURL), resp.StatusCode)
+	}
+	var discovery struct {
+		Issuer string `json:"issuer"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&discovery)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to decode discovery document", errors.Join(err, ErrKubernetes))
+	}
+	if discovery.Issuer == "" {
+		return "", fmt.Errorf(`%w: discovery document at %q has no "issuer"`, ErrKubernetes, redact(discoveryURL))
+	}
+	return discovery.Issuer, nil
+}
@@ -0,0 +1,121 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewKubernetes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const (
+		issuer = "https://kubernetes.default.svc.cluster.local"
+		token  = "service-account-token"
+	)
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			discovery := map[string]string{
+				"issuer":   issuer,
+				"jwks_uri": issuer + "/openid/v1/jwks",
+			}
+			_ = json.NewEncoder(w).Encode(discovery)
+		case "/openid/v1/jwks":
+			raw, err := store.JSONPublic(ctx)
+			if err != nil {
+				t.Errorf("Failed to get JWK Set JSON. Error: %s", err)
+			}
+			_, _ = w.Write(raw)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err := os.WriteFile(caFile, caPEM, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write CA file. Error: %s", err)
+	}
+	tokenFile := filepath.Join(dir, "token")
+	err = os.WriteFile(tokenFile, []byte(token+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write token file. Error: %s", err)
+	}
+
+	options := KubernetesOptions{
+		APIServerURL: server.URL,
+		Audiences:    []string{"my-service"},
+		CAFile:       caFile,
+		Ctx:          ctx,
+		TokenFile:    tokenFile,
+	}
+	k, err := NewKubernetes(options)
+	if err != nil {
+		t.Fatalf("Failed to create Kubernetes keyfunc. Error: %s", err)
+	}
+
+	tc := []struct {
+		name   string
+		claims jwt.MapClaims
+		err    error
+	}{
+		{name: "Valid", claims: jwt.MapClaims{"iss": issuer, "aud": []string{"my-service"}}},
+		{name: "Issuer", claims: jwt.MapClaims{"iss": "https://example.com", "aud": []string{"my-service"}}, err: jwt.ErrTokenInvalidIssuer},
+		{name: "Audience", claims: jwt.MapClaims{"iss": issuer, "aud": []string{"other"}}, err: jwt.ErrTokenInvalidAudience},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, c.claims)
+			token.Header[jwkset.HeaderKID] = keyID
+			signed, err := token.SignedString(priv)
+			if err != nil {
+				t.Fatalf("Failed to sign JWT. Error: %s", err)
+			}
+			_, err = jwt.Parse(signed, k.Keyfunc)
+			if c.err == nil && err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected error to be %q. Error: %s", c.err, err)
+			}
+		})
+	}
+
+	err = os.WriteFile(tokenFile, []byte("expired-token"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write token file. Error: %s", err)
+	}
+	_, err = NewKubernetes(options)
+	if !errors.Is(err, ErrKubernetes) {
+		t.Fatalf("Expected error to be ErrKubernetes for an unauthorized token. Error: %s", err)
+	}
+}
+
+func TestNewKubernetesOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+	_, err := NewKubernetes(KubernetesOptions{})
+	if !errors.Is(err, ErrKubernetes) {
+		t.Fatalf("Expected error to be ErrKubernetes. Error: %s", err)
+	}
+}
@@ -0,0 +1,152 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// LastKnownGoodStorage is a jwkset.Storage that serves the last successful snapshot of a backend when the backend
+// returns an error. This keeps transient outages of a backend, such as Redis or Vault, from becoming authentication
+// outages.
+type LastKnownGoodStorage interface {
+	jwkset.Storage
+	// Staleness is how long ago the backend last succeeded, if the most recent read was served from the snapshot. It is
+	// zero while the backend is healthy.
+	Staleness() time.Duration
+}
+
+type lastKnownGoodStorage struct {
+	backend     jwkset.Storage
+	lastSuccess time.Time
+	mux         sync.Mutex
+	now         func() time.Time
+	snapshot    *memoryStorage
+	stale       bool
+}
+
+// NewLastKnownGoodStorage wraps the backend with a LastKnownGoodStorage. The context is used to take the first
+// snapshot. If that fails, the snapshot starts empty.
+func NewLastKnownGoodStorage(ctx context.Context, backend jwkset.Storage) LastKnownGoodStorage {
+	l := &lastKnownGoodStorage{
+		backend:  backend,
+		now:      time.Now,
+		snapshot: newMemoryStorage(),
+	}
+	_, _ = l.KeyReadAll(ctx)
+	return l
+}
+
+func (l *lastKnownGoodStorage) Staleness() time.Duration {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if !l.stale {
+		return 0
+	}
+	return l.now().Sub(l.lastSuccess)
+}
+
+// result records the outcome of a backend call. It returns true if the snapshot should be served instead.
+func (l *lastKnownGoodStorage) result(err error) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if err == nil || errors.Is(err, jwkset.ErrKeyNotFound) {
+		l.lastSuccess = l.now()
+		l.stale = false
+		return false
+	}
+	l.stale = true
+	return true
+}
+
+func (l *lastKnownGoodStorage) KeyDelete(ctx context.Context, keyID string) (ok bool, err error) {
+	ok, err = l.backend.KeyDelete(ctx, keyID)
+	if err == nil {
+		_, _ = l.snapshot.KeyDelete(ctx, keyID)
+	}
+	return ok, err
+}
+func (l *lastKnownGoodStorage) KeyRead(ctx context.Context, keyID string) (jwkset.JWK, error) {
+	jwk, err := l.backend.KeyRead(ctx, keyID)
+	if l.result(err) {
+		return l.snapshot.KeyRead(ctx, keyID)
+	}
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	set, custom := l.snapshot.keys()
+	updated := make([]jwkset.JWK, 0, len(set)+1)
+	for _, j := range set {
+		if j.Marshal().KID != keyID {
+			updated = append(updated, j)
+		}
+	}
+	l.snapshot.replace(append(updated, jwk), custom)
+	return jwk, nil
+}
+func (l *lastKnownGoodStorage) KeyReadAll(ctx context.Context) ([]jwkset.JWK, error) {
+	jwks, err := l.backend.KeyReadAll(ctx)
+	if l.result(err) {
+		return l.snapshot.KeyReadAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, custom := l.snapshot.keys()
+	l.snapshot.replace(jwks, custom)
+	return jwks, nil
+}
+func (l *lastKnownGoodStorage) KeyWrite(ctx context.Context, jwk jwkset.JWK) error {
+	err := l.backend.KeyWrite(ctx, jwk)
+	if err == nil {
+		_ = l.snapshot.KeyWrite(ctx, jwk)
+	}
+	return err
+}
+
+func (l *lastKnownGoodStorage) JSON(ctx context.Context) (json.RawMessage, error) {
+	raw, err := l.backend.JSON(ctx)
+	if l.result(err) {
+		return l.snapshot.JSON(ctx)
+	}
+	return raw, err
+}
+func (l *lastKnownGoodStorage) JSONPublic(ctx context.Context) (json.RawMessage, error) {
+	raw, err := l.backend.JSONPublic(ctx)
+	if l.result(err) {
+		return l.snapshot.JSONPublic(ctx)
+	}
+	return raw, err
+}
+func (l *lastKnownGoodStorage) JSONPrivate(ctx context.Context) (json.RawMessage, error) {
+	raw, err := l.backend.JSONPrivate(ctx)
+	if l.result(err) {
+		return l.snapshot.JSONPrivate(ctx)
+	}
+	return raw, err
+}
+func (l *lastKnownGoodStorage) JSONWithOptions(ctx context.Context, marshalOptions jwkset.JWKMarshalOptions, validationOptions jwkset.JWKValidateOptions) (json.RawMessage, error) {
+	raw, err := l.backend.JSONWithOptions(ctx, marshalOptions, validationOptions)
+	if l.result(err) {
+		return l.snapshot.JSONWithOptions(ctx, marshalOptions, validationOptions)
+	}
+	return raw, err
+}
+func (l *lastKnownGoodStorage) Marshal(ctx context.Context) (jwkset.JWKSMarshal, error) {
+	m, err := l.backend.Marshal(ctx)
+	if l.result(err) {
+		return l.snapshot.Marshal(ctx)
+	}
+	return m, err
+}
+func (l *lastKnownGoodStorage) MarshalWithOptions(ctx context.Context, marshalOptions jwkset.JWKMarshalOptions, validationOptions jwkset.JWKValidateOptions) (jwkset.JWKSMarshal, error) {
+	m, err := l.backend.MarshalWithOptions(ctx, marshalOptions, validationOptions)
+	if l.result(err) {
+		return l.snapshot.MarshalWithOptions(ctx, marshalOptions, validationOptions)
+	}
+	return m, err
+}
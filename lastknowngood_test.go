@@ -0,0 +1,60 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLastKnownGoodStorage(t *testing.T) {
+	ctx := context.Background()
+	backend := &flakyStorage{Storage: jwkset.NewMemoryStorage()}
+	priv := writeEdDSAKey(ctx, t, backend, keyID)
+	signed := signEdDSA(t, priv, keyID)
+
+	store := NewLastKnownGoodStorage(ctx, backend)
+	now := time.Now()
+	store.(*lastKnownGoodStorage).now = func() time.Time { return now }
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if store.Staleness() != 0 {
+		t.Fatalf("Expected no staleness while the backend is healthy, but got %s.", store.Staleness())
+	}
+
+	backend.failing.Store(true)
+	now = now.Add(time.Minute)
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT from the snapshot. Error: %s", err)
+	}
+	if store.Staleness() != time.Minute {
+		t.Fatalf("Expected staleness of %s, but got %s.", time.Minute, store.Staleness())
+	}
+	all, err := store.KeyReadAll(ctx)
+	if err != nil || len(all) != 1 {
+		t.Fatalf("Expected 1 key from the snapshot, but got %d. Error: %v", len(all), err)
+	}
+	_, err = store.KeyRead(ctx, "unknown")
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound for a key not in the snapshot, but got %s.", err)
+	}
+
+	backend.failing.Store(false)
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if store.Staleness() != 0 {
+		t.Fatalf("Expected no staleness after the backend recovered, but got %s.", store.Staleness())
+	}
+}
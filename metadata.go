@@ -0,0 +1,126 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyMetadata describes a JWK for authorization layers and debug endpoints, without the cryptographic key itself.
+type KeyMetadata struct {
+	ALG jwkset.ALG
+	CRV jwkset.CRV
+	// Extra are the nonstandard parameters of the JWK. See KeyManager.ExtraFields.
+	Extra  map[string]json.RawMessage
+	KEYOPS []jwkset.KEYOPS
+	KID    string
+	KTY    jwkset.KTY
+	// Provenance reports where the JWK came from, including the URL of its remote JWK Set and when its key ID was first
+	// and last seen there. See KeyManager.Provenance.
+	Provenance []KeyProvenance
+	// Thumbprint is the RFC 7638 thumbprint of the JWK. It is empty for keys with custom key types.
+	Thumbprint string
+	USE        jwkset.USE
+	// X5C is the parsed "x5c" certificate chain, leaf certificate first.
+	X5C     []*x509.Certificate
+	X5T     string
+	X5TS256 string
+	X5U     string
+}
+
+func (k keyfunc) KeyMetadata(ctx context.Context, kid string) (KeyMetadata, error) {
+	kid = k.normalizeKID(kid)
+	if r, ok := k.storage.(customKeyReader); ok {
+		if c, ok := r.customKeyRead(ctx, k.matchKID(kid)); ok {
+			return k.customKeyMetadata(c), nil
+		}
+	}
+	jwk, err := k.keyRead(ctx, kid)
+	if err != nil {
+		return KeyMetadata{}, fmt.Errorf("%w: could not read JWK from storage", errors.Join(err, ErrKeyfunc))
+	}
+	return k.jwkMetadata(jwk), nil
+}
+
+func (k keyfunc) customKeyMetadata(c customKey) KeyMetadata {
+	return KeyMetadata{
+		ALG:        c.alg,
+		Extra:      k.ExtraFields(c.kid),
+		KID:        c.kid,
+		KTY:        c.kty,
+		Provenance: k.Provenance(c.kid),
+		USE:        c.use,
+	}
+}
+
+func (k keyfunc) jwkMetadata(jwk jwkset.JWK) KeyMetadata {
+	m := jwk.Marshal()
+	thumbprint, _ := Thumbprint(jwk)
+	return KeyMetadata{
+		ALG:        m.ALG,
+		CRV:        m.CRV,
+		Extra:      k.ExtraFields(m.KID),
+		KEYOPS:     slices.Clone(m.KEYOPS),
+		KID:        m.KID,
+		KTY:        m.KTY,
+		Provenance: k.Provenance(m.KID),
+		Thumbprint: thumbprint,
+		USE:        m.USE,
+		X5C:        slices.Clone(jwk.X509().X5C),
+		X5T:        m.X5T,
+		X5TS256:    m.X5TS256,
+		X5U:        m.X5U,
+	}
+}
+
+// ResolvedKeys holds the metadata of the keys that a jwt.Keyfunc returned, so middleware can tell which key verified a
+// JWT after jwt.Parse completes, such as for logging, step-up decisions, or tenant attribution.
+type ResolvedKeys struct {
+	keys []KeyMetadata
+	mux  sync.Mutex
+}
+
+// resolvedKeysCtxKey is the context key for the ResolvedKeys of the JWT whose key is being read from storage.
+type resolvedKeysCtxKey struct{}
+
+// WithResolvedKeys returns a context that makes the jwt.Keyfunc returned by Keyfunc.KeyfuncCtx record the metadata of
+// the keys it returns in the ResolvedKeys. Use a new context for each JWT.
+func WithResolvedKeys(ctx context.Context) (context.Context, *ResolvedKeys) {
+	r := &ResolvedKeys{}
+	return context.WithValue(ctx, resolvedKeysCtxKey{}, r), r
+}
+
+// KeyfuncWithMeta returns a jwt.Keyfunc for a single JWT that reads keys with the given context and records the
+// metadata of the keys it returns in the ResolvedKeys.
+func KeyfuncWithMeta(ctx context.Context, k Keyfunc) (jwt.Keyfunc, *ResolvedKeys) {
+	ctx, r := WithResolvedKeys(ctx)
+	return k.KeyfuncCtx(ctx), r
+}
+
+// Keys returns the metadata of the keys returned for the JWT. It is empty if no key was returned. It has more than one
+// entry if several keys may verify the JWT, such as with KIDCollisionPreferNewest, in which case the JWT was verified by
+// one of them.
+func (r *ResolvedKeys) Keys() []KeyMetadata {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return slices.Clone(r.keys)
+}
+
+func (r *ResolvedKeys) add(metadata KeyMetadata) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.keys = append(r.keys, metadata)
+}
+
+// resolvedKeys returns the ResolvedKeys of the context, if any.
+func resolvedKeys(ctx context.Context) (*ResolvedKeys, bool) {
+	r, ok := ctx.Value(resolvedKeysCtxKey{}).(*ResolvedKeys)
+	return r, ok
+}
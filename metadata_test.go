@@ -0,0 +1,99 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rawJWK, _ := newX5CJWK(t, keyID, nil, nil)
+	var params map[string]any
+	err := json.Unmarshal(rawJWK, &params)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	params["issuer"] = "https://issuer.example.com"
+	params["use"] = "sig"
+	rawJWK, err = json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	raw := jwksJSON(t, rawJWK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(raw)
+	}))
+	defer server.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	metadata, err := k.(KeyManager).KeyMetadata(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key metadata. Error: %s", err)
+	}
+	if metadata.KID != keyID || metadata.KTY != jwkset.KtyOKP || metadata.CRV != jwkset.CrvEd25519 || metadata.USE != jwkset.UseSig {
+		t.Fatalf("Unexpected key metadata parameters %+v.", metadata)
+	}
+	if len(metadata.X5C) != 1 || metadata.X5T == "" || metadata.X5TS256 == "" {
+		t.Fatalf("Expected the certificate chain and thumbprints in the key metadata.")
+	}
+	if metadata.Thumbprint == "" {
+		t.Fatalf("Expected the RFC 7638 thumbprint in the key metadata.")
+	}
+	if len(metadata.Provenance) != 1 || metadata.Provenance[0].URL != server.URL || metadata.Provenance[0].FirstSeen.IsZero() {
+		t.Fatalf("Expected the provenance of the remote JWK Set in the key metadata, got %+v.", metadata.Provenance)
+	}
+	if string(metadata.Extra["issuer"]) != `"https://issuer.example.com"` {
+		t.Fatalf("Expected the extra fields in the key metadata.")
+	}
+
+	_, err = k.(KeyManager).KeyMetadata(ctx, "unknown")
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound for an unknown key ID. Error: %v", err)
+	}
+}
+
+func TestKeyfuncWithMeta(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	k, err := New(Options{
+		Ctx:     ctx,
+		Storage: store,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	keyF, resolved := KeyfuncWithMeta(ctx, k)
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), keyF)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	keys := resolved.Keys()
+	if len(keys) != 1 || keys[0].KID != keyID || keys[0].KTY != jwkset.KtyOKP {
+		t.Fatalf("Expected the metadata of the key that verified the JWT, got %+v.", keys)
+	}
+
+	keyF, resolved = KeyfuncWithMeta(ctx, k)
+	_, err = jwt.Parse(signEdDSA(t, priv, "unknown"), keyF)
+	if err == nil {
+		t.Fatalf("Expected an error for a JWT with an unknown key ID.")
+	}
+	if len(resolved.Keys()) != 0 {
+		t.Fatalf("Expected no key metadata for a JWT with an unknown key ID.")
+	}
+}
@@ -0,0 +1,117 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IssuerKeyfunc is the Keyfunc for the keys of one issuer of a MultiIssuer.
+type IssuerKeyfunc struct {
+	// Issuer is the "iss" claim of the JWTs signed by the keys of the Keyfunc.
+	Issuer  string
+	Keyfunc Keyfunc
+	// Timeout bounds the key lookup of this issuer when the issuers are queried in parallel. If zero, only the context
+	// of the lookup bounds it.
+	Timeout time.Duration
+}
+
+// MultiIssuerOptions configure NewMultiIssuer.
+type MultiIssuerOptions struct {
+	// Ctx is used by the Keyfunc method.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// Issuers are the configured issuers. Issuers are queried in the given order unless Parallel is set.
+	Issuers []IssuerKeyfunc
+	// Parallel queries the storages of all candidate issuers concurrently and returns the first key found, cancelling
+	// the other lookups. This avoids the latency of a serial scan when the storage of one issuer is remote and the key
+	// belongs to another.
+	Parallel bool
+}
+
+// MultiIssuer resolves the keys for JWTs from several issuers. If the "iss" claim of a JWT is a configured issuer, only
+// that issuer's Keyfunc is used. If the JWT has no "iss" claim, its key ID could belong to any issuer, so every issuer
+// is a candidate. JWTs with any other "iss" claim are rejected with jwt.ErrTokenInvalidIssuer.
+type MultiIssuer interface {
+	// Keyfunc resolves the key for the JWT with the context given at creation.
+	Keyfunc(token *jwt.Token) (any, error)
+	// KeyfuncCtx returns a jwt.Keyfunc that resolves the key for the JWT with the given context.
+	KeyfuncCtx(ctx context.Context) jwt.Keyfunc
+}
+
+type multiIssuer struct {
+	ctx      context.Context
+	issuers  []IssuerKeyfunc
+	parallel bool
+}
+
+// NewMultiIssuer creates a new MultiIssuer for the given issuers.
+func NewMultiIssuer(options MultiIssuerOptions) (MultiIssuer, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if len(options.Issuers) == 0 {
+		return nil, fmt.Errorf("%w: at least one issuer is required", ErrKeyfunc)
+	}
+	for i, issuer := range options.Issuers {
+		if issuer.Keyfunc == nil {
+			return nil, fmt.Errorf("%w: no Keyfunc for issuer %q", ErrKeyfunc, issuer.Issuer)
+		}
+		if slices.ContainsFunc(options.Issuers[:i], func(other IssuerKeyfunc) bool { return other.Issuer == issuer.Issuer }) {
+			return nil, fmt.Errorf("%w: duplicate issuer %q", ErrKeyfunc, issuer.Issuer)
+		}
+	}
+	return multiIssuer{
+		ctx:      options.Ctx,
+		issuers:  slices.Clone(options.Issuers),
+		parallel: options.Parallel,
+	}, nil
+}
+
+func (m multiIssuer) Keyfunc(token *jwt.Token) (any, error) {
+	return m.KeyfuncCtx(m.ctx)(token)
+}
+func (m multiIssuer) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		var iss string
+		if token.Claims != nil {
+			var err error
+			iss, err = token.Claims.GetIssuer()
+			if err != nil {
+				return nil, fmt.Errorf(`%w: could not read "iss" claim`, errors.Join(err, jwt.ErrTokenInvalidIssuer, ErrKeyfunc))
+			}
+		}
+		candidates := m.issuers
+		if iss != "" {
+			i := slices.IndexFunc(m.issuers, func(issuer IssuerKeyfunc) bool { return issuer.Issuer == iss })
+			if i == -1 {
+				return nil, fmt.Errorf(`%w: "iss" claim %q is not a configured issuer`, errors.Join(jwt.ErrTokenInvalidIssuer, ErrKeyfunc), iss)
+			}
+			candidates = m.issuers[i : i+1]
+		}
+		if len(candidates) == 1 {
+			key, err := candidates[0].Keyfunc.KeyfuncCtx(ctx)(token)
+			if err != nil {
+				return nil, errKIDOtherIssuers(err, m.issuers, iss, token)
+			}
+			return key, nil
+		}
+		if m.parallel {
+			children := make([]RaceChild, len(candidates))
+			for i, candidate := range candidates {
+				children[i] = RaceChild{Keyfunc: candidate.Keyfunc, Timeout: candidate.Timeout}
+			}
+			return Race(ctx, children...)(token)
+		}
+		keyfuncs := make([]jwt.Keyfunc, len(candidates))
+		for i, candidate := range candidates {
+			keyfuncs[i] = candidate.Keyfunc.KeyfuncCtx(ctx)
+		}
+		return Chain(keyfuncs...)(token)
+	}
+}
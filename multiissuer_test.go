@@ -0,0 +1,76 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMultiIssuer(t *testing.T) {
+	ctx := context.Background()
+	fastStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, fastStore, keyID)
+	fast, err := New(Options{Storage: fastStore})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	slow, err := New(Options{Storage: &blockingStorage{Storage: jwkset.NewMemoryStorage()}})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	issuers := []IssuerKeyfunc{
+		{Issuer: "https://slow.example.com", Keyfunc: slow},
+		{Issuer: "https://fast.example.com", Keyfunc: fast},
+	}
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header[jwkset.HeaderKID] = keyID
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		return signed
+	}
+
+	m, err := NewMultiIssuer(MultiIssuerOptions{Issuers: issuers})
+	if err != nil {
+		t.Fatalf("Failed to create MultiIssuer. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(jwt.MapClaims{"iss": "https://fast.example.com"}), m.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with a configured issuer. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(jwt.MapClaims{"iss": "https://other.example.com"}), m.Keyfunc)
+	if !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+		t.Fatalf("Expected jwt.ErrTokenInvalidIssuer for an unknown issuer, but got %s.", err)
+	}
+	start := time.Now()
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = jwt.Parse(sign(jwt.MapClaims{}), m.KeyfuncCtx(timeoutCtx))
+	if err != nil {
+		t.Fatalf("Failed to parse JWT without an issuer serially. Error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected the serial scan to wait for the slow issuer, but it took %s.", elapsed)
+	}
+
+	m, err = NewMultiIssuer(MultiIssuerOptions{Issuers: issuers, Parallel: true})
+	if err != nil {
+		t.Fatalf("Failed to create MultiIssuer. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(jwt.MapClaims{}), m.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT without an issuer in parallel. Error: %s", err)
+	}
+
+	_, err = NewMultiIssuer(MultiIssuerOptions{Issuers: append(issuers, issuers[0])})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for a duplicate issuer, but got %s.", err)
+	}
+}
@@ -0,0 +1,78 @@
+package keyfunc
+
+import (
+	"context"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func (k keyfunc) normalizeKID(kid string) string {
+	if k.kidNormalizer == nil {
+		return kid
+	}
+	return k.kidNormalizer(kid)
+}
+
+// matchKID returns a function that reports if a key ID in the JWK Set storage matches the normalized key ID from a JWT
+// header.
+func (k keyfunc) matchKID(kid string) func(string) bool {
+	return func(stored string) bool {
+		return k.normalizeKID(stored) == kid
+	}
+}
+
+// keyRead reads the JWK for the normalized key ID from storage. With a KIDNormalizer, a key ID that only matches a key
+// in storage after normalization is found before the key read, so it does not refresh the storage for an unknown key
+// ID. The keys in storage are compared again if the key read fails, as a refresh may have added a matching key.
+func (k keyfunc) keyRead(ctx context.Context, kid string) (jwkset.JWK, error) {
+	if k.kidNormalizer == nil {
+		return k.storage.KeyRead(ctx, kid)
+	}
+	if jwk, ok := k.normalizedKeyRead(ctx, kid); ok {
+		return jwk, nil
+	}
+	jwk, err := k.storage.KeyRead(ctx, kid)
+	if err == nil {
+		return jwk, nil
+	}
+	if normalized, ok := k.normalizedKeyRead(ctx, kid); ok {
+		return normalized, nil
+	}
+	return jwkset.JWK{}, err
+}
+
+// normalizedKeyRead returns the first JWK in storage whose key ID matches the normalized key ID only after
+// normalization. It returns false if a JWK has the exact key ID, as KeyRead finds it. Storage in this package is read
+// through its index of key IDs before the normalized key IDs of all keys are compared. Errors are left to KeyRead.
+func (k keyfunc) normalizedKeyRead(ctx context.Context, kid string) (jwkset.JWK, bool) {
+	if indexer, ok := k.storage.(kidIndexer); ok {
+		keys, err := indexer.kidKeys(ctx, kid, nil)
+		if err != nil || len(keys) > 0 {
+			return jwkset.JWK{}, false
+		}
+		keys, err = indexer.kidKeys(ctx, kid, k.matchKID(kid))
+		if err != nil || len(keys) == 0 {
+			return jwkset.JWK{}, false
+		}
+		return keys[0].jwk, true
+	}
+	all, err := k.storage.KeyReadAll(ctx)
+	if err != nil {
+		return jwkset.JWK{}, false
+	}
+	match := k.matchKID(kid)
+	found := -1
+	for i, jwk := range all {
+		stored := jwk.Marshal().KID
+		if stored == kid {
+			return jwkset.JWK{}, false
+		}
+		if found < 0 && match(stored) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return jwkset.JWK{}, false
+	}
+	return all[found], true
+}
@@ -0,0 +1,87 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKIDNormalizer(t *testing.T) {
+	ctx := context.Background()
+	normalizer := func(kid string) string {
+		return strings.ToLower(strings.TrimSpace(kid))
+	}
+
+	for _, policy := range []KIDCollisionPolicy{KIDCollisionFirst, KIDCollisionPreferNewest} {
+		t.Run(string(policy), func(t *testing.T) {
+			store := jwkset.NewMemoryStorage()
+			priv := writeEdDSAKey(ctx, t, store, " My-Key-ID")
+			signed := signEdDSA(t, priv, "my-key-id ")
+
+			k, err := New(Options{Storage: store, KIDCollisionPolicy: policy})
+			if err != nil {
+				t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+			}
+			_, err = jwt.Parse(signed, k.Keyfunc)
+			if !errors.Is(err, jwkset.ErrKeyNotFound) {
+				t.Fatalf("Expected jwkset.ErrKeyNotFound without a normalizer, but got %s.", err)
+			}
+
+			k, err = New(Options{Storage: store, KIDCollisionPolicy: policy, KIDNormalizer: normalizer})
+			if err != nil {
+				t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+			}
+			_, err = jwt.Parse(signed, k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT with normalized key ID. Error: %s", err)
+			}
+		})
+	}
+}
+
+func TestKIDNormalizerHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, " My-Key-ID")
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	k, err := NewWith(
+		WithContext(ctx),
+		WithURLs(server.URL),
+		WithKIDNormalizer(func(kid string) string {
+			return strings.ToLower(strings.TrimSpace(kid))
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	before := requests.Load()
+	signed := signEdDSA(t, priv, "my-key-id ")
+	for i := 0; i < 3; i++ {
+		_, err = jwt.Parse(signed, k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT with normalized key ID. Error: %s", err)
+		}
+	}
+	if fetches := requests.Load() - before; fetches != 0 {
+		t.Fatalf("Expected a normalized key ID to not refresh the remote JWK Set, got %d fetches.", fetches)
+	}
+}
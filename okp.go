@@ -0,0 +1,59 @@
+package keyfunc
+
+import (
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/MicahParks/jwkset"
+)
+
+const (
+	x448KeySize = 56
+)
+
+// X448PublicKey is the public key of an OKP JWK with the X448 curve, used for ECDH-ES. The Go standard library does not
+// implement X448, so the raw key bytes are provided for use with another implementation.
+// https://www.rfc-editor.org/rfc/rfc8037
+type X448PublicKey []byte
+
+// X448PrivateKey is the private key of an OKP JWK with the X448 curve.
+type X448PrivateKey struct {
+	D         []byte
+	PublicKey X448PublicKey
+}
+
+// Public returns the X448PublicKey of the private key.
+func (p X448PrivateKey) Public() crypto.PublicKey {
+	return p.PublicKey
+}
+
+// parseX448 parses an OKP JWK with the X448 curve, which github.com/MicahParks/jwkset does not support.
+func parseX448(marshal jwkset.JWKMarshal) (any, error) {
+	public, err := decodeOKPParameter(marshal.X)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decode %s key parameter "x": %w`, jwkset.KtyOKP, err)
+	}
+	if len(public) != x448KeySize {
+		return nil, fmt.Errorf("%w: %s with curve %s public key should be %d bytes", jwkset.ErrKeyUnmarshalParameter, jwkset.KtyOKP, jwkset.CrvX448, x448KeySize)
+	}
+	if marshal.D == "" {
+		return X448PublicKey(public), nil
+	}
+	private, err := decodeOKPParameter(marshal.D)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decode %s key parameter "d": %w`, jwkset.KtyOKP, err)
+	}
+	if len(private) != x448KeySize {
+		return nil, fmt.Errorf("%w: %s with curve %s private key should be %d bytes", jwkset.ErrKeyUnmarshalParameter, jwkset.KtyOKP, jwkset.CrvX448, x448KeySize)
+	}
+	return X448PrivateKey{
+		D:         private,
+		PublicKey: public,
+	}, nil
+}
+
+func decodeOKPParameter(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,62 @@
+package keyfunc
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOKPKeyAgreement(t *testing.T) {
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate X25519 key. Error: %s", err)
+	}
+	x448 := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("x", x448KeySize)))
+	d448 := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("d", x448KeySize)))
+	jwksJSON := json.RawMessage(`{"keys":[` +
+		`{"kty":"OKP","crv":"X25519","kid":"x25519","use":"enc","x":"` + base64.RawURLEncoding.EncodeToString(x25519.PublicKey().Bytes()) + `"},` +
+		`{"kty":"OKP","crv":"X448","kid":"x448","use":"enc","x":"` + x448 + `"},` +
+		`{"kty":"OKP","crv":"X448","kid":"x448-private","use":"enc","x":"` + x448 + `","d":"` + d448 + `"},` +
+		`{"kty":"OKP","crv":"X448","kid":"x448-short","x":"AAAA"}]}`)
+
+	var skipped []string
+	options := JWKSetJSONOptions{
+		ParseWarningHandler: func(kid string, kty jwkset.KTY, reason error) {
+			skipped = append(skipped, kid)
+		},
+		SkipUnparsable: true,
+	}
+	k, err := NewJWKSetJSONWithOptions(jwksJSON, options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if len(skipped) != 1 || skipped[0] != "x448-short" {
+		t.Fatalf("Expected only the invalid X448 key to be skipped, but got %v.", skipped)
+	}
+
+	keyF := func(kid string) (any, error) {
+		return k.Keyfunc(&jwt.Token{Header: map[string]any{"alg": "ECDH-ES", jwkset.HeaderKID: kid}})
+	}
+	key, err := keyF("x25519")
+	if _, ok := key.(*ecdh.PublicKey); !ok || err != nil {
+		t.Fatalf("Expected *ecdh.PublicKey for X25519, but got %T. Error: %v", key, err)
+	}
+	for _, kid := range []string{"x448", "x448-private"} {
+		key, err = keyF(kid)
+		if pub, ok := key.(X448PublicKey); !ok || len(pub) != x448KeySize || err != nil {
+			t.Fatalf("Expected X448PublicKey for %q, but got %T. Error: %v", kid, key, err)
+		}
+	}
+
+	_, err = keyF("x448-short")
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound for skipped key, but got %s.", err)
+	}
+}
@@ -0,0 +1,88 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrOkta is returned when the OIDC discovery document of an Okta authorization server cannot be used.
+	ErrOkta = errors.New("failed Okta authorization server discovery")
+)
+
+// OktaOptions configure NewOkta.
+type OktaOptions struct {
+	// Audiences are the audiences of the authorization server, such as "api://default". If set, the "aud" claim of a
+	// JWT must contain one of them.
+	Audiences []string
+	// AuthorizationServerID is the ID of a custom authorization server, such as "default". If empty, the org
+	// authorization server is used.
+	AuthorizationServerID string
+	// Ctx is used for the discovery request and ends the refresh goroutine when it is done.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// OrgURL is the URL of the Okta org, such as "https://example.okta.com".
+	OrgURL string
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the JWK Set caused by JWTs with an unknown key
+	// ID. Okta recommends caching keys and only fetching them again when a JWT has a key ID that is not in the cache,
+	// because keys can be rotated at any time in an emergency.
+	//
+	// This defaults to one minute.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the remote JWK Set. The Client and HTTPTimeout are also used for the discovery request.
+	//
+	// The RefreshInterval defaults to 24 hours, as Okta rotates keys about four times a year and recommends against
+	// fetching them frequently.
+	URLOptions URLOptions
+}
+
+// NewOkta creates a new Keyfunc for an Okta authorization server. The "jwks_uri" is read from the OIDC discovery
+// document of the authorization server, so the "/oauth2/{id}/v1/keys" path structure does not need to be known. JWTs
+// with an "iss" claim other than the authorization server, or not for one of the Audiences if set, are rejected with
+// jwt.ErrTokenInvalidIssuer or jwt.ErrTokenInvalidAudience.
+func NewOkta(options OktaOptions) (Keyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = time.Minute
+	}
+	if options.URLOptions.RefreshInterval == 0 {
+		options.URLOptions.RefreshInterval = 24 * time.Hour
+	}
+	orgURL := strings.TrimSuffix(options.OrgURL, "/")
+	_, err := url.ParseRequestURI(orgURL)
+	if err != nil {
+		return nil, redactError(fmt.Errorf("%w: failed to parse Okta org URL %q", errors.Join(err, ErrOkta), redact(options.OrgURL)))
+	}
+	issuer := orgURL
+	if options.AuthorizationServerID != "" {
+		issuer += "/oauth2/" + url.PathEscape(options.AuthorizationServerID)
+	}
+
+	client, timeout := options.URLOptions.discoveryClient()
+	ctx, cancel := context.WithTimeout(options.Ctx, timeout)
+	defer cancel()
+	discoveryURL := issuer + "/.well-known/openid-configuration"
+	source, found, err := fetchJWKSSource(ctx, client, discoveryURL)
+	if err != nil {
+		return nil, errors.Join(err, ErrOkta)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: no OIDC discovery document at %q", ErrOkta, redact(discoveryURL))
+	}
+	k, err := newProviderKeyfunc(options.Ctx, source.url, source.urlOptions(options.URLOptions), options.UnknownKIDRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return claimsKeyfunc{
+		managedKeyfunc: k,
+		audiences:      options.Audiences,
+		issuers:        []string{issuer},
+	}, nil
+}
@@ -0,0 +1,82 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewOkta(t *testing.T) {
+	tc := []struct {
+		name     string
+		serverID string
+		issuer   string
+	}{
+		{name: "Org", serverID: "", issuer: ""},
+		{name: "Custom", serverID: "default", issuer: "/oauth2/default"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			store := jwkset.NewMemoryStorage()
+			priv := writeEdDSAKey(ctx, t, store, keyID)
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case c.issuer + "/.well-known/openid-configuration":
+					_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": server.URL + c.issuer + "/v1/keys"})
+				case c.issuer + "/v1/keys":
+					raw, err := store.JSONPublic(ctx)
+					if err != nil {
+						t.Errorf("Failed to get JWK Set JSON. Error: %s", err)
+					}
+					_, _ = w.Write(raw)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			options := OktaOptions{
+				AuthorizationServerID: c.serverID,
+				Ctx:                   ctx,
+				OrgURL:                server.URL + "/",
+			}
+			k, err := NewOkta(options)
+			if err != nil {
+				t.Fatalf("Failed to create Okta keyfunc. Error: %s", err)
+			}
+			sign := func(iss string) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": iss})
+				token.Header[jwkset.HeaderKID] = keyID
+				signed, err := token.SignedString(priv)
+				if err != nil {
+					t.Fatalf("Failed to sign JWT. Error: %s", err)
+				}
+				return signed
+			}
+			_, err = jwt.Parse(sign(server.URL+c.issuer), k.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT. Error: %s", err)
+			}
+			_, err = jwt.Parse(sign(server.URL+"/oauth2/other"), k.Keyfunc)
+			if !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+				t.Fatalf("Expected error to be jwt.ErrTokenInvalidIssuer. Error: %v", err)
+			}
+
+			options.AuthorizationServerID = "missing"
+			_, err = NewOkta(options)
+			if !errors.Is(err, ErrOkta) {
+				t.Fatalf("Expected error to be ErrOkta. Error: %s", err)
+			}
+		})
+	}
+}
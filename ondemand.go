@@ -0,0 +1,350 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrOnDemandStorage is returned when a keyfunc on-demand storage fails to fetch or process a JWK Set.
+	ErrOnDemandStorage = errors.New("failed on-demand JWK Set storage")
+)
+
+// OnDemandOptions are used to configure the behavior of NewOnDemandStorage and NewOnDemand.
+type OnDemandOptions struct {
+	// DuplicateKIDPolicy determines which JWKs are ingested when the JWK Set contains the same key ID more than once. It
+	// defaults to DuplicateKIDKeepBoth.
+	DuplicateKIDPolicy DuplicateKIDPolicy
+
+	// Fetch retrieves the raw JWK Set. It is called from the goroutine reading keys, so the transport suitable for the
+	// platform can be injected, such as the fetch API of a browser through syscall/js or the HTTP host functions of a
+	// WASM runtime. It must not be nil.
+	Fetch func(ctx context.Context) (json.RawMessage, error)
+
+	// MinRefreshInterval is the minimum time between the starts of fetches during key reads, whether the keys are due or
+	// a key ID is not in storage. A key read while a fetch is in progress waits for it. After a failed fetch, the JWK
+	// Set is not fetched again until this has passed.
+	//
+	// This defaults to one minute.
+	MinRefreshInterval time.Duration
+
+	// ParseWarningHandler is called for every JWK in the JWK Set that is skipped because it cannot be parsed, and for
+	// every JWK with a duplicate key ID.
+	ParseWarningHandler ParseWarningHandler
+
+	// RefreshInterval is how long fetched keys are used before the next key read fetches the JWK Set again.
+	//
+	// This defaults to one hour.
+	RefreshInterval time.Duration
+
+	// RefreshErrorHandler consumes errors that happen when fetching the JWK Set while keys from a previous fetch are
+	// still available. Those keys keep being used.
+	RefreshErrorHandler func(ctx context.Context, err error)
+
+	// StrictParsing fails the fetch if any JWK in the JWK Set cannot be parsed, keeping the previous keys.
+	StrictParsing bool
+
+	// StrictRFC7517 skips JWKs in the JWK Set that deviate from RFC 7517. See HTTPStorageOptions.
+	StrictRFC7517 bool
+
+	// LenientNormalization fixes common deviations from RFC 7517 in the JWKs of the JWK Set. See HTTPStorageOptions.
+	LenientNormalization bool
+
+	// ValidateOptions are the options to use when validating the JWKs.
+	ValidateOptions jwkset.JWKValidateOptions
+}
+
+// OnDemandStorage is a jwkset.Storage that fetches its JWK Set only when keys are read. It never launches goroutines
+// or timers and does not use net/http, so it can run where those are unavailable or costly, such as browser WASM,
+// TinyGo, and edge runtimes that suspend between requests. The JWK Set is fetched on the first key read, again on the
+// first key read after RefreshInterval, and for key IDs that are not in storage, at most once per MinRefreshInterval.
+// It works like an HTTPStorage with the OnDemand option.
+type OnDemandStorage interface {
+	jwkset.Storage
+	ThumbprintReader
+	// Refresh fetches the JWK Set and replaces the keys in storage with the result.
+	Refresh(ctx context.Context) error
+}
+
+type onDemandStorage struct {
+	*memoryStorage
+	fetched   time.Time
+	gate      refreshGate
+	lastErr   error
+	options   OnDemandOptions
+	statusMux sync.Mutex
+}
+
+// NewOnDemandStorage creates a new OnDemandStorage. The JWK Set is not fetched until keys are read.
+func NewOnDemandStorage(options OnDemandOptions) (OnDemandStorage, error) {
+	if options.Fetch == nil {
+		return nil, fmt.Errorf("%w: a Fetch function is required", ErrOnDemandStorage)
+	}
+	if options.MinRefreshInterval == 0 {
+		options.MinRefreshInterval = time.Minute
+	}
+	if options.RefreshInterval == 0 {
+		options.RefreshInterval = time.Hour
+	}
+	return &onDemandStorage{
+		memoryStorage: newMemoryStorage(),
+		options:       options,
+	}, nil
+}
+
+// NewOnDemand creates a new Keyfunc with an OnDemandStorage. See OnDemandStorage for the platforms it is intended for.
+func NewOnDemand(options OnDemandOptions) (Keyfunc, error) {
+	storage, err := NewOnDemandStorage(options)
+	if err != nil {
+		return nil, err
+	}
+	return New(Options{
+		Storage: storage,
+	})
+}
+
+func (s *onDemandStorage) KeyRead(ctx context.Context, keyID string) (jwkset.JWK, error) {
+	err := ensureOnDemand(ctx, s, false)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	jwk, err := s.memoryStorage.KeyRead(ctx, keyID)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		return jwk, err
+	}
+	err = ensureOnDemand(ctx, s, true)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	return s.memoryStorage.KeyRead(ctx, keyID)
+}
+func (s *onDemandStorage) KeyReadAll(ctx context.Context) ([]jwkset.JWK, error) {
+	err := ensureOnDemand(ctx, s, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.memoryStorage.KeyReadAll(ctx)
+}
+func (s *onDemandStorage) KeyReadThumbprint(ctx context.Context, thumbprint string) (jwkset.JWK, error) {
+	err := ensureOnDemand(ctx, s, false)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	return s.memoryStorage.KeyReadThumbprint(ctx, thumbprint)
+}
+func (s *onDemandStorage) Refresh(ctx context.Context) error {
+	now := s.now()
+	err := s.refresh(ctx)
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	s.lastErr = err
+	if err == nil {
+		s.fetched = now
+	}
+	return err
+}
+
+// refresh fetches the JWK Set and replaces the keys in storage with the result.
+func (s *onDemandStorage) refresh(ctx context.Context) error {
+	raw, err := s.options.Fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to fetch JWK Set", errors.Join(err, ErrOnDemandStorage))
+	}
+	ingestOpts := ingestOptions{
+		duplicateKIDs: s.options.DuplicateKIDPolicy,
+		normalize:     s.options.LenientNormalization,
+		rfc7517:       s.options.StrictRFC7517,
+		strict:        s.options.StrictParsing,
+		validate:      s.options.ValidateOptions,
+		warn:          s.options.ParseWarningHandler,
+	}
+	result, err := ingest(raw, ingestOpts)
+	if err != nil {
+		return fmt.Errorf("%w: failed to process JWK Set", errors.Join(err, ErrOnDemandStorage))
+	}
+	s.replaceIngested(result)
+	return nil
+}
+
+// customKeyRead fetches the JWK Set if needed before reading keys with custom key types.
+func (s *onDemandStorage) customKeyRead(ctx context.Context, match func(kid string) bool) (customKey, bool) {
+	_ = ensureOnDemand(ctx, s, false)
+	return s.memoryStorage.customKeyRead(ctx, match)
+}
+
+// kidKeys fetches the JWK Set if needed before reading the JWKs with a key ID.
+func (s *onDemandStorage) kidKeys(ctx context.Context, kid string, match func(kid string) bool) ([]ingestedJWK, error) {
+	err := ensureOnDemand(ctx, s, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.memoryStorage.kidKeys(ctx, kid, match)
+}
+
+// certificateKeys fetches the JWK Set if needed before reading the JWKs with an X.509 certificate thumbprint.
+func (s *onDemandStorage) certificateKeys(ctx context.Context, header, value string) ([]ingestedJWK, error) {
+	err := ensureOnDemand(ctx, s, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.memoryStorage.certificateKeys(ctx, header, value)
+}
+
+// keysDue reports if the JWK Set was ever fetched and if it is older than the RefreshInterval option.
+func (s *onDemandStorage) keysDue() (fetched, due bool) {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	if s.fetched.IsZero() {
+		return false, true
+	}
+	return true, s.now().Sub(s.fetched) >= s.options.RefreshInterval
+}
+
+// refreshOnDemand fetches the JWK Set through the gate of the MinRefreshInterval option.
+func (s *onDemandStorage) refreshOnDemand(ctx context.Context) RefreshReport {
+	refresh := func(ctx context.Context) RefreshReport {
+		return RefreshReport{Err: s.Refresh(ctx)}
+	}
+	report, err := s.gate.do(ctx, s.now(), s.options.MinRefreshInterval, refresh, func() {})
+	if err != nil {
+		report.Err = fmt.Errorf("%w: context ended while waiting for fetch in progress", errors.Join(err, ErrOnDemandStorage))
+	}
+	return report
+}
+
+// neverFetched returns the error of key reads when a fetch is suppressed and the JWK Set was never fetched.
+func (s *onDemandStorage) neverFetched() error {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	return fmt.Errorf("%w: the JWK Set was never fetched", errors.Join(s.lastErr, ErrOnDemandStorage))
+}
+
+// handleRefreshError gives an error of a fetch to the RefreshErrorHandler option.
+func (s *onDemandStorage) handleRefreshError(ctx context.Context, err error) {
+	if s.options.RefreshErrorHandler != nil {
+		s.options.RefreshErrorHandler(ctx, err)
+	}
+}
+
+func (s *httpStorage) KeyRead(ctx context.Context, keyID string) (jwkset.JWK, error) {
+	err := s.ensureFresh(ctx)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	return s.memoryStorage.KeyRead(ctx, keyID)
+}
+func (s *httpStorage) KeyReadAll(ctx context.Context) ([]jwkset.JWK, error) {
+	err := s.ensureFresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.memoryStorage.KeyReadAll(ctx)
+}
+func (s *httpStorage) KeyReadThumbprint(ctx context.Context, thumbprint string) (jwkset.JWK, error) {
+	err := s.ensureFresh(ctx)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	return s.memoryStorage.KeyReadThumbprint(ctx, thumbprint)
+}
+
+// customKeyRead refreshes the remote JWK Set if needed before reading keys with custom key types.
+func (s *httpStorage) customKeyRead(ctx context.Context, match func(kid string) bool) (customKey, bool) {
+	_ = s.ensureFresh(ctx)
+	return s.memoryStorage.customKeyRead(ctx, match)
+}
+
+// kidKeys refreshes the remote JWK Set if needed before reading the JWKs with a key ID.
+func (s *httpStorage) kidKeys(ctx context.Context, kid string, match func(kid string) bool) ([]ingestedJWK, error) {
+	err := s.ensureFresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.memoryStorage.kidKeys(ctx, kid, match)
+}
+
+// certificateKeys refreshes the remote JWK Set if needed before reading the JWKs with an X.509 certificate thumbprint.
+func (s *httpStorage) certificateKeys(ctx context.Context, header, value string) ([]ingestedJWK, error) {
+	err := s.ensureFresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.memoryStorage.certificateKeys(ctx, header, value)
+}
+
+// ensureFresh refreshes the remote JWK Set before a key read if the OnDemand option is set. See ensureOnDemand.
+func (s *httpStorage) ensureFresh(ctx context.Context) error {
+	if !s.options.OnDemand {
+		return nil
+	}
+	return ensureOnDemand(ctx, s, false)
+}
+
+// keysDue reports if the remote JWK Set was ever fetched and if it is older than the RefreshInterval option or past a
+// scheduled refresh.
+func (s *httpStorage) keysDue() (fetched, due bool) {
+	interval := s.settings.get().RefreshInterval
+	now := s.now()
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	switch {
+	case s.status.LastSuccess.IsZero():
+		return false, true
+	case interval > 0 && now.Sub(s.status.LastSuccess) >= interval:
+		return true, true
+	case !s.status.NextScheduledRefresh.IsZero() && !now.Before(s.status.NextScheduledRefresh):
+		return true, true
+	}
+	return true, false
+}
+
+// refreshOnDemand refreshes the remote JWK Set through the gate of the MinRefreshInterval option.
+func (s *httpStorage) refreshOnDemand(ctx context.Context) RefreshReport {
+	return s.RefreshWithReport(ctx)
+}
+
+// neverFetched returns the error of key reads when a refresh is suppressed and the remote JWK Set was never fetched.
+func (s *httpStorage) neverFetched() error {
+	return fmt.Errorf("%w: the remote JWK Set was never fetched", errors.Join(s.Status().LastError, ErrHTTPStorage))
+}
+
+// onDemandKeys is a storage whose keys are fetched during key reads by ensureOnDemand.
+type onDemandKeys interface {
+	// keysDue reports if the keys were ever fetched and if they are due for a refresh.
+	keysDue() (fetched, due bool)
+	// refreshOnDemand refreshes the keys, waiting for a refresh in progress and suppressing refreshes that start sooner
+	// than the MinRefreshInterval option after the last.
+	refreshOnDemand(ctx context.Context) RefreshReport
+	// neverFetched returns the error of key reads when a refresh is suppressed and the keys were never fetched.
+	neverFetched() error
+	// handleRefreshError consumes the error of a refresh while keys from a previous refresh are still available.
+	handleRefreshError(ctx context.Context, err error)
+}
+
+// ensureOnDemand refreshes the keys before a key read if they were never fetched, are due, or force is set. It is the
+// mechanism of OnDemandStorage and of the OnDemand option of HTTPStorageOptions, so it launches no goroutines or
+// timers. If a refresh fails or is suppressed, the previous keys keep being used, so an error is only returned if the
+// keys were never fetched.
+func ensureOnDemand(ctx context.Context, keys onDemandKeys, force bool) error {
+	fetched, due := keys.keysDue()
+	if !due && !force {
+		return nil
+	}
+	report := keys.refreshOnDemand(ctx)
+	if fetched, _ = keys.keysDue(); !fetched {
+		if report.Err != nil {
+			return report.Err
+		}
+		return keys.neverFetched()
+	}
+	if report.Err != nil {
+		keys.handleRefreshError(ctx, report.Err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOnDemand(t *testing.T) {
+	original, originalPriv := expiringJWK(t, "original", nil)
+	rotated, rotatedPriv := expiringJWK(t, "rotated", nil)
+	jwks := jwksJSON(t, original)
+	var fetchErr error
+	fetches := 0
+	var refreshErrs []error
+	options := OnDemandOptions{
+		Fetch: func(ctx context.Context) (json.RawMessage, error) {
+			fetches++
+			return jwks, fetchErr
+		},
+		RefreshErrorHandler: func(ctx context.Context, err error) {
+			refreshErrs = append(refreshErrs, err)
+		},
+	}
+	storage, err := NewOnDemandStorage(options)
+	if err != nil {
+		t.Fatalf("Failed to create on-demand storage. Error: %s", err)
+	}
+	now := time.Now()
+	storage.(*onDemandStorage).now = func() time.Time {
+		return now
+	}
+	k, err := New(Options{Storage: storage})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if fetches != 0 {
+		t.Fatalf("Expected no fetch before keys are read, got %d.", fetches)
+	}
+
+	parse := func(priv any, kid string) error {
+		token := jwt.New(jwt.SigningMethodEdDSA)
+		token.Header[jwkset.HeaderKID] = kid
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		_, err = jwt.Parse(signed, k.Keyfunc)
+		return err
+	}
+	expectFetches := func(expected int) {
+		t.Helper()
+		if fetches != expected {
+			t.Fatalf("Expected %d fetches, got %d.", expected, fetches)
+		}
+	}
+
+	err = parse(originalPriv, "original")
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	err = parse(originalPriv, "original")
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	expectFetches(1)
+
+	jwks = jwksJSON(t, original, rotated)
+	err = parse(rotatedPriv, "rotated")
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected unknown kid to be rate limited. Error: %s", err)
+	}
+	expectFetches(1)
+	now = now.Add(time.Minute)
+	err = parse(rotatedPriv, "rotated")
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed with rotated key. Error: %s", err)
+	}
+	expectFetches(2)
+
+	fetchErr = errors.New("offline")
+	now = now.Add(time.Hour)
+	err = parse(originalPriv, "original")
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with keys from a previous fetch. Error: %s", err)
+	}
+	err = parse(originalPriv, "original")
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with keys from a previous fetch. Error: %s", err)
+	}
+	expectFetches(3)
+	if len(refreshErrs) != 1 || !errors.Is(refreshErrs[0], ErrOnDemandStorage) {
+		t.Fatalf("Expected one ErrOnDemandStorage refresh error, got %v.", refreshErrs)
+	}
+}
+
+func TestOnDemandFirstFetchFails(t *testing.T) {
+	options := OnDemandOptions{
+		Fetch: func(ctx context.Context) (json.RawMessage, error) {
+			return nil, errors.New("offline")
+		},
+	}
+	k, err := NewOnDemand(options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, priv := expiringJWK(t, keyID, nil)
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if !errors.Is(err, ErrOnDemandStorage) {
+		t.Fatalf("Expected error to be ErrOnDemandStorage. Error: %s", err)
+	}
+
+	_, err = NewOnDemand(OnDemandOptions{})
+	if !errors.Is(err, ErrOnDemandStorage) {
+		t.Fatalf("Expected error to be ErrOnDemandStorage without Fetch. Error: %s", err)
+	}
+}
+
+func TestOnDemandConcurrent(t *testing.T) {
+	original, _ := expiringJWK(t, "original", nil)
+	jwks := jwksJSON(t, original)
+	var fetches atomic.Int64
+	storage, err := NewOnDemandStorage(OnDemandOptions{
+		Fetch: func(ctx context.Context) (json.RawMessage, error) {
+			fetches.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			return jwks, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create on-demand storage. Error: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := storage.KeyRead(context.Background(), "original")
+			if err != nil {
+				t.Errorf("Failed to read key. Error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches.Load() != 1 {
+		t.Fatalf("Expected concurrent key reads to share 1 fetch, got %d.", fetches.Load())
+	}
+}
+
+func TestHTTPStorageOnDemand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	var failing atomic.Bool
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	var refreshErrs atomic.Int64
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:                 ctx,
+		MinRefreshInterval:  time.Millisecond,
+		OnDemand:            true,
+		RefreshErrorHandler: func(ctx context.Context, err error) { refreshErrs.Add(1) },
+		RefreshInterval:     50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	if requests.Load() != 0 {
+		t.Fatalf("Expected no request before keys are read, got %d.", requests.Load())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.KeyRead(ctx, keyID)
+			if err != nil {
+				t.Errorf("Failed to read key. Error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if requests.Load() != 1 {
+		t.Fatalf("Expected concurrent key reads to share 1 request, got %d.", requests.Load())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if requests.Load() != 1 {
+		t.Fatalf("Expected no request without key reads, got %d.", requests.Load())
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key. Error: %s", err)
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("Expected a key read after RefreshInterval to refresh, got %d requests.", requests.Load())
+	}
+
+	failing.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	_, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Expected the previous keys to be used when a refresh fails. Error: %s", err)
+	}
+	if refreshErrs.Load() != 1 {
+		t.Fatalf("Expected the refresh error to be handled, got %d.", refreshErrs.Load())
+	}
+
+	store, err = NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:      ctx,
+		OnDemand: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if !errors.Is(err, ErrHTTPStorage) {
+		t.Fatalf("Expected an error when the remote JWK Set was never fetched, got %v.", err)
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if !errors.Is(err, ErrHTTPStorage) {
+		t.Fatalf("Expected an error when the refresh is suppressed and the remote JWK Set was never fetched, got %v.", err)
+	}
+}
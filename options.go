@@ -0,0 +1,181 @@
+package keyfunc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"golang.org/x/time/rate"
+)
+
+// Option configures a Keyfunc created by NewWith.
+type Option func(b *builder) error
+
+type builder struct {
+	options         Options
+	refreshInterval time.Duration
+	urls            map[string]URLOptions
+}
+
+// NewWith creates a new Keyfunc from functional options. Options are applied in order, so later options override
+// earlier ones.
+//
+// If any URLs are given, the JWK Set storage is an HTTPClient with the same default behavior as NewDefaultCtx, and a
+// storage given with WithStorage holds keys known from outside the URLs. This will launch a "refresh goroutine" for
+// each URL. Use WithContext to end them.
+func NewWith(opts ...Option) (Keyfunc, error) {
+	b := &builder{
+		urls: make(map[string]URLOptions),
+	}
+	for _, opt := range opts {
+		err := opt(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(b.urls) == 0 {
+		return New(b.options)
+	}
+
+	ctx := b.options.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	urls := make(map[string]URLOptions, len(b.urls))
+	for u, urlOptions := range b.urls {
+		if urlOptions.RefreshInterval == 0 {
+			urlOptions.RefreshInterval = b.refreshInterval
+		}
+		urls[u] = urlOptions
+	}
+	httpURLs, err := newDefaultHTTPStorages(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions := HTTPClientOptions{
+		Given:             b.options.Storage,
+		HTTPURLs:          httpURLs,
+		RateLimitWaitMax:  time.Minute,
+		RefreshUnknownKID: rate.NewLimiter(rate.Every(5*time.Minute), 1),
+	}
+	client, err := NewHTTPClient(clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	options := b.options
+	options.Storage = client
+	return New(options)
+}
+
+// WithAlgWhitelist sets the AlgWhitelist option.
+func WithAlgWhitelist(algs ...jwkset.ALG) Option {
+	return func(b *builder) error {
+		b.options.AlgWhitelist = algs
+		return nil
+	}
+}
+
+// WithContext sets the Ctx option. It is also used to end the "refresh goroutine" of each URL.
+func WithContext(ctx context.Context) Option {
+	return func(b *builder) error {
+		b.options.Ctx = ctx
+		return nil
+	}
+}
+
+// WithKIDCollisionPolicy sets the KIDCollisionPolicy option.
+func WithKIDCollisionPolicy(policy KIDCollisionPolicy) Option {
+	return func(b *builder) error {
+		b.options.KIDCollisionPolicy = policy
+		return nil
+	}
+}
+
+// WithKIDNormalizer sets the KIDNormalizer option.
+func WithKIDNormalizer(normalizer func(kid string) string) Option {
+	return func(b *builder) error {
+		b.options.KIDNormalizer = normalizer
+		return nil
+	}
+}
+
+// WithKeyIDHeaders sets the KeyIDHeaders option.
+func WithKeyIDHeaders(headers ...string) Option {
+	return func(b *builder) error {
+		b.options.KeyIDHeaders = headers
+		return nil
+	}
+}
+
+// WithLookupTimeout sets the LookupTimeout option.
+func WithLookupTimeout(timeout time.Duration) Option {
+	return func(b *builder) error {
+		b.options.LookupTimeout = timeout
+		return nil
+	}
+}
+
+// WithRefreshInterval sets the refresh interval of URLs that do not have one set with WithURLOptions.
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(b *builder) error {
+		if interval < 0 {
+			return fmt.Errorf("%w: refresh interval must not be negative", ErrKeyfunc)
+		}
+		b.refreshInterval = interval
+		return nil
+	}
+}
+
+// WithStorage sets the Storage option. When URLs are given, it holds keys known from outside the URLs.
+func WithStorage(storage jwkset.Storage) Option {
+	return func(b *builder) error {
+		b.options.Storage = storage
+		return nil
+	}
+}
+
+// WithStorageErrorPolicy sets the StorageErrorPolicy option.
+func WithStorageErrorPolicy(policy StorageErrorPolicy) Option {
+	return func(b *builder) error {
+		b.options.StorageErrorPolicy = policy
+		return nil
+	}
+}
+
+// WithUnknownKIDRateLimit sets the UnknownKIDRateLimit and UnknownKIDRateLimitBurst options.
+func WithUnknownKIDRateLimit(limit rate.Limit, burst int) Option {
+	return func(b *builder) error {
+		b.options.UnknownKIDRateLimit = limit
+		b.options.UnknownKIDRateLimitBurst = burst
+		return nil
+	}
+}
+
+// WithURLOptions adds a URL for a remote JWK Set with its own options.
+func WithURLOptions(u string, options URLOptions) Option {
+	return func(b *builder) error {
+		b.urls[u] = options
+		return nil
+	}
+}
+
+// WithURLs adds URLs for remote JWK Sets with the default options.
+func WithURLs(urls ...string) Option {
+	return func(b *builder) error {
+		for _, u := range urls {
+			if _, ok := b.urls[u]; !ok {
+				b.urls[u] = URLOptions{}
+			}
+		}
+		return nil
+	}
+}
+
+// WithUseWhitelist sets the UseWhitelist option.
+func WithUseWhitelist(uses ...jwkset.USE) Option {
+	return func(b *builder) error {
+		b.options.UseWhitelist = uses
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewWith(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	remotePriv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	given := jwkset.NewMemoryStorage()
+	const givenKID = "given-key-id"
+	givenPriv := writeEdDSAKey(ctx, t, given, givenKID)
+
+	k, err := NewWith(
+		WithContext(ctx),
+		WithURLs(server.URL),
+		WithRefreshInterval(time.Hour),
+		WithStorage(given),
+		WithAlgWhitelist(jwkset.AlgEdDSA),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	client, ok := k.Storage().(HTTPClient)
+	if !ok {
+		t.Fatalf("Expected storage to be an HTTPClient.")
+	}
+	if client.Given() != given {
+		t.Fatalf("Expected the given storage to hold keys known from outside the URLs.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, remotePriv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by remote key. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, givenPriv, givenKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by given key. Error: %s", err)
+	}
+
+	k, err = NewWith(WithStorage(given), WithAlgWhitelist(jwkset.AlgRS256))
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, givenPriv, givenKID), k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for alg not in whitelist, but got %s.", err)
+	}
+
+	_, err = NewWith(WithRefreshInterval(-time.Second))
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for negative refresh interval, but got %s.", err)
+	}
+	_, err = NewWith()
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc without storage or URLs, but got %s.", err)
+	}
+}
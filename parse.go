@@ -0,0 +1,20 @@
+package keyfunc
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ParseCtx is like jwt.Parse, but the given context is used when reading keys from the JWK Set storage. Pass the
+// inbound HTTP request's context so cancellation, deadlines, and trace context flow through key resolution, including
+// any refresh of a remote JWK Set triggered by an unknown key ID.
+func ParseCtx(ctx context.Context, k Keyfunc, tokenString string, options ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, k.KeyfuncCtx(ctx), options...)
+}
+
+// ParseWithClaimsCtx is like jwt.ParseWithClaims, but the given context is used when reading keys from the JWK Set
+// storage. See ParseCtx.
+func ParseWithClaimsCtx(ctx context.Context, k Keyfunc, tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, k.KeyfuncCtx(ctx), options...)
+}
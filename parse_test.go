@@ -0,0 +1,43 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseCtx(t *testing.T) {
+	store := &blockingStorage{Storage: jwkset.NewMemoryStorage()}
+	priv := writeEdDSAKey(context.Background(), t, store, keyID)
+	signed := signEdDSA(t, priv, keyID)
+
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ParseCtx(ctx, k, signed)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from the request context, but got %s.", err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = ParseWithClaimsCtx(ctx, k, signed, claims)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from the request context, but got %s.", err)
+	}
+
+	k, err = New(Options{Storage: store.Storage})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	token, err := ParseWithClaimsCtx(context.Background(), k, signed, claims, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil || !token.Valid {
+		t.Fatalf("Failed to parse JWT. Error: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package keyfunc
+
+import (
+	"fmt"
+)
+
+// checkPins confirms every pinned key ID and RFC 7638 thumbprint is present in the ingested JWK Set.
+func (r ingestResult) checkPins(kids, thumbprints []string) error {
+	if len(kids) == 0 && len(thumbprints) == 0 {
+		return nil
+	}
+	foundKIDs := make(map[string]struct{}, len(r.set)+len(r.custom))
+	foundThumbprints := make(map[string]struct{}, len(r.set))
+	for _, jwk := range r.set {
+		foundKIDs[jwk.Marshal().KID] = struct{}{}
+		if len(thumbprints) > 0 {
+			tp, err := Thumbprint(jwk)
+			if err != nil {
+				continue
+			}
+			foundThumbprints[tp] = struct{}{}
+		}
+	}
+	for _, c := range r.custom {
+		foundKIDs[c.kid] = struct{}{}
+	}
+	for _, kid := range kids {
+		if _, ok := foundKIDs[kid]; !ok {
+			return fmt.Errorf("%w: key ID %q", ErrPinnedKeyMissing, kid)
+		}
+	}
+	for _, tp := range thumbprints {
+		if _, ok := foundThumbprints[tp]; !ok {
+			return fmt.Errorf("%w: thumbprint %q", ErrPinnedKeyMissing, tp)
+		}
+	}
+	return nil
+}
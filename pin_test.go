@@ -0,0 +1,68 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestHTTPStoragePinnedKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	pinned, err := serverStore.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read pinned key. Error: %s", err)
+	}
+	tp, err := Thumbprint(pinned)
+	if err != nil {
+		t.Fatalf("Failed to compute thumbprint. Error: %s", err)
+	}
+
+	_, err = NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx, PinnedKIDs: []string{"missing"}})
+	if !errors.Is(err, ErrPinnedKeyMissing) || !errors.Is(err, ErrHTTPStorage) {
+		t.Fatalf("Expected ErrPinnedKeyMissing for missing key ID, but got %s.", err)
+	}
+	_, err = NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx, PinnedThumbprints: []string{"missing"}})
+	if !errors.Is(err, ErrPinnedKeyMissing) {
+		t.Fatalf("Expected ErrPinnedKeyMissing for missing thumbprint, but got %s.", err)
+	}
+
+	options := HTTPStorageOptions{
+		Ctx:               ctx,
+		PinnedKIDs:        []string{keyID},
+		PinnedThumbprints: []string{tp},
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+
+	// Swap the pinned key for an attacker's key with the same key ID.
+	_, err = serverStore.KeyDelete(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to delete pinned key. Error: %s", err)
+	}
+	_ = writeEdDSAKey(ctx, t, serverStore, keyID)
+	err = store.Refresh(ctx)
+	if !errors.Is(err, ErrPinnedKeyMissing) {
+		t.Fatalf("Expected ErrPinnedKeyMissing after the pinned key was replaced, but got %s.", err)
+	}
+
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected previous keys to be kept. Error: %s", err)
+	}
+}
@@ -0,0 +1,107 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyProvenance describes where a JWK came from.
+type KeyProvenance struct {
+	// FirstSeen is when the key ID was first seen in the remote JWK Set. It is zero for given keys.
+	FirstSeen time.Time
+	// Given is true if the JWK is a given key of an HTTPClient rather than from a remote JWK Set.
+	Given bool
+	// Issuer is the "iss" claim configured for the remote JWK Set with HTTPClientOptions.Issuers, if any.
+	Issuer string
+	// LastSeen is when the key ID was last seen in the remote JWK Set. It is zero for given keys.
+	LastSeen time.Time
+	// URL is the URL of the remote JWK Set. It is empty for given keys.
+	URL string
+}
+
+// provenanceReader is implemented by storage in this package that records where its keys came from.
+type provenanceReader interface {
+	Provenance(kid string) []KeyProvenance
+}
+
+// recordProvenance updates the provenance of the key IDs in the ingested JWK Set. Key IDs that are no longer in the JWK
+// Set are forgotten. The status mutex must not be held.
+func (s *httpStorage) recordProvenance(result ingestResult) {
+	now := s.now()
+	kids := make([]string, 0, len(result.set)+len(result.custom))
+	for _, jwk := range result.set {
+		kids = append(kids, jwk.Marshal().KID)
+	}
+	for _, c := range result.custom {
+		kids = append(kids, c.kid)
+	}
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	provenance := make(map[string]KeyProvenance, len(kids))
+	for _, kid := range kids {
+		p, ok := s.provenance[kid]
+		if !ok {
+			p = KeyProvenance{FirstSeen: now, URL: s.url}
+		}
+		p.LastSeen = now
+		provenance[kid] = p
+	}
+	s.provenance = provenance
+}
+
+func (s *httpStorage) Provenance(kid string) []KeyProvenance {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	p, ok := s.provenance[kid]
+	if !ok {
+		return nil
+	}
+	return []KeyProvenance{p}
+}
+
+func (c *httpClient) Provenance(kid string) []KeyProvenance {
+	var provenance []KeyProvenance
+	_, err := c.given.KeyRead(context.Background(), kid)
+	if err == nil {
+		provenance = append(provenance, KeyProvenance{Given: true})
+	}
+	urls, stores := c.urlStores()
+	for i, store := range stores {
+		r, ok := store.(provenanceReader)
+		if !ok {
+			continue
+		}
+		for _, p := range r.Provenance(kid) {
+			c.mux.RLock()
+			p.Issuer = c.issuers[urls[i]]
+			c.mux.RUnlock()
+			provenance = append(provenance, p)
+		}
+	}
+	return provenance
+}
+
+// errKIDOtherIssuers explains a key ID of the JWT that was not found for the issuer iss by naming the other issuers
+// with a JWK for the key ID. Other errors are returned unchanged.
+func errKIDOtherIssuers(err error, issuers []IssuerKeyfunc, iss string, token *jwt.Token) error {
+	kid, _ := token.Header[jwkset.HeaderKID].(string)
+	if kid == "" || !errors.Is(err, jwkset.ErrKeyNotFound) {
+		return err
+	}
+	var others []string
+	for _, issuer := range issuers {
+		m, ok := issuer.Keyfunc.(KeyManager)
+		if ok && issuer.Issuer != iss && len(m.Provenance(kid)) > 0 {
+			others = append(others, issuer.Issuer)
+		}
+	}
+	if len(others) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w: kid %q exists but only for issuers %q", err, kid, others)
+}
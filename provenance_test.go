@@ -0,0 +1,94 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestProvenance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := newJWKSServer(ctx, t, serverStore)
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	store.(*httpStorage).now = func() time.Time { return now }
+	firstSeen := store.Provenance(keyID)[0].FirstSeen
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+	}
+
+	given := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, given, keyID)
+	client, err := NewHTTPClient(HTTPClientOptions{
+		Given:    given,
+		HTTPURLs: map[string]jwkset.Storage{server.URL: store},
+		Issuers:  map[string]string{server.URL: "https://issuer.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	k, err := New(Options{Storage: client})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	provenance := k.(KeyManager).Provenance(keyID)
+	want := []KeyProvenance{
+		{Given: true},
+		{FirstSeen: firstSeen, Issuer: "https://issuer.example.com", LastSeen: now, URL: server.URL},
+	}
+	if len(provenance) != len(want) || provenance[0] != want[0] || provenance[1] != want[1] {
+		t.Fatalf("Expected provenance %+v, got %+v.", want, provenance)
+	}
+	if provenance := k.(KeyManager).Provenance("unknown-key-id"); len(provenance) != 0 {
+		t.Fatalf("Expected no provenance for an unknown key ID, got %+v.", provenance)
+	}
+
+	_, err = serverStore.KeyDelete(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to delete key. Error: %s", err)
+	}
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+	}
+	if provenance := store.Provenance(keyID); len(provenance) != 0 {
+		t.Fatalf("Expected the provenance of a removed key ID to be forgotten, got %+v.", provenance)
+	}
+
+	other, err := New(Options{Storage: jwkset.NewMemoryStorage()})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	m, err := NewMultiIssuer(MultiIssuerOptions{Issuers: []IssuerKeyfunc{
+		{Issuer: "https://issuer.example.com", Keyfunc: k},
+		{Issuer: "https://other.example.com", Keyfunc: other},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create MultiIssuer. Error: %s", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": "https://other.example.com"})
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, m.Keyfunc)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) || !strings.Contains(err.Error(), `exists but only for issuers ["https://issuer.example.com"]`) {
+		t.Fatalf("Expected the error to name the issuer with the key ID. Error: %v", err)
+	}
+}
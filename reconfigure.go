@@ -0,0 +1,92 @@
+package keyfunc
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RefreshSettings are the options of an HTTPStorage that control how often the remote JWK Set is fetched. They can be
+// changed while the HTTPStorage is in use, such as to poll more often during a key rotation incident and less often
+// afterward.
+type RefreshSettings struct {
+	// FetchRateLimit is the FetchRateLimit option of HTTPStorageOptions. If nil, HTTP requests are not limited.
+	FetchRateLimit *rate.Limiter
+	// MinRefreshInterval is the MinRefreshInterval option of HTTPStorageOptions. If zero, refreshes are not limited.
+	MinRefreshInterval time.Duration
+	// RefreshInterval is the RefreshInterval option of HTTPStorageOptions. If zero, the remote JWK Set is not refreshed
+	// on an interval.
+	RefreshInterval time.Duration
+}
+
+// refreshSettings are the RefreshSettings of an httpStorage and the "refresh goroutine" that uses them.
+type refreshSettings struct {
+	loop       sync.Once
+	mux        sync.RWMutex
+	reschedule chan struct{}
+	settings   RefreshSettings
+}
+
+func newRefreshSettings(options HTTPStorageOptions) *refreshSettings {
+	return &refreshSettings{
+		reschedule: make(chan struct{}, 1),
+		settings: RefreshSettings{
+			FetchRateLimit:     options.FetchRateLimit,
+			MinRefreshInterval: options.MinRefreshInterval,
+			RefreshInterval:    options.RefreshInterval,
+		},
+	}
+}
+
+func (r *refreshSettings) get() RefreshSettings {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.settings
+}
+
+func (s *httpStorage) RefreshSettings() RefreshSettings {
+	return s.settings.get()
+}
+func (s *httpStorage) SetRefreshSettings(settings RefreshSettings) {
+	s.settings.mux.Lock()
+	s.settings.settings = settings
+	s.settings.mux.Unlock()
+	if settings.RefreshInterval > 0 {
+		s.startRefreshLoop()
+	}
+	select {
+	case s.settings.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// startRefreshLoop launches the "refresh goroutine" unless it was already launched or the OnDemand option is set.
+func (s *httpStorage) startRefreshLoop() {
+	if s.options.OnDemand {
+		return
+	}
+	s.settings.loop.Do(func() {
+		go s.refreshLoop()
+	})
+}
+
+// SetRefreshUnknownKIDLimit changes the rate limit of refreshes for unknown key IDs. If the HTTPClient was created
+// without the RefreshUnknownKID option, refreshes for unknown key IDs are enabled with the rate limit.
+func (c *httpClient) SetRefreshUnknownKIDLimit(limit rate.Limit, burst int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.refreshUnknownKID == nil {
+		c.refreshUnknownKID = rate.NewLimiter(limit, burst)
+		return
+	}
+	c.refreshUnknownKID.SetLimit(limit)
+	c.refreshUnknownKID.SetBurst(burst)
+}
+
+// unknownKIDLimiter returns the rate limiter of refreshes for unknown key IDs, or nil if they are disabled.
+func (c *httpClient) unknownKIDLimiter() *rate.Limiter {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.refreshUnknownKID
+}
@@ -0,0 +1,123 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestSetRefreshSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:             ctx,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	if store.RefreshSettings().RefreshInterval != time.Hour {
+		t.Fatalf("Expected refresh interval %s, got %s.", time.Hour, store.RefreshSettings().RefreshInterval)
+	}
+
+	store.SetRefreshSettings(RefreshSettings{RefreshInterval: 10 * time.Millisecond})
+	time.Sleep(100 * time.Millisecond)
+	if requests.Load() < 3 {
+		t.Fatalf("Expected the shorter refresh interval to take effect, got %d requests.", requests.Load())
+	}
+
+	store.SetRefreshSettings(RefreshSettings{})
+	time.Sleep(20 * time.Millisecond)
+	stopped := requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() != stopped {
+		t.Fatalf("Expected no refreshes without a refresh interval.")
+	}
+
+	store.SetRefreshSettings(RefreshSettings{MinRefreshInterval: time.Hour})
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	report := store.RefreshWithReport(ctx)
+	if !report.Suppressed {
+		t.Fatalf("Expected the new minimum refresh interval to suppress the refresh.")
+	}
+
+	store.SetRefreshSettings(RefreshSettings{FetchRateLimit: rate.NewLimiter(rate.Every(time.Hour), 1)})
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	limitedCtx, limitedCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer limitedCancel()
+	err = store.Refresh(limitedCtx)
+	if err == nil {
+		t.Fatalf("Expected the new fetch rate limit to delay the refresh past the deadline.")
+	}
+
+	unknownStore := jwkset.NewMemoryStorage()
+	unknownServer := newJWKSServer(ctx, t, unknownStore)
+	defer unknownServer.Close()
+	client, err := NewHTTPClient(HTTPClientOptions{
+		HTTPURLs: map[string]jwkset.Storage{unknownServer.URL: nil},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	k, err := New(Options{Ctx: ctx, Storage: client})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	const rotatedKID = "rotated"
+	priv := writeEdDSAKey(ctx, t, unknownStore, rotatedKID)
+	_, err = jwt.Parse(signEdDSA(t, priv, rotatedKID), k.Keyfunc)
+	if err == nil {
+		t.Fatalf("Expected an error for an unknown key ID without refreshes for unknown key IDs.")
+	}
+	client.SetRefreshUnknownKIDLimit(rate.Inf, 1)
+	_, err = jwt.Parse(signEdDSA(t, priv, rotatedKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT after enabling refreshes for unknown key IDs. Error: %s", err)
+	}
+}
+
+func TestSetRefreshSettingsPause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newJWKSServer(ctx, t, jwkset.NewMemoryStorage())
+	defer server.Close()
+	for i := 0; i < 100; i++ {
+		store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+			Ctx: ctx,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+		}
+		store.SetRefreshSettings(RefreshSettings{RefreshInterval: time.Hour})
+		store.SetRefreshSettings(RefreshSettings{})
+	}
+	time.Sleep(20 * time.Millisecond)
+}
@@ -0,0 +1,68 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+// refreshMetadata returns how long until the next refresh according to the top-level members of a JWK Set that some
+// federations publish: "nextUpdate" and "exp" are when the JWK Set should be fetched again, as a NumericDate or an RFC
+// 3339 timestamp, and "refresh_hint" is a number of seconds to wait. The earliest applies. It returns false if the JWK
+// Set has none of these members or they cannot be parsed.
+func refreshMetadata(raw json.RawMessage, now time.Time) (time.Duration, bool) {
+	var members struct {
+		EXP         json.RawMessage `json:"exp"`
+		NextUpdate  json.RawMessage `json:"nextUpdate"`
+		RefreshHint json.Number     `json:"refresh_hint"`
+	}
+	if json.Unmarshal(raw, &members) != nil {
+		return 0, false
+	}
+	var wait time.Duration
+	found := false
+	use := func(d time.Duration) {
+		if !found || d < wait {
+			wait = d
+		}
+		found = true
+	}
+	for _, member := range []json.RawMessage{members.NextUpdate, members.EXP} {
+		if at, ok := metadataTime(member); ok {
+			use(at.Sub(now))
+		}
+	}
+	if seconds, err := members.RefreshHint.Float64(); err == nil && seconds >= 0 {
+		use(time.Duration(min(seconds, float64(maxDurationSeconds)) * float64(time.Second)))
+	}
+	return wait, found
+}
+
+// metadataTime parses a NumericDate or an RFC 3339 timestamp.
+func metadataTime(member json.RawMessage) (time.Time, bool) {
+	if len(member) == 0 {
+		return time.Time{}, false
+	}
+	var s string
+	if json.Unmarshal(member, &s) == nil {
+		at, err := time.Parse(time.RFC3339, s)
+		return at, err == nil
+	}
+	seconds, err := strconv.ParseFloat(string(member), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, false
+	}
+	whole, frac := math.Modf(min(max(seconds, 0), float64(maxDurationSeconds)))
+	return time.Unix(int64(whole), int64(frac*1e9)), true
+}
+
+// refreshMetadataWait bounds the wait from the refresh metadata of a JWK Set by the RefreshMetadataMin and
+// RefreshMetadataMax options.
+func (s *httpStorage) refreshMetadataWait(raw json.RawMessage) (time.Duration, bool) {
+	wait, ok := refreshMetadata(raw, s.now())
+	if !ok {
+		return 0, false
+	}
+	return min(max(wait, s.options.RefreshMetadataMin), s.options.RefreshMetadataMax), true
+}
@@ -0,0 +1,69 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRefreshMetadata(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tc := []struct {
+		name string
+		raw  string
+		wait time.Duration
+		ok   bool
+	}{
+		{name: "NextUpdateNumericDate", raw: `{"keys":[],"nextUpdate":1700003600}`, wait: time.Hour, ok: true},
+		{name: "NextUpdateRFC3339", raw: `{"keys":[],"nextUpdate":"` + now.Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, wait: time.Hour, ok: true},
+		{name: "EXP", raw: `{"keys":[],"exp":1700000600}`, wait: 10 * time.Minute, ok: true},
+		{name: "RefreshHint", raw: `{"keys":[],"refresh_hint":300}`, wait: 5 * time.Minute, ok: true},
+		{name: "Earliest", raw: `{"keys":[],"exp":1700003600,"refresh_hint":60}`, wait: time.Minute, ok: true},
+		{name: "Passed", raw: `{"keys":[],"nextUpdate":1699999000}`, wait: -1000 * time.Second, ok: true},
+		{name: "Missing", raw: `{"keys":[]}`},
+		{name: "Invalid", raw: `{"keys":[],"nextUpdate":"tomorrow"}`},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			wait, ok := refreshMetadata([]byte(c.raw), now)
+			if wait != c.wait || ok != c.ok {
+				t.Fatalf("Expected %s, %t, got %s, %t.", c.wait, c.ok, wait, ok)
+			}
+		})
+	}
+}
+
+func TestHonorRefreshMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nextUpdate := time.Now().Add(2 * time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[],"nextUpdate":` + strconv.FormatInt(nextUpdate, 10) + `}`))
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{
+		Ctx:                  ctx,
+		HonorRefreshMetadata: true,
+		RefreshMetadataMax:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	scheduled := store.Status().NextScheduledRefresh
+	if scheduled.IsZero() || scheduled.After(time.Now().Add(time.Hour)) || scheduled.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("Expected a refresh scheduled at the RefreshMetadataMax option, got %s.", scheduled)
+	}
+
+	store, err = NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	if !store.Status().NextScheduledRefresh.IsZero() {
+		t.Fatalf("Expected no scheduled refresh without the HonorRefreshMetadata option.")
+	}
+}
@@ -0,0 +1,105 @@
+package keyfunc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// RefreshOverflowPolicy determines what an HTTPClient does with a read of an unknown key ID when its refresh queue is
+// full. See HTTPClientOptions.RefreshQueueDepth.
+type RefreshOverflowPolicy string
+
+const (
+	// RefreshOverflowDrop fails the read with jwkset.ErrKeyNotFound without refreshing. This is the default behavior.
+	RefreshOverflowDrop RefreshOverflowPolicy = ""
+	// RefreshOverflowBlock waits for room in the refresh queue for up to HTTPClientOptions.RefreshQueueTimeout, then
+	// fails the read like RefreshOverflowDrop.
+	RefreshOverflowBlock RefreshOverflowPolicy = "block"
+	// RefreshOverflowCoalesce waits for the next queued refresh to complete, then reads the key ID without refreshing
+	// again. Many reads of unknown key IDs during a key rotation are served by a few refreshes.
+	RefreshOverflowCoalesce RefreshOverflowPolicy = "coalesce"
+)
+
+// RefreshOverflowHandler is called for every read of an unknown key ID that overflows the refresh queue of an
+// HTTPClient, such as to record a metric. The policy is the RefreshOverflowPolicy that handles the read.
+type RefreshOverflowHandler func(ctx context.Context, keyID string, policy RefreshOverflowPolicy)
+
+// refreshQueue bounds the reads of unknown key IDs that wait for the refresh rate limiter or a refresh of an
+// HTTPClient.
+type refreshQueue struct {
+	done    chan struct{}
+	handler RefreshOverflowHandler
+	mux     sync.Mutex
+	policy  RefreshOverflowPolicy
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// newRefreshQueue creates a refreshQueue. It returns nil if the depth is not positive, which does not limit reads.
+func newRefreshQueue(options HTTPClientOptions) *refreshQueue {
+	if options.RefreshQueueDepth <= 0 {
+		return nil
+	}
+	return &refreshQueue{
+		done:    make(chan struct{}),
+		handler: options.RefreshQueueOverflowHandler,
+		policy:  options.RefreshQueueOverflow,
+		slots:   make(chan struct{}, options.RefreshQueueDepth),
+		timeout: options.RefreshQueueTimeout,
+	}
+}
+
+// enter reserves room in the queue. If it returns true, leave must be called once the refresh completes. If it returns
+// false with a nil error, the read should coalesce by waiting for the returned channel, then reading without a
+// refresh.
+func (q *refreshQueue) enter(ctx context.Context, keyID string) (bool, <-chan struct{}, error) {
+	if q == nil {
+		return true, nil, nil
+	}
+	select {
+	case q.slots <- struct{}{}:
+		return true, nil, nil
+	default:
+	}
+	if q.handler != nil {
+		q.handler(ctx, keyID, q.policy)
+	}
+	switch q.policy {
+	case RefreshOverflowBlock:
+		var timeout <-chan time.Time
+		if q.timeout > 0 {
+			timer := time.NewTimer(q.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case q.slots <- struct{}{}:
+			return true, nil, nil
+		case <-timeout:
+			return false, nil, fmt.Errorf("%w %q: timed out waiting for room in the refresh queue", jwkset.ErrKeyNotFound, keyID)
+		case <-ctx.Done():
+			return false, nil, fmt.Errorf("%w %q: context ended while waiting for room in the refresh queue: %w", jwkset.ErrKeyNotFound, keyID, ctx.Err())
+		}
+	case RefreshOverflowCoalesce:
+		q.mux.Lock()
+		defer q.mux.Unlock()
+		return false, q.done, nil
+	}
+	return false, nil, fmt.Errorf("%w %q: the refresh queue is full", jwkset.ErrKeyNotFound, keyID)
+}
+
+// leave frees the room reserved by enter and wakes the reads waiting to coalesce.
+func (q *refreshQueue) leave() {
+	if q == nil {
+		return
+	}
+	q.mux.Lock()
+	close(q.done)
+	q.done = make(chan struct{})
+	q.mux.Unlock()
+	<-q.slots
+}
@@ -0,0 +1,105 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"golang.org/x/time/rate"
+)
+
+func TestRefreshQueue(t *testing.T) {
+	policies := map[string]RefreshOverflowPolicy{
+		"drop":     RefreshOverflowDrop,
+		"block":    RefreshOverflowBlock,
+		"coalesce": RefreshOverflowCoalesce,
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			store := jwkset.NewMemoryStorage()
+			var requests atomic.Int64
+			refreshing := make(chan struct{})
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) > 1 {
+					refreshing <- struct{}{}
+					<-release
+				}
+				rawJWKS, err := store.JSONPublic(ctx)
+				if err != nil {
+					t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+				}
+				_, _ = w.Write(rawJWKS)
+			}))
+			defer server.Close()
+
+			var overflows atomic.Int64
+			client, err := NewHTTPClient(HTTPClientOptions{
+				HTTPURLs:             map[string]jwkset.Storage{server.URL: nil},
+				RefreshUnknownKID:    rate.NewLimiter(rate.Inf, 1),
+				RefreshQueueDepth:    1,
+				RefreshQueueOverflow: policy,
+				RefreshQueueOverflowHandler: func(ctx context.Context, kid string, p RefreshOverflowPolicy) {
+					if kid != keyID || p != policy {
+						t.Errorf("Unexpected overflow of %q with policy %q.", kid, p)
+					}
+					overflows.Add(1)
+				},
+				RefreshQueueTimeout: 50 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create HTTP client. Error: %s", err)
+			}
+			writeEdDSAKey(ctx, t, store, keyID)
+
+			queued := make(chan error, 1)
+			go func() {
+				_, err := client.KeyRead(ctx, keyID)
+				queued <- err
+			}()
+			<-refreshing
+
+			overflowed := make(chan error, 1)
+			go func() {
+				_, err := client.KeyRead(ctx, keyID)
+				overflowed <- err
+			}()
+			if policy == RefreshOverflowCoalesce {
+				for overflows.Load() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			} else {
+				err = <-overflowed
+				if !errors.Is(err, jwkset.ErrKeyNotFound) {
+					t.Fatalf("Expected jwkset.ErrKeyNotFound for an overflowing read. Error: %v", err)
+				}
+			}
+			close(release)
+
+			err = <-queued
+			if err != nil {
+				t.Fatalf("Failed to read key with a refresh. Error: %s", err)
+			}
+			if policy == RefreshOverflowCoalesce {
+				err = <-overflowed
+				if err != nil {
+					t.Fatalf("Failed to read key after a coalesced refresh. Error: %s", err)
+				}
+			}
+			if overflows.Load() != 1 {
+				t.Fatalf("Expected 1 overflow, got %d.", overflows.Load())
+			}
+			if requests.Load() != 2 {
+				t.Fatalf("Expected 2 requests, got %d.", requests.Load())
+			}
+		})
+	}
+}
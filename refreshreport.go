@@ -0,0 +1,113 @@
+package keyfunc
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// RefreshReport describes what a refresh of a remote JWK Set did.
+type RefreshReport struct {
+	// Added are the key IDs of the JWKs that were not in storage before the refresh. A key ID whose key material changed
+	// is both added and removed.
+	Added []string
+	// Err is the error of the refresh. The keys in storage are unchanged if it is not nil.
+	Err error
+	// Removed are the key IDs of the JWKs that are no longer in storage after the refresh.
+	Removed []string
+	// StatusCode is the HTTP status code of the last response. It is zero if no response was received.
+	StatusCode int
+	// Suppressed is true if the refresh was suppressed because of the MinRefreshInterval option.
+	Suppressed bool
+	// Timing is the timing of the refresh. Its Total is the duration of the refresh.
+	Timing RefreshTiming
+	// Unchanged are the key IDs of the JWKs that were in storage before and after the refresh.
+	Unchanged []string
+	// URL is the URL of the remote JWK Set with any credentials redacted.
+	URL string
+}
+
+// reportRefresher is implemented by storage in this package that can report what a refresh did.
+type reportRefresher interface {
+	RefreshWithReport(ctx context.Context) RefreshReport
+}
+
+// diff fills in the key IDs that were added, removed, or unchanged by the refresh. Keys are compared by key ID and
+// RFC 7638 thumbprint.
+func (r *RefreshReport) diff(beforeSet []jwkset.JWK, beforeCustom []customKey, afterSet []jwkset.JWK, afterCustom []customKey) {
+	before := keyIdentities(beforeSet, beforeCustom)
+	after := keyIdentities(afterSet, afterCustom)
+	for id, kid := range after {
+		if _, ok := before[id]; ok {
+			r.Unchanged = append(r.Unchanged, kid)
+		} else {
+			r.Added = append(r.Added, kid)
+		}
+	}
+	for id, kid := range before {
+		if _, ok := after[id]; !ok {
+			r.Removed = append(r.Removed, kid)
+		}
+	}
+	slices.Sort(r.Added)
+	slices.Sort(r.Removed)
+	slices.Sort(r.Unchanged)
+}
+
+// keyIdentity identifies a key by its key ID and RFC 7638 thumbprint. The thumbprint is empty for custom keys.
+type keyIdentity struct {
+	kid        string
+	thumbprint string
+}
+
+func keyIdentities(set []jwkset.JWK, custom []customKey) map[keyIdentity]string {
+	identities := make(map[keyIdentity]string, len(set)+len(custom))
+	for _, jwk := range set {
+		kid := jwk.Marshal().KID
+		thumbprint, _ := Thumbprint(jwk)
+		identities[keyIdentity{kid: kid, thumbprint: thumbprint}] = kid
+	}
+	for _, c := range custom {
+		identities[keyIdentity{kid: c.kid}] = c.kid
+	}
+	return identities
+}
+
+// keyIDs returns the sorted key IDs of the keys.
+func keyIDs(set []jwkset.JWK, custom []customKey) []string {
+	var kids []string
+	for _, kid := range keyIdentities(set, custom) {
+		kids = append(kids, kid)
+	}
+	slices.Sort(kids)
+	return kids
+}
+
+// RefreshWithReport concurrently refreshes every HTTP storage and returns a report for each, sorted by URL. Storage that
+// cannot report what a refresh did only reports its error and duration.
+func (c *httpClient) RefreshWithReport(ctx context.Context) []RefreshReport {
+	urls, stores := c.urlStores()
+	reports := make([]RefreshReport, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func(i int, store jwkset.Storage) {
+			defer wg.Done()
+			switch r := store.(type) {
+			case reportRefresher:
+				reports[i] = r.RefreshWithReport(ctx)
+			case refresher:
+				start := time.Now()
+				err := r.Refresh(ctx)
+				reports[i] = RefreshReport{Err: err, Timing: RefreshTiming{Total: time.Since(start)}, URL: redact(urls[i])}
+			default:
+				reports[i] = RefreshReport{URL: redact(urls[i])}
+			}
+		}(i, store)
+	}
+	wg.Wait()
+	return reports
+}
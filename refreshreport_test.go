@@ -0,0 +1,70 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestRefreshWithReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, "unchanged")
+	writeEdDSAKey(ctx, t, serverStore, "removed")
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{
+		HTTPURLs: map[string]jwkset.Storage{server.URL: nil},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	_, err = serverStore.KeyDelete(ctx, "removed")
+	if err != nil {
+		t.Fatalf("Failed to delete key. Error: %s", err)
+	}
+	writeEdDSAKey(ctx, t, serverStore, "added")
+
+	reports := client.RefreshWithReport(ctx)
+	if len(reports) != 1 {
+		t.Fatalf("Expected 1 report, got %d.", len(reports))
+	}
+	report := reports[0]
+	if report.Err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", report.Err)
+	}
+	if report.StatusCode != http.StatusOK || report.URL != server.URL || report.Timing.Total <= 0 {
+		t.Fatalf("Unexpected report %+v.", report)
+	}
+	if !slices.Equal(report.Added, []string{"added"}) || !slices.Equal(report.Removed, []string{"removed"}) || !slices.Equal(report.Unchanged, []string{"unchanged"}) {
+		t.Fatalf("Unexpected key IDs in report %+v.", report)
+	}
+
+	failing.Store(true)
+	report = client.HTTPStorages()[server.URL].(HTTPStorage).RefreshWithReport(ctx)
+	if report.Err == nil || report.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected a failed refresh with the HTTP status code, got %+v.", report)
+	}
+	if len(report.Added) != 0 || len(report.Removed) != 0 || !slices.Equal(report.Unchanged, []string{"added", "unchanged"}) {
+		t.Fatalf("Expected the keys to be unchanged by a failed refresh, got %+v.", report)
+	}
+}
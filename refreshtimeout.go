@@ -0,0 +1,38 @@
+package keyfunc
+
+import (
+	"context"
+	"time"
+)
+
+// unknownKIDRefreshTimeoutCtxKey is the context key for the timeout given to WithUnknownKIDRefreshTimeout.
+type unknownKIDRefreshTimeoutCtxKey struct{}
+
+// WithUnknownKIDRefreshTimeout returns a context that bounds how long a key read with it, such as by the jwt.Keyfunc
+// returned by Keyfunc.KeyfuncCtx, waits for the refreshes of remote JWK Sets caused by an unknown key ID. This includes
+// waiting for the rate limit and queue of those refreshes and for the fetches of remote JWK Sets with the OnDemand
+// option. When the timeout passes, the key read fails with jwkset.ErrKeyNotFound, so a key rotation does not exceed the
+// latency budget of a request. The timeout applies regardless of the HTTPTimeout option. Refreshes of storage created
+// by this package for an unknown key ID are not cancelled by the timeout. They continue in the background within their
+// HTTPTimeout option, so their keys are available to later JWTs, and keep their room in the refresh queue until they
+// complete.
+func WithUnknownKIDRefreshTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, unknownKIDRefreshTimeoutCtxKey{}, timeout)
+}
+
+// unknownKIDRefreshTimeout returns the timeout given to WithUnknownKIDRefreshTimeout, if any.
+func unknownKIDRefreshTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(unknownKIDRefreshTimeoutCtxKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// detachedRefresher is implemented by storage in this package that can refresh independently of the key read that
+// caused the refresh.
+type detachedRefresher interface {
+	// detachedContext returns a context for a refresh that ends with the storage or its HTTPTimeout option.
+	detachedContext() (context.Context, context.CancelFunc)
+}
+
+func (s *httpStorage) detachedContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.options.Ctx, s.options.HTTPTimeout)
+}
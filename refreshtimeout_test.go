@@ -0,0 +1,143 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestWithUnknownKIDRefreshTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	var slow atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	const rotatedKID = "rotated"
+	signed := signEdDSA(t, writeEdDSAKey(ctx, t, serverStore, rotatedKID), rotatedKID)
+	slow.Store(true)
+
+	bounded := WithUnknownKIDRefreshTimeout(ctx, 20*time.Millisecond)
+	start := time.Now()
+	_, err = jwt.Parse(signed, k.KeyfuncCtx(bounded))
+	if !errors.Is(err, jwkset.ErrKeyNotFound) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected the key to not be found within the timeout, got %v.", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Fatalf("Expected the key read to return before the refresh completed, took %s.", elapsed)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	_, err = jwt.Parse(signed, k.KeyfuncCtx(bounded))
+	if err != nil {
+		t.Fatalf("Expected the refresh to complete in the background. Error: %s", err)
+	}
+}
+
+func TestWithUnknownKIDRefreshTimeoutQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	writeEdDSAKey(ctx, t, serverStore, keyID)
+	var requests atomic.Int64
+	var slow atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	client, err := NewHTTPClient(HTTPClientOptions{
+		HTTPURLs:          map[string]jwkset.Storage{server.URL: store},
+		RefreshQueueDepth: 1,
+		RefreshUnknownKID: rate.NewLimiter(rate.Inf, 1),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	k, err := New(Options{Ctx: ctx, Storage: client})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	slow.Store(true)
+	before := requests.Load()
+
+	bounded := WithUnknownKIDRefreshTimeout(ctx, 20*time.Millisecond)
+	for _, kid := range []string{"first", "second"} {
+		signed := signEdDSA(t, writeEdDSAKey(ctx, t, serverStore, kid), kid)
+		_, err = jwt.Parse(signed, k.KeyfuncCtx(bounded))
+		if !errors.Is(err, jwkset.ErrKeyNotFound) {
+			t.Fatalf("Expected the key %q to not be found within the timeout, got %v.", kid, err)
+		}
+	}
+	if fetches := requests.Load() - before; fetches != 1 {
+		t.Fatalf("Expected the refresh in the background to keep its room in the refresh queue, got %d fetches.", fetches)
+	}
+}
+
+func TestWithUnknownKIDRefreshTimeoutOnDemand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverStore := jwkset.NewMemoryStorage()
+	priv := writeEdDSAKey(ctx, t, serverStore, keyID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		rawJWKS, err := serverStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	k, err := NewDefaultURLOptionsCtx(ctx, map[string]URLOptions{server.URL: {OnDemand: true}})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	bounded := WithUnknownKIDRefreshTimeout(ctx, 20*time.Millisecond)
+	start := time.Now()
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.KeyfuncCtx(bounded))
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected the key to not be found within the timeout, got %v.", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Fatalf("Expected the key read to return before the on demand fetch completed, took %s.", elapsed)
+	}
+}
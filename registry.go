@@ -0,0 +1,46 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// KeyTypeParser parses the raw JSON of a single JWK with a custom key type into a cryptographic key. The returned key
+// is given to the signing method of the JWT, so a matching jwt.SigningMethod should be registered with
+// jwt.RegisterSigningMethod.
+type KeyTypeParser func(raw json.RawMessage) (any, error)
+
+var (
+	keyTypeParsers   = make(map[jwkset.KTY]KeyTypeParser)
+	keyTypeParsersMu sync.RWMutex
+)
+
+// RegisterKeyType installs a parser for a custom or experimental key type (kty). Keys with this key type are parsed with
+// the given parser when a JWK Set is ingested by this package instead of being treated as unparsable. Key types
+// supported by github.com/MicahParks/jwkset cannot be overridden. Registering a nil parser removes the key type.
+func RegisterKeyType(kty jwkset.KTY, parser KeyTypeParser) error {
+	if kty == "" {
+		return fmt.Errorf("%w: key type must not be empty", ErrKeyfunc)
+	}
+	if kty.IANARegistered() {
+		return fmt.Errorf("%w: key type %q is supported by jwkset and cannot be overridden", ErrKeyfunc, kty)
+	}
+	keyTypeParsersMu.Lock()
+	defer keyTypeParsersMu.Unlock()
+	if parser == nil {
+		delete(keyTypeParsers, kty)
+		return nil
+	}
+	keyTypeParsers[kty] = parser
+	return nil
+}
+
+func keyTypeParser(kty jwkset.KTY) (KeyTypeParser, bool) {
+	keyTypeParsersMu.RLock()
+	defer keyTypeParsersMu.RUnlock()
+	parser, ok := keyTypeParsers[kty]
+	return parser, ok
+}
@@ -0,0 +1,78 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	customKTY = jwkset.KTY("X-SHARED")
+)
+
+func TestRegisterKeyType(t *testing.T) {
+	err := RegisterKeyType(customKTY, parseCustomKTY)
+	if err != nil {
+		t.Fatalf("Failed to register custom key type. Error: %s", err)
+	}
+	defer func() {
+		_ = RegisterKeyType(customKTY, nil)
+	}()
+
+	secret := []byte("custom secret")
+	jwksJSON := json.RawMessage(`{"keys":[{"kty":"X-SHARED","kid":"custom","alg":"HS256","secret":"custom secret"},{"kty":"X-UNKNOWN","kid":"unknown"}]}`)
+	_, err = NewJWKSetJSON(jwksJSON)
+	if !errors.Is(err, ErrUnparsableJWK) {
+		t.Fatalf("Expected ErrUnparsableJWK for an unregistered key type, but got %v.", err)
+	}
+	k, err := NewJWKSetJSONWithOptions(jwksJSON, JWKSetJSONOptions{SkipUnparsable: true})
+	if err != nil {
+		t.Fatalf("Failed to create a keyfunc.Keyfunc.\nError: %s", err)
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header[jwkset.HeaderKID] = "custom"
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT with custom key type. Error: %s", err)
+	}
+
+	token.Header[jwkset.HeaderKID] = "unknown"
+	signed, err = token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for skipped key type, but got %s.", err)
+	}
+}
+
+func TestRegisterKeyTypeErr(t *testing.T) {
+	err := RegisterKeyType(jwkset.KtyRSA, parseCustomKTY)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc when overriding a supported key type, but got %s.", err)
+	}
+	err = RegisterKeyType("", parseCustomKTY)
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc for an empty key type, but got %s.", err)
+	}
+}
+
+func parseCustomKTY(raw json.RawMessage) (any, error) {
+	var custom struct {
+		Secret string `json:"secret"`
+	}
+	err := json.Unmarshal(raw, &custom)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(custom.Secret), nil
+}
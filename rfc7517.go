@@ -0,0 +1,192 @@
+package keyfunc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrRFC7517 is the reason given to a ParseWarningHandler for a JWK that is skipped because it does not comply with
+	// RFC 7517 and its companion specifications when strict RFC 7517 parsing is enabled.
+	ErrRFC7517 = errors.New("JWK does not comply with RFC 7517")
+	// ErrJWKNormalized is the reason given to a ParseWarningHandler for every deviation from RFC 7517 that is fixed in a
+	// JWK when lenient normalization is enabled. The JWK is not skipped.
+	ErrJWKNormalized = errors.New("JWK normalized")
+)
+
+// base64URLParameters are the JWK parameters whose values are base64url encoded without padding.
+var base64URLParameters = []string{"d", "dp", "dq", "e", "k", "n", "p", "q", "qi", "x", "x5t", "x5t#S256", "y"}
+
+// registeredKTYs and registeredCRVs are the key types and curves supported by github.com/MicahParks/jwkset, whose values
+// are case-sensitive.
+var (
+	registeredKTYs = []jwkset.KTY{jwkset.KtyEC, jwkset.KtyOKP, jwkset.KtyOct, jwkset.KtyRSA}
+	registeredCRVs = []jwkset.CRV{jwkset.CrvP256, jwkset.CrvP384, jwkset.CrvP521, jwkset.CrvEd25519, jwkset.CrvX25519, jwkset.CrvX448}
+)
+
+// checkRFC7517 reports deviations from RFC 7517 and RFC 7518 in the raw JSON of a single JWK that are otherwise
+// tolerated, such as padded base64url values, a key type or curve with the wrong case, a "x5c" certificate that is not
+// standard base64, and duplicate "key_ops" values.
+func checkRFC7517(raw json.RawMessage) error {
+	var params map[string]json.RawMessage
+	err := json.Unmarshal(raw, &params)
+	if err != nil {
+		return fmt.Errorf("%w: could not unmarshal JWK: %w", ErrRFC7517, err)
+	}
+	var errs []error
+	for _, name := range base64URLParameters {
+		value, ok := params[name]
+		if !ok {
+			continue
+		}
+		var s string
+		err = json.Unmarshal(value, &s)
+		if err == nil {
+			err = strictBase64(base64.RawURLEncoding, s)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q parameter is not base64url encoded without padding: %w", name, err))
+		}
+	}
+	var marshal struct {
+		CRV    jwkset.CRV      `json:"crv"`
+		KEYOPS []jwkset.KEYOPS `json:"key_ops"`
+		KTY    jwkset.KTY      `json:"kty"`
+		X5C    []string        `json:"x5c"`
+	}
+	err = json.Unmarshal(raw, &marshal)
+	if err != nil {
+		return fmt.Errorf("%w: could not unmarshal JWK: %w", ErrRFC7517, err)
+	}
+	for _, kty := range registeredKTYs {
+		if marshal.KTY != kty && strings.EqualFold(marshal.KTY.String(), kty.String()) {
+			errs = append(errs, fmt.Errorf(`"kty" parameter value %q must be %q`, marshal.KTY, kty))
+		}
+	}
+	for _, crv := range registeredCRVs {
+		if marshal.CRV != crv && strings.EqualFold(marshal.CRV.String(), crv.String()) {
+			errs = append(errs, fmt.Errorf(`"crv" parameter value %q must be %q`, marshal.CRV, crv))
+		}
+	}
+	for i, cert := range marshal.X5C {
+		err = strictBase64(base64.StdEncoding, cert)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`"x5c" certificate %d is not standard base64 encoded: %w`, i, err))
+		}
+	}
+	seen := make(map[jwkset.KEYOPS]bool, len(marshal.KEYOPS))
+	for _, op := range marshal.KEYOPS {
+		if seen[op] {
+			errs = append(errs, fmt.Errorf(`"key_ops" parameter value %q is duplicated`, op))
+		}
+		seen[op] = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrRFC7517, errors.Join(errs...))
+	}
+	return nil
+}
+
+// strictBase64 decodes the value with the encoding, rejecting the line breaks that package encoding/base64 ignores.
+func strictBase64(encoding *base64.Encoding, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return errors.New("contains line breaks")
+	}
+	_, err := encoding.DecodeString(value)
+	return err
+}
+
+// normalizeJWK fixes common deviations from RFC 7517 in the raw JSON of a single JWK from sloppy issuers: whitespace in
+// base64 values, standard base64 encoding or padding in base64url values, base64url encoding in "x5c" certificates,
+// and a key type or curve with the wrong case. Each fix is returned as a reason wrapping ErrJWKNormalized. The raw JWK
+// is returned unchanged if it needs no fixes or cannot be unmarshalled.
+func normalizeJWK(raw json.RawMessage) (json.RawMessage, []error) {
+	var params map[string]json.RawMessage
+	err := json.Unmarshal(raw, &params)
+	if err != nil {
+		return raw, nil
+	}
+	var fixes []error
+	set := func(name string, value any, reason string) {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		params[name] = b
+		fixes = append(fixes, fmt.Errorf("%w: %s in %q parameter", ErrJWKNormalized, reason, name))
+	}
+	for _, name := range base64URLParameters {
+		var s string
+		if json.Unmarshal(params[name], &s) != nil {
+			continue
+		}
+		if fixed := removeSpace(s); fixed != s {
+			s = fixed
+			set(name, s, "removed whitespace")
+		}
+		if fixed := strings.NewReplacer("+", "-", "/", "_").Replace(s); fixed != s {
+			s = fixed
+			set(name, s, "converted standard base64 to base64url")
+		}
+		if fixed := strings.TrimRight(s, "="); fixed != s {
+			set(name, fixed, "removed base64 padding")
+		}
+	}
+	var x5c []string
+	if json.Unmarshal(params["x5c"], &x5c) == nil && len(x5c) > 0 {
+		changed := false
+		for i, cert := range x5c {
+			fixed := strings.NewReplacer("-", "+", "_", "/").Replace(removeSpace(cert))
+			if n := len(strings.TrimRight(fixed, "=")) % 4; n != 0 {
+				fixed = strings.TrimRight(fixed, "=") + strings.Repeat("=", 4-n)
+			}
+			if fixed != cert {
+				x5c[i] = fixed
+				changed = true
+			}
+		}
+		if changed {
+			set("x5c", x5c, "converted certificates to standard base64")
+		}
+	}
+	var kty jwkset.KTY
+	if json.Unmarshal(params["kty"], &kty) == nil {
+		for _, registered := range registeredKTYs {
+			if kty != registered && strings.EqualFold(kty.String(), registered.String()) {
+				set("kty", registered, fmt.Sprintf("corrected case of %q", kty))
+			}
+		}
+	}
+	var crv jwkset.CRV
+	if json.Unmarshal(params["crv"], &crv) == nil {
+		for _, registered := range registeredCRVs {
+			if crv != registered && strings.EqualFold(crv.String(), registered.String()) {
+				set("crv", registered, fmt.Sprintf("corrected case of %q", crv))
+			}
+		}
+	}
+	if len(fixes) == 0 {
+		return raw, nil
+	}
+	normalized, err := json.Marshal(params)
+	if err != nil {
+		return raw, nil
+	}
+	return normalized, fixes
+}
+
+// removeSpace returns the string without any white space.
+func removeSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,150 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckRFC7517(t *testing.T) {
+	compliant, _ := expiringJWK(t, keyID, nil)
+	var params map[string]any
+	err := json.Unmarshal(compliant, &params)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	x := params["x"].(string)
+
+	tc := []struct {
+		name   string
+		params map[string]any
+	}{
+		{name: "padded base64url", params: map[string]any{"x": x + "="}},
+		{name: "line break", params: map[string]any{"x": x[:10] + "\n" + x[10:]}},
+		{name: "lowercase kty", params: map[string]any{"kty": "okp"}},
+		{name: "lowercase crv", params: map[string]any{"crv": "ed25519"}},
+		{name: "base64url x5c", params: map[string]any{"x5c": []string{"-_-_"}}},
+		{name: "duplicate key_ops", params: map[string]any{"key_ops": []string{"verify", "verify"}}},
+	}
+	err = checkRFC7517(compliant)
+	if err != nil {
+		t.Fatalf("Expected a compliant JWK. Error: %s", err)
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			rawJWK := withParams(t, compliant, c.params)
+			err := checkRFC7517(rawJWK)
+			if !errors.Is(err, ErrRFC7517) {
+				t.Fatalf("Expected ErrRFC7517. Error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStrictRFC7517(t *testing.T) {
+	compliant, _ := expiringJWK(t, keyID, nil)
+	noncompliant, _ := expiringJWK(t, "noncompliant", nil)
+	noncompliant = withParams(t, noncompliant, map[string]any{"key_ops": []string{"verify", "verify"}})
+	raw := jwksJSON(t, compliant, noncompliant)
+
+	var warnings []string
+	k, err := NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{
+		ParseWarningHandler: func(kid string, kty jwkset.KTY, reason error) {
+			if !errors.Is(reason, ErrRFC7517) {
+				t.Errorf("Expected ErrRFC7517. Error: %v", reason)
+			}
+			warnings = append(warnings, kid)
+		},
+		SkipUnparsable: true,
+		StrictRFC7517:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "noncompliant" {
+		t.Fatalf("Expected a warning for the noncompliant JWK, got %v.", warnings)
+	}
+	_, err = k.Storage().KeyRead(context.Background(), "noncompliant")
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected the noncompliant JWK to be skipped. Error: %v", err)
+	}
+
+	_, err = NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{StrictRFC7517: true})
+	if !errors.Is(err, ErrUnparsableJWK) {
+		t.Fatalf("Expected ErrUnparsableJWK without SkipUnparsable. Error: %v", err)
+	}
+}
+
+// withParams returns the raw JWK with the given parameters replaced.
+func withParams(t *testing.T, rawJWK json.RawMessage, replace map[string]any) json.RawMessage {
+	var params map[string]any
+	err := json.Unmarshal(rawJWK, &params)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	for name, value := range replace {
+		params[name] = value
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	return raw
+}
+
+func TestLenientNormalization(t *testing.T) {
+	sloppy, priv := expiringJWK(t, keyID, nil)
+	var params map[string]any
+	err := json.Unmarshal(sloppy, &params)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	x := params["x"].(string)
+	sloppy = withParams(t, sloppy, map[string]any{
+		"crv": "ed25519",
+		"x":   strings.NewReplacer("-", "+", "_", "/").Replace(x[:20]) + " \n" + x[20:] + "=",
+	})
+	expected := 3
+	if strings.ContainsAny(x[:20], "-_") {
+		expected++ // Standard base64 encoding.
+	}
+	raw := jwksJSON(t, sloppy)
+
+	normalized, fixes := normalizeJWK(sloppy)
+	if len(fixes) != expected {
+		t.Fatalf("Expected %d fixes, got %v.", expected, fixes)
+	}
+	err = checkRFC7517(normalized)
+	if err != nil {
+		t.Fatalf("Expected a compliant JWK after normalization. Error: %s", err)
+	}
+
+	var warnings []error
+	k, err := NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{
+		LenientNormalization: true,
+		ParseWarningHandler: func(kid string, kty jwkset.KTY, reason error) {
+			warnings = append(warnings, reason)
+		},
+		StrictRFC7517: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if len(warnings) != len(fixes) {
+		t.Fatalf("Expected a warning for each fix, got %v.", warnings)
+	}
+	for _, warning := range warnings {
+		if !errors.Is(warning, ErrJWKNormalized) {
+			t.Fatalf("Expected ErrJWKNormalized. Error: %v", warning)
+		}
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+}
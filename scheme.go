@@ -0,0 +1,104 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrUnsupportedScheme is returned when a source URL has a scheme without a StorageFactory registered with
+	// RegisterScheme.
+	ErrUnsupportedScheme = errors.New("unsupported URL scheme")
+)
+
+// SchemeStorage is the storage created by a StorageFactory.
+type SchemeStorage interface {
+	jwkset.Storage
+	// Stop ends any background work of the storage, such as a goroutine that polls its backend. It is called when the
+	// source URL is removed, such as by RemoveURL or an update of a ConfigKeyfunc, so the storage does not outlive it.
+	Stop()
+}
+
+// StorageFactory creates the storage for the keys at a source URL, such as a JWK Set in an object store, a secret
+// manager, or a cache. The context ends any background refreshes of the storage, like the context given to
+// NewDefaultCtx. The URLOptions are those given for the URL. A factory ignores the options that do not apply to its
+// backend.
+//
+// Storage with a Refresh method, like HTTPStorage, is refreshed when a JWT has an unknown key ID.
+type StorageFactory func(ctx context.Context, u *url.URL, options URLOptions) (SchemeStorage, error)
+
+var (
+	storageFactories = map[string]StorageFactory{
+		"file": newFileSchemeStorage,
+	}
+	storageFactoriesMu sync.RWMutex
+)
+
+// RegisterScheme installs a factory for the storage of source URLs with the scheme, such as "s3", "vault", or "redis",
+// so NewDefaultCtx, NewDefaultURLOptionsCtx, NewConfigCtx, and AddURL accept those URLs alongside HTTP URLs. Schemes
+// are case-insensitive. The "file" scheme is registered by default with a FileStorage for the path of the URL and can
+// be replaced. The "http" and "https" schemes always use HTTPStorage and cannot be registered. Registering a nil
+// factory removes the scheme.
+func RegisterScheme(scheme string, factory StorageFactory) error {
+	scheme = strings.ToLower(scheme)
+	switch scheme {
+	case "":
+		return fmt.Errorf("%w: scheme must not be empty", ErrKeyfunc)
+	case "http", "https":
+		return fmt.Errorf("%w: scheme %q always uses HTTPStorage and cannot be registered", ErrKeyfunc, scheme)
+	}
+	storageFactoriesMu.Lock()
+	defer storageFactoriesMu.Unlock()
+	if factory == nil {
+		delete(storageFactories, scheme)
+		return nil
+	}
+	storageFactories[scheme] = factory
+	return nil
+}
+
+// newSchemeStorage creates the storage for a source URL with the factory registered for its scheme. It returns false
+// if the URL is for HTTPStorage: its scheme is "http" or "https", or it cannot be parsed, which HTTPStorage reports.
+func newSchemeStorage(ctx context.Context, u string, options URLOptions) (jwkset.Storage, bool, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, false, nil
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme == "http" || scheme == "https" {
+		return nil, false, nil
+	}
+	storageFactoriesMu.RLock()
+	factory, ok := storageFactories[scheme]
+	storageFactoriesMu.RUnlock()
+	if !ok {
+		return nil, true, fmt.Errorf("%w: no storage registered for scheme %q of %q", ErrUnsupportedScheme, scheme, redact(u))
+	}
+	store, err := factory(ctx, parsed, options)
+	if err != nil {
+		return nil, true, err
+	}
+	return store, true, nil
+}
+
+// newFileSchemeStorage creates a FileStorage for a "file" URL, such as "file:///etc/jwks.json".
+func newFileSchemeStorage(ctx context.Context, u *url.URL, options URLOptions) (SchemeStorage, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("%w: file URL host %q is not local", ErrFileStorage, u.Host)
+	}
+	return NewFileStorage(u.Path, FileStorageOptions{
+		Ctx:                  ctx,
+		DuplicateKIDPolicy:   options.DuplicateKIDPolicy,
+		LenientNormalization: options.LenientNormalization,
+		ParseWarningHandler:  options.ParseWarningHandler,
+		RefreshErrorHandler:  options.RefreshErrorHandler,
+		StrictParsing:        options.StrictParsing,
+		StrictRFC7517:        options.StrictRFC7517,
+	})
+}
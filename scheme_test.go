@@ -0,0 +1,89 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRegisterScheme(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	httpStore := jwkset.NewMemoryStorage()
+	httpPriv := writeEdDSAKey(ctx, t, httpStore, "http")
+	server := newJWKSServer(ctx, t, httpStore)
+	defer server.Close()
+
+	memStore := &stoppableStorage{Storage: jwkset.NewMemoryStorage()}
+	memPriv := writeEdDSAKey(ctx, t, memStore, "mem")
+	var factoryURL *url.URL
+	err := RegisterScheme("MEM", func(ctx context.Context, u *url.URL, options URLOptions) (SchemeStorage, error) {
+		factoryURL = u
+		return memStore, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to register scheme. Error: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = RegisterScheme("mem", nil)
+	})
+
+	fileStore := jwkset.NewMemoryStorage()
+	filePriv := writeEdDSAKey(ctx, t, fileStore, "file")
+	raw, err := fileStore.JSONPublic(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set JSON. Error: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	err = os.WriteFile(path, raw, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write JWK Set file. Error: %s", err)
+	}
+
+	k, err := NewDefaultCtx(ctx, []string{server.URL, "mem://keys/signing", "file://" + path})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	if factoryURL == nil || factoryURL.Host != "keys" || factoryURL.Path != "/signing" {
+		t.Fatalf("Expected the factory to be given the parsed URL, got %v.", factoryURL)
+	}
+	for kid, priv := range map[string]ed25519.PrivateKey{"http": httpPriv, "mem": memPriv, "file": filePriv} {
+		_, err = jwt.Parse(signEdDSA(t, priv, kid), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT signed with the key from the %q source. Error: %s", kid, err)
+		}
+	}
+	if !k.(KeyManager).RemoveURL("mem://keys/signing") || !memStore.stopped.Load() {
+		t.Fatalf("Expected the storage from the factory to be stopped when its URL is removed.")
+	}
+
+	_, err = NewDefaultCtx(ctx, []string{"s3://bucket/jwks.json"})
+	if !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Expected an unregistered scheme to be unsupported, got %v.", err)
+	}
+	err = RegisterScheme("https", func(ctx context.Context, u *url.URL, options URLOptions) (SchemeStorage, error) {
+		return nil, nil
+	})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected the https scheme to not be registrable, got %v.", err)
+	}
+}
+
+// stoppableStorage is a SchemeStorage that records if it was stopped.
+type stoppableStorage struct {
+	jwkset.Storage
+	stopped atomic.Bool
+}
+
+func (s *stoppableStorage) Stop() {
+	s.stopped.Store(true)
+}
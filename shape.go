@@ -0,0 +1,48 @@
+package keyfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// wrapJWKArray converts a bare JSON array of JWKs to a JWK Set. Any other JSON is returned unchanged.
+func wrapJWKArray(raw json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return raw
+	}
+	wrapped := make([]byte, 0, len(trimmed)+len(`{"keys":}`))
+	wrapped = append(wrapped, `{"keys":`...)
+	wrapped = append(wrapped, trimmed...)
+	return append(wrapped, '}')
+}
+
+// wrapSingleJWK converts a single JWK to a JWK Set. The raw JSON is a single JWK if the media type of the Content-Type
+// header value is ContentTypeJWK, or if it is a JSON object with a "kty" member and without a "keys" member. Any other
+// JSON is returned unchanged.
+func wrapSingleJWK(raw json.RawMessage, contentType string) (json.RawMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !strings.EqualFold(mediaType, ContentTypeJWK) {
+		trimmed := bytes.TrimSpace(raw)
+		if len(trimmed) == 0 || trimmed[0] != '{' {
+			return raw, nil
+		}
+		var members struct {
+			Keys json.RawMessage `json:"keys"`
+			KTY  json.RawMessage `json:"kty"`
+		}
+		err := json.Unmarshal(trimmed, &members)
+		if err != nil || members.Keys != nil || members.KTY == nil {
+			return raw, nil
+		}
+	}
+	var jwk map[string]json.RawMessage
+	err := json.Unmarshal(raw, &jwk)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal single JWK: %w", err)
+	}
+	return json.Marshal(map[string]any{"keys": []any{jwk}})
+}
@@ -0,0 +1,60 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWrapJWKArray(t *testing.T) {
+	tc := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "Array", raw: ` [{"kty":"OKP"}] `, want: `{"keys":[{"kty":"OKP"}]}`},
+		{name: "EmptyArray", raw: `[]`, want: `{"keys":[]}`},
+		{name: "JWKSet", raw: `{"keys":[]}`, want: `{"keys":[]}`},
+		{name: "Empty", raw: ``, want: ``},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := wrapJWKArray(json.RawMessage(c.raw))
+			if string(got) != c.want {
+				t.Fatalf("Expected %s, got %s.", c.want, got)
+			}
+		})
+	}
+}
+
+func TestWrapSingleJWK(t *testing.T) {
+	tc := []struct {
+		name        string
+		contentType string
+		raw         string
+		want        string
+		wantErr     bool
+	}{
+		{name: "ContentType", contentType: "application/jwk+json; charset=utf-8", raw: `{"kid":"a"}`, want: `{"keys":[{"kid":"a"}]}`},
+		{name: "Sniffed", raw: `{"kty":"OKP","kid":"a"}`, want: `{"keys":[{"kid":"a","kty":"OKP"}]}`},
+		{name: "JWKSet", raw: `{"keys":[{"kty":"OKP"}]}`, want: `{"keys":[{"kty":"OKP"}]}`},
+		{name: "Array", raw: `[{"kty":"OKP"}]`, want: `[{"kty":"OKP"}]`},
+		{name: "BadContentType", contentType: ContentTypeJWK, raw: `[]`, wantErr: true},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := wrapSingleJWK(json.RawMessage(c.raw), c.contentType)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to wrap single JWK. Error: %s", err)
+			}
+			if string(got) != c.want {
+				t.Fatalf("Expected %s, got %s.", c.want, got)
+			}
+		})
+	}
+}
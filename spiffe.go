@@ -0,0 +1,88 @@
+package keyfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrSPIFFEBundle is returned when a SPIFFE trust bundle cannot be used.
+	ErrSPIFFEBundle = errors.New("invalid SPIFFE trust bundle")
+)
+
+const (
+	// spiffeDefaultRefreshHint is how often a SPIFFE trust bundle without a refresh hint is refreshed. The SPIFFE
+	// Trust Domain and Bundle specification suggests a low value, such as five minutes.
+	spiffeDefaultRefreshHint = 5 * time.Minute
+	// spiffeUseJWTSVID is the "use" parameter value of keys for JWT-SVIDs in a SPIFFE trust bundle.
+	spiffeUseJWTSVID = "jwt-svid"
+)
+
+// NewSPIFFEBundleStorage creates a new HTTPStorage for the SPIFFE trust bundle at the given bundle endpoint URL, so
+// JWT-SVIDs can be validated in a SPIRE deployment. Only the keys for JWT-SVIDs are loaded, with their "use" parameter
+// set to "sig". A refresh is scheduled after the "spiffe_refresh_hint" of each bundle, or five minutes if it has none.
+// Bundles with a "spiffe_sequence" lower than the last bundle are rejected with ErrSPIFFEBundle and the previous keys
+// are kept.
+//
+// The ResponseDecoder option is not used.
+func NewSPIFFEBundleStorage(bundleEndpointURL string, options HTTPStorageOptions) (HTTPStorage, error) {
+	return newHTTPStorage(bundleEndpointURL, options, newSPIFFEBundleDecoder())
+}
+
+func newSPIFFEBundleDecoder() responseDecoder {
+	var mux sync.Mutex
+	var lastSequence uint64
+	return func(body []byte) (json.RawMessage, time.Duration, error) {
+		var bundle struct {
+			Keys        []json.RawMessage `json:"keys"`
+			RefreshHint *int64            `json:"spiffe_refresh_hint"`
+			Sequence    *uint64           `json:"spiffe_sequence"`
+		}
+		err := json.Unmarshal(body, &bundle)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: could not unmarshal trust bundle", errors.Join(err, ErrSPIFFEBundle))
+		}
+		if bundle.Sequence != nil {
+			mux.Lock()
+			if *bundle.Sequence < lastSequence {
+				mux.Unlock()
+				return nil, 0, fmt.Errorf("%w: sequence %d is older than sequence %d", ErrSPIFFEBundle, *bundle.Sequence, lastSequence)
+			}
+			lastSequence = *bundle.Sequence
+			mux.Unlock()
+		}
+
+		keys := make([]json.RawMessage, 0, len(bundle.Keys))
+		for _, rawJWK := range bundle.Keys {
+			var params map[string]any
+			err = json.Unmarshal(rawJWK, &params)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%w: could not unmarshal key", errors.Join(err, ErrSPIFFEBundle))
+			}
+			if params["use"] != spiffeUseJWTSVID {
+				continue
+			}
+			params["use"] = jwkset.UseSig
+			rawJWK, err = json.Marshal(params)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%w: could not marshal key", errors.Join(err, ErrSPIFFEBundle))
+			}
+			keys = append(keys, rawJWK)
+		}
+		raw, err := json.Marshal(map[string][]json.RawMessage{"keys": keys})
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: could not marshal JWK Set", errors.Join(err, ErrSPIFFEBundle))
+		}
+
+		hint := spiffeDefaultRefreshHint
+		if bundle.RefreshHint != nil && *bundle.RefreshHint > 0 {
+			hint = time.Duration(min(*bundle.RefreshHint, maxDurationSeconds)) * time.Second
+		}
+		return raw, hint, nil
+	}
+}
@@ -0,0 +1,68 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSPIFFEBundleStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jwtSVID, priv := expiringJWK(t, keyID, map[string]any{"use": "jwt-svid"})
+	x509SVID, x509Priv := expiringJWK(t, "x509", map[string]any{"use": "x509-svid"})
+	var mux sync.Mutex
+	bundle := map[string]any{
+		"keys":                []json.RawMessage{jwtSVID, x509SVID},
+		"spiffe_refresh_hint": 2,
+		"spiffe_sequence":     2,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		_ = json.NewEncoder(w).Encode(bundle)
+	}))
+	defer server.Close()
+
+	store, err := NewSPIFFEBundleStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create SPIFFE bundle storage. Error: %s", err)
+	}
+	if until := time.Until(store.Status().NextScheduledRefresh); until <= time.Second || until > 2*time.Second {
+		t.Fatalf("Expected a refresh to be scheduled after the refresh hint, got %s.", until)
+	}
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT-SVID. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, x509Priv, "x509"), k.Keyfunc)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected X509-SVID key to be skipped. Error: %s", err)
+	}
+
+	mux.Lock()
+	bundle["keys"] = []json.RawMessage{}
+	bundle["spiffe_sequence"] = 1
+	mux.Unlock()
+	err = store.Refresh(ctx)
+	if !errors.Is(err, ErrSPIFFEBundle) {
+		t.Fatalf("Expected error to be ErrSPIFFEBundle for an older sequence. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected the previous keys to be kept. Error: %s", err)
+	}
+}
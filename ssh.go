@@ -0,0 +1,206 @@
+package keyfunc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrSSHPublicKey is returned when an OpenSSH public key cannot be converted to a JWK.
+	ErrSSHPublicKey = errors.New("failed to convert OpenSSH public key")
+)
+
+// SSHOptions are used to configure NewSSH and NewSSHJWKs.
+type SSHOptions struct {
+	// FingerprintKID uses the OpenSSH SHA-256 fingerprint of each key as its key ID, such as
+	// "SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU", which is printed by ssh-keygen -l. By default, the key ID is
+	// the RFC 7638 thumbprint of the JWK.
+	FingerprintKID bool
+	// ParseWarningHandler is called for every line that is skipped because it is not a supported public key, such as
+	// an ssh-dss key, a security key, or a certificate. Blank lines and comments are skipped silently.
+	ParseWarningHandler ParseWarningHandler
+	// Strict returns an error with ErrSSHPublicKey if any line is skipped, instead of only calling ParseWarningHandler.
+	Strict bool
+}
+
+// sshCurves are the elliptic curves of OpenSSH ECDSA public keys by their key type.
+var sshCurves = map[string]struct {
+	alg   jwkset.ALG
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+	name  string
+}{
+	"ecdsa-sha2-nistp256": {alg: jwkset.AlgES256, curve: elliptic.P256(), ecdh: ecdh.P256(), name: "nistp256"},
+	"ecdsa-sha2-nistp384": {alg: jwkset.AlgES384, curve: elliptic.P384(), ecdh: ecdh.P384(), name: "nistp384"},
+	"ecdsa-sha2-nistp521": {alg: jwkset.AlgES512, curve: elliptic.P521(), ecdh: ecdh.P521(), name: "nistp521"},
+}
+
+// NewSSH creates a new Keyfunc from OpenSSH public keys in the authorized_keys format, such as the content of an
+// authorized_keys file or the .pub files of developers. This verifies JWTs signed with SSH keys, a pattern used by
+// internal tooling and OIDC-for-SSH bridges. See NewSSHJWKs.
+func NewSSH(authorizedKeys []byte, options SSHOptions) (Keyfunc, error) {
+	jwks, err := NewSSHJWKs(authorizedKeys, options)
+	if err != nil {
+		return nil, err
+	}
+	return NewGiven(jwks...)
+}
+
+// NewSSHJWKs converts OpenSSH public keys in the authorized_keys format into JWKs. Ed25519, ECDSA, and RSA keys are
+// supported. The key options and comment of each line are ignored. The "alg" parameter is set for Ed25519 and ECDSA
+// keys. RSA keys may sign with several algorithms, so it is not set for them.
+func NewSSHJWKs(authorizedKeys []byte, options SSHOptions) ([]jwkset.JWK, error) {
+	var jwks []jwkset.JWK
+	scanner := bufio.NewScanner(bytes.NewReader(authorizedKeys))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		jwk, err := sshLineJWK(text, options.FingerprintKID)
+		if err != nil {
+			err = fmt.Errorf("line %d: %w", line, err)
+			if options.Strict {
+				return nil, fmt.Errorf("%w: %w", ErrSSHPublicKey, err)
+			}
+			if options.ParseWarningHandler != nil {
+				options.ParseWarningHandler("", "", err)
+			}
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read authorized keys", errors.Join(err, ErrSSHPublicKey))
+	}
+	return jwks, nil
+}
+
+// sshLineJWK converts a line of an authorized_keys file. The key type may be preceded by key options, so the first
+// field followed by a public key of that key type is used.
+func sshLineJWK(text string, fingerprintKID bool) (jwkset.JWK, error) {
+	fields := strings.Fields(text)
+	for i := 0; i+1 < len(fields); i++ {
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			continue
+		}
+		keyType, _, ok := sshString(blob)
+		if !ok || string(keyType) != fields[i] {
+			continue
+		}
+		return sshJWK(fields[i], blob, fingerprintKID)
+	}
+	return jwkset.JWK{}, errors.New("no OpenSSH public key found")
+}
+
+// sshJWK converts the public key in the OpenSSH wire format, RFC 4253 section 6.6, into a JWK.
+func sshJWK(keyType string, blob []byte, fingerprintKID bool) (jwkset.JWK, error) {
+	_, rest, _ := sshString(blob)
+	var alg jwkset.ALG
+	var pub any
+	switch keyType {
+	case "ssh-ed25519":
+		key, _, ok := sshString(rest)
+		if !ok || len(key) != ed25519.PublicKeySize {
+			return jwkset.JWK{}, errors.New("malformed ssh-ed25519 public key")
+		}
+		alg = jwkset.AlgEdDSA
+		pub = ed25519.PublicKey(key)
+	case "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521":
+		c := sshCurves[keyType]
+		name, rest, ok := sshString(rest)
+		if !ok || string(name) != c.name {
+			return jwkset.JWK{}, fmt.Errorf("malformed %s public key", keyType)
+		}
+		point, _, ok := sshString(rest)
+		if !ok {
+			return jwkset.JWK{}, fmt.Errorf("malformed %s public key", keyType)
+		}
+		_, err := c.ecdh.NewPublicKey(point)
+		if err != nil {
+			return jwkset.JWK{}, fmt.Errorf("invalid %s public key: %w", keyType, err)
+		}
+		size := (len(point) - 1) / 2
+		alg = c.alg
+		pub = &ecdsa.PublicKey{
+			Curve: c.curve,
+			X:     new(big.Int).SetBytes(point[1 : 1+size]),
+			Y:     new(big.Int).SetBytes(point[1+size:]),
+		}
+	case "ssh-rsa":
+		e, rest, ok := sshString(rest)
+		if !ok {
+			return jwkset.JWK{}, errors.New("malformed ssh-rsa public key")
+		}
+		n, _, ok := sshString(rest)
+		if !ok {
+			return jwkset.JWK{}, errors.New("malformed ssh-rsa public key")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return jwkset.JWK{}, errors.New("unsupported ssh-rsa public exponent")
+		}
+		pub = &rsa.PublicKey{
+			E: int(exponent.Int64()),
+			N: new(big.Int).SetBytes(n),
+		}
+	default:
+		return jwkset.JWK{}, fmt.Errorf("unsupported OpenSSH key type %q", keyType)
+	}
+
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: alg,
+			USE: jwkset.UseSig,
+		},
+	}
+	if fingerprintKID {
+		sum := sha256.Sum256(blob)
+		jwkOptions.Metadata.KID = "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+	} else {
+		jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+		if err != nil {
+			return jwkset.JWK{}, fmt.Errorf("could not create JWK: %w", err)
+		}
+		jwkOptions.Metadata.KID, err = Thumbprint(jwk)
+		if err != nil {
+			return jwkset.JWK{}, err
+		}
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("could not create JWK: %w", err)
+	}
+	return jwk, nil
+}
+
+// sshString reads a length-prefixed string of the OpenSSH wire format. RSA mpints are read the same way, as their
+// leading zero byte does not change their value.
+func sshString(b []byte) (value, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,119 @@
+package keyfunc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewSSH(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err)
+	}
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key. Error: %s", err)
+	}
+	ecPoint := append([]byte{4}, ecPriv.X.FillBytes(make([]byte, 32))...)
+	ecPoint = append(ecPoint, ecPriv.Y.FillBytes(make([]byte, 32))...)
+	authorizedKeys := strings.Join([]string{
+		"# Developer keys.",
+		sshAuthorizedKey("ssh-ed25519", []byte(edPub)) + " alice@example.com",
+		`no-pty,command="echo hi" ` + sshAuthorizedKey("ecdsa-sha2-nistp256", []byte("nistp256"), ecPoint),
+		"",
+		sshAuthorizedKey("ssh-rsa", big.NewInt(int64(rsaPriv.E)).Bytes(), append([]byte{0}, rsaPriv.N.Bytes()...)),
+		sshAuthorizedKey("ssh-dss", []byte("unsupported")),
+	}, "\n")
+
+	var warnings []error
+	options := SSHOptions{
+		ParseWarningHandler: func(_ string, _ jwkset.KTY, reason error) {
+			warnings = append(warnings, reason)
+		},
+	}
+	jwks, err := NewSSHJWKs([]byte(authorizedKeys), options)
+	if err != nil {
+		t.Fatalf("Failed to convert OpenSSH public keys. Error: %s", err)
+	}
+	if len(jwks) != 3 {
+		t.Fatalf("Expected 3 JWKs, got %d.", len(jwks))
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning for the unsupported key, got %d.", len(warnings))
+	}
+	for _, jwk := range jwks {
+		thumbprint, err := Thumbprint(jwk)
+		if err != nil {
+			t.Fatalf("Failed to compute thumbprint. Error: %s", err)
+		}
+		if jwk.Marshal().KID != thumbprint {
+			t.Fatalf("Expected the key ID to be the thumbprint %q, got %q.", thumbprint, jwk.Marshal().KID)
+		}
+	}
+
+	k, err := NewSSH([]byte(authorizedKeys), options)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	tests := []struct {
+		key    any
+		kid    string
+		method jwt.SigningMethod
+	}{
+		{key: edPriv, kid: jwks[0].Marshal().KID, method: jwt.SigningMethodEdDSA},
+		{key: ecPriv, kid: jwks[1].Marshal().KID, method: jwt.SigningMethodES256},
+		{key: rsaPriv, kid: jwks[2].Marshal().KID, method: jwt.SigningMethodRS256},
+	}
+	for _, tc := range tests {
+		token := jwt.New(tc.method)
+		token.Header[jwkset.HeaderKID] = tc.kid
+		signed, err := token.SignedString(tc.key)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		_, err = jwt.Parse(signed, k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT signed with %s. Error: %s", tc.method.Alg(), err)
+		}
+	}
+
+	jwks, err = NewSSHJWKs([]byte(authorizedKeys), SSHOptions{FingerprintKID: true})
+	if err != nil {
+		t.Fatalf("Failed to convert OpenSSH public keys. Error: %s", err)
+	}
+	if !strings.HasPrefix(jwks[0].Marshal().KID, "SHA256:") {
+		t.Fatalf("Expected an OpenSSH fingerprint key ID, got %q.", jwks[0].Marshal().KID)
+	}
+
+	_, err = NewSSHJWKs([]byte(authorizedKeys), SSHOptions{Strict: true})
+	if !errors.Is(err, ErrSSHPublicKey) {
+		t.Fatalf("Expected ErrSSHPublicKey in strict mode. Error: %v", err)
+	}
+}
+
+// sshAuthorizedKey encodes the public key fields in the OpenSSH wire format as the key type and base64 fields of an
+// authorized_keys line.
+func sshAuthorizedKey(keyType string, fields ...[]byte) string {
+	var blob []byte
+	for _, field := range append([][]byte{[]byte(keyType)}, fields...) {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(len(field)))
+		blob = append(blob, field...)
+	}
+	return keyType + " " + base64.StdEncoding.EncodeToString(blob)
+}
@@ -0,0 +1,154 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// HTTPStorageStatus reports the health of a remote JWK Set based on recent refreshes.
+type HTTPStorageStatus struct {
+	// ActiveURL is the URL, with any credentials redacted, of the endpoint of the most recent successful refresh when
+	// the FailoverURLs or HealthCheckInterval option is set. It is empty until a refresh succeeds.
+	ActiveURL string
+	// ConsecutiveFailures is the number of refreshes that have failed since the last successful refresh.
+	ConsecutiveFailures int
+	// Endpoints are the health of the URL given to NewHTTPStorage followed by the FailoverURLs option, in order of
+	// priority. It is empty if neither the FailoverURLs nor the HealthCheckInterval option is set.
+	Endpoints []EndpointStatus
+	// Healthy is false when the FailureThresholdUnhealthy option is set and ConsecutiveFailures is at or above the
+	// FailureThreshold option.
+	Healthy bool
+	// LastError is the error from the most recent failed refresh. It is nil after a successful refresh.
+	LastError error
+	// LastRefresh is when the most recent refresh, successful or not, completed.
+	LastRefresh time.Time
+	// LastSuccess is when the most recent successful refresh completed.
+	LastSuccess time.Time
+	// LastTiming is the timing of the most recent refresh, successful or not.
+	LastTiming RefreshTiming
+	// NextScheduledRefresh is when a refresh is scheduled because of the HonorCacheControl, HonorKeyExpiry, or
+	// HonorRefreshMetadata options. It is zero if no refresh is scheduled. Refreshes from the RefreshInterval option
+	// are not included.
+	NextScheduledRefresh time.Time
+	// SuppressedRefreshes is the number of refreshes that were coalesced or suppressed because of the
+	// MinRefreshInterval option.
+	SuppressedRefreshes int
+}
+
+// RefreshTiming is the timing of a refresh of a remote JWK Set. The DNS, Connect, and TTFB durations are from the last
+// attempt of the refresh and are zero when not applicable, such as when a connection is reused. This helps
+// distinguish slow identity providers from network issues.
+type RefreshTiming struct {
+	// Attempts is the number of HTTP requests made, including retries.
+	Attempts int
+	// Connect is the duration of establishing a new connection.
+	Connect time.Duration
+	// DNS is the duration of looking up the host name.
+	DNS time.Duration
+	// TTFB is the duration from sending the HTTP request to receiving the first byte of the response.
+	TTFB time.Duration
+	// Total is the duration of the entire refresh, including retries and processing the JWK Set.
+	Total time.Duration
+}
+
+// refreshTrace collects the timing of a single HTTP request. The httptrace hooks may be called concurrently.
+type refreshTrace struct {
+	connectStart time.Time
+	dnsStart     time.Time
+	mux          sync.Mutex
+	timing       RefreshTiming
+	wrote        time.Time
+}
+
+func (r *refreshTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			r.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			r.timing.DNS = time.Since(r.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			if err == nil {
+				r.timing.Connect = time.Since(r.connectStart)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			r.wrote = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+			if !r.wrote.IsZero() {
+				r.timing.TTFB = time.Since(r.wrote)
+			}
+		},
+	}
+}
+
+func (r *refreshTrace) write(timing *RefreshTiming) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	timing.Connect = r.timing.Connect
+	timing.DNS = r.timing.DNS
+	timing.TTFB = r.timing.TTFB
+}
+
+func (s *httpStorage) recordSuppressed() {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	s.status.SuppressedRefreshes++
+}
+
+func (s *httpStorage) recordRefresh(ctx context.Context, err error, timing RefreshTiming) {
+	s.statusMux.Lock()
+	now := time.Now()
+	s.status.LastRefresh = now
+	s.status.LastTiming = timing
+	if err == nil {
+		s.status.ConsecutiveFailures = 0
+		s.status.Healthy = true
+		s.status.LastError = nil
+		s.status.LastSuccess = now
+		if s.stale != nil && s.options.Ctx.Err() == nil {
+			s.stale.Reset(s.options.StalenessThreshold)
+		}
+		s.statusMux.Unlock()
+		s.publish(EventRefreshSucceeded, "", nil)
+		return
+	}
+	s.status.ConsecutiveFailures++
+	s.status.LastError = err
+	failures := s.status.ConsecutiveFailures
+	threshold := s.options.FailureThreshold
+	reached := threshold > 0 && failures >= threshold
+	if reached && s.options.FailureThresholdUnhealthy {
+		s.status.Healthy = false
+	}
+	s.statusMux.Unlock()
+
+	s.publish(EventRefreshFailed, "", err)
+	if threshold > 0 && failures == threshold {
+		s.publish(EventCircuitOpened, "", err)
+		if s.options.FailureThresholdHandler != nil {
+			s.options.FailureThresholdHandler(ctx, failures, err)
+		}
+	}
+}
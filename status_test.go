@@ -0,0 +1,110 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestHTTPStorageFailureThreshold(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	var escalations int
+	var escalationErr error
+	options := HTTPStorageOptions{
+		Ctx:              ctx,
+		FailureThreshold: 3,
+		FailureThresholdHandler: func(ctx context.Context, failures int, err error) {
+			escalations++
+			escalationErr = err
+		},
+		FailureThresholdUnhealthy: true,
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	status := store.Status()
+	if !status.Healthy || status.LastSuccess.IsZero() {
+		t.Fatalf("Expected healthy status after first refresh, but got %+v.", status)
+	}
+
+	failing.Store(true)
+	for i := 0; i < 4; i++ {
+		_ = store.Refresh(ctx)
+		status = store.Status()
+		if i < 2 && !status.Healthy {
+			t.Fatalf("Expected healthy status below the failure threshold.")
+		}
+	}
+	if status.Healthy || status.ConsecutiveFailures != 4 {
+		t.Fatalf("Expected unhealthy status with 4 consecutive failures, but got %+v.", status)
+	}
+	if escalations != 1 || !errors.Is(escalationErr, jwkset.ErrInvalidHTTPStatusCode) {
+		t.Fatalf("Expected one escalation, but got %d with error %v.", escalations, escalationErr)
+	}
+
+	failing.Store(false)
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh. Error: %s", err)
+	}
+	status = store.Status()
+	if !status.Healthy || status.ConsecutiveFailures != 0 || status.LastError != nil {
+		t.Fatalf("Expected failures to reset after a successful refresh, but got %+v.", status)
+	}
+}
+
+func TestHTTPStorageRefreshTiming(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const delay = 20 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	var handled atomic.Int64
+	options := HTTPStorageOptions{
+		Ctx: ctx,
+		RefreshTimingHandler: func(ctx context.Context, timing RefreshTiming) {
+			handled.Add(1)
+		},
+	}
+	store, err := NewHTTPStorage(server.URL, options)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	if handled.Load() != 1 {
+		t.Fatalf("Expected the timing handler to be called once, but got %d.", handled.Load())
+	}
+	timing := store.Status().LastTiming
+	if timing.Attempts != 1 {
+		t.Fatalf("Expected 1 attempt, but got %d.", timing.Attempts)
+	}
+	if timing.TTFB < delay || timing.Total < timing.TTFB {
+		t.Fatalf("Expected TTFB of at least %s within the total, but got TTFB %s and total %s.", delay, timing.TTFB, timing.Total)
+	}
+	if timing.Connect <= 0 {
+		t.Fatalf("Expected the duration of a new connection to be recorded.")
+	}
+}
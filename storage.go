@@ -0,0 +1,319 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// customKey is a key with a key type that is not supported by github.com/MicahParks/jwkset. It was parsed by a
+// KeyTypeParser given to RegisterKeyType.
+type customKey struct {
+	alg      jwkset.ALG
+	key      any
+	kid      string
+	kty      jwkset.KTY
+	use      jwkset.USE
+	validity keyValidity
+}
+
+// customKeyReader is implemented by storage in this package that can hold keys with custom key types. The first key
+// whose key ID satisfies match is returned.
+type customKeyReader interface {
+	customKeyRead(ctx context.Context, match func(kid string) bool) (customKey, bool)
+}
+
+var (
+	_ jwkset.Storage   = &memoryStorage{}
+	_ ThumbprintReader = &memoryStorage{}
+)
+
+// memoryStorage is an in-memory jwkset.Storage that can also hold keys with custom key types. Unlike
+// jwkset.MemoryJWKSet, the entire key set can be replaced atomically.
+type memoryStorage struct {
+	certs       map[certificateThumbprint][]int
+	custom      []customKey
+	extra       map[string]map[string]json.RawMessage
+	ingested    []time.Time
+	kids        map[string][]int
+	mux         sync.RWMutex
+	now         func() time.Time
+	seen        map[observationKey]time.Time
+	set         []jwkset.JWK
+	thumbprints map[string]int
+	validity    []keyValidity
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		certs:       make(map[certificateThumbprint][]int),
+		kids:        make(map[string][]int),
+		now:         time.Now,
+		seen:        make(map[observationKey]time.Time),
+		thumbprints: make(map[string]int),
+	}
+}
+
+// replace atomically replaces all keys in the storage.
+func (m *memoryStorage) replace(set []jwkset.JWK, custom []customKey) {
+	m.replaceWithValidity(set, nil, custom)
+}
+
+// replaceWithValidity is like replace, but each JWK is only read while the validity at the same index covers the
+// current time. A nil validity does not limit the JWKs.
+func (m *memoryStorage) replaceWithValidity(set []jwkset.JWK, validity []keyValidity, custom []customKey) {
+	m.replaceIngested(ingestResult{custom: custom, set: set, validity: validity})
+}
+
+// replaceIngested is like replaceWithValidity, but also keeps the nonstandard parameters of the ingested JWKs. JWKs
+// that were already in the storage keep the time they were first ingested.
+func (m *memoryStorage) replaceIngested(result ingestResult) {
+	index := indexThumbprints(result.set)
+	kids := indexKIDs(result.set)
+	certs := indexCertificates(result.set)
+	observed := make([]observationKey, len(result.set))
+	for i, jwk := range result.set {
+		observed[i] = newObservationKey(jwk)
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	now := m.now()
+	ingested := make([]time.Time, len(result.set))
+	seen := make(map[observationKey]time.Time, len(result.set))
+	for i, key := range observed {
+		t, ok := m.seen[key]
+		if !ok {
+			t = now
+		}
+		ingested[i] = t
+		seen[key] = t
+	}
+	m.set = result.set
+	m.certs = certs
+	m.custom = result.custom
+	m.ingested = ingested
+	m.kids = kids
+	m.seen = seen
+	m.thumbprints = index
+	m.validity = result.validity
+	m.extra = result.extra
+}
+
+// keys returns all keys in the storage, including those outside their validity.
+func (m *memoryStorage) keys() ([]jwkset.JWK, []customKey) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.set, m.custom
+}
+
+// usable reports if the JWK at index i is within its validity. The read lock must be held.
+func (m *memoryStorage) usable(i int, now time.Time) bool {
+	return m.validity == nil || m.validity[i].valid(now)
+}
+
+// kidKeys returns the usable JWKs with the key ID and when they were first ingested. If match is not nil, it replaces
+// the index of key IDs and the JWKs with a key ID that satisfies it are returned.
+func (m *memoryStorage) kidKeys(_ context.Context, kid string, match func(kid string) bool) ([]ingestedJWK, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	now := m.now()
+	var keys []ingestedJWK
+	if match == nil {
+		for _, i := range m.kids[kid] {
+			if m.usable(i, now) {
+				keys = append(keys, ingestedJWK{firstSeen: m.ingested[i], jwk: m.set[i]})
+			}
+		}
+		return keys, nil
+	}
+	for i, jwk := range m.set {
+		if match(jwk.Marshal().KID) && m.usable(i, now) {
+			keys = append(keys, ingestedJWK{firstSeen: m.ingested[i], jwk: jwk})
+		}
+	}
+	return keys, nil
+}
+
+// certificateKeys returns the usable JWKs with the X.509 certificate thumbprint given in the header parameter and when
+// they were first ingested.
+func (m *memoryStorage) certificateKeys(_ context.Context, header, value string) ([]ingestedJWK, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	now := m.now()
+	var keys []ingestedJWK
+	for _, i := range m.certs[certificateThumbprint{header: header, value: value}] {
+		if m.usable(i, now) {
+			keys = append(keys, ingestedJWK{firstSeen: m.ingested[i], jwk: m.set[i]})
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryStorage) customKeyRead(ctx context.Context, match func(kid string) bool) (customKey, bool) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	now := m.now()
+	for _, c := range m.custom {
+		if match(c.kid) && c.validity.valid(now) {
+			return c, true
+		}
+	}
+	return customKey{}, false
+}
+
+func (m *memoryStorage) KeyDelete(_ context.Context, keyID string) (ok bool, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if _, ok := m.extra[keyID]; ok {
+		m.extra = maps.Clone(m.extra)
+		delete(m.extra, keyID)
+	}
+	for i, jwk := range m.set {
+		if jwk.Marshal().KID == keyID {
+			m.set = slices.Delete(slices.Clone(m.set), i, i+1)
+			m.ingested = slices.Delete(slices.Clone(m.ingested), i, i+1)
+			if m.validity != nil {
+				m.validity = slices.Delete(slices.Clone(m.validity), i, i+1)
+			}
+			m.kids = indexKIDs(m.set)
+			m.certs = indexCertificates(m.set)
+			m.seen = maps.Clone(m.seen)
+			delete(m.seen, newObservationKey(jwk))
+			m.thumbprints = indexThumbprints(m.set)
+			return true, nil
+		}
+	}
+	for i, c := range m.custom {
+		if c.kid == keyID {
+			m.custom = slices.Delete(slices.Clone(m.custom), i, i+1)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *memoryStorage) KeyRead(_ context.Context, keyID string) (jwkset.JWK, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	now := m.now()
+	for i, jwk := range m.set {
+		if jwk.Marshal().KID == keyID && m.usable(i, now) {
+			return jwk, nil
+		}
+	}
+	return jwkset.JWK{}, fmt.Errorf("%w: kid %q", jwkset.ErrKeyNotFound, keyID)
+}
+func (m *memoryStorage) KeyReadThumbprint(_ context.Context, thumbprint string) (jwkset.JWK, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	i, ok := m.thumbprints[thumbprint]
+	if !ok || !m.usable(i, m.now()) {
+		return jwkset.JWK{}, fmt.Errorf("%w: thumbprint %q", jwkset.ErrKeyNotFound, thumbprint)
+	}
+	return m.set[i], nil
+}
+func (m *memoryStorage) KeyReadAll(_ context.Context) ([]jwkset.JWK, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if m.validity == nil {
+		return slices.Clone(m.set), nil
+	}
+	now := m.now()
+	set := make([]jwkset.JWK, 0, len(m.set))
+	for i, jwk := range m.set {
+		if m.usable(i, now) {
+			set = append(set, jwk)
+		}
+	}
+	return set, nil
+}
+func (m *memoryStorage) KeyWrite(_ context.Context, jwk jwkset.JWK) error {
+	key := newObservationKey(jwk)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	firstSeen, ok := m.seen[key]
+	if !ok {
+		firstSeen = m.now()
+		m.seen = maps.Clone(m.seen)
+		m.seen[key] = firstSeen
+	}
+	m.set = append(slices.Clone(m.set), jwk)
+	m.ingested = append(slices.Clone(m.ingested), firstSeen)
+	m.kids = maps.Clone(m.kids)
+	m.kids[key.kid] = append(slices.Clone(m.kids[key.kid]), len(m.set)-1)
+	if certs := certificateThumbprints(jwk.Marshal()); len(certs) > 0 {
+		m.certs = maps.Clone(m.certs)
+		for _, cert := range certs {
+			m.certs[cert] = append(slices.Clone(m.certs[cert]), len(m.set)-1)
+		}
+	}
+	if m.validity != nil {
+		m.validity = append(slices.Clone(m.validity), keyValidity{})
+	}
+	if t, err := Thumbprint(jwk); err == nil {
+		if _, ok := m.thumbprints[t]; !ok {
+			m.thumbprints = maps.Clone(m.thumbprints)
+			m.thumbprints[t] = len(m.set) - 1
+		}
+	}
+	return nil
+}
+
+// JSON and the other marshaling methods only include keys supported by github.com/MicahParks/jwkset. Keys with
+// custom key types are omitted.
+
+func (m *memoryStorage) JSON(ctx context.Context) (json.RawMessage, error) {
+	return m.snapshot(ctx).JSON(ctx)
+}
+func (m *memoryStorage) JSONPublic(ctx context.Context) (json.RawMessage, error) {
+	return m.snapshot(ctx).JSONPublic(ctx)
+}
+func (m *memoryStorage) JSONPrivate(ctx context.Context) (json.RawMessage, error) {
+	return m.snapshot(ctx).JSONPrivate(ctx)
+}
+func (m *memoryStorage) JSONWithOptions(ctx context.Context, marshalOptions jwkset.JWKMarshalOptions, validationOptions jwkset.JWKValidateOptions) (json.RawMessage, error) {
+	return m.snapshot(ctx).JSONWithOptions(ctx, marshalOptions, validationOptions)
+}
+func (m *memoryStorage) Marshal(ctx context.Context) (jwkset.JWKSMarshal, error) {
+	return m.snapshot(ctx).Marshal(ctx)
+}
+func (m *memoryStorage) MarshalWithOptions(ctx context.Context, marshalOptions jwkset.JWKMarshalOptions, validationOptions jwkset.JWKValidateOptions) (jwkset.JWKSMarshal, error) {
+	return m.snapshot(ctx).MarshalWithOptions(ctx, marshalOptions, validationOptions)
+}
+
+// indexKIDs maps each key ID to the indexes of the keys with it, so keys that share a key ID are found without reading
+// every key.
+func indexKIDs(set []jwkset.JWK) map[string][]int {
+	index := make(map[string][]int, len(set))
+	for i, jwk := range set {
+		kid := jwk.Marshal().KID
+		index[kid] = append(index[kid], i)
+	}
+	return index
+}
+
+// indexCertificates maps the X.509 certificate thumbprints of the keys to their indexes, so keys identified by the
+// HeaderX5T or HeaderX5TS256 JWT header parameter are found without reading every key.
+func indexCertificates(set []jwkset.JWK) map[certificateThumbprint][]int {
+	index := make(map[certificateThumbprint][]int)
+	for i, jwk := range set {
+		for _, cert := range certificateThumbprints(jwk.Marshal()) {
+			index[cert] = append(index[cert], i)
+		}
+	}
+	return index
+}
+
+func (m *memoryStorage) snapshot(ctx context.Context) *jwkset.MemoryJWKSet {
+	set, _ := m.KeyReadAll(ctx)
+	s := jwkset.NewMemoryStorage()
+	for _, jwk := range set {
+		_ = s.KeyWrite(ctx, jwk) // jwkset.MemoryJWKSet never returns an error when writing.
+	}
+	return s
+}
@@ -0,0 +1,48 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStorage()
+	writeEdDSAKey(ctx, t, store, keyID)
+	store.replace(store.set, []customKey{{kid: "custom", kty: customKTY, key: []byte("secret")}})
+
+	_, err := store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read key. Error: %s", err)
+	}
+	_, ok := store.customKeyRead(ctx, func(kid string) bool { return kid == "custom" })
+	if !ok {
+		t.Fatalf("Expected custom key to be found.")
+	}
+
+	marshal, err := store.Marshal(ctx)
+	if err != nil {
+		t.Fatalf("Failed to marshal storage. Error: %s", err)
+	}
+	if len(marshal.Keys) != 1 {
+		t.Fatalf("Expected only the jwkset supported key to be marshaled, but got %d keys.", len(marshal.Keys))
+	}
+
+	for _, kid := range []string{keyID, "custom"} {
+		ok, err = store.KeyDelete(ctx, kid)
+		if err != nil || !ok {
+			t.Fatalf("Failed to delete key %q. Error: %v", kid, err)
+		}
+	}
+	_, err = store.KeyRead(ctx, keyID)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound after deletion, but got %s.", err)
+	}
+	_, ok = store.customKeyRead(ctx, func(kid string) bool { return kid == "custom" })
+	if ok {
+		t.Fatalf("Expected custom key to be deleted.")
+	}
+}
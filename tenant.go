@@ -0,0 +1,295 @@
+package keyfunc
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+// TenantPlaceholder is replaced with the tenant in the URLTemplate of TenantOptions.
+const TenantPlaceholder = "{tenant}"
+
+var (
+	// ErrTenant is returned when the tenant of a JWT cannot be used to find its key.
+	ErrTenant = errors.New("failed tenant key lookup")
+)
+
+// defaultTenantPattern does not match "." or "..", so a tenant cannot escape its path segment.
+var defaultTenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// TenantOptions configure NewTenantKeyfunc.
+type TenantOptions struct {
+	// Claim is the claim of a JWT that holds its tenant, such as "tid" or "tenant_id". The claim must be a string. The
+	// claim is read before the signature is verified, but a JWT with a forged tenant fails that verification anyway
+	// because the key is read from the JWK Set of the forged tenant.
+	Claim string
+	// Ctx ends the refresh goroutines of the tenant JWK Sets when it is done and is used by the Keyfunc method.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// MaxTenants is the maximum number of tenants whose JWK Sets are cached. The least recently used tenant is evicted
+	// and its refresh goroutine ended when it is exceeded.
+	//
+	// This defaults to 1000.
+	MaxTenants int
+	// NewTenantRateLimit limits how often the JWK Set of a tenant that is not cached is fetched. JWTs for tenants over
+	// the limit are rejected without a request, so JWTs with random tenants cannot be used to flood the identity
+	// provider.
+	//
+	// This defaults to 10 new tenants per minute with a burst of 10.
+	NewTenantRateLimit *rate.Limiter
+	// TenantPattern must match the tenant of a JWT before it is put in the URL template. The tenant is also path escaped.
+	//
+	// This defaults to up to 128 letters, digits, ".", "_", and "-", starting with a letter or digit.
+	TenantPattern *regexp.Regexp
+	// UnknownKIDRefreshInterval is the minimum time between refreshes of the JWK Set of each tenant caused by JWTs with
+	// an unknown key ID.
+	//
+	// This defaults to one minute.
+	UnknownKIDRefreshInterval time.Duration
+	// URLOptions configure the JWK Set of each tenant. Set its FetchRateLimit to bound the requests for the JWK Sets of
+	// all tenants together.
+	URLOptions URLOptions
+	// URLTemplate is the URL of the JWK Set of a tenant with TenantPlaceholder in place of the tenant, such as
+	// "https://idp.example.com/{tenant}/keys".
+	URLTemplate string
+}
+
+// TenantKeyfunc resolves the keys for JWTs from the tenants of a multi-tenant identity provider. The JWK Set of a tenant
+// is fetched the first time a JWT for the tenant is seen, so tenants do not need to be known upfront.
+type TenantKeyfunc interface {
+	// Keyfunc resolves the key for the JWT with the context given at creation.
+	Keyfunc(token *jwt.Token) (any, error)
+	// KeyfuncCtx returns a jwt.Keyfunc that resolves the key for the JWT with the given context.
+	KeyfuncCtx(ctx context.Context) jwt.Keyfunc
+}
+
+type tenantKeyfunc struct {
+	cache   *keyfuncCache
+	newK    func(ctx context.Context, u string) (Keyfunc, error)
+	options TenantOptions
+}
+
+// NewTenantKeyfunc creates a new TenantKeyfunc for the URL template.
+func NewTenantKeyfunc(options TenantOptions) (TenantKeyfunc, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	if options.MaxTenants <= 0 {
+		options.MaxTenants = 1000
+	}
+	if options.NewTenantRateLimit == nil {
+		options.NewTenantRateLimit = rate.NewLimiter(rate.Every(6*time.Second), 10)
+	}
+	if options.TenantPattern == nil {
+		options.TenantPattern = defaultTenantPattern
+	}
+	if options.UnknownKIDRefreshInterval == 0 {
+		options.UnknownKIDRefreshInterval = time.Minute
+	}
+	if options.Claim == "" {
+		return nil, fmt.Errorf("%w: a tenant claim is required", ErrTenant)
+	}
+	if !strings.Contains(options.URLTemplate, TenantPlaceholder) {
+		return nil, fmt.Errorf("%w: URL template %q has no %s placeholder", ErrTenant, redact(options.URLTemplate), TenantPlaceholder)
+	}
+	u, err := url.Parse(strings.ReplaceAll(options.URLTemplate, TenantPlaceholder, "tenant"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, redactError(fmt.Errorf("%w: URL template %q is not an HTTP URL", errors.Join(err, ErrTenant), options.URLTemplate))
+	}
+	t := &tenantKeyfunc{
+		cache:   newKeyfuncCache(options.Ctx, options.MaxTenants, options.NewTenantRateLimit),
+		options: options,
+	}
+	t.newK = func(ctx context.Context, u string) (Keyfunc, error) {
+		return newProviderKeyfunc(ctx, u, t.options.URLOptions, t.options.UnknownKIDRefreshInterval)
+	}
+	return t, nil
+}
+
+func (t *tenantKeyfunc) Keyfunc(token *jwt.Token) (any, error) {
+	return t.KeyfuncCtx(t.options.Ctx)(token)
+}
+func (t *tenantKeyfunc) KeyfuncCtx(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		tenant, err := t.tenant(token)
+		if err != nil {
+			return nil, err
+		}
+		k, err := t.keyfunc(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		return k.KeyfuncCtx(ctx)(token)
+	}
+}
+
+// tenant reads the tenant claim of the JWT and confirms it matches the TenantPattern.
+func (t *tenantKeyfunc) tenant(token *jwt.Token) (string, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok && token.Claims != nil {
+		raw, err := json.Marshal(token.Claims)
+		if err != nil {
+			return "", fmt.Errorf("%w: could not read JWT claims", errors.Join(err, ErrTenant, ErrKeyfunc))
+		}
+		err = json.Unmarshal(raw, &claims)
+		if err != nil {
+			return "", fmt.Errorf("%w: could not read JWT claims", errors.Join(err, ErrTenant, ErrKeyfunc))
+		}
+	}
+	tenant, ok := claims[t.options.Claim].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: JWT has no string %q claim", errors.Join(ErrTenant, ErrKeyfunc), t.options.Claim)
+	}
+	if !t.options.TenantPattern.MatchString(tenant) {
+		return "", fmt.Errorf("%w: tenant %q does not match the tenant pattern", errors.Join(ErrTenant, ErrKeyfunc), tenant)
+	}
+	return tenant, nil
+}
+
+// keyfunc returns the Keyfunc of the tenant, creating it if the tenant is not cached.
+func (t *tenantKeyfunc) keyfunc(ctx context.Context, tenant string) (Keyfunc, error) {
+	k, err := t.cache.get(ctx, tenant, func(ctx context.Context) (Keyfunc, error) {
+		return t.newK(ctx, strings.ReplaceAll(t.options.URLTemplate, TenantPlaceholder, url.PathEscape(tenant)))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: no Keyfunc for tenant %q", errors.Join(err, ErrTenant, ErrKeyfunc), tenant)
+	}
+	return k, nil
+}
+
+const (
+	// keyfuncCacheRetryMin is how long a failure to create a Keyfunc is cached before the first retry.
+	keyfuncCacheRetryMin = time.Second
+	// keyfuncCacheRetryMax bounds how long a failure to create a Keyfunc is cached after repeated failures.
+	keyfuncCacheRetryMax = time.Minute
+)
+
+// keyfuncCache holds the Keyfuncs created on demand for each key, such as a tenant. The least recently used Keyfunc is
+// evicted and its refresh goroutine ended when there are more than max Keyfuncs. Failures to create a Keyfunc are
+// cached with an exponential backoff, so a key that cannot be resolved is not retried by every JWT.
+type keyfuncCache struct {
+	ctx     context.Context
+	entries map[string]*list.Element
+	limiter *rate.Limiter
+	lru     *list.List
+	max     int
+	mux     sync.Mutex
+	now     func() time.Time
+}
+
+type keyfuncCacheEntry struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	failures int
+	k        Keyfunc
+	key      string
+	retryAt  time.Time
+}
+
+// newKeyfuncCache creates a new keyfuncCache. The Keyfuncs are created with a child of ctx. If size is zero, Keyfuncs
+// are not evicted. If limiter is not nil, it limits how often Keyfuncs are created.
+func newKeyfuncCache(ctx context.Context, size int, limiter *rate.Limiter) *keyfuncCache {
+	return &keyfuncCache{
+		ctx:     ctx,
+		entries: make(map[string]*list.Element),
+		limiter: limiter,
+		lru:     list.New(),
+		max:     size,
+		now:     time.Now,
+	}
+}
+
+// get returns the Keyfunc for the key, calling create if the key is not cached or its failure to be created is due for
+// a retry. Concurrent lookups for a key that is being created wait for the first one. A lookup stops waiting when ctx
+// ends, but the creation continues, so its result is cached for later lookups.
+func (c *keyfuncCache) get(ctx context.Context, key string, create func(ctx context.Context) (Keyfunc, error)) (Keyfunc, error) {
+	c.mux.Lock()
+	var failures int
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*keyfuncCacheEntry)
+		select {
+		case <-entry.done:
+			if entry.err == nil || c.now().Before(entry.retryAt) {
+				c.lru.MoveToFront(element)
+				c.mux.Unlock()
+				return entry.k, entry.err
+			}
+			failures = entry.failures
+			c.remove(element)
+		default:
+			c.lru.MoveToFront(element)
+			c.mux.Unlock()
+			return c.wait(ctx, entry)
+		}
+	}
+	if c.limiter != nil && !c.limiter.Allow() {
+		c.mux.Unlock()
+		return nil, errors.New("rate limit for creating new Keyfuncs exceeded")
+	}
+	entryCtx, cancel := context.WithCancel(c.ctx)
+	entry := &keyfuncCacheEntry{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		failures: failures,
+		key:      key,
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.max > 0 && c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+	c.mux.Unlock()
+
+	go func() {
+		k, err := create(entryCtx)
+		c.mux.Lock()
+		entry.k, entry.err = k, err
+		if err != nil {
+			entry.cancel()
+			entry.failures++
+			backoff := keyfuncCacheRetryMin << min(entry.failures-1, 16)
+			entry.retryAt = c.now().Add(min(backoff, keyfuncCacheRetryMax))
+		}
+		c.mux.Unlock()
+		close(entry.done)
+	}()
+	return c.wait(ctx, entry)
+}
+
+// wait waits for the creation of the entry's Keyfunc until ctx ends.
+func (c *keyfuncCache) wait(ctx context.Context, entry *keyfuncCacheEntry) (Keyfunc, error) {
+	select {
+	case <-entry.done:
+		return entry.k, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// delete evicts the key and ends the refresh goroutine of its Keyfunc.
+func (c *keyfuncCache) delete(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// remove evicts the element and ends the refresh goroutine of its Keyfunc. The mutex must be held.
+func (c *keyfuncCache) remove(element *list.Element) {
+	entry := element.Value.(*keyfuncCacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	entry.cancel()
+}
@@ -0,0 +1,176 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestTenantKeyfunc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stores := map[string]jwkset.Storage{
+		"tenant-a": jwkset.NewMemoryStorage(),
+		"tenant-b": jwkset.NewMemoryStorage(),
+	}
+	privs := make(map[string]ed25519.PrivateKey, len(stores))
+	for tenant, store := range stores {
+		privs[tenant] = writeEdDSAKey(ctx, t, store, keyID)
+	}
+	var mux sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/keys")
+		mux.Lock()
+		requests[tenant]++
+		mux.Unlock()
+		store, ok := stores[tenant]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rawJWKS, err := store.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+
+	sign := func(priv ed25519.PrivateKey, tenant string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"tid": tenant})
+		token.Header[jwkset.HeaderKID] = keyID
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		return signed
+	}
+
+	k, err := NewTenantKeyfunc(TenantOptions{
+		Claim:              "tid",
+		Ctx:                ctx,
+		MaxTenants:         1,
+		NewTenantRateLimit: rate.NewLimiter(rate.Inf, 0),
+		URLTemplate:        server.URL + "/" + TenantPlaceholder + "/keys",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create TenantKeyfunc. Error: %s", err)
+	}
+	for _, tenant := range []string{"tenant-a", "tenant-a", "tenant-b", "tenant-a"} {
+		_, err = jwt.Parse(sign(privs[tenant], tenant), k.Keyfunc)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT for %q. Error: %s", tenant, err)
+		}
+	}
+	mux.Lock()
+	if requests["tenant-a"] != 2 || requests["tenant-b"] != 1 {
+		t.Fatalf("Expected the JWK Set of the evicted tenant to be fetched again, got requests %v.", requests)
+	}
+	mux.Unlock()
+
+	_, err = jwt.Parse(sign(privs["tenant-a"], "tenant-b"), k.Keyfunc)
+	if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Fatalf("Expected a JWT with a forged tenant to fail verification. Error: %v", err)
+	}
+	for _, tenant := range []string{"..", "tenant/a", ""} {
+		_, err = jwt.Parse(sign(privs["tenant-a"], tenant), k.Keyfunc)
+		if !errors.Is(err, ErrTenant) {
+			t.Fatalf("Expected ErrTenant for tenant %q. Error: %v", tenant, err)
+		}
+	}
+
+	limited, err := NewTenantKeyfunc(TenantOptions{
+		Claim:              "tid",
+		Ctx:                ctx,
+		NewTenantRateLimit: rate.NewLimiter(0, 1),
+		URLTemplate:        server.URL + "/" + TenantPlaceholder + "/keys",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create TenantKeyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(privs["tenant-a"], "tenant-a"), limited.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT for the first new tenant. Error: %s", err)
+	}
+	_, err = jwt.Parse(sign(privs["tenant-b"], "tenant-b"), limited.Keyfunc)
+	if !errors.Is(err, ErrTenant) {
+		t.Fatalf("Expected ErrTenant for a new tenant over the rate limit. Error: %v", err)
+	}
+	_, err = jwt.Parse(sign(privs["tenant-a"], "tenant-a"), limited.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected a cached tenant to not be rate limited. Error: %s", err)
+	}
+
+	for _, template := range []string{"https://idp.example.com/keys", "ftp://idp.example.com/{tenant}/keys"} {
+		_, err = NewTenantKeyfunc(TenantOptions{Claim: "tid", URLTemplate: template})
+		if !errors.Is(err, ErrTenant) {
+			t.Fatalf("Expected ErrTenant for URL template %q. Error: %v", template, err)
+		}
+	}
+}
+
+func TestKeyfuncCacheFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k, err := NewTenantKeyfunc(TenantOptions{Claim: "tid", URLTemplate: "https://idp.example.com/{tenant}/keys"})
+	if err != nil {
+		t.Fatalf("Failed to create TenantKeyfunc. Error: %s", err)
+	}
+	if k.(*tenantKeyfunc).cache.limiter == nil {
+		t.Fatalf("Expected new tenants to be rate limited by default.")
+	}
+
+	cache := newKeyfuncCache(ctx, 10, nil)
+	now := time.Now()
+	cache.now = func() time.Time {
+		return now
+	}
+	var creates atomic.Int64
+	failing := func(ctx context.Context) (Keyfunc, error) {
+		creates.Add(1)
+		return nil, errors.New("failed to fetch JWK Set")
+	}
+	for i := 0; i < 3; i++ {
+		_, err = cache.get(ctx, "tenant", failing)
+		if err == nil {
+			t.Fatalf("Expected the failure to create the Keyfunc to be returned.")
+		}
+	}
+	if n := creates.Load(); n != 1 {
+		t.Fatalf("Expected the failure to be cached, got %d creations.", n)
+	}
+	now = now.Add(keyfuncCacheRetryMin)
+	_, _ = cache.get(ctx, "tenant", failing)
+	now = now.Add(keyfuncCacheRetryMin)
+	_, _ = cache.get(ctx, "tenant", failing)
+	if n := creates.Load(); n != 2 {
+		t.Fatalf("Expected the retry after a repeated failure to back off, got %d creations.", n)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	blocking := func(ctx context.Context) (Keyfunc, error) {
+		<-release
+		return nil, errors.New("failed to fetch JWK Set")
+	}
+	lookupCtx, lookupCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer lookupCancel()
+	_, err = cache.get(lookupCtx, "slow", blocking)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the lookup to end with its context, got %v.", err)
+	}
+}
@@ -0,0 +1,97 @@
+package keyfunc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// Thumbprint computes the RFC 7638 JWK SHA-256 thumbprint for the given JWK, base64url encoded without padding. Only
+// the required public members for the key type are used, so a public key and its private key share a thumbprint. This
+// is the format of the "jkt" value in DPoP and "cnf" claims.
+// https://www.rfc-editor.org/rfc/rfc7638
+func Thumbprint(jwk jwkset.JWK) (string, error) {
+	m := jwk.Marshal()
+	var members any
+	switch m.KTY {
+	case jwkset.KtyEC:
+		members = struct {
+			CRV jwkset.CRV `json:"crv"`
+			KTY jwkset.KTY `json:"kty"`
+			X   string     `json:"x"`
+			Y   string     `json:"y"`
+		}{CRV: m.CRV, KTY: m.KTY, X: m.X, Y: m.Y}
+	case jwkset.KtyOKP:
+		members = struct {
+			CRV jwkset.CRV `json:"crv"`
+			KTY jwkset.KTY `json:"kty"`
+			X   string     `json:"x"`
+		}{CRV: m.CRV, KTY: m.KTY, X: m.X}
+	case jwkset.KtyRSA:
+		members = struct {
+			E   string     `json:"e"`
+			KTY jwkset.KTY `json:"kty"`
+			N   string     `json:"n"`
+		}{E: m.E, KTY: m.KTY, N: m.N}
+	case jwkset.KtyOct:
+		members = struct {
+			K   string     `json:"k"`
+			KTY jwkset.KTY `json:"kty"`
+		}{K: m.K, KTY: m.KTY}
+	default:
+		return "", fmt.Errorf("%w: cannot compute thumbprint for unsupported key type %q", ErrKeyfunc, m.KTY)
+	}
+	raw, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not marshal required JWK members for thumbprint", errors.Join(err, ErrKeyfunc))
+	}
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// ThumbprintReader is implemented by JWK Set storage that can read a key by its RFC 7638 thumbprint without computing
+// the thumbprint of every key. The storage created by this package maintains an index of thumbprints across refreshes.
+type ThumbprintReader interface {
+	KeyReadThumbprint(ctx context.Context, thumbprint string) (jwkset.JWK, error)
+}
+
+// KeyReadThumbprint reads the key with the given RFC 7638 thumbprint from the JWK Set storage. If the storage does not
+// implement ThumbprintReader, the thumbprint of every key is computed. jwkset.ErrKeyNotFound is returned if no key
+// matches.
+func KeyReadThumbprint(ctx context.Context, storage jwkset.Storage, thumbprint string) (jwkset.JWK, error) {
+	if r, ok := storage.(ThumbprintReader); ok {
+		return r.KeyReadThumbprint(ctx, thumbprint)
+	}
+	all, err := storage.KeyReadAll(ctx)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf("%w: could not read JWK Set from storage", errors.Join(err, ErrKeyfunc))
+	}
+	for _, jwk := range all {
+		t, err := Thumbprint(jwk)
+		if err == nil && t == thumbprint {
+			return jwk, nil
+		}
+	}
+	return jwkset.JWK{}, fmt.Errorf("%w: thumbprint %q", jwkset.ErrKeyNotFound, thumbprint)
+}
+
+// indexThumbprints maps the RFC 7638 thumbprint of each key to the index of the first key with it. Keys that have no
+// thumbprint are skipped.
+func indexThumbprints(set []jwkset.JWK) map[string]int {
+	index := make(map[string]int, len(set))
+	for i, jwk := range set {
+		t, err := Thumbprint(jwk)
+		if err != nil {
+			continue
+		}
+		if _, ok := index[t]; !ok {
+			index[t] = i
+		}
+	}
+	return index
+}
@@ -0,0 +1,69 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// rfc7638Example is the example key from RFC 7638 section 3.1.
+const rfc7638Example = `{"kty":"RSA","n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw","e":"AQAB","alg":"RS256","kid":"2011-04-29"}`
+
+const rfc7638Thumbprint = "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+
+func TestThumbprint(t *testing.T) {
+	jwk, err := jwkset.NewJWKFromRawJSON([]byte(rfc7638Example), jwkset.JWKMarshalOptions{}, jwkset.JWKValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	tp, err := Thumbprint(jwk)
+	if err != nil {
+		t.Fatalf("Failed to compute thumbprint. Error: %s", err)
+	}
+	if tp != rfc7638Thumbprint {
+		t.Fatalf("Expected thumbprint %q, but got %q.", rfc7638Thumbprint, tp)
+	}
+}
+
+func TestKeyReadThumbprint(t *testing.T) {
+	ctx := context.Background()
+	raw := []byte(`{"keys":[` + rfc7638Example + `]}`)
+	k, err := NewJWKSetJSON(raw)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	jwk, err := KeyReadThumbprint(ctx, k.Storage(), rfc7638Thumbprint)
+	if err != nil {
+		t.Fatalf("Failed to read key by thumbprint. Error: %s", err)
+	}
+	if jwk.Marshal().KID != "2011-04-29" {
+		t.Fatalf("Expected key ID %q, but got %q.", "2011-04-29", jwk.Marshal().KID)
+	}
+
+	// The index is maintained when keys are deleted.
+	_, err = k.Storage().KeyDelete(ctx, "2011-04-29")
+	if err != nil {
+		t.Fatalf("Failed to delete key. Error: %s", err)
+	}
+	_, err = KeyReadThumbprint(ctx, k.Storage(), rfc7638Thumbprint)
+	if !errors.Is(err, jwkset.ErrKeyNotFound) {
+		t.Fatalf("Expected jwkset.ErrKeyNotFound after delete, but got %s.", err)
+	}
+
+	// Storage without an index falls back to computing thumbprints.
+	given := jwkset.NewMemoryStorage()
+	err = given.KeyWrite(ctx, jwk)
+	if err != nil {
+		t.Fatalf("Failed to write key. Error: %s", err)
+	}
+	client, err := NewHTTPClient(HTTPClientOptions{Given: given})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client. Error: %s", err)
+	}
+	_, err = client.KeyReadThumbprint(ctx, rfc7638Thumbprint)
+	if err != nil {
+		t.Fatalf("Failed to read key by thumbprint from HTTP client. Error: %s", err)
+	}
+}
@@ -0,0 +1,125 @@
+package keyfunc
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenCacheOptions are used to create a new TokenCache.
+type TokenCacheOptions struct {
+	// ParserOptions are used to parse and validate JWTs. The registered claims of cached JWTs are validated again with
+	// them on every hit.
+	ParserOptions []jwt.ParserOption
+	// Size is the maximum number of cached JWTs. The least recently used JWT is evicted when it is exceeded.
+	//
+	// This defaults to 1000.
+	Size int
+	// TTL is how long a successfully verified JWT is cached. A JWT is never cached past its "exp" claim.
+	//
+	// This defaults to one minute.
+	TTL time.Duration
+}
+
+// TokenCache parses and verifies JWTs with a Keyfunc and caches successful results keyed by the SHA-256 hash of the
+// JWT. Hot paths that see the same bearer token many times skip repeated key lookups and signature verification.
+type TokenCache interface {
+	// ParseCtx is like the package level ParseCtx, but a cached result is returned if the same JWT was recently
+	// verified. The returned *jwt.Token is shared between callers and must not be modified.
+	ParseCtx(ctx context.Context, tokenString string) (*jwt.Token, error)
+}
+
+type tokenCacheEntry struct {
+	expires time.Time
+	hash    [sha256.Size]byte
+	token   *jwt.Token
+}
+
+type tokenCache struct {
+	entries   map[[sha256.Size]byte]*list.Element
+	k         Keyfunc
+	lru       *list.List
+	mux       sync.Mutex
+	now       func() time.Time
+	options   TokenCacheOptions
+	validator *jwt.Validator
+}
+
+// NewTokenCache creates a new TokenCache that verifies JWTs with the given Keyfunc.
+func NewTokenCache(k Keyfunc, options TokenCacheOptions) TokenCache {
+	if options.Size <= 0 {
+		options.Size = 1000
+	}
+	if options.TTL <= 0 {
+		options.TTL = time.Minute
+	}
+	return &tokenCache{
+		entries:   make(map[[sha256.Size]byte]*list.Element),
+		k:         k,
+		lru:       list.New(),
+		now:       time.Now,
+		options:   options,
+		validator: jwt.NewValidator(options.ParserOptions...),
+	}
+}
+
+func (c *tokenCache) ParseCtx(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	hash := sha256.Sum256([]byte(tokenString))
+	if token, ok := c.get(hash); ok {
+		err := c.validator.Validate(token.Claims)
+		if err != nil {
+			return nil, err
+		}
+		return token, nil
+	}
+	token, err := ParseCtx(ctx, c.k, tokenString, c.options.ParserOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.put(hash, token)
+	return token, nil
+}
+
+func (c *tokenCache) get(hash [sha256.Size]byte) (*jwt.Token, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	element, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(tokenCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, hash)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry.token, true
+}
+
+func (c *tokenCache) put(hash [sha256.Size]byte, token *jwt.Token) {
+	expires := c.now().Add(c.options.TTL)
+	exp, err := token.Claims.GetExpirationTime()
+	if err == nil && exp != nil && exp.Before(expires) {
+		expires = exp.Time
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if element, ok := c.entries[hash]; ok {
+		c.lru.Remove(element)
+	}
+	c.entries[hash] = c.lru.PushFront(tokenCacheEntry{
+		expires: expires,
+		hash:    hash,
+		token:   token,
+	})
+	for c.lru.Len() > c.options.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(tokenCacheEntry).hash)
+	}
+}
@@ -0,0 +1,77 @@
+package keyfunc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type countingStorage struct {
+	jwkset.Storage
+	reads int
+}
+
+func (c *countingStorage) KeyRead(ctx context.Context, keyID string) (jwkset.JWK, error) {
+	c.reads++
+	return c.Storage.KeyRead(ctx, keyID)
+}
+
+func TestTokenCache(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStorage{Storage: jwkset.NewMemoryStorage()}
+	priv := writeEdDSAKey(ctx, t, store, keyID)
+	k, err := New(Options{Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	now := time.Now()
+	c := NewTokenCache(k, TokenCacheOptions{Size: 1, TTL: time.Minute})
+	c.(*tokenCache).now = func() time.Time { return now }
+
+	sign := func(exp time.Time) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)})
+		token.Header[jwkset.HeaderKID] = keyID
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("Failed to sign JWT. Error: %s", err)
+		}
+		return signed
+	}
+	first := sign(now.Add(time.Hour))
+	second := sign(now.Add(2 * time.Hour))
+
+	for i := 0; i < 3; i++ {
+		_, err = c.ParseCtx(ctx, first)
+		if err != nil {
+			t.Fatalf("Failed to parse JWT. Error: %s", err)
+		}
+	}
+	if store.reads != 1 {
+		t.Fatalf("Expected 1 storage read for a cached JWT, but got %d.", store.reads)
+	}
+
+	_, err = c.ParseCtx(ctx, second)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	_, err = c.ParseCtx(ctx, first)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if store.reads != 3 {
+		t.Fatalf("Expected the first JWT to be evicted by size, but got %d storage reads.", store.reads)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = c.ParseCtx(ctx, first)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if store.reads != 4 {
+		t.Fatalf("Expected the cached JWT to expire after the TTL, but got %d storage reads.", store.reads)
+	}
+}
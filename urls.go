@@ -0,0 +1,72 @@
+package keyfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// stopper is implemented by storage in this package with background refreshes that can be stopped.
+type stopper interface {
+	stop()
+}
+
+// stopStorage ends the background work of storage from this package or from a StorageFactory, if it has any.
+func stopStorage(store jwkset.Storage) {
+	switch s := store.(type) {
+	case stopper:
+		s.stop()
+	case SchemeStorage:
+		s.Stop()
+	}
+}
+
+func (k keyfunc) AddURL(u string, options URLOptions) error {
+	_, err := k.addURL(u, options)
+	return err
+}
+func (k keyfunc) RemoveURL(u string) bool {
+	client, ok := k.storage.(HTTPClient)
+	if !ok {
+		return false
+	}
+	store, ok := client.HTTPStorages()[u]
+	if !ok || !client.RemoveHTTPStorage(u) {
+		return false
+	}
+	if k.storageErrorPolicy == StorageErrorFailOpen {
+		jwks, _ := store.KeyReadAll(context.Background())
+		for _, jwk := range jwks {
+			k.lastKnown.forget(k.normalizeKID(jwk.Marshal().KID))
+		}
+	}
+	return true
+}
+
+// addURL creates an HTTPStorage with the default behavior for the remote HTTP resource and adds it to the HTTPClient.
+// Its "refresh goroutine" ends with the context given at creation or when the URL is removed.
+func (k keyfunc) addURL(u string, options URLOptions) (jwkset.Storage, error) {
+	client, ok := k.storage.(HTTPClient)
+	if !ok {
+		return nil, fmt.Errorf("%w: the JWK Set storage is not an HTTPClient, so URLs cannot be added", ErrKeyfunc)
+	}
+	if _, ok = client.HTTPStorages()[u]; ok {
+		return nil, fmt.Errorf("%w: HTTP URL %q is already in use", ErrKeyfunc, redact(u))
+	}
+	stores, err := newDefaultHTTPStorages(k.ctx, map[string]URLOptions{u: options})
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not add HTTP URL", errors.Join(err, ErrKeyfunc))
+	}
+	store := stores[u]
+	err = client.AddHTTPStorage(u, store)
+	if err != nil {
+		stopStorage(store)
+		return nil, fmt.Errorf("%w: could not add HTTP URL", errors.Join(err, ErrKeyfunc))
+	}
+	if c, ok := client.(*httpClient); ok && options.Issuer != "" {
+		c.setIssuer(u, options.Issuer)
+	}
+	return store, nil
+}
@@ -0,0 +1,185 @@
+package keyfunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAddRemoveURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	firstStore := jwkset.NewMemoryStorage()
+	firstPriv := writeEdDSAKey(ctx, t, firstStore, "first")
+	first := newJWKSServer(ctx, t, firstStore)
+	defer first.Close()
+
+	const secondKID = "second"
+	secondStore := jwkset.NewMemoryStorage()
+	secondPriv := writeEdDSAKey(ctx, t, secondStore, secondKID)
+	var requests atomic.Int64
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rawJWKS, err := secondStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer second.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{first.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), k.Keyfunc)
+	if err == nil {
+		t.Fatalf("Expected an error for a key from a URL that was not added.")
+	}
+
+	err = k.(KeyManager).AddURL(second.URL, URLOptions{RefreshInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to add URL. Error: %s", err)
+	}
+	err = k.(KeyManager).AddURL(second.URL, URLOptions{})
+	if err == nil {
+		t.Fatalf("Expected an error for a URL that is already in use.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by key from added URL. Error: %s", err)
+	}
+
+	if !k.(KeyManager).RemoveURL(second.URL) {
+		t.Fatalf("Expected URL to be removed.")
+	}
+	if k.(KeyManager).RemoveURL(second.URL) {
+		t.Fatalf("Expected URL to already be removed.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), k.Keyfunc)
+	if err == nil {
+		t.Fatalf("Expected an error for a key from a removed URL.")
+	}
+	_, err = jwt.Parse(signEdDSA(t, firstPriv, "first"), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by key from remaining URL. Error: %s", err)
+	}
+	removed := requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() != removed {
+		t.Fatalf("Expected the removed URL to no longer be refreshed.")
+	}
+
+	config, err := NewConfigCtx(ctx, Config{URLs: []URLConfig{{URL: first.URL}}})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from config. Error: %s", err)
+	}
+	err = config.AddURL(second.URL, URLOptions{})
+	if err != nil {
+		t.Fatalf("Failed to add URL to config Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), config.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by key from URL added to config Keyfunc. Error: %s", err)
+	}
+	err = config.Update(Config{URLs: []URLConfig{{URL: first.URL}}})
+	if err != nil {
+		t.Fatalf("Failed to update config. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, secondPriv, secondKID), config.Keyfunc)
+	if err == nil {
+		t.Fatalf("Expected an update to remove the URL that is not in the config.")
+	}
+}
+
+func TestAddURLContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := newJWKSServer(ctx, t, jwkset.NewMemoryStorage())
+	defer first.Close()
+	var requests atomic.Int64
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer second.Close()
+
+	keyfuncCtx, keyfuncCancel := context.WithCancel(ctx)
+	defer keyfuncCancel()
+	k, err := NewDefaultCtx(keyfuncCtx, []string{first.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	err = k.(KeyManager).AddURL(second.URL, URLOptions{RefreshInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to add URL. Error: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() < 2 {
+		t.Fatalf("Expected the added URL to be refreshed.")
+	}
+
+	keyfuncCancel()
+	time.Sleep(20 * time.Millisecond)
+	stopped := requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() != stopped {
+		t.Fatalf("Expected the added URL to no longer be refreshed after the context of the Keyfunc ended.")
+	}
+}
+
+func TestAddURLIssuer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var firstRequests, secondRequests atomic.Int64
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		firstRequests.Add(1)
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer first.Close()
+	secondStore := jwkset.NewMemoryStorage()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondRequests.Add(1)
+		rawJWKS, err := secondStore.JSONPublic(ctx)
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer second.Close()
+
+	k, err := NewDefaultCtx(ctx, []string{first.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	const issuer = "https://second.example.com"
+	err = k.(KeyManager).AddURL(second.URL, URLOptions{Issuer: issuer})
+	if err != nil {
+		t.Fatalf("Failed to add URL. Error: %s", err)
+	}
+
+	priv := writeEdDSAKey(ctx, t, secondStore, keyID)
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": issuer})
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	firstBefore, secondBefore := firstRequests.Load(), secondRequests.Load()
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if gotFirst, gotSecond := firstRequests.Load()-firstBefore, secondRequests.Load()-secondBefore; gotFirst != 0 || gotSecond != 1 {
+		t.Fatalf("Expected only the JWK Set of the issuer of the added URL to be refreshed, got %d and %d requests.", gotFirst, gotSecond)
+	}
+}
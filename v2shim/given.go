@@ -0,0 +1,59 @@
+package v2shim
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// GivenKey represents a cryptographic key that resides in a JWKS in conjunction with Options.
+type GivenKey struct {
+	algorithm string
+	inter     any
+}
+
+// GivenKeyOptions represents the configuration options for a GivenKey. Consider the options carefully as each field
+// may have a security implication.
+type GivenKeyOptions struct {
+	// Algorithm is the given key's signing algorithm. Its value will be compared to unverified tokens' "alg" header.
+	//
+	// See RFC 8725 Section 3.1 for details.
+	// https://www.rfc-editor.org/rfc/rfc8725#section-3.1
+	//
+	// For a list of possible values, please see:
+	// https://www.rfc-editor.org/rfc/rfc7518#section-3.1
+	// https://www.iana.org/assignments/jose/jose.xhtml#web-signature-encryption-algorithms
+	Algorithm string
+}
+
+// NewGivenCustom creates a new GivenKey given an untyped variable. The key argument is expected to be a type supported
+// by the jwt package used. The GivenKey only verifies tokens whose "alg" header matches the Algorithm option, if set.
+//
+// See the https://pkg.go.dev/github.com/golang-jwt/jwt/v5#RegisterSigningMethod function for registering an
+// unsupported signing method.
+func NewGivenCustom(key any, options GivenKeyOptions) GivenKey {
+	return GivenKey{
+		algorithm: options.Algorithm,
+		inter:     key,
+	}
+}
+
+// NewGivenECDSA creates a new GivenKey given an ECDSA public key, restricted to the Algorithm option, if set.
+func NewGivenECDSA(key *ecdsa.PublicKey, options GivenKeyOptions) GivenKey {
+	return NewGivenCustom(key, options)
+}
+
+// NewGivenEdDSA creates a new GivenKey given an EdDSA public key, restricted to the Algorithm option, if set.
+func NewGivenEdDSA(key ed25519.PublicKey, options GivenKeyOptions) GivenKey {
+	return NewGivenCustom(key, options)
+}
+
+// NewGivenHMAC creates a new GivenKey given an HMAC key in a byte slice, restricted to the Algorithm option, if set.
+func NewGivenHMAC(key []byte, options GivenKeyOptions) GivenKey {
+	return NewGivenCustom(key, options)
+}
+
+// NewGivenRSA creates a new GivenKey given an RSA public key, restricted to the Algorithm option, if set.
+func NewGivenRSA(key *rsa.PublicKey, options GivenKeyOptions) GivenKey {
+	return NewGivenCustom(key, options)
+}
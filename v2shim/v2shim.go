@@ -0,0 +1,275 @@
+// Package v2shim provides the API of github.com/MicahParks/keyfunc/v2 on top of the JWK Set storage of keyfunc v3 and
+// github.com/MicahParks/jwkset, so large codebases can migrate call sites incrementally. Unlike v2, JWTs are parsed with
+// github.com/golang-jwt/jwt/v5.
+//
+// The RequestFactory and ResponseExtractor options of v2 are not supported. Use keyfunc.HTTPStorageOptions for
+// customized requests and responses.
+package v2shim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+
+	"github.com/MicahParks/keyfunc/v3"
+)
+
+var (
+	// ErrJWKAlgMismatch indicates that the given JWK was found, but its "alg" parameter's value did not match that of
+	// the JWT.
+	ErrJWKAlgMismatch = errors.New(`the given JWK was found, but its "alg" parameter's value did not match the expected algorithm`)
+	// ErrKIDNotFound indicates that the given key ID was not found in the JWKS.
+	ErrKIDNotFound = errors.New("the given key ID was not found in the JWKS")
+)
+
+// ErrorHandler is a function signature that consumes an error.
+type ErrorHandler func(err error)
+
+// JWKUse is a set of values for the "use" parameter of a JWK.
+// See https://datatracker.ietf.org/doc/html/rfc7517#section-4.2.
+type JWKUse string
+
+const (
+	// UseEncryption is a JWK "use" parameter value indicating the JSON Web Key is to be used for encryption.
+	UseEncryption JWKUse = "enc"
+	// UseOmitted is a JWK "use" parameter value that was not specified or was empty.
+	UseOmitted JWKUse = ""
+	// UseSignature is a JWK "use" parameter value indicating the JSON Web Key is to be used for signatures.
+	UseSignature JWKUse = "sig"
+	// JWKUseNoWhitelist is a special value for Options.JWKUseWhitelist that disables the whitelist.
+	JWKUseNoWhitelist JWKUse = "JWKUseNoWhitelist"
+)
+
+// Options represents the configuration options for a JWKS.
+type Options struct {
+	// Client is the HTTP client used to get the JWKS via HTTP.
+	//
+	// This defaults to http.DefaultClient.
+	Client *http.Client
+	// Ctx is the context for the keyfunc's background refresh. When the context expires or is canceled, the
+	// background goroutine will end.
+	//
+	// This defaults to context.Background().
+	Ctx context.Context
+	// GivenKeys is a map of JWT key IDs, "kid", to their given keys. The given keys are used in addition to the keys
+	// from the remote JWKS.
+	GivenKeys map[string]GivenKey
+	// GivenKIDOverride makes the key IDs of GivenKeys take precedence over the key IDs of the remote JWKS.
+	GivenKIDOverride bool
+	// JWKUseWhitelist is the "use" parameter values of the remote JWKS that are accepted. Use JWKUseNoWhitelist to
+	// accept any value.
+	//
+	// This defaults to []JWKUse{UseOmitted, UseSignature}.
+	JWKUseWhitelist []JWKUse
+	// RefreshErrorHandler is a function that consumes errors that happen during a JWKS refresh.
+	RefreshErrorHandler ErrorHandler
+	// RefreshInterval is the duration to refresh the JWKS in the background via a new HTTP request. If zero, the JWKS
+	// is not refreshed in the background.
+	RefreshInterval time.Duration
+	// RefreshRateLimit limits the rate at which refresh requests caused by RefreshUnknownKID are granted. If zero,
+	// they are not limited.
+	RefreshRateLimit time.Duration
+	// RefreshTimeout is the duration for the context timeout used to create the HTTP request for a refresh.
+	//
+	// This defaults to one minute.
+	RefreshTimeout time.Duration
+	// RefreshUnknownKID refreshes the remote JWKS when a JWT with an unknown key ID is seen.
+	RefreshUnknownKID bool
+}
+
+// JWKS represents a JSON Web Key Set (JWK Set).
+type JWKS struct {
+	cancel           context.CancelFunc
+	given            map[string]GivenKey
+	givenKIDOverride bool
+	k                keyfunc.Keyfunc
+	remote           jwkset.Storage
+}
+
+// Get loads the JWKS at the given URL.
+func Get(jwksURL string, options Options) (*JWKS, error) {
+	if options.Ctx == nil {
+		options.Ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(options.Ctx)
+	storageOptions := keyfunc.HTTPStorageOptions{
+		Client:          options.Client,
+		Ctx:             ctx,
+		HTTPTimeout:     options.RefreshTimeout,
+		RefreshInterval: options.RefreshInterval,
+	}
+	if options.RefreshErrorHandler != nil {
+		storageOptions.RefreshErrorHandler = func(_ context.Context, err error) {
+			options.RefreshErrorHandler(err)
+		}
+	}
+	remote, err := keyfunc.NewHTTPStorage(jwksURL, storageOptions)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to get JWKS from %q: %w", jwksURL, err)
+	}
+	clientOptions := keyfunc.HTTPClientOptions{
+		HTTPURLs: map[string]jwkset.Storage{jwksURL: remote},
+	}
+	if options.RefreshUnknownKID {
+		limit := rate.Inf
+		if options.RefreshRateLimit > 0 {
+			limit = rate.Every(options.RefreshRateLimit)
+		}
+		clientOptions.RefreshUnknownKID = rate.NewLimiter(limit, 1)
+	}
+	client, err := keyfunc.NewHTTPClient(clientOptions)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create JWKS client: %w", err)
+	}
+	j, err := newJWKS(ctx, client, remote, options)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	j.cancel = cancel
+	return j, nil
+}
+
+// NewGiven creates a JWKS from a map of given keys.
+func NewGiven(givenKeys map[string]GivenKey) *JWKS {
+	return &JWKS{
+		cancel: func() {},
+		given:  givenKeys,
+	}
+}
+
+// NewJSON creates a new JWKS from a raw JSON message. Keys that cannot be parsed are skipped, as in version 2.
+func NewJSON(jwksBytes []byte) (*JWKS, error) {
+	k, err := keyfunc.NewJWKSetJSONWithOptions(jwksBytes, keyfunc.JWKSetJSONOptions{SkipUnparsable: true})
+	if err != nil {
+		return nil, err
+	}
+	j, err := newJWKS(context.Background(), k.Storage(), k.Storage(), Options{})
+	if err != nil {
+		return nil, err
+	}
+	j.cancel = func() {}
+	return j, nil
+}
+
+// newJWKS creates a JWKS that reads keys from storage, which may refresh remote on an unknown key ID, and the given keys
+// of the options.
+func newJWKS(ctx context.Context, storage, remote jwkset.Storage, options Options) (*JWKS, error) {
+	whitelist := options.JWKUseWhitelist
+	if len(whitelist) == 0 {
+		whitelist = []JWKUse{UseOmitted, UseSignature}
+	}
+	var useWhitelist []jwkset.USE
+	if !slices.Contains(whitelist, JWKUseNoWhitelist) {
+		useWhitelist = make([]jwkset.USE, len(whitelist))
+		for i, use := range whitelist {
+			useWhitelist[i] = jwkset.USE(use)
+		}
+	}
+	k, err := keyfunc.New(keyfunc.Options{
+		Ctx:          ctx,
+		Storage:      storage,
+		UseWhitelist: useWhitelist,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyfunc: %w", err)
+	}
+	return &JWKS{
+		given:            options.GivenKeys,
+		givenKIDOverride: options.GivenKIDOverride,
+		k:                k,
+		remote:           remote,
+	}, nil
+}
+
+// EndBackground ends the background goroutine to update the JWKS. It can only happen once and is only effective if the
+// JWKS has a background goroutine refreshing the JWKS keys.
+func (j *JWKS) EndBackground() {
+	j.cancel()
+}
+
+// Keyfunc matches the signature of github.com/golang-jwt/jwt/v5's jwt.Keyfunc function.
+func (j *JWKS) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header[jwkset.HeaderKID].(string)
+	if given, ok := j.given[kid]; ok && (j.givenKIDOverride || !j.remoteHas(kid)) {
+		alg, _ := token.Header["alg"].(string)
+		if given.algorithm != "" && given.algorithm != alg {
+			return nil, fmt.Errorf(`%w: JWT "alg" %q, given key "alg" %q`, ErrJWKAlgMismatch, alg, given.algorithm)
+		}
+		return given.inter, nil
+	}
+	if j.k == nil {
+		return nil, fmt.Errorf("%w: %q", ErrKIDNotFound, kid)
+	}
+	key, err := j.k.Keyfunc(token)
+	if errors.Is(err, jwkset.ErrKeyNotFound) {
+		return nil, errors.Join(err, ErrKIDNotFound)
+	}
+	return key, err
+}
+
+// KIDs returns the key IDs (kid) for all keys in the JWKS.
+func (j *JWKS) KIDs() []string {
+	keys := j.ReadOnlyKeys()
+	kids := make([]string, 0, len(keys))
+	for kid := range keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
+
+// Len returns the number of keys in the JWKS.
+func (j *JWKS) Len() int {
+	return len(j.ReadOnlyKeys())
+}
+
+// RawJWKS returns the JSON of the remote JWKS. It is nil for a JWKS made only of given keys.
+func (j *JWKS) RawJWKS() []byte {
+	if j.remote == nil {
+		return nil
+	}
+	raw, err := j.remote.JSON(context.Background())
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// ReadOnlyKeys returns a read-only copy of the mapping of key IDs (kid) to cryptographic keys.
+func (j *JWKS) ReadOnlyKeys() map[string]any {
+	keys := make(map[string]any)
+	if j.remote != nil {
+		jwks, err := j.remote.KeyReadAll(context.Background())
+		if err == nil {
+			for _, jwk := range jwks {
+				keys[jwk.Marshal().KID] = jwk.Key()
+			}
+		}
+	}
+	for kid, given := range j.given {
+		if _, ok := keys[kid]; !ok || j.givenKIDOverride {
+			keys[kid] = given.inter
+		}
+	}
+	return keys
+}
+
+// remoteHas reports if the remote JWKS has the key ID without refreshing it.
+func (j *JWKS) remoteHas(kid string) bool {
+	if j.remote == nil {
+		return false
+	}
+	_, err := j.remote.KeyRead(context.Background(), kid)
+	return err == nil
+}
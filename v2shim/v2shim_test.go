@@ -0,0 +1,140 @@
+package v2shim
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	keyID = "my-key-id"
+)
+
+func TestGet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkset.JWKOptions{Metadata: jwkset.JWKMetadataOptions{KID: keyID}})
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	serverStore := jwkset.NewMemoryStorage()
+	err = serverStore.KeyWrite(ctx, jwk)
+	if err != nil {
+		t.Fatalf("Failed to write JWK to server store. Error: %s", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := serverStore.JSONPublic(r.Context())
+		if err != nil {
+			t.Errorf("Failed to get JWK Set JSON from server store. Error: %s", err)
+			return
+		}
+		_, _ = w.Write(raw)
+	}))
+	defer server.Close()
+
+	const givenKID = "given-key-id"
+	hmacKey := []byte("my-hmac-secret")
+	j, err := Get(server.URL, Options{
+		Ctx: ctx,
+		GivenKeys: map[string]GivenKey{
+			givenKID: NewGivenHMAC(hmacKey, GivenKeyOptions{Algorithm: jwt.SigningMethodHS256.Alg()}),
+		},
+		RefreshUnknownKID: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to get JWKS. Error: %s", err)
+	}
+	defer j.EndBackground()
+
+	token := jwt.New(jwt.SigningMethodEdDSA)
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, j.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the remote key. Error: %s", err)
+	}
+
+	token = jwt.New(jwt.SigningMethodHS256)
+	token.Header[jwkset.HeaderKID] = givenKID
+	signed, err = token.SignedString(hmacKey)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, j.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the given key. Error: %s", err)
+	}
+
+	token = jwt.New(jwt.SigningMethodHS512)
+	token.Header[jwkset.HeaderKID] = givenKID
+	signed, err = token.SignedString(hmacKey)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, j.Keyfunc)
+	if !errors.Is(err, ErrJWKAlgMismatch) {
+		t.Fatalf("Expected ErrJWKAlgMismatch for a mismatched given key algorithm. Error: %v", err)
+	}
+
+	token = jwt.New(jwt.SigningMethodEdDSA)
+	token.Header[jwkset.HeaderKID] = "unknown-key-id"
+	signed, err = token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, j.Keyfunc)
+	if !errors.Is(err, ErrKIDNotFound) {
+		t.Fatalf("Expected ErrKIDNotFound for an unknown key ID. Error: %v", err)
+	}
+
+	kids := j.KIDs()
+	if len(kids) != 2 || kids[0] != givenKID || kids[1] != keyID {
+		t.Fatalf("Unexpected key IDs %v.", kids)
+	}
+	if j.Len() != 2 {
+		t.Fatalf("Expected 2 keys, got %d.", j.Len())
+	}
+	if len(j.RawJWKS()) == 0 {
+		t.Fatalf("Expected the raw JWKS to be populated.")
+	}
+}
+
+func TestNewGiven(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	j := NewGiven(map[string]GivenKey{
+		keyID: NewGivenEdDSA(pub, GivenKeyOptions{}),
+	})
+	defer j.EndBackground()
+
+	token := jwt.New(jwt.SigningMethodEdDSA)
+	token.Header[jwkset.HeaderKID] = keyID
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("Failed to sign JWT. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, j.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT. Error: %s", err)
+	}
+	if j.RawJWKS() != nil {
+		t.Fatalf("Expected no raw JWKS for given keys.")
+	}
+}
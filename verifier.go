@@ -0,0 +1,124 @@
+package keyfunc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Verifier verifies JWT signatures with a key that never leaves its keystore, such as a key in a hardware security
+// module accessed through a PKCS#11 module or a key in a cloud key management service.
+type Verifier interface {
+	// Verify returns nil if the signature is valid for the signing input, which is the first two segments of the JWT,
+	// and the "alg" header value.
+	Verify(alg string, signingInput, signature []byte) error
+}
+
+// VerifierFunc is a function that implements Verifier.
+type VerifierFunc func(alg string, signingInput, signature []byte) error
+
+func (f VerifierFunc) Verify(alg string, signingInput, signature []byte) error {
+	return f(alg, signingInput, signature)
+}
+
+// VerifierKey is a key whose signature verification is delegated to a Verifier. The Keyfunc returns an opaque handle
+// for it that only the signing methods registered by RegisterVerifierSigningMethods accept.
+type VerifierKey struct {
+	// ALG is the only "alg" header value the key is used for. If empty, any "alg" header value is allowed.
+	ALG jwkset.ALG
+	// KID is the key ID matched against the JWT header.
+	KID string
+	// USE is the intended use of the key, checked against the UseWhitelist option of the Keyfunc.
+	USE      jwkset.USE
+	Verifier Verifier
+}
+
+// verifierHandle is the key returned by a Keyfunc for a VerifierKey. It deliberately does not expose the Verifier, so
+// it is never mistaken for a key held in memory.
+type verifierHandle struct {
+	verifier Verifier
+}
+
+// NewVerifierStorage creates a jwkset.Storage that holds keys whose signature verification is delegated to a Verifier.
+// Use it as the Storage option of a Keyfunc or as the Given storage of an HTTPClient. RegisterVerifierSigningMethods
+// must be called for the "alg" header values the keys are used with.
+func NewVerifierStorage(keys ...VerifierKey) (jwkset.Storage, error) {
+	custom := make([]customKey, 0, len(keys))
+	for _, key := range keys {
+		if key.Verifier == nil {
+			return nil, fmt.Errorf("%w: no Verifier for key ID %q", ErrKeyfunc, key.KID)
+		}
+		custom = append(custom, customKey{
+			alg: key.ALG,
+			key: verifierHandle{verifier: key.Verifier},
+			kid: key.KID,
+			use: key.USE,
+		})
+	}
+	store := newMemoryStorage()
+	store.replace(nil, custom)
+	return store, nil
+}
+
+// RegisterVerifierSigningMethods replaces the github.com/golang-jwt/jwt/v5 signing methods for the given "alg" header
+// values with ones that delegate verification to the Verifier of a VerifierKey. Keys held in memory are still verified
+// and signed by the replaced signing method, but the Method of a parsed jwt.Token is the replacing signing method, so
+// type assertions on it to the signing method types of github.com/golang-jwt/jwt/v5 fail. An "alg" header
+// value without a signing method, such as one only an HSM supports, can only be verified by a Verifier. If no "alg"
+// header values are given, every registered signing method is replaced. The "none" signing method is never replaced.
+//
+// The signing methods of github.com/golang-jwt/jwt/v5 are global, so this should be called once during program
+// initialization. Calling it again is harmless.
+func RegisterVerifierSigningMethods(algs ...string) {
+	if len(algs) == 0 {
+		algs = jwt.GetAlgorithms()
+	}
+	algs = slices.Clone(algs)
+	slices.Sort(algs)
+	for _, alg := range slices.Compact(algs) {
+		if alg == jwt.SigningMethodNone.Alg() {
+			continue
+		}
+		fallback := jwt.GetSigningMethod(alg)
+		if v, ok := fallback.(verifierSigningMethod); ok {
+			fallback = v.fallback
+		}
+		method := verifierSigningMethod{alg: alg, fallback: fallback}
+		jwt.RegisterSigningMethod(alg, func() jwt.SigningMethod {
+			return method
+		})
+	}
+}
+
+// verifierSigningMethod is a jwt.SigningMethod that verifies signatures of a verifierHandle with its Verifier and all
+// other keys with the fallback signing method.
+type verifierSigningMethod struct {
+	alg      string
+	fallback jwt.SigningMethod
+}
+
+func (m verifierSigningMethod) Alg() string {
+	return m.alg
+}
+func (m verifierSigningMethod) Sign(signingString string, key any) ([]byte, error) {
+	if m.fallback == nil {
+		return nil, fmt.Errorf("%w: signing with %q is not supported", ErrKeyfunc, m.alg)
+	}
+	return m.fallback.Sign(signingString, key)
+}
+func (m verifierSigningMethod) Verify(signingString string, sig []byte, key any) error {
+	if handle, ok := key.(verifierHandle); ok {
+		err := handle.verifier.Verify(m.alg, []byte(signingString), sig)
+		if err != nil {
+			return fmt.Errorf("%w: %w", jwt.ErrSignatureInvalid, err)
+		}
+		return nil
+	}
+	if m.fallback == nil {
+		return fmt.Errorf("%w: %q can only be verified by a Verifier", errors.Join(jwt.ErrInvalidKeyType, ErrKeyfunc), m.alg)
+	}
+	return m.fallback.Verify(signingString, sig, key)
+}
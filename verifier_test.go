@@ -0,0 +1,88 @@
+package keyfunc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifier(t *testing.T) {
+	RegisterVerifierSigningMethods(jwt.SigningMethodEdDSA.Alg())
+	RegisterVerifierSigningMethods(jwt.SigningMethodEdDSA.Alg())
+
+	// The public key stands in for a key held by a hardware security module.
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	calls := 0
+	verifier := VerifierFunc(func(alg string, signingInput, signature []byte) error {
+		calls++
+		if alg != jwt.SigningMethodEdDSA.Alg() {
+			t.Fatalf("Expected alg %q, got %q.", jwt.SigningMethodEdDSA.Alg(), alg)
+		}
+		if !ed25519.Verify(pub, signingInput, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	})
+	storage, err := NewVerifierStorage(VerifierKey{ALG: jwkset.AlgEdDSA, KID: "hsm", Verifier: verifier})
+	if err != nil {
+		t.Fatalf("Failed to create verifier storage. Error: %s", err)
+	}
+	k, err := New(Options{Storage: storage})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+
+	_, err = jwt.Parse(signEdDSA(t, priv, "hsm"), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT verified by the Verifier. Error: %s", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected the Verifier to be called once, got %d.", calls)
+	}
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, other, "hsm"), k.Keyfunc)
+	if !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("Expected error to be jwt.ErrSignatureInvalid. Error: %s", err)
+	}
+
+	// Keys held in memory are still verified by the replaced signing method.
+	memory, err := New(Options{Storage: storeWithEdDSAKey(t, pub)})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), memory.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT verified in memory. Error: %s", err)
+	}
+
+	_, err = NewVerifierStorage(VerifierKey{KID: "missing"})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected error to be ErrKeyfunc without a Verifier. Error: %s", err)
+	}
+}
+
+func storeWithEdDSAKey(t *testing.T, pub ed25519.PublicKey) jwkset.Storage {
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			KID: keyID,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(pub, jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	store := newMemoryStorage()
+	store.replace([]jwkset.JWK{jwk}, nil)
+	return store
+}
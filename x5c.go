@@ -0,0 +1,151 @@
+package keyfunc
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+var (
+	// ErrX5CUntrusted is the reason a JWK is filtered when its "x5c" certificate chain is missing or does not verify
+	// against the trust anchors of an X5CTrust.
+	ErrX5CUntrusted = errors.New("untrusted x5c certificate chain")
+)
+
+// X5CTrustOptions configure NewX5CTrust.
+type X5CTrustOptions struct {
+	// KeyUsages are the extended key usages the leaf certificate must be valid for.
+	//
+	// This defaults to x509.ExtKeyUsageAny.
+	KeyUsages []x509.ExtKeyUsage
+	// Reload is the interval at which the certificate store of the operating system is loaded again, so added and
+	// removed trust anchors are picked up without a restart. The store is reloaded when a JWK Set is ingested after the
+	// interval, not in the background.
+	//
+	// This defaults to 24 hours.
+	Reload time.Duration
+	// RequireX5C filters JWKs without an "x5c" parameter. Otherwise, only JWKs with an "x5c" parameter are verified.
+	RequireX5C bool
+	// Roots are trust anchors in addition to the certificate store of the operating system, if SystemRoots is set.
+	Roots *x509.CertPool
+	// SystemRoots uses the certificate store of the operating system as trust anchors. On macOS and Windows, chains are
+	// verified by the platform verifier, which also applies the platform's own trust settings. On other systems, the
+	// certificate files and directories used by crypto/x509, including those in the SSL_CERT_FILE and SSL_CERT_DIR
+	// environment variables, are read on every reload.
+	SystemRoots bool
+}
+
+// X5CTrust validates the "x5c" certificate chains of JWKs against trust anchors when a JWK Set is ingested. The first
+// certificate of the chain must verify against the trust anchors, using the other certificates as intermediates. JWKs
+// that fail validation are filtered and reported by SkippedKeys with a reason wrapping ErrX5CUntrusted. An X5CTrust can
+// be shared by several storages.
+type X5CTrust struct {
+	loaded  time.Time
+	mux     sync.Mutex
+	now     func() time.Time
+	options X5CTrustOptions
+	system  *x509.CertPool
+}
+
+// NewX5CTrust creates a new X5CTrust. If SystemRoots is set, the certificate store of the operating system is loaded
+// immediately.
+func NewX5CTrust(options X5CTrustOptions) (*X5CTrust, error) {
+	if options.Roots == nil && !options.SystemRoots {
+		return nil, fmt.Errorf("%w: no trust anchors, set Roots or SystemRoots", ErrKeyfunc)
+	}
+	if len(options.KeyUsages) == 0 {
+		options.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if options.Reload == 0 {
+		options.Reload = 24 * time.Hour
+	}
+	t := &X5CTrust{
+		now:     time.Now,
+		options: options,
+	}
+	if options.SystemRoots {
+		_, err := t.systemRoots()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// systemRoots returns the certificate store of the operating system, loading it again after the Reload interval. If
+// reloading fails, the previous store is kept.
+func (t *X5CTrust) systemRoots() (*x509.CertPool, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	now := t.now()
+	if t.system != nil && now.Sub(t.loaded) < t.options.Reload {
+		return t.system, nil
+	}
+	pool, err := loadSystemRoots()
+	if err != nil {
+		if t.system != nil {
+			return t.system, nil
+		}
+		return nil, fmt.Errorf("%w: could not load the certificate store of the operating system", errors.Join(err, ErrKeyfunc))
+	}
+	t.loaded = now
+	t.system = pool
+	return pool, nil
+}
+
+// check verifies the "x5c" certificate chain of the JWK.
+func (t *X5CTrust) check(marshal jwkset.JWKMarshal) error {
+	if len(marshal.X5C) == 0 {
+		if t.options.RequireX5C {
+			return fmt.Errorf(`%w: no "x5c" parameter`, ErrX5CUntrusted)
+		}
+		return nil
+	}
+	chain := make([]*x509.Certificate, len(marshal.X5C))
+	for i, encoded := range marshal.X5C {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf(`%w: could not decode certificate %d of the "x5c" parameter: %w`, ErrX5CUntrusted, i, err)
+		}
+		chain[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf(`%w: could not parse certificate %d of the "x5c" parameter: %w`, ErrX5CUntrusted, i, err)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	verifyOptions := x509.VerifyOptions{
+		CurrentTime:   t.now(),
+		Intermediates: intermediates,
+		KeyUsages:     t.options.KeyUsages,
+	}
+	var errs []error
+	if t.options.SystemRoots {
+		system, err := t.systemRoots()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrX5CUntrusted, err)
+		}
+		verifyOptions.Roots = system
+		_, err = chain[0].Verify(verifyOptions)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if t.options.Roots != nil {
+		verifyOptions.Roots = t.options.Roots
+		_, err := chain[0].Verify(verifyOptions)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("%w: %w", ErrX5CUntrusted, errors.Join(errs...))
+}
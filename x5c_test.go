@@ -0,0 +1,178 @@
+package keyfunc
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestX5CTrust(t *testing.T) {
+	ca, caPriv := newX5CCertificate(t, "ca", nil, nil)
+	trustedJWK, trustedPriv := newX5CJWK(t, "trusted", ca, caPriv)
+	untrustedJWK, untrustedPriv := newX5CJWK(t, "untrusted", nil, nil)
+	plainJWK, plainPriv := expiringJWK(t, "plain", nil)
+	raw := jwksJSON(t, trustedJWK, untrustedJWK, plainJWK)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	tc := []struct {
+		name      string
+		options   X5CTrustOptions
+		untrusted []string
+	}{
+		{name: "Roots", options: X5CTrustOptions{Roots: roots}, untrusted: []string{"untrusted"}},
+		{name: "RequireX5C", options: X5CTrustOptions{RequireX5C: true, Roots: roots}, untrusted: []string{"untrusted", "plain"}},
+	}
+	privs := map[string]ed25519.PrivateKey{"trusted": trustedPriv, "untrusted": untrustedPriv, "plain": plainPriv}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			trust, err := NewX5CTrust(c.options)
+			if err != nil {
+				t.Fatalf("Failed to create X5CTrust. Error: %s", err)
+			}
+			k, err := NewJWKSetJSONWithOptions(raw, JWKSetJSONOptions{X5CTrust: trust})
+			if err != nil {
+				t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+			}
+			for kid, priv := range privs {
+				_, err = jwt.Parse(signEdDSA(t, priv, kid), k.Keyfunc)
+				untrusted := false
+				for _, u := range c.untrusted {
+					untrusted = untrusted || u == kid
+				}
+				if untrusted && !errors.Is(err, jwkset.ErrKeyNotFound) {
+					t.Fatalf("Expected untrusted key %q to be filtered. Error: %v", kid, err)
+				}
+				if !untrusted && err != nil {
+					t.Fatalf("Failed to parse JWT signed with key %q. Error: %s", kid, err)
+				}
+			}
+		})
+	}
+
+	_, err := NewX5CTrust(X5CTrustOptions{})
+	if !errors.Is(err, ErrKeyfunc) {
+		t.Fatalf("Expected ErrKeyfunc without trust anchors. Error: %s", err)
+	}
+}
+
+func TestX5CTrustSystemRootsReload(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("The certificate store is read by the platform verifier.")
+	}
+	ca, caPriv := newX5CCertificate(t, "ca", nil, nil)
+	jwk, _ := newX5CJWK(t, "trusted", ca, caPriv)
+	var marshal jwkset.JWKMarshal
+	err := json.Unmarshal(jwk, &marshal)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+
+	other, _ := newX5CCertificate(t, "other", nil, nil)
+	certFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCert := func(cert *x509.Certificate) {
+		err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600)
+		if err != nil {
+			t.Fatalf("Failed to write certificate file. Error: %s", err)
+		}
+	}
+	writeCert(other)
+	t.Setenv("SSL_CERT_FILE", certFile)
+	t.Setenv("SSL_CERT_DIR", filepath.Join(t.TempDir(), "missing"))
+
+	trust, err := NewX5CTrust(X5CTrustOptions{Reload: time.Minute, SystemRoots: true})
+	if err != nil {
+		t.Fatalf("Failed to create X5CTrust. Error: %s", err)
+	}
+	now := time.Now()
+	trust.now = func() time.Time {
+		return now
+	}
+	err = trust.check(marshal)
+	if !errors.Is(err, ErrX5CUntrusted) {
+		t.Fatalf("Expected error to be ErrX5CUntrusted. Error: %v", err)
+	}
+
+	writeCert(ca)
+	err = trust.check(marshal)
+	if !errors.Is(err, ErrX5CUntrusted) {
+		t.Fatalf("Expected the certificate store to be cached until reload. Error: %v", err)
+	}
+	now = now.Add(time.Minute)
+	err = trust.check(marshal)
+	if err != nil {
+		t.Fatalf("Expected the reloaded certificate store to trust the chain. Error: %s", err)
+	}
+}
+
+// newX5CCertificate creates a CA certificate signed by the parent, or self-signed if the parent is nil.
+func newX5CCertificate(t *testing.T, name string, parent *x509.Certificate, parentPriv crypto.Signer) (*x509.Certificate, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ED25519 key pair. Error: %s", err)
+	}
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		NotAfter:              time.Now().Add(time.Hour),
+		NotBefore:             time.Now().Add(-time.Hour),
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+	}
+	if parent == nil {
+		parent, parentPriv = template, priv
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentPriv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate. Error: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate. Error: %s", err)
+	}
+	return cert, priv
+}
+
+// newX5CJWK creates a JWK with an "x5c" parameter holding a leaf certificate signed by the CA, or a self-signed
+// certificate if the CA is nil.
+func newX5CJWK(t *testing.T, kid string, ca *x509.Certificate, caPriv ed25519.PrivateKey) (json.RawMessage, ed25519.PrivateKey) {
+	var cert *x509.Certificate
+	var priv ed25519.PrivateKey
+	if ca == nil {
+		cert, priv = newX5CCertificate(t, kid, nil, nil)
+	} else {
+		cert, priv = newX5CCertificate(t, kid, ca, caPriv)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			KID: kid,
+		},
+		X509: jwkset.JWKX509Options{
+			X5C: []*x509.Certificate{cert},
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(priv.Public(), jwkOptions)
+	if err != nil {
+		t.Fatalf("Failed to create JWK. Error: %s", err)
+	}
+	raw, err := json.Marshal(jwk.Marshal())
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	return raw, priv
+}
@@ -0,0 +1,148 @@
+package keyfunc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// X5CLeaf returns the parsed leaf certificate of the JWK's "x5c" parameter, which holds the public key of the JWK. The
+// chain is parsed once when the JWK Set is ingested, so this does not parse it again. The boolean is false if the JWK
+// has no "x5c" parameter.
+func X5CLeaf(jwk jwkset.JWK) (*x509.Certificate, bool) {
+	chain := jwk.X509().X5C
+	if len(chain) == 0 {
+		return nil, false
+	}
+	return chain[0], true
+}
+
+// x5cOnly reports if the JWK's public key is only given by its "x5c" parameter, without the algebraic parameters of its
+// key type, such as "n" and "e", or without a key type at all.
+func x5cOnly(marshal jwkset.JWKMarshal) bool {
+	if len(marshal.X5C) == 0 {
+		return false
+	}
+	switch marshal.KTY {
+	case "":
+		return marshal.N == "" && marshal.E == "" && marshal.X == "" && marshal.Y == "" && marshal.K == ""
+	case jwkset.KtyRSA:
+		return marshal.N == "" && marshal.E == ""
+	case jwkset.KtyEC:
+		return marshal.X == "" && marshal.Y == ""
+	case jwkset.KtyOKP:
+		return marshal.X == ""
+	}
+	return false
+}
+
+// x5cLeafCache caches the parsed "x5c" certificate chains of JWKs whose public key is only given by the chain. Every
+// refresh of an unchanged JWK Set would otherwise parse the same certificates again. Chains that were not seen in the
+// latest ingestion are evicted. A nil *x5cLeafCache parses every chain.
+type x5cLeafCache struct {
+	chains map[string][]*x509.Certificate
+	mux    sync.Mutex
+	next   map[string][]*x509.Certificate
+}
+
+func newX5CLeafCache() *x5cLeafCache {
+	return &x5cLeafCache{
+		chains: make(map[string][]*x509.Certificate),
+		next:   make(map[string][]*x509.Certificate),
+	}
+}
+
+// chain returns the parsed certificate chain of the "x5c" parameter.
+func (c *x5cLeafCache) chain(x5c []string) ([]*x509.Certificate, error) {
+	if c == nil {
+		return parseX5C(x5c)
+	}
+	id := strings.Join(x5c, ".")
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	chain, ok := c.chains[id]
+	if !ok {
+		var err error
+		chain, err = parseX5C(x5c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.next[id] = chain
+	return chain, nil
+}
+
+// commit evicts the chains that were not read since the last commit. It is called after each ingestion.
+func (c *x5cLeafCache) commit() {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.chains = c.next
+	c.next = make(map[string][]*x509.Certificate, len(c.chains))
+}
+
+func parseX5C(x5c []string) ([]*x509.Certificate, error) {
+	chain := make([]*x509.Certificate, len(x5c))
+	for i, encoded := range x5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf(`could not decode certificate %d of the "x5c" parameter: %w`, i, err)
+		}
+		chain[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf(`could not parse certificate %d of the "x5c" parameter: %w`, i, err)
+		}
+	}
+	return chain, nil
+}
+
+// x5cLeafJWK creates a JWK whose public key is taken from the leaf certificate of its "x5c" parameter. The algebraic
+// parameters of the key type, and the key type itself if it is missing, are filled in, so the JWK can be used like any
+// other.
+func x5cLeafJWK(marshal jwkset.JWKMarshal, cache *x5cLeafCache, validate jwkset.JWKValidateOptions) (jwkset.JWK, error) {
+	chain, err := cache.chain(marshal.X5C)
+	if err != nil {
+		return jwkset.JWK{}, err
+	}
+	var kty jwkset.KTY
+	switch chain[0].PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		kty = jwkset.KtyEC
+	case ed25519.PublicKey:
+		kty = jwkset.KtyOKP
+	case *rsa.PublicKey:
+		kty = jwkset.KtyRSA
+	default:
+		return jwkset.JWK{}, fmt.Errorf(`unsupported public key type %T in the "x5c" leaf certificate`, chain[0].PublicKey)
+	}
+	if marshal.KTY != "" && kty != marshal.KTY {
+		return jwkset.JWK{}, fmt.Errorf(`"x5c" leaf certificate has key type %q, but the JWK has key type %q`, kty, marshal.KTY)
+	}
+	jwkOptions := jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG:    marshal.ALG,
+			KID:    marshal.KID,
+			KEYOPS: marshal.KEYOPS,
+			USE:    marshal.USE,
+		},
+		Validate: validate,
+		X509: jwkset.JWKX509Options{
+			X5C: chain,
+			X5U: marshal.X5U,
+		},
+	}
+	jwk, err := jwkset.NewJWKFromKey(chain[0].PublicKey, jwkOptions)
+	if err != nil {
+		return jwkset.JWK{}, fmt.Errorf(`could not create JWK from "x5c" leaf certificate: %w`, err)
+	}
+	return jwk, nil
+}
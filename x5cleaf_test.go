@@ -0,0 +1,110 @@
+package keyfunc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestX5CLeafKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rawJWK, priv := newX5CJWK(t, keyID, nil, nil)
+	var params map[string]any
+	err := json.Unmarshal(rawJWK, &params)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	delete(params, "crv")
+	delete(params, "x")
+	rawJWK, err = json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	raw := jwksJSON(t, rawJWK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(raw)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPStorage(server.URL, HTTPStorageOptions{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("Failed to create HTTP storage. Error: %s", err)
+	}
+	jwk, err := store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Expected the JWK with only an x5c parameter to be ingested. Error: %s", err)
+	}
+	leaf, ok := X5CLeaf(jwk)
+	if !ok {
+		t.Fatalf("Expected the JWK to expose its x5c leaf certificate.")
+	}
+	if jwk.Marshal().X == "" {
+		t.Fatalf(`Expected the "x" parameter to be filled in from the x5c leaf certificate.`)
+	}
+
+	err = store.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Failed to refresh HTTP storage. Error: %s", err)
+	}
+	jwk, err = store.KeyRead(ctx, keyID)
+	if err != nil {
+		t.Fatalf("Failed to read JWK after refresh. Error: %s", err)
+	}
+	refreshed, _ := X5CLeaf(jwk)
+	if refreshed != leaf {
+		t.Fatalf("Expected the parsed x5c leaf certificate to be reused across refreshes.")
+	}
+	if n := len(store.(*httpStorage).leaves.chains); n != 1 {
+		t.Fatalf("Expected 1 cached certificate chain, got %d.", n)
+	}
+
+	k, err := New(Options{Ctx: ctx, Storage: store})
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc. Error: %s", err)
+	}
+	_, err = jwt.Parse(signEdDSA(t, priv, keyID), k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the x5c leaf key. Error: %s", err)
+	}
+}
+
+func TestX5CLeafWithoutKTY(t *testing.T) {
+	rawJWK, priv := newX5CJWK(t, keyID, nil, nil)
+	var params map[string]any
+	err := json.Unmarshal(rawJWK, &params)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JWK. Error: %s", err)
+	}
+	delete(params, "crv")
+	delete(params, "kty")
+	delete(params, "x")
+	rawJWK, err = json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK. Error: %s", err)
+	}
+	signed := signEdDSA(t, priv, keyID)
+
+	k, err := NewJWKSetJSON(jwksJSON(t, rawJWK))
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from JWK Set. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the x5c leaf key of a JWK without kty. Error: %s", err)
+	}
+
+	k, err = NewJWKJSON(rawJWK)
+	if err != nil {
+		t.Fatalf("Failed to create Keyfunc from JWK. Error: %s", err)
+	}
+	_, err = jwt.Parse(signed, k.Keyfunc)
+	if err != nil {
+		t.Fatalf("Failed to parse JWT signed by the x5c leaf key of a single JWK. Error: %s", err)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !darwin && !windows
+
+package keyfunc
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// systemRootFiles are the certificate bundles searched by crypto/x509 on Linux and the BSDs. The first one that exists
+// is used.
+var systemRootFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora/RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS/RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine Linux and the BSDs
+	"/usr/local/etc/ssl/cert.pem",                       // FreeBSD
+}
+
+// systemRootDirectories are the certificate directories searched by crypto/x509 on Linux and the BSDs.
+var systemRootDirectories = []string{
+	"/etc/ssl/certs",     // SLES10/SLES11
+	"/etc/pki/tls/certs", // Fedora/RHEL
+}
+
+// loadSystemRoots reads the certificate store of the operating system from the files and directories used by
+// crypto/x509. Unlike x509.SystemCertPool, which loads the store once per process, the files are read on every call.
+// If no certificates are found, x509.SystemCertPool is used.
+func loadSystemRoots() (*x509.CertPool, error) {
+	files := systemRootFiles
+	if f := os.Getenv("SSL_CERT_FILE"); f != "" {
+		files = []string{f}
+	}
+	directories := systemRootDirectories
+	if d := os.Getenv("SSL_CERT_DIR"); d != "" {
+		directories = strings.Split(d, ":")
+	}
+
+	pool := x509.NewCertPool()
+	found := false
+	var errs []error
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			found = pool.AppendCertsFromPEM(data) || found
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	for _, directory := range directories {
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(directory, entry.Name()))
+			if err == nil {
+				found = pool.AppendCertsFromPEM(data) || found
+			}
+		}
+	}
+	if found {
+		return pool, nil
+	}
+	system, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, errors.Join(append(errs, err)...)
+	}
+	return system, nil
+}
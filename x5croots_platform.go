@@ -0,0 +1,13 @@
+//go:build darwin || windows
+
+package keyfunc
+
+import (
+	"crypto/x509"
+)
+
+// loadSystemRoots returns the certificate store of the operating system. The returned pool defers to the platform
+// verifier, which always reads the current store.
+func loadSystemRoots() (*x509.CertPool, error) {
+	return x509.SystemCertPool()
+}